@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"haven/internal/hub"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// adminBanRequest is the body of POST /admin/api/users/{username}/ban
+type adminBanRequest struct {
+	Duration int64  `json:"duration,omitempty"` // Seconds; 0 bans permanently
+	Reason   string `json:"reason,omitempty"`
+}
+
+// adminCleanupResponse is the result of POST /admin/api/cleanup
+type adminCleanupResponse struct {
+	UsersDeleted          int `json:"users_deleted"`
+	RoomsDeleted          int `json:"rooms_deleted"`
+	MessagesDeleted       int `json:"messages_deleted"`
+	DirectMessagesDeleted int `json:"direct_messages_deleted"`
+	AttachmentsDeleted    int `json:"attachments_deleted"`
+}
+
+// registerAdminAPI serves the admin API under /admin/api for requests
+// carrying "Authorization: Bearer <token>"
+func registerAdminAPI(mux *http.ServeMux, h *hub.Hub, cleanupJob *postgres.CleanupJob, token string) {
+	handle := func(pattern string, handler http.HandlerFunc) {
+		mux.HandleFunc(pattern, requireAdmin(token, handler))
+	}
+
+	handle("GET /admin/api/users", func(w http.ResponseWriter, r *http.Request) {
+		users, err := h.AdminUsers(r.URL.Query().Get("q"), queryLimit(r))
+		if err != nil {
+			writeHubError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"users": users})
+	})
+
+	handle("POST /admin/api/users/{username}/disconnect", func(w http.ResponseWriter, r *http.Request) {
+		n, err := h.DisconnectUser(r.PathValue("username"))
+		if err != nil {
+			writeHubError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"disconnected": n})
+	})
+
+	handle("POST /admin/api/users/{username}/ban", func(w http.ResponseWriter, r *http.Request) {
+		var req adminBanRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil || req.Duration < 0 {
+				writeHTTPError(w, http.StatusBadRequest, protocol.ErrCodeInvalidMessage, "Invalid ban request")
+				return
+			}
+		}
+		if err := h.BanUser(r.PathValue("username"), time.Duration(req.Duration)*time.Second, req.Reason); err != nil {
+			writeHubError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("DELETE /admin/api/users/{username}/ban", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.UnbanUser(r.PathValue("username")); err != nil {
+			writeHubError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("POST /admin/api/connections/{id}/disconnect", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.DisconnectClient(r.PathValue("id")); err != nil {
+			writeHubError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("GET /admin/api/rooms", func(w http.ResponseWriter, r *http.Request) {
+		rooms := h.AdminRooms(r.URL.Query().Get("q"), queryLimit(r))
+		writeJSON(w, http.StatusOK, map[string]any{"rooms": rooms})
+	})
+
+	handle("DELETE /admin/api/rooms/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.DeleteRoom(r.PathValue("id")); err != nil {
+			writeHubError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("DELETE /admin/api/rooms/{id}/messages/{messageID}", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.AdminDeleteMessage(r.PathValue("id"), r.PathValue("messageID")); err != nil {
+			writeHubError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("GET /admin/api/held-messages", func(w http.ResponseWriter, r *http.Request) {
+		held, err := h.AdminHeldMessages(r.URL.Query().Get("room_id"), queryLimit(r))
+		if err != nil {
+			writeHubError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{"messages": held})
+	})
+
+	handle("POST /admin/api/held-messages/{id}/release", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.ReleaseHeldMessage(r.PathValue("id")); err != nil {
+			writeHubError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("DELETE /admin/api/held-messages/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if err := h.DiscardHeldMessage(r.PathValue("id")); err != nil {
+			writeHubError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	handle("POST /admin/api/cleanup", func(w http.ResponseWriter, r *http.Request) {
+		// The run goes on if the caller hangs up; stopping halfway would leave
+		// the hub out of step with what was already deleted
+		stats, err := cleanupJob.RunNow(context.WithoutCancel(r.Context()))
+		if err != nil {
+			slog.Error("Cleanup failed", "err", err)
+			writeHTTPError(w, http.StatusInternalServerError, protocol.ErrCodeInvalidMessage, "Cleanup failed")
+			return
+		}
+		slog.Info("Admin cleanup completed", "users", stats.UsersDeleted, "rooms", stats.RoomsDeleted,
+			"messages", stats.MessagesDeleted, "direct_messages", stats.DirectMessagesDeleted,
+			"attachments", stats.AttachmentsDeleted)
+		writeJSON(w, http.StatusOK, adminCleanupResponse{
+			UsersDeleted:          stats.UsersDeleted,
+			RoomsDeleted:          stats.RoomsDeleted,
+			MessagesDeleted:       stats.MessagesDeleted,
+			DirectMessagesDeleted: stats.DirectMessagesDeleted,
+			AttachmentsDeleted:    stats.AttachmentsDeleted,
+		})
+	})
+}
+
+// requireAdmin rejects requests that don't carry the admin bearer token
+// The token is never accepted in the URL, where it would end up in access logs
+func requireAdmin(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		given, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeHTTPError(w, http.StatusUnauthorized, protocol.ErrCodePermissionDenied, "Invalid or missing admin token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// queryLimit reads the optional limit query parameter; 0 means the default
+func queryLimit(r *http.Request) int {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	return limit
+}
+
+// writeJSON answers an HTTP request with a JSON body
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"haven/internal/client"
+	"haven/internal/hub"
+	"haven/internal/protocol"
+)
+
+// Room for multipart headers on top of the file itself
+const uploadOverhead = 64 << 10
+
+// withCORS allows the web client to call an endpoint from another origin.
+// Requests authenticate with a bearer token rather than cookies, so any
+// origin may be allowed. A nil handler only answers preflight requests.
+func withCORS(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		if r.Method == http.MethodOptions || next == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authenticate resolves the connection an HTTP request acts for from its
+// "Authorization: Bearer" header. The token is never accepted in the URL,
+// where it would leak into access logs and Referer headers.
+func authenticate(h *hub.Hub, r *http.Request) (*client.Client, bool) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, false
+	}
+	return h.Authenticate(token)
+}
+
+// serveUpload handles POST /attachments?room_id=... with a multipart "file" field
+func serveUpload(h *hub.Hub, maxSize int64, w http.ResponseWriter, r *http.Request) {
+	c, ok := authenticate(h, r)
+	if !ok {
+		writeHTTPError(w, http.StatusUnauthorized, protocol.ErrCodeNotRegistered, "Invalid or missing auth token")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+uploadOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, protocol.ErrCodeInvalidMessage, "Expected a multipart upload")
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeHTTPError(w, http.StatusRequestEntityTooLarge, protocol.ErrCodeFileTooLarge, "File is too large")
+				return
+			}
+			writeHTTPError(w, http.StatusBadRequest, protocol.ErrCodeInvalidMessage, "Missing file field")
+			return
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		info, err := h.UploadAttachment(c, r.URL.Query().Get("room_id"), part.FileName(), part)
+		_ = part.Close()
+		if err != nil {
+			writeHubError(w, err)
+			return
+		}
+
+		slog.InfoContext(c.LogContext(), "Attachment uploaded", "attachment_id", info.ID, "room_id", r.URL.Query().Get("room_id"), "size", info.Size)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(info)
+		return
+	}
+}
+
+// serveDownload handles GET /attachments/{id}, authenticated by a bearer
+// token or by the expires and sig parameters of the signed URL that comes
+// with each attachment (for <img> tags)
+func serveDownload(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
+	var info *protocol.AttachmentInfo
+	var content io.ReadSeekCloser
+	var err error
+
+	if query := r.URL.Query(); query.Has("sig") {
+		expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+		info, content, err = h.OpenSignedAttachment(r.PathValue("id"), expires, query.Get("sig"))
+	} else {
+		c, ok := authenticate(h, r)
+		if !ok {
+			writeHTTPError(w, http.StatusUnauthorized, protocol.ErrCodeNotRegistered, "Invalid or missing auth token")
+			return
+		}
+		info, content, err = h.OpenAttachment(c, r.PathValue("id"))
+	}
+	if err != nil {
+		writeHubError(w, err)
+		return
+	}
+	defer func() { _ = content.Close() }()
+
+	// Images may be shown inline; everything else downloads. The stored type was
+	// detected from the contents, so browsers must not second-guess it.
+	disposition := "attachment"
+	if strings.HasPrefix(info.ContentType, "image/") {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": info.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, "", time.Time{}, content)
+}
+
+// writeHubError answers an HTTP request with a hub error and a matching status
+func writeHubError(w http.ResponseWriter, err error) {
+	var hubErr *hub.Error
+	if !errors.As(err, &hubErr) {
+		writeHTTPError(w, http.StatusInternalServerError, protocol.ErrCodeInvalidMessage, "Internal error")
+		return
+	}
+
+	status := http.StatusBadRequest
+	switch hubErr.Code {
+	case protocol.ErrCodeNotRegistered:
+		status = http.StatusUnauthorized
+	case protocol.ErrCodeNotInRoom, protocol.ErrCodePermissionDenied:
+		status = http.StatusForbidden
+	case protocol.ErrCodeRoomNotFound, protocol.ErrCodeFileNotFound, protocol.ErrCodeUserNotFound, protocol.ErrCodeMessageNotFound:
+		status = http.StatusNotFound
+	case protocol.ErrCodeFileTooLarge, protocol.ErrCodeQuotaExceeded:
+		status = http.StatusRequestEntityTooLarge
+	case protocol.ErrCodeUnsupportedFile:
+		status = http.StatusUnsupportedMediaType
+	}
+	writeHTTPError(w, status, hubErr.Code, hubErr.Message)
+}
+
+// writeHTTPError answers an HTTP request with the same error payload sent over WebSocket
+func writeHTTPError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(protocol.ErrorPayload{Code: code, Message: message})
+}
@@ -3,17 +3,22 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 
+	"haven/internal/blob"
 	"haven/internal/client"
 	"haven/internal/config"
 	"haven/internal/hub"
+	"haven/internal/logging"
+	"haven/internal/metrics"
+	"haven/internal/moderation"
 	"haven/internal/protocol"
 	"haven/internal/storage/postgres"
 )
@@ -26,6 +31,9 @@ var upgrader = websocket.Upgrader{
 
 func main() {
 	cfg := config.Load()
+	if err := logging.Setup(cfg.Log.Format, cfg.Log.Level); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
 	ctx := context.Background()
 
 	// Initialize PostgreSQL database
@@ -42,35 +50,91 @@ func main() {
 
 	db, err := postgres.NewDB(ctx, dbCfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("Failed to connect to database", err)
 	}
 	defer db.Close()
-	log.Printf("Connected to PostgreSQL at %s:%s/%s", cfg.DB.Host, cfg.DB.Port, cfg.DB.Database)
+	slog.Info("Connected to PostgreSQL", "host", cfg.DB.Host, "port", cfg.DB.Port, "database", cfg.DB.Database)
 
 	// Run database migrations
 	if err := db.RunMigrations(); err != nil {
-		log.Fatalf("Failed to run database migrations: %v", err)
+		fatal("Failed to run database migrations", err)
 	}
-	log.Printf("Database migrations applied successfully")
+	slog.Info("Database migrations applied")
 
 	// Create stores
 	userStore := postgres.NewUserStore(db.Pool)
 	roomStore := postgres.NewRoomStore(db.Pool)
 	memberStore := postgres.NewMemberStore(db.Pool)
 	messageStore := postgres.NewMessageStore(db.Pool)
+	dmStore := postgres.NewDirectMessageStore(db.Pool)
 
 	// Get initial counts for logging
 	userCount, _ := userStore.Count(ctx)
 	roomCount, _ := roomStore.Count(ctx)
-	log.Printf("Database initialized: %d users, %d rooms", userCount, roomCount)
+	slog.Info("Database initialized", "users", userCount, "rooms", roomCount)
 
 	// Create hub and set storage
 	h := hub.New()
-	h.SetStores(roomStore, userStore, memberStore, messageStore)
+	h.SetStores(roomStore, userStore, memberStore, messageStore, dmStore)
+
+	// Attachment contents live on the local filesystem
+	blobs, err := blob.NewLocalStore(cfg.Attachments.Dir)
+	if err != nil {
+		fatal("Failed to open attachment store", err)
+	}
+	h.SetBlobStore(blobs, hub.AttachmentLimits{
+		MaxSize: cfg.Attachments.MaxSize,
+		Quota:   cfg.Attachments.Quota,
+	})
+	slog.Info("Attachment store opened", "dir", cfg.Attachments.Dir,
+		"max_size_mb", cfg.Attachments.MaxSize>>20, "quota_mb", cfg.Attachments.Quota>>20)
+
+	// Content filters for new and edited messages
+	moderationCfg := &moderation.Config{}
+	if cfg.Moderation.RulesFile != "" {
+		moderationCfg, err = moderation.LoadConfig(cfg.Moderation.RulesFile)
+		if err != nil {
+			fatal("Failed to load moderation rules", err)
+		}
+	}
+	if moderationCfg.MaxLength == 0 {
+		moderationCfg.MaxLength = cfg.Moderation.MaxLength
+	}
+	pipeline, err := moderationCfg.Pipeline()
+	if err != nil {
+		fatal("Invalid moderation rules", err)
+	}
+	h.SetModeration(pipeline)
+	slog.Info("Moderation configured", "max_length", moderationCfg.MaxLength,
+		"global_rules", len(moderationCfg.Rules), "room_rules", len(moderationCfg.Rooms))
+
+	// Flood protection
+	limits := cfg.RateLimits
+	h.SetRateLimits(map[string]hub.RateLimit{
+		hub.RateLimitMessages:      {Conn: limits.ConnMessages, User: limits.UserMessages},
+		hub.RateLimitRoomCreates:   {Conn: limits.ConnRoomCreates, User: limits.UserRoomCreates},
+		hub.RateLimitRegistrations: {Conn: limits.ConnRegistrations},
+		hub.RateLimitHistory:       {Conn: limits.ConnHistory, User: limits.UserHistory},
+	})
+	slog.Info("Rate limits configured",
+		"messages", limits.ConnMessages, "user_messages", limits.UserMessages,
+		"room_creates", limits.ConnRoomCreates, "user_room_creates", limits.UserRoomCreates,
+		"registrations", limits.ConnRegistrations,
+		"history", limits.ConnHistory, "user_history", limits.UserHistory)
 
 	// Load persisted rooms
 	if err := h.LoadRooms(); err != nil {
-		log.Printf("Warning: Failed to load rooms from storage: %v", err)
+		slog.Warn("Failed to load rooms from storage", "err", err)
+	}
+
+	// Load mutes and bans, and who may hand them out server-wide
+	if err := h.LoadSanctions(); err != nil {
+		slog.Warn("Failed to load sanctions from storage", "err", err)
+	}
+	if err := h.SetServerAdmins(cfg.ServerAdmins); err != nil {
+		slog.Warn("Failed to set server admins", "err", err)
+	} else if len(cfg.ServerAdmins) > 0 {
+		slog.Info("Server admins configured", "usernames", cfg.ServerAdmins)
 	}
 
 	// Start cleanup job
@@ -78,16 +142,47 @@ func main() {
 		UserInactivityTimeout: cfg.UserInactivityTimeout,
 		RoomInactivityTimeout: cfg.RoomInactivityTimeout,
 		MessageRetention:      cfg.MessageRetention,
+		Blobs:                 blobs,
+		// Deleted rooms and users must disappear for connected clients too
+		AfterRun: h.ApplyCleanup,
 	}, cfg.CleanupInterval)
 	cleanupJob.Start()
 	defer cleanupJob.Stop()
-	log.Printf("Cleanup job started (interval: %v, user timeout: %v, room timeout: %v, message retention: %v)",
-		cfg.CleanupInterval, cfg.UserInactivityTimeout, cfg.RoomInactivityTimeout, cfg.MessageRetention)
+	slog.Info("Cleanup job started", "interval", cfg.CleanupInterval,
+		"user_timeout", cfg.UserInactivityTimeout, "room_timeout", cfg.RoomInactivityTimeout,
+		"message_retention", cfg.MessageRetention)
 
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		serveWs(h, w, r)
 	})
 
+	http.HandleFunc("POST /attachments", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		serveUpload(h, cfg.Attachments.MaxSize, w, r)
+	}))
+	http.HandleFunc("GET /attachments/{id}", withCORS(func(w http.ResponseWriter, r *http.Request) {
+		serveDownload(h, w, r)
+	}))
+	// CORS preflight for uploads from the web client's origin
+	http.HandleFunc("OPTIONS /attachments", withCORS(nil))
+	http.HandleFunc("OPTIONS /attachments/{id}", withCORS(nil))
+
+	// Operator API, only served when a token is configured
+	if cfg.AdminToken != "" {
+		registerAdminAPI(http.DefaultServeMux, h, cleanupJob, cfg.AdminToken)
+		slog.Info("Admin API enabled", "path", "/admin/api")
+	}
+
+	// Prometheus scrape endpoint, on its own listener so it isn't public
+	if cfg.MetricsAddr != "" {
+		registerHubMetrics(h)
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Handler())
+		go func() {
+			fatal("Metrics server stopped", http.ListenAndServe(cfg.MetricsAddr, metricsMux))
+		}()
+		slog.Info("Metrics enabled", "addr", cfg.MetricsAddr, "path", "/metrics")
+	}
+
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		uc, _ := userStore.Count(ctx)
@@ -99,14 +194,21 @@ func main() {
 		})
 	})
 
-	log.Printf("Haven relay starting on :%s", cfg.Port)
-	log.Fatal(http.ListenAndServe(":"+cfg.Port, nil))
+	slog.Info("Haven relay starting", "port", cfg.Port)
+	fatal("Server stopped", http.ListenAndServe(":"+cfg.Port, nil))
+}
+
+// fatal logs an error the relay can't run without and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
 
 func serveWs(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Upgrade error:", err)
+		upgradeFailures.Inc()
+		slog.Warn("WebSocket upgrade failed", "remote_addr", r.RemoteAddr, "err", err)
 		return
 	}
 
@@ -121,17 +223,31 @@ func serveWs(h *hub.Hub, w http.ResponseWriter, r *http.Request) {
 	// Set up disconnect handler
 	c.OnClose = func(c *client.Client) {
 		h.RemoveClient(c)
-		log.Printf("Client disconnected: %s (%s)", c.ID, c.Username)
+		slog.InfoContext(c.LogContext(), "Client disconnected", "username", c.Username)
 	}
 
 	h.AddClient(c)
-	log.Printf("Client connected: %s", c.ID)
+	slog.InfoContext(c.LogContext(), "Client connected", "remote_addr", r.RemoteAddr)
 
 	go c.WritePump()
 	go c.ReadPump()
 }
 
 func handleMessage(h *hub.Hub, c *client.Client, env *protocol.Envelope) {
+	// Unknown types share one label so clients can't create series at will
+	label := string(env.Type)
+	defer func() { messagesReceived.Inc(label) }()
+
+	if err := h.CheckRateLimit(c, env.Type); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorRetryAfter(hubErr.Code, hubErr.Message, hubErr.RetryAfter)
+		}
+		return
+	}
+
+	// Any message counts as activity for idle detection
+	h.Touch(c)
+
 	switch env.Type {
 	case protocol.TypeRegister:
 		handleRegister(h, c, env.Payload)
@@ -145,13 +261,72 @@ func handleMessage(h *hub.Hub, c *client.Client, env *protocol.Envelope) {
 		handleRoomLeave(h, c, env.Payload)
 	case protocol.TypeRoomMessage:
 		handleRoomMessage(h, c, env.Payload)
+	case protocol.TypeRoomMsgEdit:
+		handleRoomMessageEdit(h, c, env.Payload)
+	case protocol.TypeRoomMsgDelete:
+		handleRoomMessageDelete(h, c, env.Payload)
+	case protocol.TypeReactionAdd:
+		handleReaction(h, c, env.Payload, true)
+	case protocol.TypeReactionRemove:
+		handleReaction(h, c, env.Payload, false)
 	case protocol.TypeRoomHistory:
 		handleRoomHistory(h, c, env.Payload)
+	case protocol.TypeThreadHistory:
+		handleThreadHistory(h, c, env.Payload)
+	case protocol.TypeDMHistory:
+		handleDMHistory(h, c, env.Payload)
+	case protocol.TypeTyping:
+		handleTyping(h, c, env.Payload)
+	case protocol.TypePresenceUpdate:
+		handlePresenceUpdate(h, c, env.Payload)
+	case protocol.TypeMarkRead:
+		handleMarkRead(h, c, env.Payload)
+	case protocol.TypeSync:
+		handleSync(h, c, env.Payload)
+	case protocol.TypeMentions:
+		handleMentions(h, c, env.Payload)
+	case protocol.TypeMessageSearch:
+		handleMessageSearch(h, c, env.Payload)
+	case protocol.TypeMessagePin:
+		handleMessagePin(h, c, env.Payload, true)
+	case protocol.TypeMessageUnpin:
+		handleMessagePin(h, c, env.Payload, false)
+	case protocol.TypeRoomUpdate:
+		handleRoomUpdate(h, c, env.Payload)
+	case protocol.TypeRoomSetRole:
+		handleRoomSetRole(h, c, env.Payload)
+	case protocol.TypeRoomKick:
+		handleRoomKick(h, c, env.Payload)
+	case protocol.TypeRoomTransfer:
+		handleRoomTransfer(h, c, env.Payload)
+	case protocol.TypeRoomInvite:
+		handleRoomInvite(h, c, env.Payload)
+	case protocol.TypeInviteCreate:
+		handleInviteCreate(h, c, env.Payload)
+	case protocol.TypeInviteRevoke:
+		handleInviteRevoke(h, c, env.Payload)
+	case protocol.TypeInviteList:
+		handleInviteList(h, c, env.Payload)
+	case protocol.TypeKickSessions:
+		handleKickSessions(h, c)
+	case protocol.TypeReport:
+		handleReport(h, c, env.Payload)
+	case protocol.TypeReportList:
+		handleReportList(h, c, env.Payload)
+	case protocol.TypeReportResolve:
+		handleReportResolve(h, c, env.Payload)
+	case protocol.TypeUserBlock:
+		handleUserBlock(h, c, env.Payload, true)
+	case protocol.TypeUserUnblock:
+		handleUserBlock(h, c, env.Payload, false)
+	case protocol.TypeBlockList:
+		handleBlockList(h, c)
 	case protocol.TypeUserList:
 		handleUserList(h, c)
 	case protocol.TypeRoomList:
 		handleRoomList(h, c)
 	default:
+		label = "unknown"
 		c.SendError(protocol.ErrCodeInvalidMessage, "Unknown message type")
 	}
 }
@@ -179,18 +354,28 @@ func handleRegister(h *hub.Hub, c *client.Client, payload json.RawMessage) {
 		userID = c.ID // Fallback for non-DB mode
 	}
 
+	// HTTP requests (attachments) authenticate as this connection
+	authToken, err := h.IssueAuthToken(c)
+	if err != nil {
+		slog.ErrorContext(c.LogContext(), "Failed to issue auth token", "err", err)
+	}
+
 	_ = c.SendMessage(protocol.TypeRegisterAck, protocol.RegisterAckPayload{
 		Success:      true,
 		Username:     c.Username,
 		UserID:       userID,
 		RecoveryCode: result.RecoveryCode, // Only set for new users
 		IsNewUser:    result.IsNewUser,
+		AuthToken:    authToken,
 	})
 
+	// Deliver direct messages received while offline (after the ack so the client is ready)
+	h.DeliverPendingDirectMessages(c)
+
 	if result.IsNewUser {
-		log.Printf("New user registered: %s (%s)", c.Username, c.ID)
+		slog.InfoContext(c.LogContext(), "New user registered", "username", c.Username)
 	} else {
-		log.Printf("User logged in: %s (%s)", c.Username, c.ID)
+		slog.InfoContext(c.LogContext(), "User logged in", "username", c.Username)
 	}
 }
 
@@ -201,9 +386,9 @@ func handleDirectMessage(h *hub.Hub, c *client.Client, payload json.RawMessage)
 		return
 	}
 
-	if err := h.SendDirectMessage(c, p.To, p.Content); err != nil {
+	if err := h.SendDirectMessage(c, p.To, p.Content, p.ClientMsgID); err != nil {
 		if hubErr, ok := err.(*hub.Error); ok {
-			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.To)
+			c.SendErrorWithReason(hubErr.Code, hubErr.Message, p.To, hubErr.Reason)
 		}
 	}
 }
@@ -231,7 +416,7 @@ func handleRoomCreate(h *hub.Hub, c *client.Client, payload json.RawMessage) {
 		Success: true,
 		Room:    &roomInfo,
 	})
-	log.Printf("Room created: %s (%s) by %s", room.Name, room.ID, c.Username)
+	slog.InfoContext(c.LogContext(), "Room created", "room_id", room.ID, "room_name", roomInfo.Name)
 }
 
 func handleRoomJoin(h *hub.Hub, c *client.Client, payload json.RawMessage) {
@@ -241,7 +426,7 @@ func handleRoomJoin(h *hub.Hub, c *client.Client, payload json.RawMessage) {
 		return
 	}
 
-	room, err := h.JoinRoom(c, p.RoomID)
+	room, err := h.JoinRoom(c, p.RoomID, p.InviteToken)
 	if err != nil {
 		if hubErr, ok := err.(*hub.Error); ok {
 			_ = c.SendMessage(protocol.TypeRoomJoined, protocol.RoomJoinedPayload{
@@ -253,7 +438,7 @@ func handleRoomJoin(h *hub.Hub, c *client.Client, payload json.RawMessage) {
 		return
 	}
 
-	roomInfo := room.Info()
+	roomInfo := h.RoomInfoFor(c, room)
 
 	// Fetch recent message history to include in join response
 	var history []protocol.IncomingRoomMessage
@@ -266,10 +451,150 @@ func handleRoomJoin(h *hub.Hub, c *client.Client, payload json.RawMessage) {
 		Success: true,
 		RoomID:  room.ID,
 		Room:    &roomInfo,
-		Members: room.MemberInfoList(),
+		Members: h.RoomMembers(room),
 		History: history,
+		Pins:    h.GetPins(room.ID),
+	})
+	slog.InfoContext(c.LogContext(), "Joined room", "room_id", room.ID, "room_name", roomInfo.Name)
+}
+
+func handleRoomUpdate(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.RoomUpdatePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid room update payload")
+		return
+	}
+
+	if err := h.UpdateRoom(c, p.RoomID, p.Name, p.Topic, p.Description); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.RoomID)
+		}
+	}
+}
+
+func handleRoomSetRole(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.RoomSetRolePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid set role payload")
+		return
+	}
+
+	if err := h.SetMemberRole(c, p.RoomID, p.UserID, p.Role); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.UserID)
+		}
+	}
+}
+
+func handleRoomKick(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.RoomKickPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid kick payload")
+		return
+	}
+
+	if err := h.KickMember(c, p.RoomID, p.UserID); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.UserID)
+		}
+	}
+}
+
+func handleRoomTransfer(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.RoomTransferPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid transfer ownership payload")
+		return
+	}
+
+	if err := h.TransferOwnership(c, p.RoomID, p.UserID); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.UserID)
+		}
+	}
+}
+
+func handleRoomInvite(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.RoomInvitePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid room invite payload")
+		return
+	}
+
+	user, err := h.InviteUser(c, p.RoomID, p.Username)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.Username)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeRoomInviteResp, protocol.RoomInviteResponsePayload{
+		RoomID: p.RoomID,
+		User:   *user,
+	})
+}
+
+func handleInviteCreate(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.InviteCreatePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid invite create payload")
+		return
+	}
+
+	invite, err := h.CreateInviteToken(c, p.RoomID, p.MaxUses, time.Duration(p.ExpiresIn)*time.Second)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeInviteCreated, protocol.InviteCreatedPayload{
+		RoomID: p.RoomID,
+		Invite: *invite,
+	})
+}
+
+func handleInviteRevoke(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.InviteRevokePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid invite revoke payload")
+		return
+	}
+
+	if err := h.RevokeInviteToken(c, p.RoomID, p.Token); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.Token)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeInviteRevoked, protocol.InviteRevokedPayload{
+		RoomID: p.RoomID,
+		Token:  p.Token,
+	})
+}
+
+func handleInviteList(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.InviteListPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid invite list payload")
+		return
+	}
+
+	invites, err := h.ListInviteTokens(c, p.RoomID)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeInviteListResp, protocol.InviteListResponsePayload{
+		RoomID:  p.RoomID,
+		Invites: invites,
 	})
-	log.Printf("User %s joined room %s", c.Username, room.Name)
 }
 
 func handleRoomLeave(h *hub.Hub, c *client.Client, payload json.RawMessage) {
@@ -303,9 +628,58 @@ func handleRoomMessage(h *hub.Hub, c *client.Client, payload json.RawMessage) {
 		return
 	}
 
-	if err := h.SendRoomMessage(c, p.RoomID, p.Content); err != nil {
+	opts := hub.MessageOptions{ReplyTo: p.ReplyTo, ThreadID: p.ThreadID, ClientMsgID: p.ClientMsgID, Attachments: p.Attachments}
+	if err := h.SendRoomMessage(c, p.RoomID, p.Content, opts); err != nil {
 		if hubErr, ok := err.(*hub.Error); ok {
-			c.SendError(hubErr.Code, hubErr.Message)
+			c.SendErrorWithReason(hubErr.Code, hubErr.Message, "", hubErr.Reason)
+		}
+	}
+}
+
+func handleRoomMessageEdit(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.RoomMessageEditPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid room message edit payload")
+		return
+	}
+
+	if err := h.EditRoomMessage(c, p.RoomID, p.MessageID, p.Content); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithReason(hubErr.Code, hubErr.Message, p.MessageID, hubErr.Reason)
+		}
+	}
+}
+
+func handleRoomMessageDelete(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.RoomMessageDeletePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid room message delete payload")
+		return
+	}
+
+	if err := h.DeleteRoomMessage(c, p.RoomID, p.MessageID); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.MessageID)
+		}
+	}
+}
+
+func handleReaction(h *hub.Hub, c *client.Client, payload json.RawMessage, add bool) {
+	var p protocol.ReactionPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid reaction payload")
+		return
+	}
+
+	var err error
+	if add {
+		err = h.AddReaction(c, p.RoomID, p.MessageID, p.Emoji)
+	} else {
+		err = h.RemoveReaction(c, p.RoomID, p.MessageID, p.Emoji)
+	}
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.MessageID)
 		}
 	}
 }
@@ -333,6 +707,301 @@ func handleRoomHistory(h *hub.Hub, c *client.Client, payload json.RawMessage) {
 	_ = c.SendMessage(protocol.TypeRoomHistoryResp, response)
 }
 
+func handleThreadHistory(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.ThreadHistoryPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid thread history payload")
+		return
+	}
+
+	var before time.Time
+	if p.Before > 0 {
+		before = time.UnixMilli(p.Before)
+	}
+
+	response, err := h.GetThreadHistory(c, p.RoomID, p.ThreadID, p.Limit, before)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.ThreadID)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeThreadHistoryResp, response)
+}
+
+func handleDMHistory(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.DMHistoryPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid DM history payload")
+		return
+	}
+
+	var before time.Time
+	if p.Before > 0 {
+		before = time.UnixMilli(p.Before)
+	}
+
+	response, err := h.GetDirectMessageHistory(c, p.With, p.Limit, before)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.With)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeDMHistoryResp, response)
+}
+
+func handleTyping(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.TypingPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid typing payload")
+		return
+	}
+
+	if err := h.SetTyping(c, p.RoomID, p.To, p.Stopped); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+	}
+}
+
+func handlePresenceUpdate(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.PresenceUpdatePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid presence payload")
+		return
+	}
+
+	expiresIn := time.Duration(p.StatusExpiresIn) * time.Second
+	if err := h.SetPresence(c, p.State, p.Status, expiresIn); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+	}
+}
+
+func handleMarkRead(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.MarkReadPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid mark read payload")
+		return
+	}
+
+	if err := h.MarkRead(c, p.RoomID, p.MessageID); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.RoomID)
+		}
+	}
+}
+
+func handleSync(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.SyncPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid sync payload")
+		return
+	}
+
+	// Responses are sent by the hub in chunks
+	if err := h.Sync(c, p.Since, p.Cursors); err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		} else {
+			slog.WarnContext(c.LogContext(), "Sync aborted", "err", err)
+		}
+	}
+}
+
+func handleMentions(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.MentionsPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid mentions payload")
+		return
+	}
+
+	var before time.Time
+	if p.Before > 0 {
+		before = time.UnixMilli(p.Before)
+	}
+
+	response, err := h.GetMentions(c, p.Limit, before)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeMentionsResp, response)
+}
+
+func handleMessageSearch(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.MessageSearchPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid search payload")
+		return
+	}
+
+	opts := hub.SearchOptions{
+		Query:  p.Query,
+		RoomID: p.RoomID,
+		Sender: p.Sender,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+	}
+	if p.After > 0 {
+		opts.After = time.UnixMilli(p.After)
+	}
+	if p.Before > 0 {
+		opts.Before = time.UnixMilli(p.Before)
+	}
+
+	response, err := h.SearchMessages(c, opts)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.RoomID)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeMessageSearchResp, response)
+}
+
+func handleMessagePin(h *hub.Hub, c *client.Client, payload json.RawMessage, pin bool) {
+	var p protocol.MessagePinPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid pin payload")
+		return
+	}
+
+	var err error
+	if pin {
+		err = h.PinMessage(c, p.RoomID, p.MessageID)
+	} else {
+		err = h.UnpinMessage(c, p.RoomID, p.MessageID)
+	}
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.MessageID)
+		}
+	}
+}
+
+func handleKickSessions(h *hub.Hub, c *client.Client) {
+	kicked, err := h.KickOtherSessions(c)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeKickSessionsResp, protocol.KickSessionsResponsePayload{
+		Kicked: kicked,
+	})
+}
+
+func handleReport(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.ReportPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid report payload")
+		return
+	}
+
+	target := hub.ReportTarget{
+		Type:      p.TargetType,
+		RoomID:    p.RoomID,
+		MessageID: p.MessageID,
+		Username:  p.Username,
+	}
+	reportID, err := h.Report(c, target, p.Category, p.Details)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeReportResp, protocol.ReportResponsePayload{
+		ReportID: reportID,
+	})
+}
+
+func handleReportList(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.ReportListPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid report list payload")
+		return
+	}
+
+	reports, err := h.ListReports(c, p.RoomID, p.Status, p.Limit)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.RoomID)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeReportListResp, protocol.ReportListResponsePayload{
+		Reports: reports,
+	})
+}
+
+func handleReportResolve(h *hub.Hub, c *client.Client, payload json.RawMessage) {
+	var p protocol.ReportResolvePayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid report resolve payload")
+		return
+	}
+
+	report, err := h.ResolveReport(c, p.ReportID, p.Action, time.Duration(p.Duration)*time.Second, p.Note)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.ReportID)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeReportResolved, protocol.ReportResolvedPayload{
+		Report: *report,
+	})
+}
+
+func handleUserBlock(h *hub.Hub, c *client.Client, payload json.RawMessage, block bool) {
+	var p protocol.UserBlockPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		c.SendError(protocol.ErrCodeInvalidMessage, "Invalid block payload")
+		return
+	}
+
+	var err error
+	if block {
+		err = h.BlockUser(c, p.Username)
+	} else {
+		err = h.UnblockUser(c, p.Username)
+	}
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendErrorWithTarget(hubErr.Code, hubErr.Message, p.Username)
+		}
+	}
+}
+
+func handleBlockList(h *hub.Hub, c *client.Client) {
+	blocked, err := h.GetBlockList(c)
+	if err != nil {
+		if hubErr, ok := err.(*hub.Error); ok {
+			c.SendError(hubErr.Code, hubErr.Message)
+		}
+		return
+	}
+
+	_ = c.SendMessage(protocol.TypeBlockListResp, protocol.BlockListResponsePayload{
+		Blocked: blocked,
+	})
+}
+
 func handleUserList(h *hub.Hub, c *client.Client) {
 	users := h.GetUserList()
 	_ = c.SendMessage(protocol.TypeUserListResp, protocol.UserListResponsePayload{
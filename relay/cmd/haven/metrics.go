@@ -0,0 +1,29 @@
+package main
+
+import (
+	"haven/internal/hub"
+	"haven/internal/metrics"
+)
+
+var (
+	messagesReceived = metrics.NewCounter("haven_messages_received_total",
+		"WebSocket messages received from clients, by message type.", "type")
+	upgradeFailures = metrics.NewCounter("haven_websocket_upgrade_failures_total",
+		"HTTP requests to /ws that could not be upgraded to WebSocket.")
+)
+
+// registerHubMetrics exposes the hub's in-memory counts
+func registerHubMetrics(h *hub.Hub) {
+	metrics.NewGaugeFunc("haven_connected_clients",
+		"Open WebSocket connections, registered or not.",
+		func() float64 { return float64(h.Stats().Clients) })
+	metrics.NewGaugeFunc("haven_sessions",
+		"Registered WebSocket connections.",
+		func() float64 { return float64(h.Stats().Sessions) })
+	metrics.NewGaugeFunc("haven_online_users",
+		"Users with at least one registered connection.",
+		func() float64 { return float64(h.Stats().OnlineUsers) })
+	metrics.NewGaugeFunc("haven_rooms",
+		"Rooms held in memory.",
+		func() float64 { return float64(h.Stats().Rooms) })
+}
@@ -0,0 +1,25 @@
+// Package blob stores uploaded file contents, such as message attachments.
+// Metadata lives in PostgreSQL; a Store only holds the bytes under opaque keys.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no blob exists under a key
+var ErrNotFound = errors.New("blob not found")
+
+// Store is a place to keep blobs. Implementations must be safe for concurrent use.
+type Store interface {
+	// Put stores the contents of r under key, replacing any existing blob
+	// Returns the number of bytes written
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+
+	// Open returns a reader for the blob under key, or ErrNotFound
+	Open(ctx context.Context, key string) (io.ReadSeekCloser, error)
+
+	// Delete removes the blob under key; deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,53 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	s, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	ctx := context.Background()
+
+	n, err := s.Put(ctx, "abc123", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Failed to put blob: %v", err)
+	}
+	if n != 5 {
+		t.Errorf("Expected 5 bytes written, got %d", n)
+	}
+
+	r, err := s.Open(ctx, "abc123")
+	if err != nil {
+		t.Fatalf("Failed to open blob: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	_ = r.Close()
+	if string(data) != "hello" {
+		t.Errorf("Expected 'hello', got '%s'", data)
+	}
+
+	if err := s.Delete(ctx, "abc123"); err != nil {
+		t.Fatalf("Failed to delete blob: %v", err)
+	}
+	if _, err := s.Open(ctx, "abc123"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	// Deleting twice is fine
+	if err := s.Delete(ctx, "abc123"); err != nil {
+		t.Errorf("Expected second delete to succeed, got %v", err)
+	}
+
+	// Keys can't escape the store's directory
+	for _, key := range []string{"../etc", "a/b/c", "x", ""} {
+		if _, err := s.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"log/slog"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 
+	"haven/internal/logging"
+	"haven/internal/metrics"
 	"haven/internal/protocol"
 )
 
@@ -28,22 +32,40 @@ const (
 	sendBufferSize = 256
 )
 
+// ErrSendTimeout is returned by SendMessageWait when the send buffer stays full
+var ErrSendTimeout = errors.New("send buffer full")
+
+// sendDropped counts messages lost to a full send buffer
+var sendDropped = metrics.NewCounter("haven_client_send_dropped_total",
+	"Messages dropped because a client's send buffer was full, by message type.", "type")
+
 // Client represents a connected WebSocket user
 type Client struct {
-	ID       string // Connection ID (WebSocket session UUID)
-	UserID   string // Database user ID (persisted across sessions)
-	Username string
-	Conn     *websocket.Conn
-	Send     chan []byte
-	rooms    map[string]bool // Set of room IDs
-	mu       sync.RWMutex
+	ID        string // Connection ID (WebSocket session UUID)
+	UserID    string // Database user ID (persisted across sessions)
+	Username  string
+	AuthToken string // Token authenticating HTTP requests for this connection (empty until issued)
+	Conn      *websocket.Conn
+	Send      chan []byte
+	rooms     map[string]bool // Set of room IDs
+	mu        sync.RWMutex
 
 	// Handler is called for each incoming message
 	Handler func(c *Client, env *protocol.Envelope)
 	// OnClose is called when the client disconnects
 	OnClose func(c *Client)
 
-	closeOnce sync.Once
+	closeOnce   sync.Once
+	done        chan struct{} // Closed by Close; Send itself is never closed
+	sendMu      sync.RWMutex  // guards closed and the close status
+	closed      bool
+	closeCode   int // WebSocket close code sent on Close (0 = normal closure)
+	closeReason string
+
+	throttleMu sync.Mutex
+	lastEvent  map[string]time.Time // Throttle key -> last allowed event
+
+	handling protocol.MessageType // Type of the message being handled, for log lines (guarded by mu)
 }
 
 // New creates a new client
@@ -52,6 +74,7 @@ func New(id string, conn *websocket.Conn) *Client {
 		ID:    id,
 		Conn:  conn,
 		Send:  make(chan []byte, sendBufferSize),
+		done:  make(chan struct{}),
 		rooms: make(map[string]bool),
 	}
 }
@@ -61,6 +84,7 @@ func NewMock(id string) *Client {
 	return &Client{
 		ID:    id,
 		Send:  make(chan []byte, sendBufferSize),
+		done:  make(chan struct{}),
 		rooms: make(map[string]bool),
 	}
 }
@@ -97,6 +121,47 @@ func (c *Client) Rooms() []string {
 	return result
 }
 
+// LogContext returns a context whose log lines identify the connection,
+// its user once registered, and the message being handled
+func (c *Client) LogContext() context.Context {
+	c.mu.RLock()
+	handling := c.handling
+	c.mu.RUnlock()
+
+	args := []any{"conn_id", c.ID}
+	if c.UserID != "" {
+		args = append(args, "user_id", c.UserID)
+	}
+	if handling != "" {
+		args = append(args, "msg_type", string(handling))
+	}
+	return logging.With(context.Background(), args...)
+}
+
+// setHandling records the type of the message being handled
+func (c *Client) setHandling(msgType protocol.MessageType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handling = msgType
+}
+
+// Throttle reports whether an event identified by key may proceed, allowing
+// at most one event per key within interval for this connection
+func (c *Client) Throttle(key string, interval time.Duration) bool {
+	c.throttleMu.Lock()
+	defer c.throttleMu.Unlock()
+
+	now := time.Now()
+	if last, ok := c.lastEvent[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+	if c.lastEvent == nil {
+		c.lastEvent = make(map[string]time.Time)
+	}
+	c.lastEvent[key] = now
+	return true
+}
+
 // SendMessage sends a protocol message to the client
 func (c *Client) SendMessage(msgType protocol.MessageType, payload interface{}) error {
 	env, err := protocol.NewEnvelope(msgType, payload)
@@ -107,11 +172,50 @@ func (c *Client) SendMessage(msgType protocol.MessageType, payload interface{})
 	if err != nil {
 		return err
 	}
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.closed {
+		return nil
+	}
 	select {
 	case c.Send <- data:
 		return nil
 	default:
-		return nil // Drop if buffer full
+		sendDropped.Inc(string(msgType)) // Drop if buffer full
+		return nil
+	}
+}
+
+// SendMessageWait sends a protocol message to the client, waiting up to
+// writeWait for room in the send buffer instead of dropping the message.
+// Used for bulk responses that could otherwise overrun the buffer.
+// No lock is held while waiting, so Close never waits for a slow reader.
+func (c *Client) SendMessageWait(msgType protocol.MessageType, payload interface{}) error {
+	env, err := protocol.NewEnvelope(msgType, payload)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(writeWait)
+	defer timer.Stop()
+	select {
+	case c.Send <- data:
+		return nil
+	case <-c.done:
+		return nil
+	case <-timer.C:
+		sendDropped.Inc(string(msgType))
+		return ErrSendTimeout
 	}
 }
 
@@ -132,6 +236,26 @@ func (c *Client) SendErrorWithTarget(code, message, target string) {
 	})
 }
 
+// SendErrorRetryAfter sends an error message telling the client when it may retry
+func (c *Client) SendErrorRetryAfter(code, message string, retryAfter time.Duration) {
+	_ = c.SendMessage(protocol.TypeError, protocol.ErrorPayload{
+		Code:       code,
+		Message:    message,
+		RetryAfter: retryAfter.Milliseconds(),
+	})
+}
+
+// SendErrorWithReason sends an error message with a target and a reason code
+// (e.g., why the content filter rejected a message)
+func (c *Client) SendErrorWithReason(code, message, target, reason string) {
+	_ = c.SendMessage(protocol.TypeError, protocol.ErrorPayload{
+		Code:    code,
+		Message: message,
+		Target:  target,
+		Reason:  reason,
+	})
+}
+
 // ReadPump handles incoming WebSocket messages
 func (c *Client) ReadPump() {
 	defer func() {
@@ -154,7 +278,7 @@ func (c *Client) ReadPump() {
 			if websocket.IsUnexpectedCloseError(err,
 				websocket.CloseGoingAway,
 				websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error for %s: %v", c.ID, err)
+				slog.WarnContext(c.LogContext(), "WebSocket error", "err", err)
 			}
 			break
 		}
@@ -170,7 +294,9 @@ func (c *Client) ReadPump() {
 		}
 
 		if c.Handler != nil {
+			c.setHandling(env.Type)
 			c.Handler(c, &env)
+			c.setHandling("")
 		}
 	}
 }
@@ -185,20 +311,24 @@ func (c *Client) WritePump() {
 
 	for {
 		select {
-		case message, ok := <-c.Send:
-			_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				_ = c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case message := <-c.Send:
+			if err := c.writeMessage(message); err != nil {
 				return
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
-			}
-			_, _ = w.Write(message)
-			if err := w.Close(); err != nil {
-				return
+		case <-c.done:
+			// Flush what was queued before Close, e.g. the reason for a kick
+			for {
+				select {
+				case message := <-c.Send:
+					if err := c.writeMessage(message); err != nil {
+						return
+					}
+				default:
+					_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+					_ = c.Conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
+					return
+				}
 			}
 
 		case <-ticker.C:
@@ -210,9 +340,43 @@ func (c *Client) WritePump() {
 	}
 }
 
+// writeMessage writes one text frame to the peer
+func (c *Client) writeMessage(message []byte) error {
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+	w, err := c.Conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	_, _ = w.Write(message)
+	return w.Close()
+}
+
 // Close closes the client connection safely (can be called multiple times)
+// Messages sent after Close are dropped; those already queued are still written
 func (c *Client) Close() {
 	c.closeOnce.Do(func() {
-		close(c.Send)
+		c.sendMu.Lock()
+		defer c.sendMu.Unlock()
+		c.closed = true
+		close(c.done)
 	})
 }
+
+// SetCloseStatus sets the WebSocket close code and reason sent when the
+// connection is closed, e.g. websocket.ClosePolicyViolation
+func (c *Client) SetCloseStatus(code int, reason string) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.closeCode = code
+	c.closeReason = reason
+}
+
+// closeMessage builds the close frame payload for the connection's close status
+func (c *Client) closeMessage() []byte {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.closeCode == 0 {
+		return []byte{}
+	}
+	return websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+}
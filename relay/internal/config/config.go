@@ -3,7 +3,10 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
+
+	"haven/internal/ratelimit"
 )
 
 // Config holds all configuration options
@@ -11,6 +14,10 @@ type Config struct {
 	// Server port
 	Port string
 
+	// Listen address of the Prometheus /metrics endpoint, kept off the public
+	// port (default: localhost:9098; empty disables it)
+	MetricsAddr string
+
 	// Database configuration
 	DB DatabaseConfig
 
@@ -25,6 +32,56 @@ type Config struct {
 
 	// Cleanup interval - how often to run cleanup job (default: 1 hour)
 	CleanupInterval time.Duration
+
+	// Attachment configuration
+	Attachments AttachmentConfig
+
+	// Rate limits per connection and per user
+	RateLimits RateLimitConfig
+
+	// Content filter configuration
+	Moderation ModerationConfig
+
+	// Usernames allowed to resolve any report and mute or ban server-wide,
+	// resolved to accounts at startup (requires the database)
+	ServerAdmins []string
+
+	// Bearer token for the admin HTTP API (default: none, which disables the API)
+	AdminToken string
+
+	// Log output configuration
+	Log LogConfig
+}
+
+// LogConfig holds logging settings
+type LogConfig struct {
+	Format string // "text" or "json" (default: text)
+	Level  string // "debug", "info", "warn" or "error" (default: info)
+}
+
+// ModerationConfig holds content filter settings
+type ModerationConfig struct {
+	RulesFile string // JSON file of word and pattern rules (default: none)
+	MaxLength int    // Longest message in characters, unless the rules file sets one (default: 4000)
+}
+
+// RateLimitConfig holds the token-bucket limits of each kind of request
+// Limits are written "count/duration", e.g. "20/20s"; "off" disables one
+type RateLimitConfig struct {
+	ConnMessages      ratelimit.Limit // Messages, edits and reactions per connection (default: 20/20s)
+	UserMessages      ratelimit.Limit // Messages, edits and reactions per user (default: 30/20s)
+	ConnRoomCreates   ratelimit.Limit // Room creations per connection (default: 5/1m)
+	UserRoomCreates   ratelimit.Limit // Room creations per user (default: 10/1h)
+	ConnRegistrations ratelimit.Limit // Registration attempts per connection (default: 5/1m)
+	ConnHistory       ratelimit.Limit // History, sync and search requests per connection (default: 30/1m)
+	UserHistory       ratelimit.Limit // History, sync and search requests per user (default: 60/1m)
+}
+
+// AttachmentConfig holds file upload settings
+type AttachmentConfig struct {
+	Dir     string // Directory of the local blob store
+	MaxSize int64  // Largest single file in bytes (default: 10 MB)
+	Quota   int64  // Total stored per user in bytes (default: 200 MB)
 }
 
 // DatabaseConfig holds PostgreSQL connection settings
@@ -42,7 +99,8 @@ type DatabaseConfig struct {
 // Load reads configuration from environment variables with defaults
 func Load() *Config {
 	return &Config{
-		Port: getEnv("PORT", "9088"),
+		Port:        getEnv("PORT", "9088"),
+		MetricsAddr: getEnvDefault("METRICS_ADDR", "localhost:9098"),
 		DB: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
 			Port:     getEnv("DB_PORT", "5432"),
@@ -57,6 +115,30 @@ func Load() *Config {
 		RoomInactivityTimeout: getDurationEnv("ROOM_INACTIVITY_TIMEOUT", 7*24*time.Hour),
 		MessageRetention:      getDurationEnv("MESSAGE_RETENTION", 365*24*time.Hour),
 		CleanupInterval:       getDurationEnv("CLEANUP_INTERVAL", 1*time.Hour),
+		Attachments: AttachmentConfig{
+			Dir:     getEnv("ATTACHMENT_DIR", "data/attachments"),
+			MaxSize: int64(getIntEnv("ATTACHMENT_MAX_SIZE_MB", 10)) << 20,
+			Quota:   int64(getIntEnv("ATTACHMENT_QUOTA_MB", 200)) << 20,
+		},
+		RateLimits: RateLimitConfig{
+			ConnMessages:      getLimitEnv("RATE_LIMIT_CONN_MESSAGES", ratelimit.Limit{Burst: 20, Per: 20 * time.Second}),
+			UserMessages:      getLimitEnv("RATE_LIMIT_USER_MESSAGES", ratelimit.Limit{Burst: 30, Per: 20 * time.Second}),
+			ConnRoomCreates:   getLimitEnv("RATE_LIMIT_CONN_ROOM_CREATES", ratelimit.Limit{Burst: 5, Per: time.Minute}),
+			UserRoomCreates:   getLimitEnv("RATE_LIMIT_USER_ROOM_CREATES", ratelimit.Limit{Burst: 10, Per: time.Hour}),
+			ConnRegistrations: getLimitEnv("RATE_LIMIT_CONN_REGISTRATIONS", ratelimit.Limit{Burst: 5, Per: time.Minute}),
+			ConnHistory:       getLimitEnv("RATE_LIMIT_CONN_HISTORY", ratelimit.Limit{Burst: 30, Per: time.Minute}),
+			UserHistory:       getLimitEnv("RATE_LIMIT_USER_HISTORY", ratelimit.Limit{Burst: 60, Per: time.Minute}),
+		},
+		Moderation: ModerationConfig{
+			RulesFile: getEnv("MODERATION_RULES_FILE", ""),
+			MaxLength: getIntEnv("MAX_MESSAGE_LENGTH", 4000),
+		},
+		ServerAdmins: getListEnv("SERVER_ADMINS"),
+		AdminToken:   getEnv("ADMIN_TOKEN", ""),
+		Log: LogConfig{
+			Format: getEnv("LOG_FORMAT", "text"),
+			Level:  getEnv("LOG_LEVEL", "info"),
+		},
 	}
 }
 
@@ -67,6 +149,26 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvDefault is getEnv, except that a variable set to the empty string
+// overrides the default
+func getEnvDefault(key, defaultValue string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// getListEnv reads a comma-separated list, skipping empty entries
+func getListEnv(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func getIntEnv(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if i, err := strconv.Atoi(value); err == nil {
@@ -89,3 +191,12 @@ func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getLimitEnv(key string, defaultValue ratelimit.Limit) ratelimit.Limit {
+	if value := os.Getenv(key); value != "" {
+		if limit, err := ratelimit.ParseLimit(value); err == nil {
+			return limit
+		}
+	}
+	return defaultValue
+}
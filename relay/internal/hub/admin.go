@@ -0,0 +1,405 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/logging"
+	"haven/internal/protocol"
+	"haven/internal/room"
+	"haven/internal/storage/postgres"
+)
+
+const (
+	// Users or rooms returned by an admin listing by default and at most
+	defaultAdminListLimit = 50
+	maxAdminListLimit     = 500
+)
+
+// adminActor is who admin API operations are attributed to in notifications
+// The name is not a valid username, so it can't be mistaken for a user
+var adminActor = protocol.UserInfo{Username: "Server admin"}
+
+// adminListLimit clamps the requested size of an admin listing
+func adminListLimit(limit int) int {
+	if limit <= 0 {
+		return defaultAdminListLimit
+	}
+	return min(limit, maxAdminListLimit)
+}
+
+// AdminUsers lists users whose username contains query, ignoring case, in
+// alphabetical order. Without persistent storage only online users are known.
+func (h *Hub) AdminUsers(query string, limit int) ([]protocol.AdminUser, error) {
+	limit = adminListLimit(limit)
+
+	if h.userStore == nil {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+
+		needle := strings.ToLower(query)
+		users := make([]protocol.AdminUser, 0)
+		for username, userID := range h.usernames {
+			if strings.Contains(strings.ToLower(username), needle) {
+				users = append(users, h.adminUserLocked(userID, username))
+			}
+		}
+		sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+		if len(users) > limit {
+			users = users[:limit]
+		}
+		return users, nil
+	}
+
+	stored, err := h.userStore.Search(context.Background(), query, limit)
+	if err != nil {
+		slog.Error("Failed to search users", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	users := make([]protocol.AdminUser, len(stored))
+	for i, u := range stored {
+		users[i] = h.adminUserLocked(u.ID, u.Username)
+		users[i].CreatedAt = u.CreatedAt.UnixMilli()
+		users[i].LastSeenAt = u.LastSeenAt.UnixMilli()
+	}
+	return users, nil
+}
+
+// adminUserLocked describes a user's live connections and server ban
+// Must be called with h.mu held
+func (h *Hub) adminUserLocked(userID, username string) protocol.AdminUser {
+	connections := make([]string, 0)
+	for _, c := range h.sessionsLocked(userID) {
+		connections = append(connections, c.ID)
+	}
+	sort.Strings(connections)
+
+	return protocol.AdminUser{
+		UserID:      userID,
+		Username:    username,
+		Connections: connections,
+		Banned:      h.sanctionedLocked(postgres.SanctionBan, userID, ""),
+	}
+}
+
+// AdminRooms lists rooms whose name contains query, ignoring case, or whose
+// ID is query, in alphabetical order. Private rooms are included.
+func (h *Hub) AdminRooms(query string, limit int) []protocol.AdminRoom {
+	limit = adminListLimit(limit)
+	needle := strings.ToLower(query)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	rooms := make([]protocol.AdminRoom, 0)
+	for id, r := range h.rooms {
+		info := r.Info()
+		if id != query && !strings.Contains(strings.ToLower(info.Name), needle) {
+			continue
+		}
+		online := 0
+		for _, memberID := range r.MemberList() {
+			if len(h.sessions[memberID]) > 0 {
+				online++
+			}
+		}
+		rooms = append(rooms, protocol.AdminRoom{RoomInfo: info, OnlineCount: online})
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		if rooms[i].Name != rooms[j].Name {
+			return rooms[i].Name < rooms[j].Name
+		}
+		return rooms[i].RoomID < rooms[j].RoomID
+	})
+	if len(rooms) > limit {
+		rooms = rooms[:limit]
+	}
+	return rooms
+}
+
+// DisconnectUser closes every connection of an online user
+// Returns the number of connections closed
+func (h *Hub) DisconnectUser(username string) (int, error) {
+	h.mu.RLock()
+	userID, online := h.usernames[username]
+	sessions := h.sessionsLocked(userID)
+	h.mu.RUnlock()
+
+	if !online || len(sessions) == 0 {
+		return 0, &Error{Code: protocol.ErrCodeUserNotFound, Message: "User is not connected"}
+	}
+
+	h.disconnect(sessions, "Disconnected by an administrator")
+	slog.Info("Admin disconnected user", "user_id", userID, "username", username, "connections", len(sessions))
+	return len(sessions), nil
+}
+
+// DisconnectClient closes a single connection, registered or not
+func (h *Hub) DisconnectClient(clientID string) error {
+	h.mu.RLock()
+	c, ok := h.clients[clientID]
+	h.mu.RUnlock()
+
+	if !ok {
+		return &Error{Code: protocol.ErrCodeUserNotFound, Message: "Connection not found"}
+	}
+
+	h.disconnect([]*client.Client{c}, "Disconnected by an administrator")
+	slog.InfoContext(c.LogContext(), "Admin disconnected connection")
+	return nil
+}
+
+// disconnect tells connections why they are being closed and removes them
+// Must be called without h.mu held
+func (h *Hub) disconnect(conns []*client.Client, reason string) {
+	for _, c := range conns {
+		_ = c.SendMessage(protocol.TypeKicked, protocol.KickedPayload{Reason: reason})
+		h.RemoveClient(c)
+	}
+}
+
+// DeleteRoom deletes a room with its members, messages and invites
+func (h *Hub) DeleteRoom(roomID string) error {
+	h.mu.RLock()
+	_, exists := h.rooms[roomID]
+	h.mu.RUnlock()
+	if !exists {
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+
+	ctx := logging.With(context.Background(), "room_id", roomID)
+
+	if h.roomStore != nil {
+		if err := h.roomStore.Delete(ctx, roomID); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete room", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to delete room"}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r, ok := h.rooms[roomID]; ok {
+		h.dropRoomLocked(r)
+		slog.InfoContext(ctx, "Admin deleted room", "room_name", r.Name)
+	}
+	return nil
+}
+
+// PruneDeletedRooms forgets rooms that are no longer in storage, e.g. after
+// a cleanup run. Returns the number of rooms forgotten.
+func (h *Hub) PruneDeletedRooms(ctx context.Context) (int, error) {
+	if h.roomStore == nil {
+		return 0, nil
+	}
+
+	storedRooms, err := h.roomStore.GetAll(ctx)
+	if err != nil {
+		return 0, err
+	}
+	storedIDs := make(map[string]bool, len(storedRooms))
+	for _, r := range storedRooms {
+		storedIDs[r.ID] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pruned := 0
+	for id, r := range h.rooms {
+		if !storedIDs[id] {
+			h.dropRoomLocked(r)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// ApplyCleanup brings the hub in line with a cleanup run: deleted rooms are
+// forgotten, and deleted users leave their rooms, which hand ownership to the
+// longest-standing remaining member as storage did. Their invites, sanctions
+// and blocks, given or received, go with them, and any connection they still
+// have is closed.
+func (h *Hub) ApplyCleanup(ctx context.Context, stats *postgres.CleanupStats) {
+	if stats.RoomsDeleted > 0 {
+		if _, err := h.PruneDeletedRooms(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to prune deleted rooms", "err", err)
+		}
+	}
+	if len(stats.DeletedUserIDs) == 0 {
+		return
+	}
+
+	deleted := make(map[string]bool, len(stats.DeletedUserIDs))
+	var disconnect []*client.Client
+
+	h.mu.Lock()
+	for _, userID := range stats.DeletedUserIDs {
+		deleted[userID] = true
+		for _, r := range h.rooms {
+			if r.HasMember(userID) {
+				h.removeDeletedMemberLocked(r, userID)
+			}
+			r.RemoveInvite(userID)
+		}
+		delete(h.blocks, userID)
+		delete(h.admins, userID)
+		disconnect = append(disconnect, h.sessionsLocked(userID)...)
+	}
+	for key := range h.sanctions {
+		if deleted[key.userID] {
+			delete(h.sanctions, key)
+		}
+	}
+	for _, list := range h.blocks {
+		for blockedID := range list {
+			if deleted[blockedID] {
+				delete(list, blockedID)
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	h.disconnect(disconnect, "Account deleted")
+}
+
+// removeDeletedMemberLocked removes a deleted user from a room, promoting a
+// new owner if they owned it, and notifies the remaining members
+// Must be called with h.mu held
+func (h *Hub) removeDeletedMemberLocked(r *room.Room, userID string) {
+	user := h.memberInfoLocked(r, userID)
+	wasOwner := r.Role(userID) == room.RoleOwner
+	r.RemoveMember(userID)
+	h.stopTypingLocked(typingKey(userID, r.ID, ""))
+
+	h.broadcastToRoomLocked(r.ID, "", protocol.TypeRoomMembers, protocol.RoomMembersPayload{
+		RoomID:  r.ID,
+		Action:  "left",
+		User:    user,
+		Members: h.roomMembersLocked(r),
+	})
+
+	if !wasOwner {
+		return
+	}
+	successor, ok := r.LongestStandingMember()
+	if !ok {
+		return
+	}
+	r.SetRole(successor, room.RoleOwner)
+	h.broadcastToRoomLocked(r.ID, "", protocol.TypeRoomMembers, protocol.RoomMembersPayload{
+		RoomID:  r.ID,
+		Action:  "owner_changed",
+		User:    h.memberInfoLocked(r, successor),
+		Members: h.roomMembersLocked(r),
+	})
+}
+
+// dropRoomLocked forgets a room that is gone from storage and tells its
+// members, or everyone for a public room, that it no longer exists
+// Must be called with h.mu held
+func (h *Hub) dropRoomLocked(r *room.Room) {
+	delete(h.rooms, r.ID)
+	payload := protocol.RoomDeletedPayload{RoomID: r.ID, RoomName: r.Name}
+
+	for _, memberID := range r.MemberList() {
+		h.stopTypingLocked(typingKey(memberID, r.ID, ""))
+		for _, c := range h.sessionsLocked(memberID) {
+			c.LeaveRoom(r.ID)
+			if !r.IsPublic {
+				_ = c.SendMessage(protocol.TypeRoomDeleted, payload)
+			}
+		}
+	}
+	if r.IsPublic {
+		h.broadcastLocked("", protocol.TypeRoomDeleted, payload)
+	}
+}
+
+// AdminDeleteMessage deletes a room message regardless of who sent it
+func (h *Hub) AdminDeleteMessage(roomID, messageID string) error {
+	notFound := &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	if h.messageStore == nil {
+		return notFound
+	}
+	if _, err := uuid.Parse(messageID); err != nil {
+		return notFound
+	}
+
+	ctx := logging.With(context.Background(), "room_id", roomID, "message_id", messageID)
+
+	msg, err := h.messageStore.GetByID(ctx, messageID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get message", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to delete message"}
+	}
+	if msg == nil || msg.RoomID != roomID || msg.IsDeleted() {
+		return notFound
+	}
+
+	if err := h.redactRoomMessage(ctx, roomID, messageID, adminActor.UserID, adminActor.Username); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Admin deleted message")
+	return nil
+}
+
+// BanUser bans a user from the server and disconnects them
+// A zero duration makes the ban permanent
+func (h *Hub) BanUser(username string, duration time.Duration, reason string) error {
+	if utf8.RuneCountInString(reason) > maxReportTextLength {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Reason must be at most 1000 characters"}
+	}
+
+	ctx := context.Background()
+
+	userID, err := h.resolveUserID(ctx, username)
+	if err != nil {
+		return err
+	}
+	return h.applySanction(ctx, postgres.SanctionBan, userID, "", duration, reason, adminActor)
+}
+
+// UnbanUser lifts a user's server-wide ban
+func (h *Hub) UnbanUser(username string) error {
+	ctx := context.Background()
+
+	userID, err := h.resolveUserID(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	removed := false
+	if h.userStore != nil {
+		removed, err = h.userStore.RemoveSanction(ctx, userID, "", postgres.SanctionBan)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to remove sanction", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to lift ban"}
+		}
+	}
+
+	h.mu.Lock()
+	key := sanctionKey{postgres.SanctionBan, userID, ""}
+	if _, ok := h.sanctions[key]; ok {
+		removed = true
+		delete(h.sanctions, key)
+	}
+	h.mu.Unlock()
+
+	if !removed {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "User is not banned"}
+	}
+	slog.InfoContext(ctx, "Admin lifted ban", "user_id", userID, "username", username)
+	return nil
+}
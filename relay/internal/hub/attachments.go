@@ -0,0 +1,381 @@
+package hub
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"haven/internal/blob"
+	"haven/internal/client"
+	"haven/internal/logging"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+const (
+	// Random bytes in an HTTP auth token (base64url encoded on the wire)
+	authTokenBytes = 32
+
+	// Most attachments a single message may carry
+	maxAttachmentsPerMessage = 10
+
+	// Longest attachment filename, in characters
+	maxFilenameLength = 255
+
+	// Bytes examined to detect an upload's content type
+	sniffLength = 512
+
+	// Random bytes in the key signing attachment URLs
+	urlKeyBytes = 32
+
+	// How long a signed attachment URL can be used
+	attachmentURLLifetime = time.Hour
+)
+
+// allowedAttachmentTypes lists the content types users may upload
+// Types are detected from the file contents, not taken from the client
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"application/zip": true,
+	"video/mp4":       true,
+	"video/webm":      true,
+	"audio/mpeg":      true,
+	"audio/wave":      true,
+	"application/ogg": true,
+}
+
+// AttachmentLimits bounds what users may upload
+type AttachmentLimits struct {
+	MaxSize int64 // Largest single file, in bytes
+	Quota   int64 // Total size of a user's stored attachments, in bytes
+}
+
+// SetBlobStore enables attachments, keeping their contents in store
+// Attachments also need message storage
+func (h *Hub) SetBlobStore(store blob.Store, limits AttachmentLimits) {
+	h.blobs = store
+	h.limits = limits
+}
+
+// IssueAuthToken creates the token a registered connection uses to
+// authenticate HTTP requests. The token is valid until the connection closes.
+func (h *Hub) IssueAuthToken(c *client.Client) (string, error) {
+	if c.Username == "" {
+		return "", &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	b := make([]byte, authTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.authTokens, c.AuthToken)
+	c.AuthToken = token
+	h.authTokens[token] = c.ID
+	return token, nil
+}
+
+// Authenticate returns the live connection an HTTP auth token belongs to
+func (h *Hub) Authenticate(token string) (*client.Client, bool) {
+	if token == "" {
+		return nil, false
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	c, ok := h.clients[h.authTokens[token]]
+	return c, ok
+}
+
+// UploadAttachment stores a file for the client to send to a room
+// The attachment stays pending until it is sent with a room message
+func (h *Hub) UploadAttachment(c *client.Client, roomID, filename string, body io.Reader) (*protocol.AttachmentInfo, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if h.blobs == nil || h.messageStore == nil || c.UserID == "" {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Attachments are not available"}
+	}
+
+	h.mu.RLock()
+	_, err := h.authorizeHistoryLocked(roomID, c.UserID)
+	h.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	filename = strings.TrimSpace(filepath.Base(filename))
+	if filename == "." || filename == string(filepath.Separator) || filename == "" {
+		filename = "file"
+	}
+	if utf8.RuneCountInString(filename) > maxFilenameLength {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Filename must be at most 255 characters"}
+	}
+
+	// Detect the type from the first bytes, then put them back in front of the rest
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to read upload"}
+	}
+	if n == 0 {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "File is empty"}
+	}
+	head = head[:n]
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !allowedAttachmentTypes[contentType] {
+		return nil, &Error{Code: protocol.ErrCodeUnsupportedFile, Message: "File type is not allowed"}
+	}
+
+	ctx := logContext(c, roomID)
+
+	// An early look at the quota bounds how much of the upload is read; the
+	// insert checks it again as other uploads may finish meanwhile
+	usage, err := h.messageStore.AttachmentUsage(ctx, c.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get attachment usage", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to store attachment"}
+	}
+	allowance := min(h.limits.MaxSize, h.limits.Quota-usage)
+	if allowance <= 0 {
+		return nil, &Error{Code: protocol.ErrCodeQuotaExceeded, Message: "Attachment quota exceeded"}
+	}
+
+	// Read one byte past the allowance to tell a file that just fits from one that doesn't
+	id := uuid.New().String()
+	size, err := h.blobs.Put(ctx, id, io.LimitReader(io.MultiReader(bytes.NewReader(head), body), allowance+1))
+	if err != nil {
+		_ = h.blobs.Delete(ctx, id)
+		slog.ErrorContext(ctx, "Failed to store attachment", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to store attachment"}
+	}
+	if size > allowance {
+		_ = h.blobs.Delete(ctx, id)
+		if size > h.limits.MaxSize {
+			return nil, &Error{Code: protocol.ErrCodeFileTooLarge, Message: "File is too large"}
+		}
+		return nil, &Error{Code: protocol.ErrCodeQuotaExceeded, Message: "Attachment quota exceeded"}
+	}
+
+	a, err := h.messageStore.SaveAttachment(ctx, &postgres.Attachment{
+		ID:          id,
+		UploaderID:  c.UserID,
+		RoomID:      roomID,
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        size,
+	}, h.limits.Quota)
+	if err != nil {
+		_ = h.blobs.Delete(ctx, id)
+		slog.ErrorContext(ctx, "Failed to save attachment", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to store attachment"}
+	}
+	if a == nil {
+		_ = h.blobs.Delete(ctx, id)
+		return nil, &Error{Code: protocol.ErrCodeQuotaExceeded, Message: "Attachment quota exceeded"}
+	}
+
+	info := h.attachmentToProtocol(a)
+	return &info, nil
+}
+
+// OpenAttachment returns an attachment and its contents for download
+// Sent attachments are visible to room members; pending ones only to their uploader
+// The caller must close the returned reader
+func (h *Hub) OpenAttachment(c *client.Client, id string) (*protocol.AttachmentInfo, io.ReadSeekCloser, error) {
+	if c.Username == "" {
+		return nil, nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	notFound := &Error{Code: protocol.ErrCodeFileNotFound, Message: "Attachment not found"}
+	if h.blobs == nil || h.messageStore == nil || c.UserID == "" {
+		return nil, nil, notFound
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil, notFound
+	}
+
+	ctx := c.LogContext()
+
+	a, err := h.messageStore.GetAttachment(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get attachment", "err", err)
+		return nil, nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch attachment"}
+	}
+	if a == nil || (a.MessageID == "" && a.UploaderID != c.UserID) {
+		return nil, nil, notFound
+	}
+
+	h.mu.RLock()
+	_, err = h.authorizeHistoryLocked(a.RoomID, c.UserID)
+	h.mu.RUnlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return h.openAttachment(ctx, a)
+}
+
+// OpenSignedAttachment returns an attachment and its contents for download
+// through a signed URL, which needs no further authentication until it expires
+// The caller must close the returned reader
+func (h *Hub) OpenSignedAttachment(id string, expires int64, signature string) (*protocol.AttachmentInfo, io.ReadSeekCloser, error) {
+	notFound := &Error{Code: protocol.ErrCodeFileNotFound, Message: "Attachment not found"}
+	if h.blobs == nil || h.messageStore == nil {
+		return nil, nil, notFound
+	}
+	if time.Now().Unix() > expires || !hmac.Equal([]byte(signature), []byte(h.signAttachmentURL(id, expires))) {
+		return nil, nil, &Error{Code: protocol.ErrCodePermissionDenied, Message: "Invalid or expired link"}
+	}
+
+	ctx := logging.With(context.Background(), "attachment_id", id)
+
+	a, err := h.messageStore.GetAttachment(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get attachment", "err", err)
+		return nil, nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch attachment"}
+	}
+	if a == nil {
+		return nil, nil, notFound
+	}
+
+	return h.openAttachment(ctx, a)
+}
+
+// openAttachment opens the contents of an attachment the caller may see
+func (h *Hub) openAttachment(ctx context.Context, a *postgres.Attachment) (*protocol.AttachmentInfo, io.ReadSeekCloser, error) {
+	r, err := h.blobs.Open(ctx, a.ID)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, nil, &Error{Code: protocol.ErrCodeFileNotFound, Message: "Attachment not found"}
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to open attachment", "err", err)
+		return nil, nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch attachment"}
+	}
+
+	info := h.attachmentToProtocol(a)
+	return &info, r, nil
+}
+
+// checkAttachments verifies that attachments can be sent with a new message:
+// they must be the sender's own pending uploads to the same room
+func (h *Hub) checkAttachments(ctx context.Context, roomID, senderID string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if h.blobs == nil || h.messageStore == nil {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Attachments are not available"}
+	}
+	if len(ids) > maxAttachmentsPerMessage {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "A message can have at most 10 attachments"}
+	}
+
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		notFound := &Error{Code: protocol.ErrCodeFileNotFound, Message: "Attachment not found"}
+		if _, err := uuid.Parse(id); err != nil || seen[id] {
+			return notFound
+		}
+		seen[id] = true
+
+		a, err := h.messageStore.GetAttachment(ctx, id)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get attachment", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch attachment"}
+		}
+		if a == nil || a.MessageID != "" || a.RoomID != roomID || a.UploaderID != senderID {
+			return notFound
+		}
+	}
+	return nil
+}
+
+// attachAttachments fills in the attachments of a batch of room messages
+func (h *Hub) attachAttachments(ctx context.Context, messages []protocol.IncomingRoomMessage) {
+	if h.messageStore == nil || len(messages) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if !m.Deleted {
+			ids = append(ids, m.MessageID)
+		}
+	}
+
+	attachments, err := h.messageStore.GetAttachments(ctx, ids)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get attachments", "err", err)
+		return
+	}
+
+	for i := range messages {
+		if list, ok := attachments[messages[i].MessageID]; ok {
+			messages[i].Attachments = h.attachmentsToProtocol(list)
+		}
+	}
+}
+
+// attachmentToProtocol converts a stored attachment to its wire format, with
+// a freshly signed download URL
+func (h *Hub) attachmentToProtocol(a *postgres.Attachment) protocol.AttachmentInfo {
+	expires := time.Now().Add(attachmentURLLifetime).Unix()
+	return protocol.AttachmentInfo{
+		ID:          a.ID,
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		URL: "/attachments/" + a.ID + "?expires=" + strconv.FormatInt(expires, 10) +
+			"&sig=" + h.signAttachmentURL(a.ID, expires),
+	}
+}
+
+// attachmentsToProtocol converts a list of stored attachments to their wire format
+func (h *Hub) attachmentsToProtocol(list []*postgres.Attachment) []protocol.AttachmentInfo {
+	infos := make([]protocol.AttachmentInfo, len(list))
+	for i, a := range list {
+		infos[i] = h.attachmentToProtocol(a)
+	}
+	return infos
+}
+
+// signAttachmentURL computes the signature of a download URL for an attachment
+func (h *Hub) signAttachmentURL(id string, expires int64) string {
+	mac := hmac.New(sha256.New, h.urlKey)
+	mac.Write([]byte(id + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newURLKey creates the key signing attachment URLs
+// Each process has its own, so URLs signed before a restart stop working
+func newURLKey() []byte {
+	key := make([]byte, urlKeyBytes)
+	_, _ = rand.Read(key) // Never fails
+	return key
+}
@@ -0,0 +1,215 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+)
+
+// blockList maps blocked userIDs to their block list entries
+type blockList map[string]protocol.BlockedUser
+
+// BlockUser adds a user to the client's block list. Their direct messages to
+// the client are dropped and their room messages are no longer delivered to
+// any of the client's sessions.
+func (h *Hub) BlockUser(c *client.Client, username string) error {
+	return h.setBlocked(c, username, true)
+}
+
+// UnblockUser removes a user from the client's block list
+func (h *Hub) UnblockUser(c *client.Client, username string) error {
+	return h.setBlocked(c, username, false)
+}
+
+// setBlocked blocks or unblocks a user and tells all of the client's sessions
+func (h *Hub) setBlocked(c *client.Client, username string, block bool) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+	if username == c.Username {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Cannot block yourself"}
+	}
+
+	ctx := c.LogContext()
+
+	targetID, err := h.resolveUserID(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	changed := true
+	if h.userStore != nil {
+		if block {
+			changed, err = h.userStore.Block(ctx, c.UserID, targetID)
+		} else {
+			changed, err = h.userStore.Unblock(ctx, c.UserID, targetID)
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to update block list", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to update block list"}
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	blocked, ok := h.blocks[c.UserID]
+	if !ok {
+		// Connection closed meanwhile
+		return nil
+	}
+	_, wasBlocked := blocked[targetID]
+	if block && !wasBlocked {
+		blocked[targetID] = protocol.BlockedUser{
+			UserID:    targetID,
+			Username:  username,
+			BlockedAt: time.Now().UnixMilli(),
+		}
+	} else if !block {
+		delete(blocked, targetID)
+	}
+	if !changed || block == wasBlocked {
+		return nil
+	}
+
+	msgType := protocol.TypeUserBlocked
+	if !block {
+		msgType = protocol.TypeUserUnblocked
+	}
+	h.sendToUserLocked(c.UserID, "", msgType, protocol.UserBlockedPayload{
+		UserID:   targetID,
+		Username: username,
+	})
+	return nil
+}
+
+// GetBlockList returns the users the client has blocked, most recent first
+func (h *Hub) GetBlockList(c *client.Client) ([]protocol.BlockedUser, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	list := make([]protocol.BlockedUser, 0, len(h.blocks[c.UserID]))
+	for _, b := range h.blocks[c.UserID] {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].BlockedAt > list[j].BlockedAt
+	})
+	return list, nil
+}
+
+// resolveUserID returns the ID of a user, who may be offline
+func (h *Hub) resolveUserID(ctx context.Context, username string) (string, error) {
+	h.mu.RLock()
+	userID, online := h.usernames[username]
+	h.mu.RUnlock()
+	if online {
+		return userID, nil
+	}
+
+	if h.userStore == nil {
+		return "", &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	}
+	user, err := h.userStore.GetByUsername(ctx, username)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get user", "err", err)
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	if user == nil {
+		return "", &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	}
+	return user.ID, nil
+}
+
+// loadBlocksLocked caches the block list of a user who just came online
+// Must be called with h.mu held
+func (h *Hub) loadBlocksLocked(userID string) {
+	blocked := make(blockList)
+	h.blocks[userID] = blocked
+
+	if h.userStore == nil {
+		return
+	}
+	list, err := h.userStore.GetBlocked(context.Background(), userID)
+	if err != nil {
+		slog.Error("Failed to get block list", "user_id", userID, "err", err)
+		return
+	}
+	for _, b := range list {
+		blocked[b.UserID] = protocol.BlockedUser{
+			UserID:    b.UserID,
+			Username:  b.Username,
+			BlockedAt: b.BlockedAt.UnixMilli(),
+		}
+	}
+}
+
+// hasBlockedLocked reports whether an online user has blocked another user
+// Must be called with h.mu held
+func (h *Hub) hasBlockedLocked(blockerID, blockedID string) bool {
+	_, blocked := h.blocks[blockerID][blockedID]
+	return blocked
+}
+
+// broadcastFromUserLocked sends a room event caused by a user, such as their
+// message, edit or reaction, to every device of the room's members except
+// members who blocked that user
+// Must be called with h.mu held
+func (h *Hub) broadcastFromUserLocked(roomID, fromID string, msgType protocol.MessageType, payload interface{}) {
+	r, exists := h.rooms[roomID]
+	if !exists {
+		return
+	}
+	for _, memberUserID := range r.MemberList() {
+		if h.hasBlockedLocked(memberUserID, fromID) {
+			continue
+		}
+		h.sendToUserLocked(memberUserID, "", msgType, payload)
+	}
+}
+
+// hasBlocked reports whether a user, who may be offline, has blocked another user
+func (h *Hub) hasBlocked(ctx context.Context, blockerID, blockedID string) bool {
+	h.mu.RLock()
+	list, cached := h.blocks[blockerID]
+	_, blocked := list[blockedID]
+	h.mu.RUnlock()
+	if cached || h.userStore == nil {
+		return blocked
+	}
+
+	blocked, err := h.userStore.IsBlocked(ctx, blockerID, blockedID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to check block list", "err", err)
+		return false
+	}
+	return blocked
+}
+
+// dropBlockedDirectMessage answers the sender of a direct message to someone
+// who blocked them as if it had been delivered, without storing or delivering
+// it, so the block isn't revealed
+func (h *Hub) dropBlockedDirectMessage(from *client.Client, fromClients []*client.Client, msg protocol.IncomingDirectMessage) error {
+	msg.MessageID = uuid.New().String()
+	msg.Timestamp = protocol.NewEnvelopeTimestamp()
+
+	h.stopTyping(typingKey(msg.FromID, "", msg.To))
+
+	if msg.ClientMsgID != "" {
+		_ = from.SendMessage(protocol.TypeDirectMsg, msg)
+	}
+	for _, fc := range fromClients {
+		_ = fc.SendMessage(protocol.TypeDirectMsg, msg)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/moderation"
+	"haven/internal/protocol"
+	"haven/internal/room"
+)
+
+// EditRoomMessage replaces the content of a room message and notifies room members
+// Only the original sender or a room moderator may edit a message
+func (h *Hub) EditRoomMessage(c *client.Client, roomID, messageID, content string) error {
+	if content == "" {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Message content cannot be empty"}
+	}
+
+	memberID, err := h.authorizeMessageChange(c, roomID, messageID)
+	if err != nil {
+		return err
+	}
+
+	// Editing would let a muted user post new content
+	if h.isMuted(memberID, roomID) {
+		return &Error{Code: protocol.ErrCodeMuted, Message: "You are muted in this room"}
+	}
+
+	// Edits go through the same filters as new messages, but can't be held
+	// for review as the original is already visible
+	verdict, err := h.moderate(moderation.Message{RoomID: roomID, SenderID: memberID, Content: content})
+	if err != nil {
+		return err
+	}
+	if verdict.Action == moderation.Quarantine {
+		return &Error{Code: protocol.ErrCodeMessageRejected, Message: "Message blocked by content filter", Reason: verdict.Reason}
+	}
+	content = verdict.Content
+
+	ctx := logContext(c, roomID)
+	edited, err := h.messageStore.Edit(ctx, messageID, memberID, content)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to edit message", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to edit message"}
+	}
+	if edited == nil {
+		// Deleted concurrently
+		return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.broadcastFromUserLocked(roomID, memberID, protocol.TypeMessageEdited, protocol.MessageEditedPayload{
+		RoomID:    roomID,
+		MessageID: messageID,
+		Content:   edited.Content,
+		EditedBy:  memberID,
+		EditedAt:  edited.EditedAt.UnixMilli(),
+	})
+
+	return nil
+}
+
+// DeleteRoomMessage redacts a room message and notifies room members
+// Only the original sender or a room moderator may delete a message
+func (h *Hub) DeleteRoomMessage(c *client.Client, roomID, messageID string) error {
+	memberID, err := h.authorizeMessageChange(c, roomID, messageID)
+	if err != nil {
+		return err
+	}
+
+	return h.redactRoomMessage(context.Background(), roomID, messageID, memberID, c.Username)
+}
+
+// redactRoomMessage deletes a message on behalf of memberID, unpins it and
+// notifies room members
+func (h *Hub) redactRoomMessage(ctx context.Context, roomID, messageID, memberID, username string) error {
+	redacted, err := h.messageStore.Redact(ctx, messageID, memberID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to delete message", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to delete message"}
+	}
+	if redacted == nil {
+		// Deleted concurrently
+		return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	// A deleted message can't stay pinned
+	var pinsUpdate *protocol.RoomPinsUpdatedPayload
+	if unpinned, err := h.messageStore.UnpinMessage(ctx, roomID, messageID); err != nil {
+		slog.ErrorContext(ctx, "Failed to unpin deleted message", "err", err)
+	} else if unpinned {
+		update := h.pinsUpdate(ctx, roomID, "unpinned", messageID, memberID, username)
+		pinsUpdate = &update
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.broadcastToRoomLocked(roomID, "", protocol.TypeMessageDeleted, protocol.MessageDeletedPayload{
+		RoomID:    roomID,
+		MessageID: messageID,
+		DeletedBy: memberID,
+		DeletedAt: redacted.DeletedAt.UnixMilli(),
+	})
+	if pinsUpdate != nil {
+		h.broadcastToRoomLocked(roomID, "", protocol.TypeRoomPinsUpdated, *pinsUpdate)
+	}
+
+	return nil
+}
+
+// authorizeMessageChange checks that the client may modify a message in a room
+// Returns the client's member ID
+func (h *Hub) authorizeMessageChange(c *client.Client, roomID, messageID string) (string, error) {
+	if c.Username == "" {
+		return "", &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, exists := h.rooms[roomID]
+	if !exists {
+		h.mu.RUnlock()
+		return "", &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if !r.HasMember(memberID) {
+		h.mu.RUnlock()
+		return "", &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	canModerate := room.RoleAtLeast(r.Role(memberID), permModerate)
+	h.mu.RUnlock()
+
+	// Messages only exist in storage; without it there is nothing to change
+	if h.messageStore == nil {
+		return "", &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	if _, err := uuid.Parse(messageID); err != nil {
+		return "", &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	ctx := logContext(c, roomID)
+	msg, err := h.messageStore.GetByID(ctx, messageID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get message", "err", err)
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	if msg == nil || msg.RoomID != roomID || msg.IsDeleted() {
+		return "", &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	if msg.SenderID != memberID && !canModerate {
+		return "", &Error{Code: protocol.ErrCodePermissionDenied, Message: "Only the sender or a moderator can change this message"}
+	}
+
+	return memberID, nil
+}
@@ -2,7 +2,7 @@ package hub
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"regexp"
 	"sync"
 	"time"
@@ -10,44 +10,73 @@ import (
 	"github.com/google/uuid"
 
 	"haven/internal/auth"
+	"haven/internal/blob"
 	"haven/internal/client"
+	"haven/internal/logging"
+	"haven/internal/moderation"
 	"haven/internal/protocol"
+	"haven/internal/ratelimit"
 	"haven/internal/room"
 	"haven/internal/storage/postgres"
 )
 
 var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{3,20}$`)
 var roomNameRegex = regexp.MustCompile(`^.{1,50}$`)
+var roomTopicRegex = regexp.MustCompile(`^.{0,250}$`)
+var roomDescriptionRegex = regexp.MustCompile(`(?s)^.{0,1000}$`)
 
 // Hub maintains the set of active clients and rooms
 type Hub struct {
-	clients      map[string]*client.Client // clientID -> Client
-	usernames    map[string]string         // username -> clientID
-	userIDs      map[string]string         // db userID -> clientID (for looking up online users by DB ID)
-	rooms        map[string]*room.Room     // roomID -> Room
-	roomStore    *postgres.RoomStore       // persistent room storage
-	userStore    *postgres.UserStore       // persistent user storage
-	memberStore  *postgres.MemberStore     // persistent room membership
-	messageStore *postgres.MessageStore    // persistent room messages
+	clients      map[string]*client.Client    // clientID -> Client
+	usernames    map[string]string            // username -> db userID of online users
+	sessions     map[string]map[string]bool   // db userID -> live connection IDs (a user may be connected from several devices)
+	rooms        map[string]*room.Room        // roomID -> Room
+	roomStore    *postgres.RoomStore          // persistent room storage
+	userStore    *postgres.UserStore          // persistent user storage
+	memberStore  *postgres.MemberStore        // persistent room membership
+	messageStore *postgres.MessageStore       // persistent room messages
+	dmStore      *postgres.DirectMessageStore // persistent direct messages
+	blobs        blob.Store                   // attachment contents (nil disables attachments)
+	limits       AttachmentLimits             // attachment size and quota limits
+	authTokens   map[string]string            // HTTP auth token -> clientID
+	urlKey       []byte                       // signs attachment download URLs
+	typing       map[string]*typingState      // typing key -> active indicator (never persisted)
+	presence     map[string]*presenceState    // userID -> presence of connected users (never persisted)
+	rateLimits   map[string]*rateLimiter      // rate limit class -> buckets (set once at startup)
+	strikes      *ratelimit.Limiter           // rate limit rejections per connection before disconnecting
+	moderation   *moderation.Pipeline         // content filters for new and edited messages (nil accepts everything)
+	blocks       map[string]blockList         // online userID -> users they blocked
+	admins       map[string]bool              // user IDs of server admins
+	sanctions    map[sanctionKey]time.Time    // mutes and bans -> expiry (zero = permanent)
 	mu           sync.RWMutex
+	typingMu     sync.Mutex // guards typing; acquire after mu, never before
+	presenceMu   sync.Mutex // guards presence; acquire after mu, never before
 }
 
 // New creates a new Hub
 func New() *Hub {
 	return &Hub{
-		clients:   make(map[string]*client.Client),
-		usernames: make(map[string]string),
-		userIDs:   make(map[string]string),
-		rooms:     make(map[string]*room.Room),
+		clients:    make(map[string]*client.Client),
+		usernames:  make(map[string]string),
+		sessions:   make(map[string]map[string]bool),
+		rooms:      make(map[string]*room.Room),
+		typing:     make(map[string]*typingState),
+		presence:   make(map[string]*presenceState),
+		authTokens: make(map[string]string),
+		urlKey:     newURLKey(),
+		blocks:     make(map[string]blockList),
+		admins:     make(map[string]bool),
+		sanctions:  make(map[sanctionKey]time.Time),
 	}
 }
 
 // SetStores sets all storage backends
-func (h *Hub) SetStores(roomStore *postgres.RoomStore, userStore *postgres.UserStore, memberStore *postgres.MemberStore, messageStore *postgres.MessageStore) {
+func (h *Hub) SetStores(roomStore *postgres.RoomStore, userStore *postgres.UserStore, memberStore *postgres.MemberStore, messageStore *postgres.MessageStore, dmStore *postgres.DirectMessageStore) {
 	h.roomStore = roomStore
 	h.userStore = userStore
 	h.memberStore = memberStore
 	h.messageStore = messageStore
+	h.dmStore = dmStore
 }
 
 // LoadRooms loads persisted rooms from storage and restores membership
@@ -68,23 +97,28 @@ func (h *Hub) LoadRooms() error {
 
 	for _, data := range storedRooms {
 		r := room.New(data.ID, data.Name, data.CreatorID, data.CreatorUsername, data.IsPublic)
+		r.Topic = data.Topic
+		r.Description = data.Description
 
 		// Load persisted members for this room
 		if h.memberStore != nil {
 			members, err := h.memberStore.GetRoomMembers(ctx, data.ID)
 			if err != nil {
-				log.Printf("Failed to load members for room %s: %v", data.ID, err)
+				slog.ErrorContext(ctx, "Failed to load room members", "room_id", data.ID, "err", err)
 			} else {
+				// The creator may have left or been deleted since; trust storage
+				r.RemoveMember(data.CreatorID)
 				for _, m := range members {
-					r.AddMember(m.UserID, m.Username)
+					r.RestoreMember(m.UserID, m.Username, m.Role, m.JoinedAt)
 				}
 			}
+			h.loadInvitesLocked(ctx, r)
 		}
 
 		h.rooms[data.ID] = r
 	}
 
-	log.Printf("Loaded %d rooms from storage", len(storedRooms))
+	slog.InfoContext(ctx, "Loaded rooms from storage", "rooms", len(storedRooms))
 	return nil
 }
 
@@ -103,20 +137,9 @@ func (h *Hub) CleanupInactiveRooms(threshold time.Duration) (int, error) {
 
 	if count > 0 {
 		// Remove from in-memory map as well
-		h.mu.Lock()
-		storedRooms, _ := h.roomStore.GetAll(ctx)
-		storedIDs := make(map[string]bool)
-		for _, r := range storedRooms {
-			storedIDs[r.ID] = true
-		}
-		for id := range h.rooms {
-			if !storedIDs[id] {
-				delete(h.rooms, id)
-			}
-		}
-		h.mu.Unlock()
+		_, _ = h.PruneDeletedRooms(ctx)
 
-		log.Printf("Cleaned up %d inactive rooms", count)
+		slog.InfoContext(ctx, "Cleaned up inactive rooms", "rooms", count)
 	}
 
 	return count, nil
@@ -130,6 +153,7 @@ func (h *Hub) AddClient(c *client.Client) {
 }
 
 // RemoveClient removes a client from the hub
+// The user goes offline only when their last connection closes.
 // NOTE: We intentionally do NOT remove users from rooms on disconnect.
 // Users remain room members even when offline. They are only removed
 // from rooms via explicit LeaveRoom calls.
@@ -137,24 +161,64 @@ func (h *Hub) RemoveClient(c *client.Client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	if !h.dropClientLocked(c) {
+		// Already removed, e.g. signed out by another session
+		return
+	}
+	if c.Username == "" || !h.removeSessionLocked(c) {
+		return
+	}
+
+	// Invisible users already look offline
+	invisible := h.stopPresenceLocked(c.UserID)
+
 	// Broadcast user_left to all (this notifies that user is offline)
-	if c.Username != "" {
-		userIDForBroadcast := c.UserID
-		if userIDForBroadcast == "" {
-			userIDForBroadcast = c.ID // Fallback for non-DB mode
-		}
+	if !invisible {
 		h.broadcastLocked(c.ID, protocol.TypeUserLeft, protocol.UserLeftPayload{
-			UserID:   userIDForBroadcast,
+			UserID:   c.UserID,
 			Username: c.Username,
 		})
-		delete(h.usernames, c.Username)
-	}
-	if c.UserID != "" {
-		delete(h.userIDs, c.UserID)
 	}
+	h.clearUserTypingLocked(c.UserID)
+}
 
-	delete(h.clients, c.ID)
+// dropClientLocked closes a connection and forgets it, along with its auth
+// token and rate limits; its session is left to the caller
+// Returns false if the connection was already dropped
+// Must be called with h.mu held
+func (h *Hub) dropClientLocked(c *client.Client) bool {
 	c.Close()
+	if _, ok := h.clients[c.ID]; !ok {
+		return false
+	}
+	delete(h.clients, c.ID)
+	delete(h.authTokens, c.AuthToken)
+	h.resetRateLimits(c.ID)
+	return true
+}
+
+// Stats counts what the hub holds in memory
+type Stats struct {
+	Clients     int // Open connections, registered or not
+	Sessions    int // Registered connections
+	OnlineUsers int // Users with at least one registered connection
+	Rooms       int
+}
+
+// Stats returns the hub's current counts
+func (h *Hub) Stats() Stats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	stats := Stats{
+		Clients:     len(h.clients),
+		OnlineUsers: len(h.sessions),
+		Rooms:       len(h.rooms),
+	}
+	for _, sessions := range h.sessions {
+		stats.Sessions += len(sessions)
+	}
+	return stats
 }
 
 // RegisterResult contains the result of a registration attempt
@@ -176,7 +240,7 @@ func (h *Hub) RegisterUser(c *client.Client, username, fingerprint, recoveryCode
 		fingerprintHash = auth.HashValue(fingerprint)
 	}
 
-	ctx := context.Background()
+	ctx := c.LogContext()
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -185,7 +249,7 @@ func (h *Hub) RegisterUser(c *client.Client, username, fingerprint, recoveryCode
 	if h.userStore != nil {
 		existingUser, err := h.userStore.GetByUsername(ctx, username)
 		if err != nil {
-			log.Printf("Failed to get user: %v", err)
+			slog.ErrorContext(ctx, "Failed to get user", "err", err)
 			return &RegisterResult{Error: &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}}
 		}
 
@@ -224,21 +288,21 @@ func (h *Hub) RegisterUser(c *client.Client, username, fingerprint, recoveryCode
 		// New user - generate recovery code and save
 		newRecoveryCode, err := auth.GenerateRecoveryCode()
 		if err != nil {
-			log.Printf("Failed to generate recovery code: %v", err)
+			slog.ErrorContext(ctx, "Failed to generate recovery code", "err", err)
 			return &RegisterResult{Error: &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to generate recovery code"}}
 		}
 
 		newUser, err := h.userStore.Create(ctx, username, fingerprintHash, auth.HashValue(newRecoveryCode))
 		if err != nil {
-			log.Printf("Failed to save user: %v", err)
+			slog.ErrorContext(ctx, "Failed to save user", "err", err)
 			return &RegisterResult{Error: &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to save user"}}
 		}
 
 		// Complete registration - set both UserID (DB) and maintain mappings
 		c.UserID = newUser.ID
 		c.Username = username
-		h.usernames[username] = c.ID
-		h.userIDs[c.UserID] = c.ID
+		h.addSessionLocked(c)
+		h.startPresenceLocked(c.UserID)
 
 		// Broadcast user_joined (use UserID for consistency with room membership)
 		h.broadcastLocked(c.ID, protocol.TypeUserJoined, protocol.UserJoinedPayload{
@@ -261,8 +325,8 @@ func (h *Hub) RegisterUser(c *client.Client, username, fingerprint, recoveryCode
 	// In non-DB mode, use connection ID as UserID for consistency
 	c.UserID = c.ID
 	c.Username = username
-	h.usernames[username] = c.ID
-	h.userIDs[c.UserID] = c.ID
+	h.addSessionLocked(c)
+	h.startPresenceLocked(c.UserID)
 
 	// Broadcast user_joined
 	h.broadcastLocked(c.ID, protocol.TypeUserJoined, protocol.UserJoinedPayload{
@@ -273,39 +337,31 @@ func (h *Hub) RegisterUser(c *client.Client, username, fingerprint, recoveryCode
 	return &RegisterResult{Success: true}
 }
 
-// loginExistingUserLocked handles login for an existing user, kicking any imposter
+// loginExistingUserLocked handles login for an existing user. The connection
+// is added to the user's sessions; other devices stay connected (see
+// KickOtherSessions to sign them out).
 // Must be called with h.mu held
 func (h *Hub) loginExistingUserLocked(ctx context.Context, c *client.Client, username string, userData *postgres.User) *RegisterResult {
-	// Check if someone else is using this username
-	if existingClientID, online := h.usernames[username]; online && existingClientID != c.ID {
-		// Kick the imposter
-		if imposter, ok := h.clients[existingClientID]; ok {
-			_ = imposter.SendMessage(protocol.TypeKicked, protocol.KickedPayload{
-				Reason: "The account owner has logged in from another device",
-			})
-			// Clean up imposter
-			delete(h.usernames, username)
-			if imposter.UserID != "" {
-				delete(h.userIDs, imposter.UserID)
-			}
-			// Note: We don't remove imposter from rooms - room membership persists
-			imposter.Close()
-			delete(h.clients, existingClientID)
-			log.Printf("Kicked imposter %s for username %s", existingClientID, username)
-		}
+	if h.sanctionedLocked(postgres.SanctionBan, userData.ID, "") {
+		return &RegisterResult{Error: &Error{Code: protocol.ErrCodeBanned, Message: "This account is banned"}}
 	}
 
 	// Register this client - set both UserID (DB) and maintain mappings
 	c.UserID = userData.ID
 	c.Username = username
-	h.usernames[username] = c.ID
-	h.userIDs[c.UserID] = c.ID
+	first := h.addSessionLocked(c)
 
 	// Update last seen
 	if h.userStore != nil {
 		go func() { _ = h.userStore.UpdateLastSeen(context.Background(), userData.ID) }()
 	}
 
+	if !first {
+		// Already online from another device - presence carries over
+		return &RegisterResult{Success: true, IsNewUser: false}
+	}
+	h.startPresenceLocked(c.UserID)
+
 	// Broadcast user_joined (use UserID for consistency with room membership)
 	h.broadcastLocked(c.ID, protocol.TypeUserJoined, protocol.UserJoinedPayload{
 		UserID:   c.UserID,
@@ -315,27 +371,37 @@ func (h *Hub) loginExistingUserLocked(ctx context.Context, c *client.Client, use
 	return &RegisterResult{Success: true, IsNewUser: false}
 }
 
-// GetUserList returns list of online users
+// GetUserList returns list of online users with their presence
+// Invisible users are left out
 func (h *Hub) GetUserList() []protocol.UserInfo {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	users := make([]protocol.UserInfo, 0, len(h.usernames))
-	for username, clientID := range h.usernames {
-		userID := clientID // Default to connection ID
-		if c, ok := h.clients[clientID]; ok && c.UserID != "" {
-			userID = c.UserID // Use DB user ID if available
-		}
+	for username, userID := range h.usernames {
 		users = append(users, protocol.UserInfo{
 			UserID:   userID,
 			Username: username,
 		})
 	}
-	return users
+
+	users = h.withPresenceLocked(users)
+	visible := users[:0]
+	for _, u := range users {
+		if u.Presence != PresenceOffline {
+			visible = append(visible, u)
+		}
+	}
+	return visible
 }
 
-// GetRoomList returns list of rooms (public rooms + rooms user is member of)
+// GetRoomList returns list of rooms (public rooms, rooms the user is member of
+// and private rooms they are invited to)
+// Rooms the user belongs to include their unread count
 func (h *Hub) GetRoomList(c *client.Client) []protocol.RoomInfo {
+	// Load unread counts before taking the lock (database round trip)
+	readStates := h.readStatesFor(c)
+
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
@@ -346,45 +412,244 @@ func (h *Hub) GetRoomList(c *client.Client) []protocol.RoomInfo {
 
 	rooms := make([]protocol.RoomInfo, 0)
 	for _, r := range h.rooms {
-		if r.IsPublic || r.HasMember(memberID) {
-			rooms = append(rooms, r.Info())
+		invited := r.HasInvite(memberID)
+		if r.IsPublic || invited || r.HasMember(memberID) {
+			info := r.Info()
+			info.Invited = invited
+			applyReadState(&info, readStates[r.ID])
+			rooms = append(rooms, info)
 		}
 	}
 	return rooms
 }
 
 // SendDirectMessage sends a DM from one user to another
-func (h *Hub) SendDirectMessage(from *client.Client, toUsername, content string) error {
+// If the recipient is registered but offline, the message is stored and
+// delivered the next time they log in (see DeliverPendingDirectMessages).
+// If clientMsgID is set, the stored message is echoed back to the sender so
+// it can confirm the send; a retry with the same key is echoed again but not
+// stored or delivered twice.
+func (h *Hub) SendDirectMessage(from *client.Client, toUsername, content, clientMsgID string) error {
 	if from.Username == "" {
 		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
 	}
 
+	if len(clientMsgID) > maxClientMsgIDLength {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "client_msg_id too long"}
+	}
+
+	fromID := from.UserID
+	if fromID == "" {
+		fromID = from.ID // Fallback for non-DB mode
+	}
+
+	if h.isMuted(fromID, "") {
+		return &Error{Code: protocol.ErrCodeMuted, Message: "You are muted"}
+	}
+
+	verdict, err := h.moderate(moderation.Message{SenderID: fromID, Content: content})
+	if err != nil {
+		return err
+	}
+	content = verdict.Content
+	if verdict.Action == moderation.Quarantine {
+		return h.holdDirectMessage(from, fromID, toUsername, content, clientMsgID, verdict.Reason)
+	}
+
+	// The message goes to every device of the recipient, and to the sender's
+	// other devices so the conversation stays in sync
 	h.mu.RLock()
-	toClientID, exists := h.usernames[toUsername]
-	if !exists {
-		h.mu.RUnlock()
-		return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	toID, online := h.usernames[toUsername]
+	var toClients, fromClients []*client.Client
+	if online {
+		toClients = h.sessionsLocked(toID)
+	}
+	for _, fc := range h.sessionsLocked(fromID) {
+		if fc.ID != from.ID {
+			fromClients = append(fromClients, fc)
+		}
 	}
-	toClient := h.clients[toClientID]
 	h.mu.RUnlock()
 
-	if toClient == nil {
-		return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	msg := protocol.IncomingDirectMessage{
+		From:        from.Username,
+		FromID:      fromID,
+		To:          toUsername,
+		Content:     content,
+		ClientMsgID: clientMsgID,
 	}
 
-	fromID := from.UserID
-	if fromID == "" {
-		fromID = from.ID // Fallback for non-DB mode
+	if h.dmStore != nil && h.userStore != nil {
+		ctx := from.LogContext()
+
+		// Resolve the recipient's database ID (they may be offline)
+		if !online {
+			recipient, err := h.userStore.GetByUsername(ctx, toUsername)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to get user", "err", err)
+				return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+			}
+			if recipient == nil {
+				return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+			}
+			toID = recipient.ID
+		}
+		msg.ToID = toID
+
+		if h.hasBlocked(ctx, toID, fromID) {
+			return h.dropBlockedDirectMessage(from, fromClients, msg)
+		}
+
+		savedMsg, created, err := h.dmStore.Save(ctx, fromID, from.Username, toID, toUsername, content, clientMsgID, online)
+		if err == nil && !created {
+			// Retry of a message we already have - just confirm it again
+			if savedMsg.RecipientID != toID {
+				return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "client_msg_id already used"}
+			}
+			return from.SendMessage(protocol.TypeDirectMsg, directMessageToProtocol(savedMsg))
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to save direct message", "err", err)
+			if !online {
+				// Nothing we can do for an offline recipient without storage
+				return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to store message"}
+			}
+			// Continue anyway - message will still be delivered in real-time
+			msg.MessageID = uuid.New().String()
+			msg.Timestamp = protocol.NewEnvelopeTimestamp()
+		} else {
+			msg.MessageID = savedMsg.ID
+			msg.Timestamp = savedMsg.CreatedAt.UnixMilli()
+		}
+	} else {
+		if !online {
+			return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+		}
+		msg.ToID = toID
+		if h.hasBlocked(context.Background(), toID, fromID) {
+			return h.dropBlockedDirectMessage(from, fromClients, msg)
+		}
+		msg.MessageID = uuid.New().String()
+		msg.Timestamp = protocol.NewEnvelopeTimestamp()
 	}
 
-	messageID := uuid.New().String()
-	return toClient.SendMessage(protocol.TypeDirectMsg, protocol.IncomingDirectMessage{
-		MessageID: messageID,
-		From:      from.Username,
-		FromID:    fromID,
-		Content:   content,
-		Timestamp: protocol.NewEnvelopeTimestamp(),
-	})
+	// Sending a message ends the sender's typing indicator
+	h.stopTyping(typingKey(fromID, "", toUsername))
+
+	if clientMsgID != "" {
+		_ = from.SendMessage(protocol.TypeDirectMsg, msg)
+	}
+	for _, fc := range fromClients {
+		_ = fc.SendMessage(protocol.TypeDirectMsg, msg)
+	}
+
+	// Offline recipients get the stored message when they next log in
+	for _, tc := range toClients {
+		_ = tc.SendMessage(protocol.TypeDirectMsg, msg)
+	}
+	return nil
+}
+
+// DeliverPendingDirectMessages sends any direct messages that were stored while
+// the client's user was offline, then marks them as delivered
+func (h *Hub) DeliverPendingDirectMessages(c *client.Client) {
+	if h.dmStore == nil || c.UserID == "" {
+		return
+	}
+
+	ctx := c.LogContext()
+	pending, err := h.dmStore.GetUndelivered(ctx, c.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get pending direct messages", "err", err)
+		return
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	delivered := make([]string, 0, len(pending))
+	for _, m := range pending {
+		msg := directMessageToProtocol(m)
+		msg.Offline = true
+		if err := c.SendMessage(protocol.TypeDirectMsg, msg); err != nil {
+			slog.WarnContext(ctx, "Failed to deliver direct message", "message_id", m.ID, "err", err)
+			continue
+		}
+		delivered = append(delivered, m.ID)
+	}
+
+	if err := h.dmStore.MarkDelivered(ctx, delivered); err != nil {
+		slog.ErrorContext(ctx, "Failed to mark direct messages delivered", "err", err)
+	}
+}
+
+// GetDirectMessageHistory retrieves the conversation between the client and another user
+func (h *Hub) GetDirectMessageHistory(c *client.Client, withUsername string, limit int, before time.Time) (*protocol.DMHistoryResponsePayload, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if h.dmStore == nil || h.userStore == nil {
+		return &protocol.DMHistoryResponsePayload{
+			With:     withUsername,
+			Messages: []protocol.IncomingDirectMessage{},
+			HasMore:  false,
+		}, nil
+	}
+
+	ctx := c.LogContext()
+
+	peer, err := h.userStore.GetByUsername(ctx, withUsername)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get user", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch history"}
+	}
+	if peer == nil {
+		return nil, &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	}
+
+	// Default limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	// Fetch one extra to detect if there are more messages
+	messages, err := h.dmStore.GetConversation(ctx, c.UserID, peer.ID, limit+1, before)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get direct message history", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch history"}
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	// Messages are returned newest first, reverse them so oldest is first
+	protoMessages := make([]protocol.IncomingDirectMessage, len(messages))
+	for i, msg := range messages {
+		protoMessages[len(messages)-1-i] = directMessageToProtocol(msg)
+	}
+
+	return &protocol.DMHistoryResponsePayload{
+		With:     peer.Username,
+		Messages: protoMessages,
+		HasMore:  hasMore,
+	}, nil
+}
+
+// directMessageToProtocol converts a stored direct message to its wire format
+func directMessageToProtocol(m *postgres.DirectMessage) protocol.IncomingDirectMessage {
+	return protocol.IncomingDirectMessage{
+		MessageID:   m.ID,
+		From:        m.SenderUsername,
+		FromID:      m.SenderID,
+		To:          m.RecipientUsername,
+		ToID:        m.RecipientID,
+		Content:     m.Content,
+		Timestamp:   m.CreatedAt.UnixMilli(),
+		ClientMsgID: m.ClientMsgID,
+	}
 }
 
 // CreateRoom creates a new room
@@ -403,7 +668,7 @@ func (h *Hub) CreateRoom(c *client.Client, name string, isPublic bool) (*room.Ro
 		creatorID = c.ID
 	}
 
-	ctx := context.Background()
+	ctx := c.LogContext()
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -414,7 +679,7 @@ func (h *Hub) CreateRoom(c *client.Client, name string, isPublic bool) (*room.Ro
 	if h.roomStore != nil {
 		storedRoom, err := h.roomStore.Create(ctx, name, creatorID, c.Username, isPublic)
 		if err != nil {
-			log.Printf("Failed to create room in database: %v", err)
+			slog.ErrorContext(ctx, "Failed to create room in database", "err", err)
 			return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to create room"}
 		}
 		roomID = storedRoom.ID
@@ -444,7 +709,9 @@ func (h *Hub) CreateRoom(c *client.Client, name string, isPublic bool) (*room.Ro
 }
 
 // JoinRoom adds a client to a room
-func (h *Hub) JoinRoom(c *client.Client, roomID string) (*room.Room, error) {
+// Private rooms can only be joined with a pending invitation or a usable
+// invite token; with a token, roomID may be empty
+func (h *Hub) JoinRoom(c *client.Client, roomID, inviteToken string) (*room.Room, error) {
 	if c.Username == "" {
 		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
 	}
@@ -455,11 +722,19 @@ func (h *Hub) JoinRoom(c *client.Client, roomID string) (*room.Room, error) {
 		memberID = c.ID
 	}
 
-	ctx := context.Background()
+	ctx := logContext(c, roomID)
+	now := time.Now()
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	if roomID == "" && inviteToken != "" {
+		roomID = h.roomForTokenLocked(inviteToken, now)
+		if roomID == "" {
+			return nil, &Error{Code: protocol.ErrCodeInvalidInvite, Message: "Invite is invalid or expired"}
+		}
+	}
+
 	r, exists := h.rooms[roomID]
 	if !exists {
 		return nil, &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
@@ -471,20 +746,48 @@ func (h *Hub) JoinRoom(c *client.Client, roomID string) (*room.Room, error) {
 		return r, nil
 	}
 
+	if h.sanctionedLocked(postgres.SanctionBan, memberID, roomID) {
+		return nil, &Error{Code: protocol.ErrCodeBanned, Message: "You are banned from this room"}
+	}
+
+	// A pending invitation is used up before any token
+	invited := r.RemoveInvite(memberID)
+	redeemed := false
+	if !r.IsPublic && !invited {
+		if inviteToken == "" {
+			return nil, &Error{Code: protocol.ErrCodeInviteRequired, Message: "This room requires an invitation"}
+		}
+		if !r.RedeemToken(inviteToken, now) {
+			return nil, &Error{Code: protocol.ErrCodeInvalidInvite, Message: "Invite is invalid or expired"}
+		}
+		redeemed = true
+	}
+
 	r.AddMember(memberID, c.Username)
 	c.JoinRoom(roomID)
+	for _, session := range h.sessionsLocked(memberID) {
+		session.JoinRoom(roomID)
+	}
 
-	// Persist membership
+	// Persist membership and invite bookkeeping
 	if h.memberStore != nil {
-		go func() { _, _ = h.memberStore.Add(ctx, roomID, memberID, c.Username) }()
+		go func() {
+			_, _ = h.memberStore.Add(ctx, roomID, memberID, c.Username)
+			if invited {
+				_ = h.memberStore.DeleteInvite(ctx, roomID, memberID)
+			}
+			if redeemed {
+				_, _ = h.memberStore.UseInviteToken(ctx, inviteToken)
+			}
+		}()
 	}
 
 	// Notify other members
 	h.broadcastToRoomLocked(roomID, c.ID, protocol.TypeRoomMembers, protocol.RoomMembersPayload{
 		RoomID:  roomID,
 		Action:  "joined",
-		User:    protocol.UserInfo{UserID: memberID, Username: c.Username},
-		Members: r.MemberInfoList(),
+		User:    h.memberInfoLocked(r, memberID),
+		Members: h.roomMembersLocked(r),
 	})
 
 	return r, nil
@@ -498,7 +801,7 @@ func (h *Hub) LeaveRoom(c *client.Client, roomID string) error {
 		memberID = c.ID
 	}
 
-	ctx := context.Background()
+	ctx := logContext(c, roomID)
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -512,12 +815,30 @@ func (h *Hub) LeaveRoom(c *client.Client, roomID string) error {
 		return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
 	}
 
+	wasOwner := r.Role(memberID) == room.RoleOwner
 	r.RemoveMember(memberID)
 	c.LeaveRoom(roomID)
+	for _, session := range h.sessionsLocked(memberID) {
+		session.LeaveRoom(roomID)
+	}
+
+	// An owner leaving hands the room to the longest-standing member
+	var successor string
+	if wasOwner {
+		if id, ok := r.LongestStandingMember(); ok {
+			r.SetRole(id, room.RoleOwner)
+			successor = id
+		}
+	}
 
 	// Remove from persistent membership
 	if h.memberStore != nil {
-		go func() { _ = h.memberStore.Remove(ctx, roomID, memberID) }()
+		go func() {
+			_ = h.memberStore.Remove(ctx, roomID, memberID)
+			if successor != "" {
+				_, _ = h.memberStore.SetRole(ctx, roomID, successor, room.RoleOwner)
+			}
+		}()
 	}
 
 	// Notify other members
@@ -525,26 +846,50 @@ func (h *Hub) LeaveRoom(c *client.Client, roomID string) error {
 		RoomID:  roomID,
 		Action:  "left",
 		User:    protocol.UserInfo{UserID: memberID, Username: c.Username},
-		Members: r.MemberInfoList(),
+		Members: h.roomMembersLocked(r),
 	})
+	if successor != "" {
+		owner := h.memberInfoLocked(r, successor)
+		h.broadcastToRoomLocked(roomID, "", protocol.TypeRoomMembers, protocol.RoomMembersPayload{
+			RoomID:  roomID,
+			Action:  "owner_changed",
+			User:    owner,
+			Members: h.roomMembersLocked(r),
+		})
+	}
 	// Note: We don't delete empty rooms immediately - the cleanup routine handles this based on inactivity
 
 	return nil
 }
 
+// maxClientMsgIDLength is the longest idempotency key a client may supply
+const maxClientMsgIDLength = 64
+
+// MessageOptions holds optional attributes of an outgoing room message
+type MessageOptions struct {
+	ReplyTo     string   // Message being replied to
+	ThreadID    string   // Thread root to post into
+	ClientMsgID string   // Idempotency key; a retry with the same key is not stored twice
+	Attachments []string // Pending uploads to send with the message
+}
+
 // SendRoomMessage sends a message to all room members
-func (h *Hub) SendRoomMessage(from *client.Client, roomID, content string) error {
+func (h *Hub) SendRoomMessage(from *client.Client, roomID, content string, opts MessageOptions) error {
 	if from.Username == "" {
 		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
 	}
 
+	if len(opts.ClientMsgID) > maxClientMsgIDLength {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "client_msg_id too long"}
+	}
+
 	// Use database UserID for persistence, fall back to connection ID
 	senderID := from.UserID
 	if senderID == "" {
 		senderID = from.ID
 	}
 
-	ctx := context.Background()
+	ctx := logContext(from, roomID)
 
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -558,20 +903,109 @@ func (h *Hub) SendRoomMessage(from *client.Client, roomID, content string) error
 		return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
 	}
 
+	if h.sanctionedLocked(postgres.SanctionMute, senderID, roomID) {
+		return &Error{Code: protocol.ErrCodeMuted, Message: "You are muted in this room"}
+	}
+
+	thread, err := h.resolveThread(ctx, roomID, opts.ReplyTo, opts.ThreadID)
+	if err != nil {
+		return err
+	}
+	thread.ClientMsgID = opts.ClientMsgID
+
+	if err := h.checkAttachments(ctx, roomID, senderID, opts.Attachments); err != nil {
+		return err
+	}
+
+	verdict, err := h.moderate(moderation.Message{
+		RoomID:         roomID,
+		SenderID:       senderID,
+		Content:        content,
+		HasAttachments: len(opts.Attachments) > 0,
+	})
+	if err != nil {
+		return err
+	}
+	content = verdict.Content
+	if verdict.Action == moderation.Quarantine {
+		return h.holdMessage(ctx, from, &postgres.QuarantinedMessage{
+			RoomID:         roomID,
+			SenderID:       senderID,
+			SenderUsername: from.Username,
+			Content:        content,
+			Reason:         verdict.Reason,
+			ThreadID:       thread.ThreadID,
+			ReplyTo:        thread.ReplyTo,
+			ClientMsgID:    opts.ClientMsgID,
+			AttachmentIDs:  opts.Attachments,
+		}, protocol.MessageHeldPayload{
+			RoomID:      roomID,
+			ClientMsgID: opts.ClientMsgID,
+			Reason:      verdict.Reason,
+		})
+	}
+
+	msg, created, err := h.postRoomMessageLocked(ctx, r, senderID, from.Username, content, thread, opts.Attachments)
+	if err != nil || created {
+		return err
+	}
+	return from.SendMessage(protocol.TypeRoomMessage, msg)
+}
+
+// postRoomMessageLocked stores a room message that passed moderation and sends
+// it to the room's members. If the sender already sent a message with the same
+// client_msg_id, nothing is delivered and the stored message is returned with
+// created false.
+// Must be called with h.mu held
+func (h *Hub) postRoomMessageLocked(ctx context.Context, r *room.Room, senderID, senderUsername, content string, thread postgres.MessageOptions, attachmentIDs []string) (protocol.IncomingRoomMessage, bool, error) {
+	roomID := r.ID
+	mentioned := parseMentions(content, r.MemberInfoList(), senderID)
+
 	var messageID string
 	var timestamp int64
+	var attachments []protocol.AttachmentInfo
 
 	// Persist message to database
 	if h.messageStore != nil {
-		savedMsg, err := h.messageStore.Save(ctx, roomID, senderID, from.Username, content)
+		savedMsg, created, err := h.messageStore.SaveWithOptions(ctx, roomID, senderID, senderUsername, content, thread)
+		if err == nil && !created {
+			// Retry of a message the room already has - only the sender needs it again
+			if savedMsg.RoomID != roomID {
+				return protocol.IncomingRoomMessage{}, false, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "client_msg_id already used"}
+			}
+			retry := []protocol.IncomingRoomMessage{roomMessageToProtocol(savedMsg)}
+			h.attachAttachments(ctx, retry)
+			return retry[0], false, nil
+		}
 		if err != nil {
-			log.Printf("Failed to save message: %v", err)
+			slog.ErrorContext(ctx, "Failed to save message", "err", err)
 			// Continue anyway - message will still be delivered in real-time
 			messageID = uuid.New().String()
 			timestamp = protocol.NewEnvelopeTimestamp()
 		} else {
 			messageID = savedMsg.ID
 			timestamp = savedMsg.CreatedAt.UnixMilli()
+
+			linked, err := h.messageStore.LinkAttachments(ctx, savedMsg.ID, roomID, senderID, attachmentIDs)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to link attachments", "err", err)
+			}
+			if len(linked) > 0 {
+				attachments = h.attachmentsToProtocol(linked)
+			}
+
+			// The sender has read everything up to their own message
+			if h.memberStore != nil {
+				go func() { _, _ = h.memberStore.MarkRead(context.Background(), roomID, senderID, savedMsg.ID) }()
+			}
+
+			if len(mentioned) > 0 {
+				userIDs := make([]string, len(mentioned))
+				for i, user := range mentioned {
+					userIDs[i] = user.UserID
+				}
+				go func() { _ = h.messageStore.SaveMentions(context.Background(), savedMsg.ID, userIDs) }()
+			}
 		}
 
 		// Update room activity
@@ -582,25 +1016,28 @@ func (h *Hub) SendRoomMessage(from *client.Client, roomID, content string) error
 	}
 
 	msg := protocol.IncomingRoomMessage{
-		MessageID: messageID,
-		RoomID:    roomID,
-		From:      from.Username,
-		FromID:    senderID,
-		Content:   content,
-		Timestamp: timestamp,
+		MessageID:   messageID,
+		RoomID:      roomID,
+		From:        senderUsername,
+		FromID:      senderID,
+		Content:     content,
+		Timestamp:   timestamp,
+		ThreadID:    thread.ThreadID,
+		ReplyTo:     thread.ReplyTo,
+		ClientMsgID: thread.ClientMsgID,
+		Attachments: attachments,
 	}
 
-	// Send to all members including sender
-	// Room members are tracked by UserID, need to look up connection by UserID
-	for _, memberUserID := range r.MemberList() {
-		if clientID, ok := h.userIDs[memberUserID]; ok {
-			if c, ok := h.clients[clientID]; ok {
-				_ = c.SendMessage(protocol.TypeRoomMessage, msg)
-			}
-		}
-	}
+	// Sending a message ends the sender's typing indicator
+	h.stopTypingLocked(typingKey(senderID, roomID, ""))
 
-	return nil
+	// Send to all members including sender, on every device, except members
+	// who blocked the sender
+	h.broadcastFromUserLocked(roomID, senderID, protocol.TypeRoomMessage, msg)
+
+	h.notifyMentionsLocked(r, mentioned, msg)
+
+	return msg, true, nil
 }
 
 // GetRoom returns a room by ID
@@ -630,20 +1067,14 @@ func (h *Hub) GetRoomHistory(c *client.Client, roomID string, limit int, before
 		}, nil
 	}
 
-	ctx := context.Background()
+	ctx := logContext(c, roomID)
 
 	h.mu.RLock()
-	r, exists := h.rooms[roomID]
-	if !exists {
-		h.mu.RUnlock()
-		return nil, &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
-	}
-
-	if !r.HasMember(memberID) {
-		h.mu.RUnlock()
-		return nil, &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
-	}
+	_, err := h.authorizeHistoryLocked(roomID, memberID)
 	h.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
 
 	// Default limit
 	if limit <= 0 || limit > 100 {
@@ -653,7 +1084,7 @@ func (h *Hub) GetRoomHistory(c *client.Client, roomID string, limit int, before
 	// Fetch one extra to detect if there are more messages
 	messages, err := h.messageStore.GetHistory(ctx, roomID, limit+1, before)
 	if err != nil {
-		log.Printf("Failed to get room history: %v", err)
+		slog.ErrorContext(ctx, "Failed to get room history", "err", err)
 		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch history"}
 	}
 
@@ -666,15 +1097,11 @@ func (h *Hub) GetRoomHistory(c *client.Client, roomID string, limit int, before
 	protoMessages := make([]protocol.IncomingRoomMessage, len(messages))
 	for i, msg := range messages {
 		// Messages are returned newest first, reverse them
-		protoMessages[len(messages)-1-i] = protocol.IncomingRoomMessage{
-			MessageID: msg.ID,
-			RoomID:    msg.RoomID,
-			From:      msg.SenderUsername,
-			FromID:    msg.SenderID,
-			Content:   msg.Content,
-			Timestamp: msg.CreatedAt.UnixMilli(),
-		}
+		protoMessages[len(messages)-1-i] = roomMessageToProtocol(msg)
 	}
+	h.attachReactions(ctx, protoMessages)
+	h.attachAttachments(ctx, protoMessages)
+	h.attachThreadSummaries(ctx, protoMessages)
 
 	return &protocol.RoomHistoryResponsePayload{
 		RoomID:   roomID,
@@ -683,6 +1110,41 @@ func (h *Hub) GetRoomHistory(c *client.Client, roomID string, limit int, before
 	}, nil
 }
 
+// authorizeHistoryLocked checks that a member may read a room's messages
+// Must be called with h.mu held
+func (h *Hub) authorizeHistoryLocked(roomID, memberID string) (*room.Room, error) {
+	r, exists := h.rooms[roomID]
+	if !exists {
+		return nil, &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+
+	if !r.HasMember(memberID) {
+		return nil, &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+
+	return r, nil
+}
+
+// roomMessageToProtocol converts a stored room message to its wire format
+func roomMessageToProtocol(m *postgres.Message) protocol.IncomingRoomMessage {
+	msg := protocol.IncomingRoomMessage{
+		MessageID:   m.ID,
+		RoomID:      m.RoomID,
+		From:        m.SenderUsername,
+		FromID:      m.SenderID,
+		Content:     m.Content,
+		Timestamp:   m.CreatedAt.UnixMilli(),
+		Deleted:     m.IsDeleted(),
+		ThreadID:    m.ThreadID,
+		ReplyTo:     m.ReplyTo,
+		ClientMsgID: m.ClientMsgID,
+	}
+	if m.EditedAt != nil {
+		msg.EditedAt = m.EditedAt.UnixMilli()
+	}
+	return msg
+}
+
 // broadcastLocked sends a message to all registered clients except excludeID
 // Must be called with h.mu held
 func (h *Hub) broadcastLocked(excludeID string, msgType protocol.MessageType, payload interface{}) {
@@ -703,20 +1165,27 @@ func (h *Hub) broadcastToRoomLocked(roomID, excludeConnID string, msgType protoc
 
 	// Room members are tracked by database UserID
 	for _, memberUserID := range r.MemberList() {
-		if clientID, ok := h.userIDs[memberUserID]; ok {
-			if clientID != excludeConnID {
-				if c, ok := h.clients[clientID]; ok {
-					_ = c.SendMessage(msgType, payload)
-				}
-			}
-		}
+		h.sendToUserLocked(memberUserID, excludeConnID, msgType, payload)
+	}
+}
+
+// logContext returns the context for work done on behalf of a client: its
+// log lines carry the client's connection, user and current message, and
+// the room if roomID is set
+func logContext(c *client.Client, roomID string) context.Context {
+	ctx := c.LogContext()
+	if roomID != "" {
+		ctx = logging.With(ctx, "room_id", roomID)
 	}
+	return ctx
 }
 
 // Error represents a hub error
 type Error struct {
-	Code    string
-	Message string
+	Code       string
+	Message    string
+	RetryAfter time.Duration // Set for RATE_LIMITED errors
+	Reason     string        // Content filter reason code, set for MESSAGE_REJECTED errors
 }
 
 func (e *Error) Error() string {
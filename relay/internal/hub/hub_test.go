@@ -1,10 +1,17 @@
 package hub
 
 import (
+	"context"
+	"encoding/json"
+	"strings"
 	"testing"
+	"time"
 
 	"haven/internal/client"
+	"haven/internal/moderation"
 	"haven/internal/protocol"
+	"haven/internal/ratelimit"
+	"haven/internal/storage/postgres"
 )
 
 // mockClient creates a test client without a real WebSocket connection
@@ -21,6 +28,37 @@ func registerUser(t *testing.T, h *Hub, c *client.Client, username string) {
 	}
 }
 
+// drainMessages empties a mock client's send buffer
+func drainMessages(c *client.Client) {
+	for {
+		select {
+		case <-c.Send:
+		default:
+			return
+		}
+	}
+}
+
+// nextMessage returns the next buffered envelope of the given type, skipping others
+func nextMessage(t *testing.T, c *client.Client, msgType protocol.MessageType) *protocol.Envelope {
+	t.Helper()
+	for {
+		select {
+		case data := <-c.Send:
+			var env protocol.Envelope
+			if err := json.Unmarshal(data, &env); err != nil {
+				t.Fatalf("Failed to decode message: %v", err)
+			}
+			if env.Type == msgType {
+				return &env
+			}
+		default:
+			t.Fatalf("Expected a '%s' message, got none", msgType)
+			return nil
+		}
+	}
+}
+
 func TestHub_RegisterUser(t *testing.T) {
 	h := New()
 
@@ -131,7 +169,7 @@ func TestHub_JoinLeaveRoom(t *testing.T) {
 	room, _ := h.CreateRoom(c1, "General", true)
 
 	// Bob joins the room
-	joinedRoom, err := h.JoinRoom(c2, room.ID)
+	joinedRoom, err := h.JoinRoom(c2, room.ID, "")
 	if err != nil {
 		t.Fatalf("Expected successful join, got error: %v", err)
 	}
@@ -140,7 +178,7 @@ func TestHub_JoinLeaveRoom(t *testing.T) {
 	}
 
 	// Bob tries to join again - should succeed silently (for reconnect support)
-	joinedRoom, err = h.JoinRoom(c2, room.ID)
+	joinedRoom, err = h.JoinRoom(c2, room.ID, "")
 	if err != nil {
 		t.Fatalf("Expected silent success for rejoining, got error: %v", err)
 	}
@@ -214,7 +252,7 @@ func TestHub_RemoveClient(t *testing.T) {
 
 	// Alice creates a room, bob joins
 	room, _ := h.CreateRoom(c1, "General", true)
-	_, _ = h.JoinRoom(c2, room.ID)
+	_, _ = h.JoinRoom(c2, room.ID, "")
 
 	// Remove alice (disconnect)
 	h.RemoveClient(c1)
@@ -234,3 +272,1627 @@ func TestHub_RemoveClient(t *testing.T) {
 	h.AddClient(c3)
 	registerUser(t, h, c3, "alice") // Should succeed since Alice disconnected
 }
+
+func TestHub_SendDirectMessage(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+
+	// Must register first
+	if err := h.SendDirectMessage(c1, "bob", "hi", ""); err == nil {
+		t.Fatal("Expected error for unregistered user, got nil")
+	}
+
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	drainMessages(c2)
+
+	if err := h.SendDirectMessage(c1, "bob", "hi bob", ""); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+
+	env := nextMessage(t, c2, protocol.TypeDirectMsg)
+	var msg protocol.IncomingDirectMessage
+	if err := json.Unmarshal(env.Payload, &msg); err != nil {
+		t.Fatalf("Failed to decode direct message: %v", err)
+	}
+	if msg.From != "alice" || msg.To != "bob" || msg.Content != "hi bob" {
+		t.Errorf("Unexpected direct message: %+v", msg)
+	}
+	if msg.MessageID == "" {
+		t.Error("Expected message ID to be set")
+	}
+
+	// Without storage, offline users can't receive messages
+	h.RemoveClient(c2)
+	err := h.SendDirectMessage(c1, "bob", "are you there?", "")
+	if err == nil {
+		t.Fatal("Expected error for offline user without storage, got nil")
+	}
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeUserNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeUserNotFound, err)
+	}
+}
+
+func TestHub_ClientMsgIDEcho(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	drainMessages(c1)
+	drainMessages(c2)
+
+	if err := h.SendRoomMessage(c1, room.ID, "hello", MessageOptions{ClientMsgID: "c-1"}); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+	env := nextMessage(t, c1, protocol.TypeRoomMessage)
+	var roomMsg protocol.IncomingRoomMessage
+	if err := json.Unmarshal(env.Payload, &roomMsg); err != nil {
+		t.Fatalf("Failed to decode room message: %v", err)
+	}
+	if roomMsg.ClientMsgID != "c-1" {
+		t.Errorf("Expected client_msg_id 'c-1', got '%s'", roomMsg.ClientMsgID)
+	}
+
+	// DMs with a key are echoed back to the sender
+	if err := h.SendDirectMessage(c1, "bob", "hi bob", "c-2"); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+	env = nextMessage(t, c1, protocol.TypeDirectMsg)
+	var dm protocol.IncomingDirectMessage
+	if err := json.Unmarshal(env.Payload, &dm); err != nil {
+		t.Fatalf("Failed to decode direct message: %v", err)
+	}
+	if dm.ClientMsgID != "c-2" || dm.To != "bob" {
+		t.Errorf("Unexpected echo: %+v", dm)
+	}
+
+	// Oversized keys are rejected
+	long := strings.Repeat("x", maxClientMsgIDLength+1)
+	err := h.SendRoomMessage(c1, room.ID, "hello", MessageOptions{ClientMsgID: long})
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+}
+
+func TestHub_GetDirectMessageHistoryWithoutStorage(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	h.AddClient(c1)
+
+	if _, err := h.GetDirectMessageHistory(c1, "bob", 10, time.Time{}); err == nil {
+		t.Fatal("Expected error for unregistered user, got nil")
+	}
+
+	registerUser(t, h, c1, "alice")
+
+	resp, err := h.GetDirectMessageHistory(c1, "bob", 10, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected empty history, got error: %v", err)
+	}
+	if len(resp.Messages) != 0 || resp.HasMore {
+		t.Errorf("Expected empty history, got %+v", resp)
+	}
+}
+
+func TestHub_EditDeleteRoomMessageWithoutStorage(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+
+	// Non-members can't change messages
+	err := h.EditRoomMessage(c2, room.ID, "msg-1", "edited")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeNotInRoom {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeNotInRoom, err)
+	}
+
+	// Empty content is rejected
+	err = h.EditRoomMessage(c1, room.ID, "msg-1", "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+
+	// Without storage there are no persisted messages to change
+	err = h.EditRoomMessage(c1, room.ID, "msg-1", "edited")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMessageNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeMessageNotFound, err)
+	}
+	err = h.DeleteRoomMessage(c1, room.ID, "msg-1")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMessageNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeMessageNotFound, err)
+	}
+}
+
+func TestHub_AddReactionValidation(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	h.AddClient(c1)
+
+	if err := h.AddReaction(c1, "room-1", "msg-1", "👍"); err == nil {
+		t.Fatal("Expected error for unregistered user, got nil")
+	}
+
+	registerUser(t, h, c1, "alice")
+	room, _ := h.CreateRoom(c1, "General", true)
+
+	for _, emoji := range []string{"", "thumbs up", "this-reaction-is-far-too-long-to-be-an-emoji"} {
+		err := h.AddReaction(c1, room.ID, "msg-1", emoji)
+		if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+			t.Errorf("Expected error code '%s' for %q, got %v", protocol.ErrCodeInvalidMessage, emoji, err)
+		}
+	}
+
+	// Valid emoji but no persisted message without storage
+	err := h.AddReaction(c1, room.ID, "msg-1", "👍🏽")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMessageNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeMessageNotFound, err)
+	}
+}
+
+func TestHub_SendRoomMessageReply(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	drainMessages(c2)
+
+	if err := h.SendRoomMessage(c1, room.ID, "in a thread", MessageOptions{ReplyTo: "msg-1"}); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+
+	env := nextMessage(t, c2, protocol.TypeRoomMessage)
+	var msg protocol.IncomingRoomMessage
+	if err := json.Unmarshal(env.Payload, &msg); err != nil {
+		t.Fatalf("Failed to decode room message: %v", err)
+	}
+	if msg.ReplyTo != "msg-1" || msg.ThreadID != "msg-1" {
+		t.Errorf("Expected reply in thread 'msg-1', got reply_to=%q thread_id=%q", msg.ReplyTo, msg.ThreadID)
+	}
+
+	// Thread history requires membership
+	c3 := mockClient("client-3")
+	h.AddClient(c3)
+	registerUser(t, h, c3, "carol")
+	_, err := h.GetThreadHistory(c3, room.ID, "msg-1", 10, time.Time{})
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeNotInRoom {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeNotInRoom, err)
+	}
+
+	resp, err := h.GetThreadHistory(c2, room.ID, "msg-1", 10, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected empty thread history, got error: %v", err)
+	}
+	if len(resp.Messages) != 0 {
+		t.Errorf("Expected no messages without storage, got %d", len(resp.Messages))
+	}
+}
+
+func TestHub_SetTyping(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	drainMessages(c1)
+	drainMessages(c2)
+
+	// Exactly one target is required
+	err := h.SetTyping(c1, "", "", false)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+
+	if err := h.SetTyping(c1, room.ID, "", false); err != nil {
+		t.Fatalf("Expected typing to start, got error: %v", err)
+	}
+	nextMessage(t, c2, protocol.TypeTypingStarted)
+	if len(c1.Send) != 0 {
+		t.Error("Expected typing indicator not to be echoed to the typist")
+	}
+
+	// A refresh doesn't produce another event
+	_ = h.SetTyping(c1, room.ID, "", false)
+	if len(c2.Send) != 0 {
+		t.Error("Expected refresh not to be relayed")
+	}
+
+	// Sending a message stops typing
+	_ = h.SendRoomMessage(c1, room.ID, "hello", MessageOptions{})
+	nextMessage(t, c2, protocol.TypeTypingStopped)
+	drainMessages(c1)
+	drainMessages(c2)
+
+	// DM typing goes only to the peer
+	if err := h.SetTyping(c2, "", "alice", false); err != nil {
+		t.Fatalf("Expected DM typing to start, got error: %v", err)
+	}
+	env := nextMessage(t, c1, protocol.TypeTypingStarted)
+	var payload protocol.TypingEventPayload
+	_ = json.Unmarshal(env.Payload, &payload)
+	if payload.Username != "bob" || payload.RoomID != "" {
+		t.Errorf("Unexpected DM typing payload: %+v", payload)
+	}
+
+	_ = h.SetTyping(c2, "", "alice", true)
+	nextMessage(t, c1, protocol.TypeTypingStopped)
+}
+
+func TestHub_MarkRead(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", false)
+
+	// Non-members can't mark a room as read
+	err := h.MarkRead(c2, room.ID, "msg-1")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeNotInRoom {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeNotInRoom, err)
+	}
+
+	_, _ = h.InviteUser(c1, room.ID, "bob")
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	drainMessages(c1)
+	drainMessages(c2)
+
+	if err := h.MarkRead(c2, room.ID, "msg-1"); err != nil {
+		t.Fatalf("Expected successful mark read, got error: %v", err)
+	}
+
+	// Receipt goes to the whole room, including the reader's own connection
+	for _, c := range []*client.Client{c1, c2} {
+		env := nextMessage(t, c, protocol.TypeReadReceipt)
+		var receipt protocol.ReadReceiptPayload
+		_ = json.Unmarshal(env.Payload, &receipt)
+		if receipt.Username != "bob" || receipt.MessageID != "msg-1" {
+			t.Errorf("Unexpected read receipt: %+v", receipt)
+		}
+	}
+}
+
+func TestHub_RemoveClientDuringBlockedSend(t *testing.T) {
+	h := New()
+	c := mockClient("client-1")
+	h.AddClient(c)
+	registerUser(t, h, c, "alice")
+
+	// Fill the send buffer so a bulk send has to wait for room
+	for len(c.Send) < cap(c.Send) {
+		c.Send <- []byte("{}")
+	}
+	sent := make(chan error, 1)
+	go func() {
+		sent <- c.SendMessageWait(protocol.TypeSyncResp, protocol.SyncResponsePayload{})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	removed := make(chan struct{})
+	go func() {
+		h.RemoveClient(c)
+		close(removed)
+	}()
+	select {
+	case <-removed:
+	case <-time.After(time.Second):
+		t.Fatal("Expected RemoveClient not to wait for a blocked send")
+	}
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Errorf("Expected a send to a closed client to be dropped quietly, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the blocked send to return once the client closed")
+	}
+}
+
+func TestHub_SyncWithoutStorage(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.CreateRoom(c2, "Other", true)
+	drainMessages(c1)
+
+	// A cursor or watermark is required
+	err := h.Sync(c1, 0, nil)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+
+	if err := h.Sync(c1, time.Now().Add(-time.Minute).UnixMilli(), nil); err != nil {
+		t.Fatalf("Expected successful sync, got error: %v", err)
+	}
+
+	env := nextMessage(t, c1, protocol.TypeSyncResp)
+	var resp protocol.SyncResponsePayload
+	if err := json.Unmarshal(env.Payload, &resp); err != nil {
+		t.Fatalf("Failed to decode sync response: %v", err)
+	}
+	if !resp.Done || resp.Watermark == 0 {
+		t.Errorf("Expected a single final chunk with a watermark, got %+v", resp)
+	}
+	// Only rooms the user belongs to are included
+	if len(resp.Rooms) != 1 || resp.Rooms[0].RoomID != room.ID {
+		t.Fatalf("Expected only room '%s', got %+v", room.ID, resp.Rooms)
+	}
+	if len(resp.Rooms[0].Members) != 1 || resp.Rooms[0].Members[0].Username != "alice" {
+		t.Errorf("Unexpected members: %+v", resp.Rooms[0].Members)
+	}
+}
+
+func TestHub_SearchMessagesWithoutStorage(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+
+	tests := []struct {
+		name string
+		opts SearchOptions
+		code string
+	}{
+		{"empty query", SearchOptions{Query: "  "}, protocol.ErrCodeInvalidMessage},
+		{"long query", SearchOptions{Query: strings.Repeat("a", 201)}, protocol.ErrCodeInvalidMessage},
+		{"bad range", SearchOptions{Query: "hi", After: time.Now(), Before: time.Now().Add(-time.Hour)}, protocol.ErrCodeInvalidMessage},
+		{"negative offset", SearchOptions{Query: "hi", Offset: -1}, protocol.ErrCodeInvalidMessage},
+		{"unknown room", SearchOptions{Query: "hi", RoomID: "nope"}, protocol.ErrCodeRoomNotFound},
+		{"not a member", SearchOptions{Query: "hi", RoomID: room.ID}, protocol.ErrCodeNotInRoom},
+	}
+	for _, tt := range tests {
+		_, err := h.SearchMessages(c2, tt.opts)
+		if hubErr, ok := err.(*Error); !ok || hubErr.Code != tt.code {
+			t.Errorf("%s: expected error code '%s', got %v", tt.name, tt.code, err)
+		}
+	}
+
+	// Without storage there is nothing to search
+	resp, err := h.SearchMessages(c1, SearchOptions{Query: " hello ", RoomID: room.ID})
+	if err != nil {
+		t.Fatalf("Expected successful search, got error: %v", err)
+	}
+	if resp.Query != "hello" || len(resp.Results) != 0 || resp.HasMore {
+		t.Errorf("Expected empty results, got %+v", resp)
+	}
+}
+
+func TestParseMentions(t *testing.T) {
+	members := []protocol.UserInfo{
+		{UserID: "u1", Username: "alice"},
+		{UserID: "u2", Username: "bob"},
+		{UserID: "u3", Username: "carol_x"},
+	}
+
+	tests := []struct {
+		content  string
+		expected []string
+	}{
+		{"hi @bob", []string{"u2"}},
+		{"@carol_x, @bob and @bob again", []string{"u3", "u2"}},
+		{"mail bob@bob.com", nil},
+		{"@dave isn't here", nil},
+		{"note to self @alice", nil}, // Sender is skipped
+	}
+
+	for _, tt := range tests {
+		got := parseMentions(tt.content, members, "u1")
+		if len(got) != len(tt.expected) {
+			t.Errorf("parseMentions(%q) = %v, expected %v", tt.content, got, tt.expected)
+			continue
+		}
+		for i, user := range got {
+			if user.UserID != tt.expected[i] {
+				t.Errorf("parseMentions(%q) = %v, expected %v", tt.content, got, tt.expected)
+				break
+			}
+		}
+	}
+}
+
+func TestHub_MentionedEvent(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	drainMessages(c2)
+
+	if err := h.SendRoomMessage(c1, room.ID, "hey @bob", MessageOptions{}); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+
+	env := nextMessage(t, c2, protocol.TypeMentioned)
+	var mention protocol.MentionInfo
+	if err := json.Unmarshal(env.Payload, &mention); err != nil {
+		t.Fatalf("Failed to decode mention: %v", err)
+	}
+	if mention.RoomID != room.ID || mention.RoomName != "General" || mention.Message.Content != "hey @bob" {
+		t.Errorf("Unexpected mention: %+v", mention)
+	}
+
+	resp, err := h.GetMentions(c2, 10, time.Time{})
+	if err != nil {
+		t.Fatalf("Expected empty mentions, got error: %v", err)
+	}
+	if len(resp.Mentions) != 0 {
+		t.Errorf("Expected no stored mentions without storage, got %d", len(resp.Mentions))
+	}
+}
+
+func TestHub_PinMessageWithoutStorage(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+
+	err := h.PinMessage(c2, room.ID, "msg-1")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeNotInRoom {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeNotInRoom, err)
+	}
+
+	// Messages only exist in storage
+	err = h.PinMessage(c1, room.ID, "msg-1")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMessageNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeMessageNotFound, err)
+	}
+
+	if pins := h.GetPins(room.ID); len(pins) != 0 {
+		t.Errorf("Expected no pins without storage, got %d", len(pins))
+	}
+}
+
+func TestHub_UpdateRoom(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	c3 := mockClient("client-3")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	h.AddClient(c3)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	registerUser(t, h, c3, "carol")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	drainMessages(c1)
+	drainMessages(c2)
+	drainMessages(c3)
+
+	topic := "Release planning"
+
+	// Only the owner may update
+	err := h.UpdateRoom(c2, room.ID, nil, &topic, nil)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodePermissionDenied {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodePermissionDenied, err)
+	}
+
+	// Names follow the same rules as at creation
+	empty := ""
+	err = h.UpdateRoom(c1, room.ID, &empty, nil, nil)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidRoomName {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidRoomName, err)
+	}
+
+	if err := h.UpdateRoom(c1, room.ID, nil, &topic, nil); err != nil {
+		t.Fatalf("Expected successful update, got error: %v", err)
+	}
+
+	// Public room updates reach non-members too
+	for _, c := range []*client.Client{c1, c2, c3} {
+		env := nextMessage(t, c, protocol.TypeRoomUpdated)
+		var payload protocol.RoomUpdatedPayload
+		_ = json.Unmarshal(env.Payload, &payload)
+		if payload.Room.Name != "General" || payload.Room.Topic != topic || payload.UpdatedBy.Username != "alice" {
+			t.Errorf("Unexpected room update: %+v", payload)
+		}
+	}
+}
+
+func TestHub_SetMemberRoleAndKick(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	c3 := mockClient("client-3")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	h.AddClient(c3)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	registerUser(t, h, c3, "carol")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	_, _ = h.JoinRoom(c3, room.ID, "")
+	drainMessages(c1)
+	drainMessages(c2)
+	drainMessages(c3)
+
+	// Members can't assign roles
+	err := h.SetMemberRole(c2, room.ID, c3.UserID, "moderator")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodePermissionDenied {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodePermissionDenied, err)
+	}
+
+	// Ownership can't be granted
+	err = h.SetMemberRole(c1, room.ID, c2.UserID, "owner")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+
+	if err := h.SetMemberRole(c1, room.ID, c2.UserID, "moderator"); err != nil {
+		t.Fatalf("Expected successful role change, got error: %v", err)
+	}
+	env := nextMessage(t, c3, protocol.TypeRoomMembers)
+	var members protocol.RoomMembersPayload
+	_ = json.Unmarshal(env.Payload, &members)
+	if members.Action != "role_changed" || members.User.Username != "bob" || members.User.Role != "moderator" {
+		t.Errorf("Unexpected role change notification: %+v", members)
+	}
+
+	drainMessages(c1)
+
+	// Moderators can't kick the owner
+	err = h.KickMember(c2, room.ID, c1.UserID)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodePermissionDenied {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodePermissionDenied, err)
+	}
+
+	if err := h.KickMember(c2, room.ID, c3.UserID); err != nil {
+		t.Fatalf("Expected successful kick, got error: %v", err)
+	}
+
+	env = nextMessage(t, c3, protocol.TypeRoomKicked)
+	var kicked protocol.RoomKickedPayload
+	_ = json.Unmarshal(env.Payload, &kicked)
+	if kicked.RoomID != room.ID || kicked.By.Username != "bob" {
+		t.Errorf("Unexpected kick notification: %+v", kicked)
+	}
+	if room.HasMember(c3.UserID) || c3.IsInRoom(room.ID) {
+		t.Error("Expected kicked user to be removed from room")
+	}
+
+	env = nextMessage(t, c1, protocol.TypeRoomMembers)
+	_ = json.Unmarshal(env.Payload, &members)
+	if members.Action != "kicked" || members.User.Username != "carol" {
+		t.Errorf("Unexpected kick broadcast: %+v", members)
+	}
+}
+
+func TestHub_PrivateRoomInvites(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	c3 := mockClient("client-3")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	h.AddClient(c3)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	registerUser(t, h, c3, "carol")
+
+	room, _ := h.CreateRoom(c1, "Secret", false)
+	drainMessages(c2)
+
+	// Knowing the ID is not enough
+	_, err := h.JoinRoom(c2, room.ID, "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInviteRequired {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInviteRequired, err)
+	}
+
+	// Direct invitation
+	if _, err := h.InviteUser(c1, room.ID, "bob"); err != nil {
+		t.Fatalf("Expected successful invite, got error: %v", err)
+	}
+	env := nextMessage(t, c2, protocol.TypeRoomInvite)
+	var invited protocol.RoomInvitedPayload
+	_ = json.Unmarshal(env.Payload, &invited)
+	if invited.Room.RoomID != room.ID || invited.InvitedBy.Username != "alice" {
+		t.Errorf("Unexpected invite notification: %+v", invited)
+	}
+
+	rooms := h.GetRoomList(c2)
+	if len(rooms) != 1 || !rooms[0].Invited {
+		t.Errorf("Expected invited room in room list, got %+v", rooms)
+	}
+
+	if _, err := h.JoinRoom(c2, room.ID, ""); err != nil {
+		t.Fatalf("Expected invited user to join, got error: %v", err)
+	}
+
+	// Plain members can't invite to private rooms or manage links
+	if _, err := h.InviteUser(c2, room.ID, "carol"); err == nil {
+		t.Error("Expected member invite to be denied")
+	}
+	if _, err := h.CreateInviteToken(c2, room.ID, 0, 0); err == nil {
+		t.Error("Expected member token creation to be denied")
+	}
+
+	// Single-use invite link
+	invite, err := h.CreateInviteToken(c1, room.ID, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected successful token creation, got error: %v", err)
+	}
+	if invite.ExpiresAt == 0 || invite.MaxUses != 1 {
+		t.Errorf("Unexpected invite: %+v", invite)
+	}
+
+	_, err = h.JoinRoom(c3, room.ID, "bogus")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidInvite {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidInvite, err)
+	}
+
+	// The token alone identifies the room
+	joined, err := h.JoinRoom(c3, "", invite.Token)
+	if err != nil {
+		t.Fatalf("Expected join with token, got error: %v", err)
+	}
+	if joined.ID != room.ID {
+		t.Errorf("Expected to join '%s', got '%s'", room.ID, joined.ID)
+	}
+
+	// The link is used up
+	tokens, _ := h.ListInviteTokens(c1, room.ID)
+	if len(tokens) != 0 {
+		t.Errorf("Expected exhausted token to be gone, got %+v", tokens)
+	}
+
+	// Revoked links stop working
+	invite, _ = h.CreateInviteToken(c1, room.ID, 0, 0)
+	tokens, _ = h.ListInviteTokens(c1, room.ID)
+	if len(tokens) != 1 || tokens[0].Token != invite.Token {
+		t.Errorf("Expected new token in list, got %+v", tokens)
+	}
+	if err := h.RevokeInviteToken(c1, room.ID, invite.Token); err != nil {
+		t.Fatalf("Expected successful revoke, got error: %v", err)
+	}
+	_ = h.LeaveRoom(c3, room.ID)
+	if _, err := h.JoinRoom(c3, room.ID, invite.Token); err == nil {
+		t.Error("Expected revoked token to be rejected")
+	}
+}
+
+func TestHub_OwnershipTransfer(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	c3 := mockClient("client-3")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	h.AddClient(c3)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	registerUser(t, h, c3, "carol")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	_, _ = h.JoinRoom(c3, room.ID, "")
+	drainMessages(c1)
+	drainMessages(c2)
+	drainMessages(c3)
+
+	// Only the owner can transfer
+	err := h.TransferOwnership(c2, room.ID, c3.UserID)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodePermissionDenied {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodePermissionDenied, err)
+	}
+
+	if err := h.TransferOwnership(c1, room.ID, c3.UserID); err != nil {
+		t.Fatalf("Expected successful transfer, got error: %v", err)
+	}
+	if room.Role(c3.UserID) != "owner" || room.Role(c1.UserID) != "admin" {
+		t.Errorf("Unexpected roles after transfer: carol=%s alice=%s", room.Role(c3.UserID), room.Role(c1.UserID))
+	}
+	env := nextMessage(t, c2, protocol.TypeRoomMembers)
+	var members protocol.RoomMembersPayload
+	_ = json.Unmarshal(env.Payload, &members)
+	if members.Action != "owner_changed" || members.User.Username != "carol" {
+		t.Errorf("Unexpected transfer notification: %+v", members)
+	}
+
+	// The owner leaving promotes the longest-standing member
+	drainMessages(c2)
+	if err := h.LeaveRoom(c3, room.ID); err != nil {
+		t.Fatalf("Expected owner to leave, got error: %v", err)
+	}
+	if room.Role(c1.UserID) != "owner" {
+		t.Errorf("Expected alice to be promoted, got %s", room.Role(c1.UserID))
+	}
+	env = nextMessage(t, c2, protocol.TypeRoomMembers)
+	_ = json.Unmarshal(env.Payload, &members)
+	if members.Action != "left" {
+		t.Errorf("Expected leave notification first, got %+v", members)
+	}
+	env = nextMessage(t, c2, protocol.TypeRoomMembers)
+	_ = json.Unmarshal(env.Payload, &members)
+	if members.Action != "owner_changed" || members.User.Username != "alice" {
+		t.Errorf("Unexpected promotion notification: %+v", members)
+	}
+}
+
+func TestHub_Presence(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	drainMessages(c1)
+	drainMessages(c2)
+
+	for _, u := range h.GetUserList() {
+		if u.Presence != PresenceOnline {
+			t.Errorf("Expected %s to be online, got '%s'", u.Username, u.Presence)
+		}
+	}
+
+	err := h.SetPresence(c1, "busy", nil, 0)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+
+	status := "At lunch"
+	if err := h.SetPresence(c1, PresenceDND, &status, 0); err != nil {
+		t.Fatalf("Expected successful presence update, got error: %v", err)
+	}
+	env := nextMessage(t, c2, protocol.TypePresenceChanged)
+	var changed protocol.PresenceChangedPayload
+	_ = json.Unmarshal(env.Payload, &changed)
+	if changed.Username != "alice" || changed.Presence != PresenceDND || changed.Status != status {
+		t.Errorf("Unexpected presence change: %+v", changed)
+	}
+
+	// Invisible looks like going offline to everyone else
+	drainMessages(c1)
+	if err := h.SetPresence(c1, PresenceInvisible, nil, 0); err != nil {
+		t.Fatalf("Expected successful presence update, got error: %v", err)
+	}
+	nextMessage(t, c2, protocol.TypeUserLeft)
+	env = nextMessage(t, c1, protocol.TypePresenceChanged)
+	_ = json.Unmarshal(env.Payload, &changed)
+	if changed.Presence != PresenceInvisible {
+		t.Errorf("Expected own presence to be invisible, got '%s'", changed.Presence)
+	}
+	for _, u := range h.GetUserList() {
+		if u.Username == "alice" {
+			t.Error("Expected invisible user to be left out of the user list")
+		}
+	}
+
+	if err := h.SetPresence(c1, PresenceOnline, nil, 0); err != nil {
+		t.Fatalf("Expected successful presence update, got error: %v", err)
+	}
+	nextMessage(t, c2, protocol.TypeUserJoined)
+
+	// Idle detection and activity
+	drainMessages(c2)
+	h.presenceMu.Lock()
+	p := h.presence[c1.UserID]
+	h.presenceMu.Unlock()
+	h.markIdle(c1.UserID, p)
+	env = nextMessage(t, c2, protocol.TypePresenceChanged)
+	_ = json.Unmarshal(env.Payload, &changed)
+	if changed.Presence != PresenceAway {
+		t.Errorf("Expected idle user to be away, got '%s'", changed.Presence)
+	}
+
+	h.Touch(c1)
+	env = nextMessage(t, c2, protocol.TypePresenceChanged)
+	_ = json.Unmarshal(env.Payload, &changed)
+	if changed.Presence != PresenceOnline {
+		t.Errorf("Expected active user to be online, got '%s'", changed.Presence)
+	}
+
+	// Custom status expiry
+	status = "Brb"
+	if err := h.SetPresence(c1, "", &status, 20*time.Millisecond); err != nil {
+		t.Fatalf("Expected successful presence update, got error: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	nextMessage(t, c2, protocol.TypePresenceChanged)
+	env = nextMessage(t, c2, protocol.TypePresenceChanged)
+	var expired protocol.PresenceChangedPayload
+	_ = json.Unmarshal(env.Payload, &expired)
+	if expired.Status != "" {
+		t.Errorf("Expected status to expire, got '%s'", expired.Status)
+	}
+}
+
+// addSession connects c as another device of an already registered user
+func addSession(h *Hub, c *client.Client, of *client.Client) {
+	h.AddClient(c)
+	c.UserID = of.UserID
+	c.Username = of.Username
+	h.mu.Lock()
+	h.addSessionLocked(c)
+	h.mu.Unlock()
+}
+
+func TestHub_MultipleSessions(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	// Alice connects a second device
+	c3 := mockClient("client-3")
+	addSession(h, c3, c1)
+	drainMessages(c1)
+	drainMessages(c2)
+
+	users := h.GetUserList()
+	if len(users) != 2 {
+		t.Errorf("Expected 2 online users, got %d", len(users))
+	}
+
+	// Direct messages reach every device of the recipient and the sender's other devices
+	if err := h.SendDirectMessage(c2, "alice", "hi alice", ""); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+	nextMessage(t, c1, protocol.TypeDirectMsg)
+	nextMessage(t, c3, protocol.TypeDirectMsg)
+
+	if err := h.SendDirectMessage(c1, "bob", "hi bob", ""); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+	nextMessage(t, c2, protocol.TypeDirectMsg)
+	nextMessage(t, c3, protocol.TypeDirectMsg)
+
+	// Room messages fan out to every device
+	room, _ := h.CreateRoom(c2, "General", true)
+	if _, err := h.JoinRoom(c1, room.ID, ""); err != nil {
+		t.Fatalf("Expected successful join, got error: %v", err)
+	}
+	if !c3.IsInRoom(room.ID) {
+		t.Error("Expected join to apply to every session")
+	}
+	if err := h.SendRoomMessage(c2, room.ID, "hello", MessageOptions{}); err != nil {
+		t.Fatalf("Expected successful send, got error: %v", err)
+	}
+	nextMessage(t, c1, protocol.TypeRoomMessage)
+	nextMessage(t, c3, protocol.TypeRoomMessage)
+
+	// Closing one device keeps the user online
+	drainMessages(c2)
+	h.RemoveClient(c3)
+	select {
+	case data := <-c2.Send:
+		t.Errorf("Expected no notification while another session is open, got %s", data)
+	default:
+	}
+	users = h.GetUserList()
+	if len(users) != 2 {
+		t.Errorf("Expected alice to stay online, got %d users", len(users))
+	}
+
+	// Signing out other sessions
+	c4 := mockClient("client-4")
+	addSession(h, c4, c1)
+	kicked, err := h.KickOtherSessions(c1)
+	if err != nil {
+		t.Fatalf("Expected successful kick, got error: %v", err)
+	}
+	if kicked != 1 {
+		t.Errorf("Expected 1 session kicked, got %d", kicked)
+	}
+	nextMessage(t, c4, protocol.TypeKicked)
+	h.RemoveClient(c4) // Disconnect of a kicked session is a no-op
+
+	// The last connection going away takes the user offline
+	h.RemoveClient(c1)
+	nextMessage(t, c2, protocol.TypeUserLeft)
+	users = h.GetUserList()
+	if len(users) != 1 || users[0].Username != "bob" {
+		t.Errorf("Expected only bob online, got %+v", users)
+	}
+}
+
+func TestHub_AuthTokens(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	h.AddClient(c1)
+
+	if _, err := h.IssueAuthToken(c1); err == nil {
+		t.Fatal("Expected error for unregistered user, got nil")
+	}
+
+	registerUser(t, h, c1, "alice")
+	token, err := h.IssueAuthToken(c1)
+	if err != nil || token == "" {
+		t.Fatalf("Expected a token, got '%s' (err %v)", token, err)
+	}
+	if c, ok := h.Authenticate(token); !ok || c != c1 {
+		t.Error("Expected token to authenticate its connection")
+	}
+	if _, ok := h.Authenticate("bogus"); ok {
+		t.Error("Expected unknown token to be rejected")
+	}
+
+	// Tokens die with their connection
+	h.RemoveClient(c1)
+	if _, ok := h.Authenticate(token); ok {
+		t.Error("Expected token to be rejected after disconnect")
+	}
+}
+
+func TestHub_AttachmentsWithoutStorage(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	h.AddClient(c1)
+	registerUser(t, h, c1, "alice")
+	room, _ := h.CreateRoom(c1, "General", true)
+
+	_, err := h.UploadAttachment(c1, room.ID, "a.txt", strings.NewReader("hello"))
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+
+	_, _, err = h.OpenAttachment(c1, "7d0b4bd6-3f3c-4b52-9f0e-4a9e8f3b2c11")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeFileNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeFileNotFound, err)
+	}
+	_, _, err = h.OpenSignedAttachment("7d0b4bd6-3f3c-4b52-9f0e-4a9e8f3b2c11", time.Now().Add(time.Minute).Unix(), "sig")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeFileNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeFileNotFound, err)
+	}
+
+	err = h.SendRoomMessage(c1, room.ID, "see attached", MessageOptions{Attachments: []string{"7d0b4bd6-3f3c-4b52-9f0e-4a9e8f3b2c11"}})
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeInvalidMessage, err)
+	}
+}
+
+func TestHub_RateLimits(t *testing.T) {
+	h := New()
+
+	// Without limits nothing is rejected
+	c1 := mockClient("client-1")
+	h.AddClient(c1)
+	for i := 0; i < 50; i++ {
+		if err := h.CheckRateLimit(c1, protocol.TypeRoomMessage); err != nil {
+			t.Fatalf("Expected no rate limit before SetRateLimits, got %v", err)
+		}
+	}
+
+	h.SetRateLimits(map[string]RateLimit{
+		RateLimitMessages: {
+			Conn: ratelimit.Limit{Burst: 3, Per: time.Minute},
+			User: ratelimit.Limit{Burst: 4, Per: time.Minute},
+		},
+		RateLimitRegistrations: {Conn: ratelimit.Limit{Burst: 1, Per: time.Minute}},
+	})
+
+	if err := h.CheckRateLimit(c1, protocol.TypeRegister); err != nil {
+		t.Fatalf("Expected first registration attempt to be allowed, got %v", err)
+	}
+	err := h.CheckRateLimit(c1, protocol.TypeRegister)
+	hubErr, ok := err.(*Error)
+	if !ok || hubErr.Code != protocol.ErrCodeRateLimited {
+		t.Fatalf("Expected RATE_LIMITED for second registration attempt, got %v", err)
+	}
+	if hubErr.RetryAfter <= 0 || hubErr.RetryAfter > time.Minute {
+		t.Errorf("Expected a retry-after hint within a minute, got %v", hubErr.RetryAfter)
+	}
+
+	registerUser(t, h, c1, "alice")
+	c2 := mockClient("client-2")
+	addSession(h, c2, c1)
+
+	// The connection budget runs out first...
+	for i := 0; i < 3; i++ {
+		if err := h.CheckRateLimit(c1, protocol.TypeRoomMessage); err != nil {
+			t.Fatalf("Expected message %d to be allowed, got %v", i+1, err)
+		}
+	}
+	if err := h.CheckRateLimit(c1, protocol.TypeRoomMessage); err == nil {
+		t.Error("Expected message past the connection limit to be rejected")
+	}
+
+	// ...then the user budget is shared by the user's other sessions
+	if err := h.CheckRateLimit(c2, protocol.TypeRoomMessage); err != nil {
+		t.Errorf("Expected message from other session to be allowed, got %v", err)
+	}
+	if err := h.CheckRateLimit(c2, protocol.TypeRoomMessage); err == nil {
+		t.Error("Expected message past the user limit to be rejected")
+	}
+
+	// Other classes are unaffected
+	if err := h.CheckRateLimit(c1, protocol.TypeRoomHistory); err != nil {
+		t.Errorf("Expected unlimited class to be allowed, got %v", err)
+	}
+
+	// Repeat offenders are disconnected
+	for i := 0; i < rateLimitStrikes.Burst; i++ {
+		_ = h.CheckRateLimit(c1, protocol.TypeRoomMessage)
+	}
+	h.mu.RLock()
+	_, connected := h.clients[c1.ID]
+	h.mu.RUnlock()
+	if connected {
+		t.Error("Expected repeat offender to be disconnected")
+	}
+
+	// Sending to a disconnected client is harmless
+	if err := c1.SendMessage(protocol.TypeError, protocol.ErrorPayload{}); err != nil {
+		t.Errorf("Expected send after close to be dropped, got %v", err)
+	}
+}
+
+func TestHub_Moderation(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+
+	cfg := moderation.Config{
+		MaxLength: 20,
+		Rules: []moderation.Rule{
+			{Words: []string{"darn"}, Action: "mask"},
+			{Words: []string{"spam"}, Reason: "spam"},
+		},
+		Rooms: map[string][]moderation.Rule{
+			room.ID: {{Patterns: []string{`https?://`}, Action: "quarantine", Reason: "link"}},
+		},
+	}
+	pipeline, err := cfg.Pipeline()
+	if err != nil {
+		t.Fatalf("Failed to build pipeline: %v", err)
+	}
+	h.SetModeration(pipeline)
+	drainMessages(c1)
+	drainMessages(c2)
+
+	// Rejections carry the filter's reason code
+	err = h.SendRoomMessage(c1, room.ID, "buy spam", MessageOptions{})
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMessageRejected || hubErr.Reason != "spam" {
+		t.Fatalf("Expected MESSAGE_REJECTED with reason 'spam', got %v", err)
+	}
+	err = h.SendDirectMessage(c1, "bob", "   ", "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Reason != moderation.ReasonEmpty {
+		t.Errorf("Expected empty DM to be rejected, got %v", err)
+	}
+	err = h.SendRoomMessage(c1, room.ID, strings.Repeat("x", 21), MessageOptions{})
+	if hubErr, ok := err.(*Error); !ok || hubErr.Reason != moderation.ReasonTooLong {
+		t.Errorf("Expected long message to be rejected, got %v", err)
+	}
+
+	// Masked content is what gets delivered
+	if err := h.SendRoomMessage(c1, room.ID, "darn it", MessageOptions{}); err != nil {
+		t.Fatalf("Expected masked message to be sent, got %v", err)
+	}
+	env := nextMessage(t, c2, protocol.TypeRoomMessage)
+	var roomMsg protocol.IncomingRoomMessage
+	_ = json.Unmarshal(env.Payload, &roomMsg)
+	if roomMsg.Content != "**** it" {
+		t.Errorf("Expected masked content, got '%s'", roomMsg.Content)
+	}
+
+	// Quarantined messages are held for review and only the sender hears about it
+	if err := h.SendRoomMessage(c1, room.ID, "http://x.io", MessageOptions{ClientMsgID: "c-1"}); err != nil {
+		t.Fatalf("Expected quarantined message to be accepted, got %v", err)
+	}
+	env = nextMessage(t, c1, protocol.TypeMessageHeld)
+	var held protocol.MessageHeldPayload
+	_ = json.Unmarshal(env.Payload, &held)
+	if held.RoomID != room.ID || held.ClientMsgID != "c-1" || held.Reason != "link" {
+		t.Errorf("Unexpected held notice: %+v", held)
+	}
+	select {
+	case data := <-c2.Send:
+		t.Errorf("Expected nothing delivered to bob, got %s", data)
+	default:
+	}
+
+	// Room rules don't apply to direct messages
+	if err := h.SendDirectMessage(c1, "bob", "http://x.io", ""); err != nil {
+		t.Fatalf("Expected DM to be sent, got %v", err)
+	}
+	nextMessage(t, c2, protocol.TypeDirectMsg)
+}
+
+func TestHub_BlockUser(t *testing.T) {
+	h := New()
+
+	alice := mockClient("client-1")
+	bob := mockClient("client-2")
+	carol := mockClient("client-3")
+	h.AddClient(alice)
+	h.AddClient(bob)
+	h.AddClient(carol)
+	registerUser(t, h, alice, "alice")
+	registerUser(t, h, bob, "bob")
+	registerUser(t, h, carol, "carol")
+	alice2 := mockClient("client-4")
+	addSession(h, alice2, alice)
+
+	room, _ := h.CreateRoom(alice, "General", true)
+	_, _ = h.JoinRoom(bob, room.ID, "")
+	_, _ = h.JoinRoom(carol, room.ID, "")
+
+	if err := h.BlockUser(alice, "alice"); err == nil {
+		t.Error("Expected self-block to fail")
+	}
+	err := h.BlockUser(alice, "nobody")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeUserNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeUserNotFound, err)
+	}
+
+	drainMessages(alice)
+	drainMessages(alice2)
+	if err := h.BlockUser(alice, "bob"); err != nil {
+		t.Fatalf("Expected successful block, got %v", err)
+	}
+
+	// Every session of the blocker learns about the block
+	for _, c := range []*client.Client{alice, alice2} {
+		env := nextMessage(t, c, protocol.TypeUserBlocked)
+		var blocked protocol.UserBlockedPayload
+		_ = json.Unmarshal(env.Payload, &blocked)
+		if blocked.Username != "bob" || blocked.UserID != bob.UserID {
+			t.Errorf("Unexpected block notice: %+v", blocked)
+		}
+	}
+
+	list, _ := h.GetBlockList(alice2)
+	if len(list) != 1 || list[0].Username != "bob" {
+		t.Fatalf("Expected block list [bob], got %+v", list)
+	}
+
+	// DMs from a blocked user look delivered to them but never arrive
+	drainMessages(bob)
+	if err := h.SendDirectMessage(bob, "alice", "hello?", "c-1"); err != nil {
+		t.Fatalf("Expected DM to a blocker to look successful, got %v", err)
+	}
+	nextMessage(t, bob, protocol.TypeDirectMsg)
+	for _, c := range []*client.Client{alice, alice2} {
+		select {
+		case data := <-c.Send:
+			t.Errorf("Expected nothing delivered to alice, got %s", data)
+		default:
+		}
+	}
+
+	// Room messages from a blocked user skip the blocker's sessions only
+	drainMessages(carol)
+	if err := h.SendRoomMessage(bob, room.ID, "hi @alice", MessageOptions{}); err != nil {
+		t.Fatalf("Expected room message to be sent, got %v", err)
+	}
+	nextMessage(t, carol, protocol.TypeRoomMessage)
+	for _, c := range []*client.Client{alice, alice2} {
+		select {
+		case data := <-c.Send:
+			t.Errorf("Expected nothing delivered to alice, got %s", data)
+		default:
+		}
+	}
+
+	// Typing indicators, in a DM or the room, don't reach the blocker either
+	drainMessages(carol)
+	if err := h.SetTyping(bob, "", "alice", false); err != nil {
+		t.Fatalf("Expected typing to look successful, got %v", err)
+	}
+	if err := h.SetTyping(bob, room.ID, "", false); err != nil {
+		t.Fatalf("Expected typing to be relayed, got %v", err)
+	}
+	nextMessage(t, carol, protocol.TypeTypingStarted)
+	for _, c := range []*client.Client{alice, alice2} {
+		select {
+		case data := <-c.Send:
+			t.Errorf("Expected no typing indicator for alice, got %s", data)
+		default:
+		}
+	}
+
+	// Blocks are one-way
+	if err := h.SendDirectMessage(alice, "bob", "bye", ""); err != nil {
+		t.Fatalf("Expected DM from the blocker to be sent, got %v", err)
+	}
+	nextMessage(t, bob, protocol.TypeDirectMsg)
+
+	drainMessages(alice)
+	if err := h.UnblockUser(alice, "bob"); err != nil {
+		t.Fatalf("Expected successful unblock, got %v", err)
+	}
+	nextMessage(t, alice, protocol.TypeUserUnblocked)
+	if err := h.SendDirectMessage(bob, "alice", "hello again", ""); err != nil {
+		t.Fatalf("Expected DM to be sent, got %v", err)
+	}
+	nextMessage(t, alice2, protocol.TypeDirectMsg)
+	if list, _ := h.GetBlockList(alice); len(list) != 0 {
+		t.Errorf("Expected empty block list, got %d", len(list))
+	}
+}
+
+func TestHub_ReportsWithoutStorage(t *testing.T) {
+	h := New()
+	// Usernames can't be trusted without storage
+	if err := h.SetServerAdmins([]string{"admin"}); err == nil {
+		t.Error("Expected server admins to be refused without storage")
+	}
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	c3 := mockClient("client-3")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	h.AddClient(c3)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	registerUser(t, h, c3, "admin")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+
+	_, err := h.Report(c2, ReportTarget{Type: "user", Username: "alice"}, "spam", "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeInvalidMessage {
+		t.Errorf("Expected reports to be unavailable without storage, got %v", err)
+	}
+
+	// Only room moderators see a room's reports, and nobody sees all reports
+	if _, err := h.ListReports(c2, room.ID, "", 0); err == nil {
+		t.Error("Expected member to be denied the room's reports")
+	}
+	if _, err := h.ListReports(c1, "", "", 0); err == nil {
+		t.Error("Expected room owner to be denied all reports")
+	}
+	if reports, err := h.ListReports(c1, room.ID, "", 0); err != nil || len(reports) != 0 {
+		t.Errorf("Expected empty report list for room owner, got %v (err %v)", reports, err)
+	}
+	if _, err := h.ListReports(c3, "", "all", 0); err == nil {
+		t.Error("Expected a configured admin to be denied all reports without storage")
+	}
+
+	_, err = h.ResolveReport(c3, "7d0b4bd6-3f3c-4b52-9f0e-4a9e8f3b2c11", ResolveDismiss, 0, "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeReportNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeReportNotFound, err)
+	}
+}
+
+func TestHub_Sanctions(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	c2b := mockClient("client-3")
+	addSession(h, c2b, c2)
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	by := protocol.UserInfo{UserID: c1.UserID, Username: "alice"}
+	ctx := context.Background()
+
+	// A room mute stops room messages in that room only
+	if err := h.applySanction(ctx, postgres.SanctionMute, c2.UserID, room.ID, time.Hour, "", by); err != nil {
+		t.Fatalf("Failed to mute: %v", err)
+	}
+	err := h.SendRoomMessage(c2, room.ID, "hello", MessageOptions{})
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMuted {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeMuted, err)
+	}
+	if err := h.SendDirectMessage(c2, "alice", "hi", ""); err != nil {
+		t.Errorf("Expected DM from room-muted user to be sent, got %v", err)
+	}
+
+	// Expired sanctions no longer apply
+	if err := h.applySanction(ctx, postgres.SanctionMute, c2.UserID, room.ID, time.Nanosecond, "", by); err != nil {
+		t.Fatalf("Failed to mute: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if err := h.SendRoomMessage(c2, room.ID, "hello", MessageOptions{}); err != nil {
+		t.Errorf("Expected message after mute expired to be sent, got %v", err)
+	}
+
+	// A server mute stops direct messages too
+	if err := h.applySanction(ctx, postgres.SanctionMute, c2.UserID, "", 0, "", by); err != nil {
+		t.Fatalf("Failed to mute: %v", err)
+	}
+	err = h.SendDirectMessage(c2, "alice", "hi", "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMuted {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeMuted, err)
+	}
+
+	// A room ban removes the user and keeps them out
+	drainMessages(c2)
+	if err := h.applySanction(ctx, postgres.SanctionBan, c2.UserID, room.ID, 0, "", by); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+	nextMessage(t, c2, protocol.TypeRoomKicked)
+	if h.GetRoom(room.ID).HasMember(c2.UserID) {
+		t.Error("Expected banned user to be removed from room")
+	}
+	_, err = h.JoinRoom(c2, room.ID, "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeBanned {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeBanned, err)
+	}
+
+	// A server ban disconnects every session
+	if err := h.applySanction(ctx, postgres.SanctionBan, c2.UserID, "", 0, "", by); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+	h.mu.RLock()
+	_, online := h.usernames["bob"]
+	h.mu.RUnlock()
+	if online {
+		t.Error("Expected server-banned user to be disconnected")
+	}
+}
+
+func TestHub_Admin(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	c3 := mockClient("client-3")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	h.AddClient(c3)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	registerUser(t, h, c3, "carol")
+	c2b := mockClient("client-4")
+	addSession(h, c2b, c2)
+
+	// Users are listed alphabetically with their connections
+	users, err := h.AdminUsers("", 0)
+	if err != nil {
+		t.Fatalf("Failed to list users: %v", err)
+	}
+	if len(users) != 3 || users[0].Username != "alice" || users[2].Username != "carol" {
+		t.Fatalf("Expected alice, bob and carol, got %+v", users)
+	}
+	if len(users[1].Connections) != 2 {
+		t.Errorf("Expected bob to have 2 connections, got %d", len(users[1].Connections))
+	}
+	if users, _ := h.AdminUsers("AL", 0); len(users) != 1 || users[0].Username != "alice" {
+		t.Errorf("Expected search to find only alice, got %+v", users)
+	}
+
+	general, _ := h.CreateRoom(c1, "General", true)
+	secret, _ := h.CreateRoom(c1, "Secret", false)
+	_, _ = h.JoinRoom(c2, general.ID, "")
+
+	rooms := h.AdminRooms("", 0)
+	if len(rooms) != 2 || rooms[0].Name != "General" || rooms[0].OnlineCount != 2 {
+		t.Errorf("Expected both rooms with 2 online in General, got %+v", rooms)
+	}
+	if rooms := h.AdminRooms(secret.ID, 0); len(rooms) != 1 || rooms[0].IsPublic {
+		t.Errorf("Expected lookup by ID to find the private room, got %+v", rooms)
+	}
+
+	// Deleting a private room tells only its members
+	drainMessages(c1)
+	drainMessages(c3)
+	if err := h.DeleteRoom(secret.ID); err != nil {
+		t.Fatalf("Failed to delete room: %v", err)
+	}
+	nextMessage(t, c1, protocol.TypeRoomDeleted)
+	if len(c3.Send) != 0 {
+		t.Error("Expected non-member not to hear about a private room")
+	}
+
+	// Deleting a public room tells everyone
+	if err := h.DeleteRoom(general.ID); err != nil {
+		t.Fatalf("Failed to delete room: %v", err)
+	}
+	nextMessage(t, c3, protocol.TypeRoomDeleted)
+	if h.GetRoom(general.ID) != nil || c2.IsInRoom(general.ID) {
+		t.Error("Expected room to be gone")
+	}
+	err = h.DeleteRoom(general.ID)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeRoomNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeRoomNotFound, err)
+	}
+
+	// Banning disconnects every session
+	drainMessages(c2)
+	if err := h.BanUser("bob", 0, "spam"); err != nil {
+		t.Fatalf("Failed to ban: %v", err)
+	}
+	nextMessage(t, c2, protocol.TypeKicked)
+	if users, _ := h.AdminUsers("bob", 0); len(users) != 0 {
+		t.Error("Expected banned user to be disconnected")
+	}
+	err = h.BanUser("nobody", 0, "")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeUserNotFound {
+		t.Errorf("Expected error code '%s', got %v", protocol.ErrCodeUserNotFound, err)
+	}
+
+	// Unbanning clears the ban from memory
+	h.mu.Lock()
+	h.sanctions[sanctionKey{postgres.SanctionBan, c3.UserID, ""}] = time.Time{}
+	h.mu.Unlock()
+	if users, _ := h.AdminUsers("carol", 0); len(users) != 1 || !users[0].Banned {
+		t.Error("Expected carol to be listed as banned")
+	}
+	if err := h.UnbanUser("carol"); err != nil {
+		t.Fatalf("Failed to unban: %v", err)
+	}
+	if users, _ := h.AdminUsers("carol", 0); len(users) != 1 || users[0].Banned {
+		t.Error("Expected carol's ban to be lifted")
+	}
+	if err := h.UnbanUser("carol"); err == nil {
+		t.Error("Expected unbanning a user who isn't banned to fail")
+	}
+
+	// Single connections can be closed too
+	if err := h.DisconnectClient(c3.ID); err != nil {
+		t.Fatalf("Failed to disconnect: %v", err)
+	}
+	if _, err := h.DisconnectUser("carol"); err == nil {
+		t.Error("Expected disconnected user to be offline")
+	}
+	if err := h.DisconnectClient("no-such-client"); err == nil {
+		t.Error("Expected unknown connection to be rejected")
+	}
+}
+
+func TestHub_ApplyCleanup(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	c3 := mockClient("client-3")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	h.AddClient(c3)
+	registerUser(t, h, c1, "alice")
+	registerUser(t, h, c2, "bob")
+	registerUser(t, h, c3, "carol")
+
+	room, _ := h.CreateRoom(c1, "General", true)
+	_, _ = h.JoinRoom(c2, room.ID, "")
+	_, _ = h.JoinRoom(c3, room.ID, "")
+	if err := h.applySanction(context.Background(), postgres.SanctionMute, c1.UserID, room.ID, 0, "", adminActor); err != nil {
+		t.Fatalf("Failed to mute: %v", err)
+	}
+	if err := h.BlockUser(c3, "alice"); err != nil {
+		t.Fatalf("Failed to block: %v", err)
+	}
+	// alice is left with one stale connection
+	stale := mockClient("client-4")
+	addSession(h, stale, c1)
+	h.RemoveClient(c1)
+
+	// Cleanup deleted the owner; bob joined first so storage made him owner
+	drainMessages(c3)
+	drainMessages(stale)
+	h.ApplyCleanup(context.Background(), &postgres.CleanupStats{
+		UsersDeleted:   1,
+		DeletedUserIDs: []string{c1.UserID},
+	})
+
+	if room.HasMember(c1.UserID) || room.MemberCount() != 2 {
+		t.Errorf("Expected the deleted user to leave the room, got %d members", room.MemberCount())
+	}
+	if room.Role(c2.UserID) != "owner" {
+		t.Errorf("Expected bob to own the room, got %q", room.Role(c2.UserID))
+	}
+	var p protocol.RoomMembersPayload
+	_ = json.Unmarshal(nextMessage(t, c3, protocol.TypeRoomMembers).Payload, &p)
+	if p.Action != "left" || p.User.UserID != c1.UserID {
+		t.Errorf("Expected alice to be reported as left, got %+v", p)
+	}
+	_ = json.Unmarshal(nextMessage(t, c3, protocol.TypeRoomMembers).Payload, &p)
+	if p.Action != "owner_changed" || p.User.UserID != c2.UserID {
+		t.Errorf("Expected bob to be reported as owner, got %+v", p)
+	}
+
+	// The new owner can use owner actions right away
+	if err := h.SetMemberRole(c2, room.ID, c3.UserID, "admin"); err != nil {
+		t.Errorf("Expected the new owner to promote carol, got %v", err)
+	}
+
+	// Nothing in memory still refers to the deleted user
+	nextMessage(t, stale, protocol.TypeKicked)
+	if _, connected := h.clients[stale.ID]; connected {
+		t.Error("Expected the deleted user's connection to be closed")
+	}
+	if h.isMuted(c1.UserID, room.ID) {
+		t.Error("Expected the deleted user's mute to be dropped")
+	}
+	if h.hasBlocked(context.Background(), c3.UserID, c1.UserID) {
+		t.Error("Expected blocks of the deleted user to be dropped")
+	}
+}
+
+func TestHub_Stats(t *testing.T) {
+	h := New()
+
+	c1 := mockClient("client-1")
+	c2 := mockClient("client-2")
+	h.AddClient(c1)
+	h.AddClient(c2)
+	registerUser(t, h, c1, "alice")
+	addSession(h, mockClient("client-3"), c1)
+	_, _ = h.CreateRoom(c1, "General", true)
+
+	stats := h.Stats()
+	expected := Stats{Clients: 3, Sessions: 2, OnlineUsers: 1, Rooms: 1}
+	if stats != expected {
+		t.Errorf("Expected %+v, got %+v", expected, stats)
+	}
+}
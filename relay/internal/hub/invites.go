@@ -0,0 +1,334 @@
+package hub
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"sort"
+	"time"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/room"
+	"haven/internal/storage/postgres"
+)
+
+const (
+	// Random bytes in an invite token (base64url encoded on the wire)
+	inviteTokenBytes = 16
+
+	// Limits on invite links; 0 means unlimited/never for either
+	maxInviteUses     = 1000
+	maxInviteLifetime = 30 * 24 * time.Hour
+)
+
+// InviteUser invites a user to a room and notifies them if they are online.
+// Anyone in a public room may invite; private rooms require permInvite.
+// Inviting someone who already has a pending invitation re-sends it.
+func (h *Hub) InviteUser(c *client.Client, roomID, username string) (*protocol.UserInfo, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, exists := h.rooms[roomID]
+	if !exists {
+		h.mu.RUnlock()
+		return nil, &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	role := r.Role(memberID)
+	if role == "" {
+		h.mu.RUnlock()
+		return nil, &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	if !r.IsPublic && !room.RoleAtLeast(role, permInvite) {
+		h.mu.RUnlock()
+		return nil, &Error{Code: protocol.ErrCodePermissionDenied, Message: "Insufficient role"}
+	}
+
+	// Prefer the online connection, fall back to storage for offline users
+	targetID := h.usernames[username]
+	h.mu.RUnlock()
+
+	if targetID == "" && h.userStore != nil {
+		ctx := logContext(c, roomID)
+		user, err := h.userStore.GetByUsername(ctx, username)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to look up user", "err", err)
+			return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+		}
+		if user != nil {
+			targetID = user.ID
+		}
+	}
+	if targetID == "" {
+		return nil, &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r.HasMember(targetID) {
+		return nil, &Error{Code: protocol.ErrCodeAlreadyInRoom, Message: "User is already in room"}
+	}
+
+	if r.AddInvite(room.Invite{
+		UserID:            targetID,
+		Username:          username,
+		InvitedBy:         memberID,
+		InvitedByUsername: c.Username,
+		CreatedAt:         time.Now(),
+	}) && h.memberStore != nil {
+		ctx := logContext(c, roomID)
+		go func() {
+			err := h.memberStore.SaveInvite(ctx, roomID, targetID, username, memberID, c.Username)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to save invite", "err", err)
+			}
+		}()
+	}
+
+	info := r.Info()
+	info.Invited = true
+	h.sendToUserLocked(targetID, "", protocol.TypeRoomInvite, protocol.RoomInvitedPayload{
+		Room:      info,
+		InvitedBy: protocol.UserInfo{UserID: memberID, Username: c.Username},
+	})
+
+	return &protocol.UserInfo{UserID: targetID, Username: username}, nil
+}
+
+// CreateInviteToken creates an invite link for a room
+// maxUses and expiresIn may be 0 for an unlimited, never-expiring link
+func (h *Hub) CreateInviteToken(c *client.Client, roomID string, maxUses int, expiresIn time.Duration) (*protocol.InviteInfo, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if maxUses < 0 || maxUses > maxInviteUses {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "max_uses must be between 0 and 1000"}
+	}
+	if expiresIn < 0 || expiresIn > maxInviteLifetime {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "expires_in must be at most 30 days"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, err := h.authorizeInviteLocked(roomID, memberID)
+	h.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := logContext(c, roomID)
+
+	token, err := newInviteToken()
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to generate invite token", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to create invite"}
+	}
+
+	t := room.InviteToken{
+		Token:             token,
+		CreatedBy:         memberID,
+		CreatedByUsername: c.Username,
+		MaxUses:           maxUses,
+		CreatedAt:         time.Now(),
+	}
+	if expiresIn > 0 {
+		t.ExpiresAt = t.CreatedAt.Add(expiresIn)
+	}
+
+	// Persist before handing out the link so it survives a restart
+	if h.memberStore != nil {
+		stored := &postgres.InviteToken{
+			Token:             t.Token,
+			RoomID:            roomID,
+			CreatedBy:         t.CreatedBy,
+			CreatedByUsername: t.CreatedByUsername,
+			MaxUses:           t.MaxUses,
+			CreatedAt:         t.CreatedAt,
+		}
+		if !t.ExpiresAt.IsZero() {
+			stored.ExpiresAt = &t.ExpiresAt
+		}
+		if err := h.memberStore.SaveInviteToken(ctx, stored); err != nil {
+			slog.ErrorContext(ctx, "Failed to save invite token", "err", err)
+			return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to create invite"}
+		}
+	}
+
+	r.AddToken(t)
+
+	info := inviteTokenToProtocol(t)
+	return &info, nil
+}
+
+// RevokeInviteToken deletes an invite link so it can no longer be used
+func (h *Hub) RevokeInviteToken(c *client.Client, roomID, token string) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, err := h.authorizeInviteLocked(roomID, memberID)
+	h.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if !r.RevokeToken(token) {
+		return &Error{Code: protocol.ErrCodeInvalidInvite, Message: "Invite not found"}
+	}
+
+	if h.memberStore != nil {
+		ctx := logContext(c, roomID)
+		go func() {
+			if _, err := h.memberStore.RevokeInviteToken(ctx, roomID, token); err != nil {
+				slog.ErrorContext(ctx, "Failed to revoke invite token", "err", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// ListInviteTokens returns a room's usable invite links, oldest first
+func (h *Hub) ListInviteTokens(c *client.Client, roomID string) ([]protocol.InviteInfo, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, err := h.authorizeInviteLocked(roomID, memberID)
+	h.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := r.Tokens(time.Now())
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+
+	infos := make([]protocol.InviteInfo, len(tokens))
+	for i, t := range tokens {
+		infos[i] = inviteTokenToProtocol(t)
+	}
+	return infos, nil
+}
+
+// authorizeInviteLocked checks that a member may manage a room's invite links
+// Must be called with h.mu held
+func (h *Hub) authorizeInviteLocked(roomID, memberID string) (*room.Room, error) {
+	r, exists := h.rooms[roomID]
+	if !exists {
+		return nil, &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+
+	role := r.Role(memberID)
+	if role == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	if !room.RoleAtLeast(role, permInvite) {
+		return nil, &Error{Code: protocol.ErrCodePermissionDenied, Message: "Insufficient role"}
+	}
+
+	return r, nil
+}
+
+// roomForTokenLocked finds the room a usable invite link belongs to
+// Must be called with h.mu held
+func (h *Hub) roomForTokenLocked(token string, now time.Time) string {
+	for id, r := range h.rooms {
+		if r.HasToken(token, now) {
+			return id
+		}
+	}
+	return ""
+}
+
+// loadInvitesLocked restores a room's pending invitations and invite links
+// Must be called with h.mu held
+func (h *Hub) loadInvitesLocked(ctx context.Context, r *room.Room) {
+	invites, err := h.memberStore.GetInvites(ctx, r.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load invites", "room_id", r.ID, "err", err)
+	}
+	for _, inv := range invites {
+		r.AddInvite(room.Invite{
+			UserID:            inv.UserID,
+			Username:          inv.Username,
+			InvitedBy:         inv.InvitedBy,
+			InvitedByUsername: inv.InvitedByUsername,
+			CreatedAt:         inv.CreatedAt,
+		})
+	}
+
+	tokens, err := h.memberStore.GetInviteTokens(ctx, r.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to load invite tokens", "room_id", r.ID, "err", err)
+	}
+	for _, t := range tokens {
+		token := room.InviteToken{
+			Token:             t.Token,
+			CreatedBy:         t.CreatedBy,
+			CreatedByUsername: t.CreatedByUsername,
+			MaxUses:           t.MaxUses,
+			Uses:              t.Uses,
+			CreatedAt:         t.CreatedAt,
+		}
+		if t.ExpiresAt != nil {
+			token.ExpiresAt = *t.ExpiresAt
+		}
+		r.AddToken(token)
+	}
+}
+
+// newInviteToken generates a random, URL-safe invite token
+func newInviteToken() (string, error) {
+	b := make([]byte, inviteTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// inviteTokenToProtocol converts an invite link to its wire format
+func inviteTokenToProtocol(t room.InviteToken) protocol.InviteInfo {
+	info := protocol.InviteInfo{
+		Token:     t.Token,
+		CreatedBy: protocol.UserInfo{UserID: t.CreatedBy, Username: t.CreatedByUsername},
+		MaxUses:   t.MaxUses,
+		Uses:      t.Uses,
+		CreatedAt: t.CreatedAt.UnixMilli(),
+	}
+	if !t.ExpiresAt.IsZero() {
+		info.ExpiresAt = t.ExpiresAt.UnixMilli()
+	}
+	return info
+}
@@ -0,0 +1,109 @@
+package hub
+
+import (
+	"log/slog"
+	"regexp"
+	"time"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/room"
+)
+
+// mentionRegex matches @username tokens that don't continue a word (e.g. an email address)
+var mentionRegex = regexp.MustCompile(`(?:^|[^a-zA-Z0-9_-])@([a-zA-Z0-9_-]{3,20})`)
+
+// parseMentions returns the room members @mentioned in content, in order of
+// first appearance. Users mentioning themselves are not notified.
+func parseMentions(content string, members []protocol.UserInfo, senderID string) []protocol.UserInfo {
+	byName := make(map[string]protocol.UserInfo, len(members))
+	for _, m := range members {
+		byName[m.Username] = m
+	}
+
+	var mentioned []protocol.UserInfo
+	seen := make(map[string]bool)
+	for _, match := range mentionRegex.FindAllStringSubmatch(content, -1) {
+		member, ok := byName[match[1]]
+		if !ok || member.UserID == senderID || seen[member.UserID] {
+			continue
+		}
+		seen[member.UserID] = true
+		mentioned = append(mentioned, member)
+	}
+	return mentioned
+}
+
+// notifyMentionsLocked sends a mentioned event to each mentioned user's connections
+// Must be called with h.mu held
+func (h *Hub) notifyMentionsLocked(r *room.Room, mentioned []protocol.UserInfo, msg protocol.IncomingRoomMessage) {
+	mention := protocol.MentionInfo{
+		RoomID:   r.ID,
+		RoomName: r.Name,
+		Message:  msg,
+	}
+	for _, user := range mentioned {
+		if h.hasBlockedLocked(user.UserID, msg.FromID) {
+			continue
+		}
+		h.sendToUserLocked(user.UserID, "", protocol.TypeMentioned, mention)
+	}
+}
+
+// GetMentions retrieves the client's recent mentions across all their rooms
+func (h *Hub) GetMentions(c *client.Client, limit int, before time.Time) (*protocol.MentionsResponsePayload, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Mentions are only recorded for stored messages
+	if h.messageStore == nil || c.UserID == "" {
+		return &protocol.MentionsResponsePayload{
+			Mentions: []protocol.MentionInfo{},
+			HasMore:  false,
+		}, nil
+	}
+
+	// Default limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	ctx := c.LogContext()
+
+	// Fetch one extra to detect if there are more mentions
+	messages, err := h.messageStore.GetMentions(ctx, c.UserID, limit+1, before)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get mentions", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch mentions"}
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	protoMessages := make([]protocol.IncomingRoomMessage, len(messages))
+	for i, msg := range messages {
+		protoMessages[i] = roomMessageToProtocol(msg)
+	}
+	h.attachReactions(ctx, protoMessages)
+	h.attachAttachments(ctx, protoMessages)
+	h.attachThreadSummaries(ctx, protoMessages)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	mentions := make([]protocol.MentionInfo, len(protoMessages))
+	for i, msg := range protoMessages {
+		mentions[i] = protocol.MentionInfo{RoomID: msg.RoomID, Message: msg}
+		if r, ok := h.rooms[msg.RoomID]; ok {
+			mentions[i].RoomName = r.Name
+		}
+	}
+
+	return &protocol.MentionsResponsePayload{
+		Mentions: mentions,
+		HasMore:  hasMore,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package hub
+
+import (
+	"log/slog"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/room"
+)
+
+// UpdateRoom changes a room's name, topic and/or description and notifies
+// members; updates to public rooms also go to every registered client, like
+// room_created. Nil fields are left unchanged. Requires the admin role or above.
+func (h *Hub) UpdateRoom(c *client.Client, roomID string, name, topic, description *string) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if name == nil && topic == nil && description == nil {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Nothing to update"}
+	}
+	if name != nil && !roomNameRegex.MatchString(*name) {
+		return &Error{Code: protocol.ErrCodeInvalidRoomName, Message: "Room name must be 1-50 characters"}
+	}
+	if topic != nil && !roomTopicRegex.MatchString(*topic) {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Room topic must be at most 250 characters on one line"}
+	}
+	if description != nil && !roomDescriptionRegex.MatchString(*description) {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Room description must be at most 1000 characters"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	ctx := logContext(c, roomID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, exists := h.rooms[roomID]
+	if !exists {
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if !r.HasMember(memberID) {
+		return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	if !room.RoleAtLeast(r.Role(memberID), permSettings) {
+		return &Error{Code: protocol.ErrCodePermissionDenied, Message: "Only room admins can update the room"}
+	}
+
+	newName, newTopic, newDescription := r.Name, r.Topic, r.Description
+	if name != nil {
+		newName = *name
+	}
+	if topic != nil {
+		newTopic = *topic
+	}
+	if description != nil {
+		newDescription = *description
+	}
+
+	// Persist before changing the in-memory room so the two can't diverge
+	if h.roomStore != nil {
+		updated, err := h.roomStore.UpdateMetadata(ctx, roomID, newName, newTopic, newDescription)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to update room", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to update room"}
+		}
+		if updated == nil {
+			return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+		}
+	}
+
+	r.SetMetadata(newName, newTopic, newDescription)
+
+	payload := protocol.RoomUpdatedPayload{
+		Room:      r.Info(),
+		UpdatedBy: protocol.UserInfo{UserID: memberID, Username: c.Username},
+	}
+	if r.IsPublic {
+		h.broadcastLocked("", protocol.TypeRoomUpdated, payload)
+	} else {
+		h.broadcastToRoomLocked(roomID, "", protocol.TypeRoomUpdated, payload)
+	}
+
+	return nil
+}
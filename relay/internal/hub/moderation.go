@@ -0,0 +1,252 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/logging"
+	"haven/internal/moderation"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// rejectionMessages explains the built-in rejection reasons to senders
+var rejectionMessages = map[string]string{
+	moderation.ReasonEmpty:   "Message content cannot be empty",
+	moderation.ReasonTooLong: "Message is too long",
+}
+
+// SetModeration sets the pipeline new and edited messages pass through
+func (h *Hub) SetModeration(p *moderation.Pipeline) {
+	h.moderation = p
+}
+
+// moderate runs a message through the moderation pipeline
+// A rejection is returned as a MESSAGE_REJECTED error carrying the reason code
+func (h *Hub) moderate(m moderation.Message) (moderation.Verdict, error) {
+	v := h.moderation.Check(m)
+	if v.Action != moderation.Reject {
+		return v, nil
+	}
+
+	message, ok := rejectionMessages[v.Reason]
+	if !ok {
+		message = "Message blocked by content filter"
+	}
+	return v, &Error{Code: protocol.ErrCodeMessageRejected, Message: message, Reason: v.Reason}
+}
+
+// holdMessage quarantines a message for review instead of delivering it and
+// tells the sender. Without message storage the message is dropped.
+// Attachments of a held room message stay pending while it awaits review.
+func (h *Hub) holdMessage(ctx context.Context, from *client.Client, held *postgres.QuarantinedMessage, notice protocol.MessageHeldPayload) error {
+	if h.messageStore != nil {
+		if _, err := h.messageStore.Quarantine(ctx, held); err != nil {
+			slog.ErrorContext(ctx, "Failed to quarantine message", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to store message"}
+		}
+	}
+
+	slog.InfoContext(ctx, "Held message for review", "reason", held.Reason)
+	return from.SendMessage(protocol.TypeMessageHeld, notice)
+}
+
+// holdDirectMessage quarantines a direct message, resolving the recipient's ID
+func (h *Hub) holdDirectMessage(from *client.Client, fromID, toUsername, content, clientMsgID, reason string) error {
+	ctx := from.LogContext()
+
+	h.mu.RLock()
+	toID, online := h.usernames[toUsername]
+	h.mu.RUnlock()
+
+	if !online {
+		if h.userStore == nil {
+			return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+		}
+		recipient, err := h.userStore.GetByUsername(ctx, toUsername)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get user", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+		}
+		if recipient == nil {
+			return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+		}
+		toID = recipient.ID
+	}
+
+	return h.holdMessage(ctx, from, &postgres.QuarantinedMessage{
+		RecipientID:    toID,
+		SenderID:       fromID,
+		SenderUsername: from.Username,
+		Content:        content,
+		Reason:         reason,
+		ClientMsgID:    clientMsgID,
+	}, protocol.MessageHeldPayload{
+		To:          toUsername,
+		ClientMsgID: clientMsgID,
+		Reason:      reason,
+	})
+}
+
+// AdminHeldMessages lists messages held for review, oldest first, either all
+// of them or those held in one room. Without message storage nothing is held.
+func (h *Hub) AdminHeldMessages(roomID string, limit int) ([]protocol.AdminHeldMessage, error) {
+	messages := make([]protocol.AdminHeldMessage, 0)
+	if h.messageStore == nil {
+		return messages, nil
+	}
+	if _, err := uuid.Parse(roomID); roomID != "" && err != nil {
+		return messages, nil
+	}
+
+	held, err := h.messageStore.GetQuarantined(context.Background(), roomID, adminListLimit(limit))
+	if err != nil {
+		slog.Error("Failed to get held messages", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	for _, m := range held {
+		messages = append(messages, protocol.AdminHeldMessage{
+			ID:            m.ID,
+			RoomID:        m.RoomID,
+			ToID:          m.RecipientID,
+			From:          m.SenderUsername,
+			FromID:        m.SenderID,
+			Content:       m.Content,
+			Reason:        m.Reason,
+			ThreadID:      m.ThreadID,
+			ReplyTo:       m.ReplyTo,
+			AttachmentIDs: m.AttachmentIDs,
+			HeldAt:        m.CreatedAt.UnixMilli(),
+		})
+	}
+	return messages, nil
+}
+
+// ReleaseHeldMessage approves a held message and delivers it as it was sent,
+// without running it through the filters again. The message stays held if it
+// can't be delivered, e.g. because its sender has since left the room.
+func (h *Hub) ReleaseHeldMessage(id string) error {
+	ctx := logging.With(context.Background(), "held_message_id", id)
+
+	held, err := h.takeHeldMessage(ctx, id, func(held *postgres.QuarantinedMessage) error {
+		if held.RoomID != "" {
+			return h.releaseRoomMessage(ctx, held)
+		}
+		return h.releaseDirectMessage(ctx, held)
+	})
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Admin released held message", "reason", held.Reason)
+	return nil
+}
+
+// DiscardHeldMessage rejects a held message; cleanup deletes its uploads
+func (h *Hub) DiscardHeldMessage(id string) error {
+	ctx := logging.With(context.Background(), "held_message_id", id)
+
+	held, err := h.takeHeldMessage(ctx, id, func(*postgres.QuarantinedMessage) error { return nil })
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Admin discarded held message", "reason", held.Reason)
+	return nil
+}
+
+// takeHeldMessage removes a message from review once handle succeeds
+// Errors from handle are returned as they are
+func (h *Hub) takeHeldMessage(ctx context.Context, id string, handle func(*postgres.QuarantinedMessage) error) (*postgres.QuarantinedMessage, error) {
+	notFound := &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Held message not found"}
+	if h.messageStore == nil {
+		return nil, notFound
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, notFound
+	}
+
+	held, err := h.messageStore.TakeQuarantined(ctx, id, handle)
+	var hubErr *Error
+	if errors.As(err, &hubErr) {
+		return nil, err
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to take held message", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	if held == nil {
+		return nil, notFound
+	}
+	return held, nil
+}
+
+// releaseRoomMessage posts a released message to its room
+func (h *Hub) releaseRoomMessage(ctx context.Context, held *postgres.QuarantinedMessage) error {
+	ctx = logging.With(ctx, "room_id", held.RoomID)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, exists := h.rooms[held.RoomID]
+	if !exists {
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if !r.HasMember(held.SenderID) {
+		return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Sender is no longer in the room"}
+	}
+
+	_, _, err := h.postRoomMessageLocked(ctx, r, held.SenderID, held.SenderUsername, held.Content, postgres.MessageOptions{
+		ThreadID:    held.ThreadID,
+		ReplyTo:     held.ReplyTo,
+		ClientMsgID: held.ClientMsgID,
+	}, held.AttachmentIDs)
+	return err
+}
+
+// releaseDirectMessage delivers a released direct message, or stores it until
+// the recipient next logs in. A message to someone who has since blocked the
+// sender is dropped.
+func (h *Hub) releaseDirectMessage(ctx context.Context, held *postgres.QuarantinedMessage) error {
+	if h.dmStore == nil || h.userStore == nil {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to store message"}
+	}
+
+	recipient, err := h.userStore.GetByID(ctx, held.RecipientID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get user", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	if recipient == nil {
+		return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	}
+	if h.hasBlocked(ctx, recipient.ID, held.SenderID) {
+		slog.InfoContext(ctx, "Dropped released message to a user who blocked its sender")
+		return nil
+	}
+
+	h.mu.RLock()
+	toClients := h.sessionsLocked(recipient.ID)
+	fromClients := h.sessionsLocked(held.SenderID)
+	h.mu.RUnlock()
+
+	saved, created, err := h.dmStore.Save(ctx, held.SenderID, held.SenderUsername, recipient.ID, recipient.Username,
+		held.Content, held.ClientMsgID, len(toClients) > 0)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save direct message", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to store message"}
+	}
+	if !created {
+		// The sender already got the same message through
+		return nil
+	}
+
+	// The sender's devices get it too, confirming the client_msg_id
+	msg := directMessageToProtocol(saved)
+	for _, c := range append(fromClients, toClients...) {
+		_ = c.SendMessage(protocol.TypeDirectMsg, msg)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// Maximum number of pinned messages per room
+const maxPinsPerRoom = 50
+
+// PinMessage pins a room message and broadcasts the updated pin list
+// Any room member may pin a message
+func (h *Hub) PinMessage(c *client.Client, roomID, messageID string) error {
+	return h.changePin(c, roomID, messageID, true)
+}
+
+// UnpinMessage unpins a room message and broadcasts the updated pin list
+// Any room member may unpin a message
+func (h *Hub) UnpinMessage(c *client.Client, roomID, messageID string) error {
+	return h.changePin(c, roomID, messageID, false)
+}
+
+// changePin pins or unpins a message and notifies the room if anything changed
+func (h *Hub) changePin(c *client.Client, roomID, messageID string, pin bool) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, exists := h.rooms[roomID]
+	if !exists {
+		h.mu.RUnlock()
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if !r.HasMember(memberID) {
+		h.mu.RUnlock()
+		return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	h.mu.RUnlock()
+
+	// Messages only exist in storage; without it there is nothing to pin
+	if h.messageStore == nil {
+		return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+	if _, err := uuid.Parse(messageID); err != nil {
+		return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	ctx := logContext(c, roomID)
+	action := "unpinned"
+	var changed bool
+
+	if pin {
+		msg, err := h.messageStore.GetByID(ctx, messageID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get message", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+		}
+		if msg == nil || msg.RoomID != roomID || msg.IsDeleted() {
+			return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+		}
+
+		action = "pinned"
+		var full bool
+		changed, full, err = h.messageStore.PinMessage(ctx, roomID, messageID, memberID, c.Username, maxPinsPerRoom)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to pin message", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to pin message"}
+		}
+		if full {
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Too many pinned messages in this room"}
+		}
+	} else {
+		var err error
+		changed, err = h.messageStore.UnpinMessage(ctx, roomID, messageID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to unpin message", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to unpin message"}
+		}
+	}
+
+	if !changed {
+		// Already in the requested state - nothing to broadcast
+		return nil
+	}
+
+	update := h.pinsUpdate(ctx, roomID, action, messageID, memberID, c.Username)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.broadcastToRoomLocked(roomID, "", protocol.TypeRoomPinsUpdated, update)
+
+	return nil
+}
+
+// pinsUpdate builds a room_pins_updated payload carrying the room's current pins
+func (h *Hub) pinsUpdate(ctx context.Context, roomID, action, messageID, userID, username string) protocol.RoomPinsUpdatedPayload {
+	return protocol.RoomPinsUpdatedPayload{
+		RoomID:    roomID,
+		Action:    action,
+		MessageID: messageID,
+		UserID:    userID,
+		Username:  username,
+		Pins:      h.getPins(ctx, roomID),
+	}
+}
+
+// GetPins returns a room's pinned messages, most recently pinned first
+// Returns an empty list without storage or on error
+func (h *Hub) GetPins(roomID string) []protocol.PinnedMessage {
+	return h.getPins(context.Background(), roomID)
+}
+
+// getPins loads a room's pinned messages
+func (h *Hub) getPins(ctx context.Context, roomID string) []protocol.PinnedMessage {
+	if h.messageStore == nil {
+		return []protocol.PinnedMessage{}
+	}
+
+	pins, err := h.messageStore.GetPins(ctx, roomID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get pins", "err", err)
+		return []protocol.PinnedMessage{}
+	}
+	return h.pinsToProtocol(ctx, pins)
+}
+
+// pinsToProtocol converts stored pins, attaching reactions and thread summaries
+func (h *Hub) pinsToProtocol(ctx context.Context, pins []*postgres.Pin) []protocol.PinnedMessage {
+	messages := make([]protocol.IncomingRoomMessage, len(pins))
+	for i, pin := range pins {
+		messages[i] = roomMessageToProtocol(pin.Message)
+	}
+	h.attachReactions(ctx, messages)
+	h.attachAttachments(ctx, messages)
+	h.attachThreadSummaries(ctx, messages)
+
+	result := make([]protocol.PinnedMessage, len(pins))
+	for i, pin := range pins {
+		result[i] = protocol.PinnedMessage{
+			Message:    messages[i],
+			PinnedBy:   pin.PinnedByUsername,
+			PinnedByID: pin.PinnedBy,
+			PinnedAt:   pin.PinnedAt.UnixMilli(),
+		}
+	}
+	return result
+}
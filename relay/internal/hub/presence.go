@@ -0,0 +1,318 @@
+package hub
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/room"
+)
+
+// Presence states. Invisible users appear offline to everyone else.
+const (
+	PresenceOnline    = "online"
+	PresenceAway      = "away"
+	PresenceDND       = "dnd"
+	PresenceInvisible = "invisible"
+	PresenceOffline   = "offline" // Never set by clients
+)
+
+const (
+	// How long a connection may stay silent before its user is marked away
+	idleTimeout = 5 * time.Minute
+
+	// Longest custom status text, in characters
+	maxStatusLength = 100
+
+	// Longest custom status lifetime
+	maxStatusLifetime = 7 * 24 * time.Hour
+)
+
+// presenceState tracks a user's presence while they are connected.
+// Presence is never persisted; it resets to online on every login.
+type presenceState struct {
+	state           string // Chosen by the user: online, away, dnd or invisible
+	idle            bool   // Set by idle detection, cleared by activity
+	status          string // Custom status text
+	statusExpiresAt time.Time
+	idleTimer       *time.Timer
+	statusTimer     *time.Timer
+}
+
+// effective returns the state other users should see
+func (p *presenceState) effective() string {
+	if p.state == PresenceInvisible {
+		return PresenceOffline
+	}
+	if p.idle && p.state == PresenceOnline {
+		return PresenceAway
+	}
+	return p.state
+}
+
+// validPresence reports whether a client may choose the given state
+func validPresence(state string) bool {
+	switch state {
+	case PresenceOnline, PresenceAway, PresenceDND, PresenceInvisible:
+		return true
+	}
+	return false
+}
+
+// SetPresence changes the client's presence state and/or custom status and
+// broadcasts the change. An empty state keeps the current one; a nil status
+// keeps the current status, an empty one clears it. statusExpiresIn of 0
+// keeps the status until it is changed.
+func (h *Hub) SetPresence(c *client.Client, state string, status *string, statusExpiresIn time.Duration) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if state != "" && !validPresence(state) {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "State must be online, away, dnd or invisible"}
+	}
+	if status != nil && utf8.RuneCountInString(*status) > maxStatusLength {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Status must be at most 100 characters"}
+	}
+	if statusExpiresIn < 0 || statusExpiresIn > maxStatusLifetime {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Status expiry must be at most 7 days"}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.presenceMu.Lock()
+	p, ok := h.presence[c.UserID]
+	if !ok {
+		h.presenceMu.Unlock()
+		return nil
+	}
+
+	before := p.effective()
+	if state != "" {
+		p.state = state
+	}
+	if status != nil {
+		p.status = *status
+		p.statusExpiresAt = time.Time{}
+		if p.statusTimer != nil {
+			p.statusTimer.Stop()
+			p.statusTimer = nil
+		}
+		if p.status != "" && statusExpiresIn > 0 {
+			p.statusExpiresAt = time.Now().Add(statusExpiresIn)
+			userID := c.UserID
+			p.statusTimer = time.AfterFunc(statusExpiresIn, func() { h.expireStatus(userID, p) })
+		}
+	}
+	after := p.effective()
+	h.presenceMu.Unlock()
+
+	h.announcePresenceLocked(c.UserID, before, after)
+	return nil
+}
+
+// Touch records activity on a connection, resetting idle detection and
+// bringing an idle user back online
+func (h *Hub) Touch(c *client.Client) {
+	if c.Username == "" {
+		return
+	}
+
+	h.presenceMu.Lock()
+	p, ok := h.presence[c.UserID]
+	if !ok {
+		h.presenceMu.Unlock()
+		return
+	}
+	p.idleTimer.Reset(idleTimeout)
+	wasIdle := p.idle
+	before := p.effective()
+	p.idle = false
+	after := p.effective()
+	h.presenceMu.Unlock()
+
+	if wasIdle {
+		h.mu.RLock()
+		defer h.mu.RUnlock()
+		h.announcePresenceLocked(c.UserID, before, after)
+	}
+}
+
+// startPresenceLocked begins tracking presence for a newly registered user
+// Must be called with h.mu held
+func (h *Hub) startPresenceLocked(userID string) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	if old, ok := h.presence[userID]; ok {
+		old.stopTimers()
+	}
+	p := &presenceState{state: PresenceOnline}
+	p.idleTimer = time.AfterFunc(idleTimeout, func() { h.markIdle(userID, p) })
+	h.presence[userID] = p
+}
+
+// stopPresenceLocked stops tracking presence for a disconnected user
+// Returns true if the user was invisible (others already consider them offline)
+// Must be called with h.mu held
+func (h *Hub) stopPresenceLocked(userID string) bool {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	p, ok := h.presence[userID]
+	if !ok {
+		return false
+	}
+	p.stopTimers()
+	delete(h.presence, userID)
+	return p.state == PresenceInvisible
+}
+
+// stopTimers cancels the idle and status timers
+func (p *presenceState) stopTimers() {
+	p.idleTimer.Stop()
+	if p.statusTimer != nil {
+		p.statusTimer.Stop()
+	}
+}
+
+// markIdle is called by the idle timer when a connection has been silent too long
+func (h *Hub) markIdle(userID string, p *presenceState) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.presenceMu.Lock()
+	if h.presence[userID] != p || p.idle {
+		// Disconnected, replaced or already idle in the meantime
+		h.presenceMu.Unlock()
+		return
+	}
+	before := p.effective()
+	p.idle = true
+	after := p.effective()
+	h.presenceMu.Unlock()
+
+	h.announcePresenceLocked(userID, before, after)
+}
+
+// expireStatus is called by the status timer when a custom status runs out
+func (h *Hub) expireStatus(userID string, p *presenceState) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.presenceMu.Lock()
+	if h.presence[userID] != p || p.statusExpiresAt.IsZero() || time.Now().Before(p.statusExpiresAt) {
+		// Disconnected or status changed in the meantime
+		h.presenceMu.Unlock()
+		return
+	}
+	p.status = ""
+	p.statusExpiresAt = time.Time{}
+	p.statusTimer = nil
+	state := p.effective()
+	h.presenceMu.Unlock()
+
+	h.announcePresenceLocked(userID, state, state)
+}
+
+// announcePresenceLocked tells other users about a presence change. Going
+// invisible looks like disconnecting and coming back like reconnecting; the
+// user's own connections always get the real state.
+// Must be called with h.mu held
+func (h *Hub) announcePresenceLocked(userID, before, after string) {
+	sessions := h.sessionsLocked(userID)
+	if len(sessions) == 0 {
+		return
+	}
+	username := sessions[0].Username
+
+	payload := h.presencePayloadLocked(userID, username)
+
+	// The user's own connections see their chosen state, not "offline"
+	self := payload
+	h.presenceMu.Lock()
+	if p, ok := h.presence[userID]; ok && p.state == PresenceInvisible {
+		self.Presence = PresenceInvisible
+	}
+	h.presenceMu.Unlock()
+	h.sendToUserLocked(userID, "", protocol.TypePresenceChanged, self)
+
+	switch {
+	case after == PresenceOffline && before != PresenceOffline:
+		h.broadcastExceptUserLocked(userID, protocol.TypeUserLeft, protocol.UserLeftPayload{
+			UserID:   userID,
+			Username: username,
+		})
+	case after != PresenceOffline && before == PresenceOffline:
+		h.broadcastExceptUserLocked(userID, protocol.TypeUserJoined, protocol.UserJoinedPayload{
+			UserID:   userID,
+			Username: username,
+		})
+		h.broadcastExceptUserLocked(userID, protocol.TypePresenceChanged, payload)
+	case after != PresenceOffline:
+		h.broadcastExceptUserLocked(userID, protocol.TypePresenceChanged, payload)
+	}
+}
+
+// presencePayloadLocked builds the presence_changed payload others should see
+// Must be called with h.mu held
+func (h *Hub) presencePayloadLocked(userID, username string) protocol.PresenceChangedPayload {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	payload := protocol.PresenceChangedPayload{
+		UserID:   userID,
+		Username: username,
+		Presence: PresenceOffline,
+	}
+	if p, ok := h.presence[userID]; ok {
+		payload.Presence = p.effective()
+		if payload.Presence != PresenceOffline {
+			payload.Status = p.status
+			if !p.statusExpiresAt.IsZero() {
+				payload.StatusExpiresAt = p.statusExpiresAt.UnixMilli()
+			}
+		}
+	}
+	return payload
+}
+
+// withPresenceLocked fills in the presence of each user as others see it
+// Must be called with h.mu held
+func (h *Hub) withPresenceLocked(users []protocol.UserInfo) []protocol.UserInfo {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	for i := range users {
+		users[i].Presence = PresenceOffline
+		if p, ok := h.presence[users[i].UserID]; ok {
+			users[i].Presence = p.effective()
+			if users[i].Presence != PresenceOffline {
+				users[i].Status = p.status
+			}
+		}
+	}
+	return users
+}
+
+// roomMembersLocked returns a room's member list with presence
+// Must be called with h.mu held
+func (h *Hub) roomMembersLocked(r *room.Room) []protocol.UserInfo {
+	return h.withPresenceLocked(r.MemberInfoList())
+}
+
+// memberInfoLocked returns one room member's info with presence
+// Must be called with h.mu held
+func (h *Hub) memberInfoLocked(r *room.Room, userID string) protocol.UserInfo {
+	info, _ := r.MemberInfo(userID)
+	return h.withPresenceLocked([]protocol.UserInfo{info})[0]
+}
+
+// RoomMembers returns a room's member list with presence
+func (h *Hub) RoomMembers(r *room.Room) []protocol.UserInfo {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.roomMembersLocked(r)
+}
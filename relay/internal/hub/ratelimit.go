@@ -0,0 +1,110 @@
+package hub
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/ratelimit"
+)
+
+// Rate limit classes group message types that share a budget
+const (
+	RateLimitMessages      = "messages"
+	RateLimitRoomCreates   = "room_creates"
+	RateLimitRegistrations = "registrations"
+	RateLimitHistory       = "history"
+)
+
+// rateLimitClasses maps message types to their rate limit class
+// Unlisted types are not rate limited
+var rateLimitClasses = map[protocol.MessageType]string{
+	protocol.TypeDirectMsg:      RateLimitMessages,
+	protocol.TypeRoomMessage:    RateLimitMessages,
+	protocol.TypeRoomMsgEdit:    RateLimitMessages,
+	protocol.TypeReactionAdd:    RateLimitMessages,
+	protocol.TypeReactionRemove: RateLimitMessages,
+	protocol.TypeReport:         RateLimitMessages,
+	protocol.TypeRoomCreate:     RateLimitRoomCreates,
+	protocol.TypeRegister:       RateLimitRegistrations,
+	protocol.TypeRoomHistory:    RateLimitHistory,
+	protocol.TypeThreadHistory:  RateLimitHistory,
+	protocol.TypeDMHistory:      RateLimitHistory,
+	protocol.TypeSync:           RateLimitHistory,
+	protocol.TypeMentions:       RateLimitHistory,
+	protocol.TypeMessageSearch:  RateLimitHistory,
+	protocol.TypeReportList:     RateLimitHistory,
+}
+
+// RateLimit is the budget of one rate limit class
+// Conn applies to each connection, User to all of a user's connections together
+// Registration attempts happen before there is a user, so only Conn applies to them
+type RateLimit struct {
+	Conn ratelimit.Limit
+	User ratelimit.Limit
+}
+
+// rateLimiter holds the buckets of one rate limit class
+type rateLimiter struct {
+	conn *ratelimit.Limiter
+	user *ratelimit.Limiter
+}
+
+// Rejected requests a connection may make before it is disconnected
+// Each rejection uses up a strike; strikes come back over the period
+var rateLimitStrikes = ratelimit.Limit{Burst: 20, Per: time.Minute}
+
+// SetRateLimits sets the rate limit of each class
+// Classes left out are not rate limited
+func (h *Hub) SetRateLimits(limits map[string]RateLimit) {
+	h.rateLimits = make(map[string]*rateLimiter, len(limits))
+	for class, limit := range limits {
+		h.rateLimits[class] = &rateLimiter{
+			conn: ratelimit.New(limit.Conn),
+			user: ratelimit.New(limit.User),
+		}
+	}
+	h.strikes = ratelimit.New(rateLimitStrikes)
+}
+
+// CheckRateLimit spends a token for a message of the given type from the
+// client's connection and user buckets. A connection that keeps sending
+// after being rate limited is disconnected.
+func (h *Hub) CheckRateLimit(c *client.Client, msgType protocol.MessageType) error {
+	limiter := h.rateLimits[rateLimitClasses[msgType]]
+	if limiter == nil {
+		return nil
+	}
+
+	ok, retryAfter := limiter.conn.Allow(c.ID)
+	if ok && c.UserID != "" && msgType != protocol.TypeRegister {
+		ok, retryAfter = limiter.user.Allow(c.UserID)
+	}
+	if ok {
+		return nil
+	}
+
+	if allowed, _ := h.strikes.Allow(c.ID); !allowed {
+		slog.WarnContext(c.LogContext(), "Disconnecting client: rate limit exceeded repeatedly", "username", c.Username)
+		c.SetCloseStatus(websocket.ClosePolicyViolation, "Rate limit exceeded")
+		h.RemoveClient(c)
+	}
+
+	return &Error{
+		Code:       protocol.ErrCodeRateLimited,
+		Message:    "Too many requests, slow down",
+		RetryAfter: retryAfter,
+	}
+}
+
+// resetRateLimits forgets a closed connection's buckets
+// User buckets are kept, as the user may still be connected elsewhere
+func (h *Hub) resetRateLimits(connID string) {
+	for _, limiter := range h.rateLimits {
+		limiter.conn.Reset(connID)
+	}
+	h.strikes.Reset(connID)
+}
@@ -0,0 +1,158 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// maxEmojiLength is the maximum number of characters in a reaction
+// (long enough for multi-codepoint emoji such as flags and skin tones)
+const maxEmojiLength = 32
+
+// AddReaction adds an emoji reaction to a room message
+func (h *Hub) AddReaction(c *client.Client, roomID, messageID, emoji string) error {
+	return h.changeReaction(c, roomID, messageID, emoji, true)
+}
+
+// RemoveReaction removes an emoji reaction from a room message
+func (h *Hub) RemoveReaction(c *client.Client, roomID, messageID, emoji string) error {
+	return h.changeReaction(c, roomID, messageID, emoji, false)
+}
+
+// changeReaction adds or removes a reaction and broadcasts the new totals to the room
+func (h *Hub) changeReaction(c *client.Client, roomID, messageID, emoji string, add bool) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiLength || strings.ContainsAny(emoji, " \t\r\n") {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Invalid reaction"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, exists := h.rooms[roomID]
+	if !exists {
+		h.mu.RUnlock()
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if !r.HasMember(memberID) {
+		h.mu.RUnlock()
+		return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	// Muted users can still take their reactions back
+	if add && h.sanctionedLocked(postgres.SanctionMute, memberID, roomID) {
+		h.mu.RUnlock()
+		return &Error{Code: protocol.ErrCodeMuted, Message: "You are muted in this room"}
+	}
+	h.mu.RUnlock()
+
+	// Reactions reference persisted messages
+	if h.messageStore == nil {
+		return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	if _, err := uuid.Parse(messageID); err != nil {
+		return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	ctx := logContext(c, roomID)
+
+	msg, err := h.messageStore.GetByID(ctx, messageID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get message", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	if msg == nil || msg.RoomID != roomID || msg.IsDeleted() {
+		return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+	}
+
+	var changed bool
+	action := "added"
+	if add {
+		changed, err = h.messageStore.AddReaction(ctx, messageID, memberID, emoji)
+	} else {
+		action = "removed"
+		changed, err = h.messageStore.RemoveReaction(ctx, messageID, memberID, emoji)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update reaction", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to update reaction"}
+	}
+	if !changed {
+		// Duplicate add or remove of a missing reaction - nothing to broadcast
+		return nil
+	}
+
+	reactions, err := h.messageStore.GetReactions(ctx, []string{messageID})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get reactions", "err", err)
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to update reaction"}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.broadcastFromUserLocked(roomID, memberID, protocol.TypeReactionUpdated, protocol.ReactionUpdatedPayload{
+		RoomID:    roomID,
+		MessageID: messageID,
+		Emoji:     emoji,
+		UserID:    memberID,
+		Action:    action,
+		Reactions: reactionsToProtocol(reactions[messageID]),
+	})
+
+	return nil
+}
+
+// attachReactions fills in aggregated reactions on a batch of room messages
+func (h *Hub) attachReactions(ctx context.Context, messages []protocol.IncomingRoomMessage) {
+	if h.messageStore == nil || len(messages) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if !m.Deleted {
+			ids = append(ids, m.MessageID)
+		}
+	}
+
+	reactions, err := h.messageStore.GetReactions(ctx, ids)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get reactions", "err", err)
+		return
+	}
+
+	for i := range messages {
+		if counts, ok := reactions[messages[i].MessageID]; ok {
+			messages[i].Reactions = reactionsToProtocol(counts)
+		}
+	}
+}
+
+// reactionsToProtocol converts stored reaction counts to their wire format
+func reactionsToProtocol(counts []*postgres.ReactionCount) []protocol.ReactionInfo {
+	infos := make([]protocol.ReactionInfo, 0, len(counts))
+	for _, rc := range counts {
+		infos = append(infos, protocol.ReactionInfo{
+			Emoji:   rc.Emoji,
+			Count:   rc.Count,
+			UserIDs: rc.UserIDs,
+		})
+	}
+	return infos
+}
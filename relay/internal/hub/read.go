@@ -0,0 +1,123 @@
+package hub
+
+import (
+	"log/slog"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/room"
+	"haven/internal/storage/postgres"
+)
+
+// MarkRead advances the client's read cursor in a room and broadcasts a read
+// receipt to the room (including the user's own connection so every device
+// can clear its unread badge)
+func (h *Hub) MarkRead(c *client.Client, roomID, messageID string) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, exists := h.rooms[roomID]
+	if !exists {
+		h.mu.RUnlock()
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if !r.HasMember(memberID) {
+		h.mu.RUnlock()
+		return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	h.mu.RUnlock()
+
+	timestamp := protocol.NewEnvelopeTimestamp()
+
+	if h.messageStore != nil && h.memberStore != nil {
+		if _, err := uuid.Parse(messageID); err != nil {
+			return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+		}
+
+		ctx := logContext(c, roomID)
+
+		msg, err := h.messageStore.GetByID(ctx, messageID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get message", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+		}
+		if msg == nil || msg.RoomID != roomID {
+			return &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+		}
+
+		advanced, err := h.memberStore.MarkRead(ctx, roomID, memberID, messageID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to update read cursor", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to mark as read"}
+		}
+		if !advanced {
+			// Already read past this message - nothing changed
+			return nil
+		}
+		timestamp = msg.CreatedAt.UnixMilli()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	h.broadcastToRoomLocked(roomID, "", protocol.TypeReadReceipt, protocol.ReadReceiptPayload{
+		RoomID:    roomID,
+		UserID:    memberID,
+		Username:  c.Username,
+		MessageID: messageID,
+		Timestamp: timestamp,
+	})
+
+	return nil
+}
+
+// RoomInfoFor returns a room's public info together with the client's read state
+func (h *Hub) RoomInfoFor(c *client.Client, r *room.Room) protocol.RoomInfo {
+	info := r.Info()
+	if h.memberStore == nil || c.UserID == "" {
+		return info
+	}
+
+	ctx := logContext(c, r.ID)
+	state, err := h.memberStore.GetReadState(ctx, r.ID, c.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get read state", "err", err)
+		return info
+	}
+	applyReadState(&info, state)
+	return info
+}
+
+// readStatesFor loads the client's read state in all of their rooms
+func (h *Hub) readStatesFor(c *client.Client) map[string]*postgres.ReadState {
+	if h.memberStore == nil || c.UserID == "" {
+		return nil
+	}
+
+	ctx := c.LogContext()
+	states, err := h.memberStore.GetReadStates(ctx, c.UserID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get read states", "err", err)
+		return nil
+	}
+	return states
+}
+
+// applyReadState copies a member's read state onto room info
+func applyReadState(info *protocol.RoomInfo, state *postgres.ReadState) {
+	if state == nil {
+		return
+	}
+	info.UnreadCount = state.UnreadCount
+	info.LastReadMessageID = state.LastReadMessageID
+}
@@ -0,0 +1,394 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/room"
+	"haven/internal/storage/postgres"
+)
+
+const (
+	// Longest report details or resolution note, in characters
+	maxReportTextLength = 1000
+
+	// Reports returned by ListReports by default and at most
+	defaultReportListLimit = 50
+	maxReportListLimit     = 200
+
+	// How long a mute lasts when no duration is given
+	defaultMuteDuration = 24 * time.Hour
+)
+
+// reportCategories lists the reasons a report can give
+var reportCategories = map[string]bool{
+	"spam":       true,
+	"harassment": true,
+	"hate":       true,
+	"sexual":     true,
+	"violence":   true,
+	"other":      true,
+}
+
+// Report resolution actions
+const (
+	ResolveDismiss = "dismiss" // Take no action
+	ResolveDelete  = "delete"  // Delete the reported message
+	ResolveMute    = "mute"    // Mute the reported user in the room, or server-wide
+	ResolveBan     = "ban"     // Ban the reported user from the room, or the server
+)
+
+// ReportTarget identifies what a report is about
+type ReportTarget struct {
+	Type      string // postgres.ReportRoomMessage, ReportDirectMessage or ReportUser
+	RoomID    string // Room of a reported room message
+	MessageID string // Reported room or direct message
+	Username  string // Reported user (user reports only)
+}
+
+// Report files a report for moderators, keeping a snapshot of the reported
+// message. Room message reports go to the room's moderators; reports of
+// direct messages and users go to server admins. Returns the report ID.
+func (h *Hub) Report(c *client.Client, target ReportTarget, category, details string) (string, error) {
+	if c.Username == "" {
+		return "", &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+	if h.messageStore == nil || h.userStore == nil || c.UserID == "" {
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Reports are not available"}
+	}
+	if !reportCategories[category] {
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Unknown report category"}
+	}
+	if utf8.RuneCountInString(details) > maxReportTextLength {
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Report details must be at most 1000 characters"}
+	}
+
+	ctx := c.LogContext()
+	report := &postgres.Report{
+		ReporterID:       c.UserID,
+		ReporterUsername: c.Username,
+		TargetType:       target.Type,
+		Category:         category,
+		Details:          details,
+	}
+	notFound := &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Message not found"}
+
+	switch target.Type {
+	case postgres.ReportRoomMessage:
+		h.mu.RLock()
+		_, err := h.authorizeHistoryLocked(target.RoomID, c.UserID)
+		h.mu.RUnlock()
+		if err != nil {
+			return "", err
+		}
+		if _, err := uuid.Parse(target.MessageID); err != nil {
+			return "", notFound
+		}
+		msg, err := h.messageStore.GetByID(ctx, target.MessageID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get message", "err", err)
+			return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+		}
+		if msg == nil || msg.RoomID != target.RoomID || msg.IsDeleted() {
+			return "", notFound
+		}
+		report.RoomID = msg.RoomID
+		report.MessageID = msg.ID
+		report.ReportedUserID = msg.SenderID
+		report.ReportedUsername = msg.SenderUsername
+		report.Snapshot = msg.Content
+
+	case postgres.ReportDirectMessage:
+		if _, err := uuid.Parse(target.MessageID); err != nil || h.dmStore == nil {
+			return "", notFound
+		}
+		msg, err := h.dmStore.GetByID(ctx, target.MessageID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get direct message", "err", err)
+			return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+		}
+		// Only the recipient can report a direct message
+		if msg == nil || msg.RecipientID != c.UserID {
+			return "", notFound
+		}
+		report.MessageID = msg.ID
+		report.ReportedUserID = msg.SenderID
+		report.ReportedUsername = msg.SenderUsername
+		report.Snapshot = msg.Content
+
+	case postgres.ReportUser:
+		userID, err := h.resolveUserID(ctx, target.Username)
+		if err != nil {
+			return "", err
+		}
+		report.ReportedUserID = userID
+		report.ReportedUsername = target.Username
+
+	default:
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Report target must be room_message, direct_message or user"}
+	}
+
+	if report.ReportedUserID == c.UserID {
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Cannot report yourself"}
+	}
+
+	saved, err := h.messageStore.CreateReport(ctx, report)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save report", "err", err)
+		return "", &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to save report"}
+	}
+
+	slog.InfoContext(ctx, "Report filed", "report_id", saved.ID, "reported_user_id", saved.ReportedUserID, "category", category)
+	return saved.ID, nil
+}
+
+// ListReports returns reports, oldest first. Room moderators may list the
+// reports about their room; server admins may list any, or all, reports.
+// status is "open" (the default), "resolved" or "all".
+func (h *Hub) ListReports(c *client.Client, roomID, status string, limit int) ([]protocol.ReportInfo, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	switch status {
+	case "":
+		status = postgres.ReportOpen
+	case "all":
+		status = ""
+	case postgres.ReportOpen, postgres.ReportResolved:
+	default:
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Status must be open, resolved or all"}
+	}
+
+	if err := h.authorizeReports(c, roomID); err != nil {
+		return nil, err
+	}
+
+	if h.messageStore == nil {
+		return []protocol.ReportInfo{}, nil
+	}
+
+	if limit <= 0 {
+		limit = defaultReportListLimit
+	}
+	limit = min(limit, maxReportListLimit)
+
+	ctx := logContext(c, roomID)
+	reports, err := h.messageStore.ListReports(ctx, postgres.ReportFilter{
+		RoomID: roomID,
+		Status: status,
+		Limit:  limit,
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to list reports", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to list reports"}
+	}
+
+	infos := make([]protocol.ReportInfo, len(reports))
+	for i, r := range reports {
+		infos[i] = reportToProtocol(r)
+	}
+	return infos, nil
+}
+
+// ResolveReport closes an open report with an action against the reported
+// content or user. For room message reports, mutes and bans apply to the
+// room; otherwise they apply server-wide and only server admins may resolve.
+// A zero duration uses the default: one day for mutes, permanent for bans.
+func (h *Hub) ResolveReport(c *client.Client, reportID, action string, duration time.Duration, note string) (*protocol.ReportInfo, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+	if utf8.RuneCountInString(note) > maxReportTextLength {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Note must be at most 1000 characters"}
+	}
+	if duration < 0 {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Duration cannot be negative"}
+	}
+
+	notFound := &Error{Code: protocol.ErrCodeReportNotFound, Message: "Report not found"}
+	if h.messageStore == nil {
+		return nil, notFound
+	}
+	if _, err := uuid.Parse(reportID); err != nil {
+		return nil, notFound
+	}
+
+	ctx := c.LogContext()
+
+	report, err := h.messageStore.GetReport(ctx, reportID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get report", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	if report == nil {
+		return nil, notFound
+	}
+	if report.RoomID == "" && !h.isServerAdmin(c) {
+		// Other moderators can't see these reports
+		return nil, notFound
+	}
+	if err := h.authorizeReports(c, report.RoomID); err != nil {
+		return nil, err
+	}
+	if report.Status != postgres.ReportOpen {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Report already resolved"}
+	}
+
+	switch action {
+	case ResolveDismiss, ResolveDelete:
+	case ResolveMute, ResolveBan:
+		if err := h.authorizeSanction(c, report); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Action must be dismiss, delete, mute or ban"}
+	}
+
+	// The report is claimed before its action is applied, so two moderators
+	// can't both act on it; a failed action leaves it open
+	by := protocol.UserInfo{UserID: c.UserID, Username: c.Username}
+	resolved, err := h.messageStore.ResolveReport(ctx, report.ID, c.UserID, c.Username, action, note, func(report *postgres.Report) error {
+		switch action {
+		case ResolveDelete:
+			return h.deleteReportedMessage(ctx, report, by)
+		case ResolveMute, ResolveBan:
+			if action == ResolveMute && duration == 0 {
+				duration = defaultMuteDuration
+			}
+			kind := postgres.SanctionMute
+			if action == ResolveBan {
+				kind = postgres.SanctionBan
+			}
+			return h.applySanction(ctx, kind, report.ReportedUserID, report.RoomID, duration, "Report "+report.ID, by)
+		}
+		return nil
+	})
+	var hubErr *Error
+	if errors.As(err, &hubErr) {
+		return nil, err
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to resolve report", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to resolve report"}
+	}
+	if resolved == nil {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Report already resolved"}
+	}
+
+	slog.InfoContext(ctx, "Report resolved", "report_id", resolved.ID, "action", action)
+	info := reportToProtocol(resolved)
+	return &info, nil
+}
+
+// authorizeReports checks that the client may see and resolve the
+// reports of a room (or all reports, for an empty roomID)
+func (h *Hub) authorizeReports(c *client.Client, roomID string) error {
+	if h.isServerAdmin(c) {
+		return nil
+	}
+	if roomID == "" {
+		return &Error{Code: protocol.ErrCodePermissionDenied, Message: "Only server admins can see all reports"}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, exists := h.rooms[roomID]
+	if !exists {
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if !room.RoleAtLeast(r.Role(c.UserID), permModerate) {
+		return &Error{Code: protocol.ErrCodePermissionDenied, Message: "Only room moderators can see reports"}
+	}
+	return nil
+}
+
+// authorizeSanction checks that the client may mute or ban a report's target:
+// room moderators must outrank them, and server admins can't be sanctioned
+func (h *Hub) authorizeSanction(c *client.Client, report *postgres.Report) error {
+	if report.ReportedUserID == "" {
+		return &Error{Code: protocol.ErrCodeUserNotFound, Message: "User not found"}
+	}
+	if report.ReportedUserID == c.UserID {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Cannot sanction yourself"}
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.admins[report.ReportedUserID] {
+		return &Error{Code: protocol.ErrCodePermissionDenied, Message: "Cannot sanction a server admin"}
+	}
+	if h.admins[c.UserID] || report.RoomID == "" {
+		return nil
+	}
+
+	r, exists := h.rooms[report.RoomID]
+	if !exists {
+		return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+	if targetRole := r.Role(report.ReportedUserID); targetRole != "" && !room.Outranks(r.Role(c.UserID), targetRole) {
+		return &Error{Code: protocol.ErrCodePermissionDenied, Message: "Insufficient role"}
+	}
+	return nil
+}
+
+// deleteReportedMessage deletes the message a report is about
+// Messages deleted since the report was filed are left alone
+func (h *Hub) deleteReportedMessage(ctx context.Context, report *postgres.Report, by protocol.UserInfo) error {
+	switch report.TargetType {
+	case postgres.ReportRoomMessage:
+		err := h.redactRoomMessage(ctx, report.RoomID, report.MessageID, by.UserID, by.Username)
+		if hubErr, ok := err.(*Error); ok && hubErr.Code == protocol.ErrCodeMessageNotFound {
+			return nil
+		}
+		return err
+
+	case postgres.ReportDirectMessage:
+		if h.dmStore == nil {
+			return nil
+		}
+		if _, err := h.dmStore.Delete(ctx, report.MessageID); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete direct message", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to delete message"}
+		}
+		return nil
+
+	default:
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "User reports have no message to delete"}
+	}
+}
+
+// reportToProtocol converts a stored report to its wire format
+func reportToProtocol(r *postgres.Report) protocol.ReportInfo {
+	info := protocol.ReportInfo{
+		ID:           r.ID,
+		TargetType:   r.TargetType,
+		RoomID:       r.RoomID,
+		MessageID:    r.MessageID,
+		ReportedUser: protocol.UserInfo{UserID: r.ReportedUserID, Username: r.ReportedUsername},
+		Reporter:     protocol.UserInfo{UserID: r.ReporterID, Username: r.ReporterUsername},
+		Category:     r.Category,
+		Details:      r.Details,
+		Snapshot:     r.Snapshot,
+		Status:       r.Status,
+		CreatedAt:    r.CreatedAt.UnixMilli(),
+	}
+	if r.ResolvedAt != nil {
+		info.Resolution = &protocol.ReportResolution{
+			Action:     r.Resolution,
+			By:         protocol.UserInfo{UserID: r.ResolvedBy, Username: r.ResolvedByUsername},
+			Note:       r.ResolutionNote,
+			ResolvedAt: r.ResolvedAt.UnixMilli(),
+		}
+	}
+	return info
+}
@@ -0,0 +1,203 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/room"
+)
+
+// Minimum room role required for each kind of privileged action
+const (
+	permModerate = room.RoleModerator // Change others' messages, kick members
+	permInvite   = room.RoleModerator // Invite users to a private room
+	permSettings = room.RoleAdmin     // Change room metadata, assign roles
+)
+
+// SetMemberRole changes a member's role in a room and notifies members.
+// The actor needs the admin role or above and must outrank both the target's
+// current role and the role being granted. Ownership can't be granted here.
+func (h *Hub) SetMemberRole(c *client.Client, roomID, targetID, role string) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if !room.ValidRole(role) || role == room.RoleOwner {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Role must be admin, moderator or member"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, err := h.authorizeMemberActionLocked(roomID, memberID, targetID, permSettings)
+	if err != nil {
+		return err
+	}
+	actorRole := r.Role(memberID)
+	if !room.Outranks(actorRole, role) {
+		return &Error{Code: protocol.ErrCodePermissionDenied, Message: "Cannot grant a role equal to or above your own"}
+	}
+	if r.Role(targetID) == role {
+		return nil
+	}
+
+	if h.memberStore != nil {
+		ctx := logContext(c, roomID)
+		if _, err := h.memberStore.SetRole(ctx, roomID, targetID, role); err != nil {
+			slog.ErrorContext(ctx, "Failed to set member role", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to change role"}
+		}
+	}
+	r.SetRole(targetID, role)
+
+	target := h.memberInfoLocked(r, targetID)
+	h.broadcastToRoomLocked(roomID, "", protocol.TypeRoomMembers, protocol.RoomMembersPayload{
+		RoomID:  roomID,
+		Action:  "role_changed",
+		User:    target,
+		Members: h.roomMembersLocked(r),
+	})
+
+	return nil
+}
+
+// KickMember removes a member from a room and notifies them and the room.
+// The actor needs the moderator role or above and must outrank the target.
+func (h *Hub) KickMember(c *client.Client, roomID, targetID string) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, err := h.authorizeMemberActionLocked(roomID, memberID, targetID, permModerate)
+	if err != nil {
+		return err
+	}
+
+	h.removeMemberLocked(r, targetID, protocol.UserInfo{UserID: memberID, Username: c.Username})
+	return nil
+}
+
+// removeMemberLocked kicks a member out of a room and notifies them and the room
+// Must be called with h.mu held
+func (h *Hub) removeMemberLocked(r *room.Room, targetID string, by protocol.UserInfo) {
+	roomID := r.ID
+	target := h.memberInfoLocked(r, targetID)
+	r.RemoveMember(targetID)
+
+	// Remove from persistent membership
+	if h.memberStore != nil {
+		go func() { _ = h.memberStore.Kick(context.Background(), roomID, targetID) }()
+	}
+
+	h.stopTypingLocked(typingKey(targetID, roomID, ""))
+
+	// Tell the kicked user's connections, which no longer get room broadcasts
+	for _, kicked := range h.sessionsLocked(targetID) {
+		kicked.LeaveRoom(roomID)
+		_ = kicked.SendMessage(protocol.TypeRoomKicked, protocol.RoomKickedPayload{
+			RoomID:   roomID,
+			RoomName: r.Name,
+			By:       by,
+		})
+	}
+
+	h.broadcastToRoomLocked(roomID, "", protocol.TypeRoomMembers, protocol.RoomMembersPayload{
+		RoomID:  roomID,
+		Action:  "kicked",
+		User:    target,
+		Members: h.roomMembersLocked(r),
+	})
+}
+
+// TransferOwnership hands a room to another member and notifies members.
+// Only the owner may do this; they become an admin.
+func (h *Hub) TransferOwnership(c *client.Client, roomID, targetID string) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, err := h.authorizeMemberActionLocked(roomID, memberID, targetID, room.RoleOwner)
+	if err != nil {
+		return err
+	}
+
+	if h.memberStore != nil {
+		ctx := logContext(c, roomID)
+		ok, err := h.memberStore.TransferOwnership(ctx, roomID, memberID, targetID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to transfer ownership", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to transfer ownership"}
+		}
+		if !ok {
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to transfer ownership"}
+		}
+	}
+	r.SetRole(targetID, room.RoleOwner)
+	r.SetRole(memberID, room.RoleAdmin)
+
+	owner := h.memberInfoLocked(r, targetID)
+	h.broadcastToRoomLocked(roomID, "", protocol.TypeRoomMembers, protocol.RoomMembersPayload{
+		RoomID:  roomID,
+		Action:  "owner_changed",
+		User:    owner,
+		Members: h.roomMembersLocked(r),
+	})
+
+	return nil
+}
+
+// authorizeMemberActionLocked checks that actorID may act on another member of a
+// room: both must be members, the actor must hold at least minRole and must
+// outrank the target. Returns the room.
+// Must be called with h.mu held
+func (h *Hub) authorizeMemberActionLocked(roomID, actorID, targetID, minRole string) (*room.Room, error) {
+	r, exists := h.rooms[roomID]
+	if !exists {
+		return nil, &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+
+	actorRole := r.Role(actorID)
+	if actorRole == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	if actorID == targetID {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Cannot change your own membership"}
+	}
+
+	targetRole := r.Role(targetID)
+	if targetRole == "" {
+		return nil, &Error{Code: protocol.ErrCodeUserNotFound, Message: "User is not in room"}
+	}
+
+	if !room.RoleAtLeast(actorRole, minRole) || !room.Outranks(actorRole, targetRole) {
+		return nil, &Error{Code: protocol.ErrCodePermissionDenied, Message: "Insufficient role"}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,154 @@
+package hub
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// sanctionKey identifies a mute or ban; roomID is empty for server-wide sanctions
+type sanctionKey struct {
+	kind   string
+	userID string
+	roomID string
+}
+
+// SetServerAdmins sets the users allowed to moderate the whole server
+// Usernames are resolved to user IDs now, so an admin's name taken over after
+// their account is deleted carries no rights. Users who haven't registered
+// yet are skipped. Without persistent storage usernames can't be trusted and
+// nobody is an admin.
+func (h *Hub) SetServerAdmins(usernames []string) error {
+	admins := make(map[string]bool, len(usernames))
+	if len(usernames) > 0 && h.userStore == nil {
+		return errors.New("server admins require persistent storage")
+	}
+
+	ctx := context.Background()
+	for _, username := range usernames {
+		user, err := h.userStore.GetByUsername(ctx, username)
+		if err != nil {
+			return err
+		}
+		if user == nil {
+			slog.Warn("Server admin is not a registered user", "username", username)
+			continue
+		}
+		admins[user.ID] = true
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.admins = admins
+	return nil
+}
+
+// isServerAdmin reports whether the client is logged in as a server admin
+func (h *Hub) isServerAdmin(c *client.Client) bool {
+	if c.Username == "" {
+		return false
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.admins[c.UserID]
+}
+
+// LoadSanctions loads active mutes and bans from storage
+func (h *Hub) LoadSanctions() error {
+	if h.userStore == nil {
+		return nil
+	}
+
+	sanctions, err := h.userStore.GetActiveSanctions(context.Background())
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, sn := range sanctions {
+		h.sanctions[sanctionKey{sn.Kind, sn.UserID, sn.RoomID}] = expiry(sn.ExpiresAt)
+	}
+	slog.Info("Loaded active sanctions from storage", "sanctions", len(sanctions))
+	return nil
+}
+
+// sanctionedLocked reports whether a user is under a sanction of the given
+// kind in a room, including server-wide ones. An empty roomID checks only
+// server-wide sanctions.
+// Must be called with h.mu held
+func (h *Hub) sanctionedLocked(kind, userID, roomID string) bool {
+	now := time.Now()
+	active := func(key sanctionKey) bool {
+		until, ok := h.sanctions[key]
+		return ok && (until.IsZero() || until.After(now))
+	}
+	if active(sanctionKey{kind, userID, ""}) {
+		return true
+	}
+	return roomID != "" && active(sanctionKey{kind, userID, roomID})
+}
+
+// isMuted reports whether a user may not send messages in a room
+// (or anywhere, for an empty roomID)
+func (h *Hub) isMuted(userID, roomID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.sanctionedLocked(postgres.SanctionMute, userID, roomID)
+}
+
+// applySanction mutes or bans a user and enforces it right away: a room ban
+// removes them from the room and a server ban disconnects them
+// A zero duration makes the sanction permanent
+func (h *Hub) applySanction(ctx context.Context, kind, userID, roomID string, duration time.Duration, reason string, by protocol.UserInfo) error {
+	sn := &postgres.Sanction{
+		UserID:    userID,
+		RoomID:    roomID,
+		Kind:      kind,
+		Reason:    reason,
+		CreatedBy: by.UserID,
+	}
+	if duration > 0 {
+		expires := time.Now().Add(duration)
+		sn.ExpiresAt = &expires
+	}
+
+	if h.userStore != nil {
+		if _, err := h.userStore.AddSanction(ctx, sn); err != nil {
+			slog.ErrorContext(ctx, "Failed to save sanction", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to apply " + kind}
+		}
+	}
+
+	h.mu.Lock()
+	h.sanctions[sanctionKey{kind, userID, roomID}] = expiry(sn.ExpiresAt)
+
+	var disconnect []*client.Client
+	if kind == postgres.SanctionBan {
+		if roomID == "" {
+			disconnect = h.sessionsLocked(userID)
+		} else if r, ok := h.rooms[roomID]; ok && r.HasMember(userID) {
+			h.removeMemberLocked(r, userID, by)
+		}
+	}
+	h.mu.Unlock()
+
+	h.disconnect(disconnect, "Banned from the server")
+
+	slog.InfoContext(ctx, "Sanction applied", "kind", kind, "target_user_id", userID, "target_room_id", roomID, "by", by.Username)
+	return nil
+}
+
+// expiry converts a stored expiry time to the in-memory form (zero = permanent)
+func expiry(expiresAt *time.Time) time.Time {
+	if expiresAt == nil {
+		return time.Time{}
+	}
+	return *expiresAt
+}
@@ -0,0 +1,139 @@
+package hub
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+const (
+	// Longest search query, in characters
+	maxSearchQueryLength = 200
+
+	// Deepest page of search results a client may ask for
+	maxSearchOffset = 1000
+)
+
+// SearchOptions describes a message search; zero-valued filters are not applied
+type SearchOptions struct {
+	Query  string    // Search terms
+	RoomID string    // Only search this room
+	Sender string    // Only messages from this username
+	After  time.Time // Only messages after this time
+	Before time.Time // Only messages before this time
+	Limit  int
+	Offset int
+}
+
+// SearchMessages runs a full-text search over the messages of the client's rooms
+// Results only come from rooms whose history the client may read
+func (h *Hub) SearchMessages(c *client.Client, opts SearchOptions) (*protocol.MessageSearchResponsePayload, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	q := postgres.SearchQuery{
+		Text:           strings.TrimSpace(opts.Query),
+		RoomID:         opts.RoomID,
+		SenderUsername: opts.Sender,
+		After:          opts.After,
+		Before:         opts.Before,
+		Limit:          opts.Limit,
+		Offset:         opts.Offset,
+	}
+	if q.Text == "" {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Search query is required"}
+	}
+	if utf8.RuneCountInString(q.Text) > maxSearchQueryLength {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Search query must be at most 200 characters"}
+	}
+	if !q.After.IsZero() && !q.Before.IsZero() && !q.After.Before(q.Before) {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "after must be earlier than before"}
+	}
+	if q.Offset < 0 || q.Offset > maxSearchOffset {
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "offset must be between 0 and 1000"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	if q.RoomID != "" {
+		h.mu.RLock()
+		_, err := h.authorizeHistoryLocked(q.RoomID, memberID)
+		h.mu.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Search needs the stored messages
+	if h.messageStore == nil || c.UserID == "" {
+		return &protocol.MessageSearchResponsePayload{
+			Query:   q.Text,
+			Results: []protocol.SearchResult{},
+			HasMore: false,
+		}, nil
+	}
+
+	// Default limit
+	if q.Limit <= 0 || q.Limit > 100 {
+		q.Limit = 20
+	}
+	limit := q.Limit
+
+	ctx := c.LogContext()
+
+	// Fetch one extra to detect if there are more results
+	q.Limit++
+	found, err := h.messageStore.Search(ctx, c.UserID, q)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to search messages", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to search messages"}
+	}
+
+	hasMore := len(found) > limit
+	if hasMore {
+		found = found[:limit]
+	}
+
+	protoMessages := make([]protocol.IncomingRoomMessage, len(found))
+	for i, result := range found {
+		protoMessages[i] = roomMessageToProtocol(result.Message)
+	}
+	h.attachReactions(ctx, protoMessages)
+	h.attachAttachments(ctx, protoMessages)
+	h.attachThreadSummaries(ctx, protoMessages)
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	results := make([]protocol.SearchResult, 0, len(found))
+	for i, result := range found {
+		// Membership may have changed since the query ran
+		r, err := h.authorizeHistoryLocked(result.Message.RoomID, memberID)
+		if err != nil {
+			continue
+		}
+		results = append(results, protocol.SearchResult{
+			RoomID:   r.ID,
+			RoomName: r.Name,
+			Message:  protoMessages[i],
+			Snippet:  result.Snippet,
+			Rank:     result.Rank,
+		})
+	}
+
+	return &protocol.MessageSearchResponsePayload{
+		Query:   q.Text,
+		Results: results,
+		HasMore: hasMore,
+	}, nil
+}
@@ -0,0 +1,113 @@
+package hub
+
+import (
+	"log/slog"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+)
+
+// addSessionLocked records a registered connection as one of its user's sessions
+// Returns true if it is the user's first live connection
+// Must be called with h.mu held
+func (h *Hub) addSessionLocked(c *client.Client) bool {
+	h.usernames[c.Username] = c.UserID
+	sessions, ok := h.sessions[c.UserID]
+	if !ok {
+		sessions = make(map[string]bool)
+		h.sessions[c.UserID] = sessions
+	}
+	sessions[c.ID] = true
+	if len(sessions) > 1 {
+		return false
+	}
+	h.loadBlocksLocked(c.UserID)
+	return true
+}
+
+// removeSessionLocked forgets a connection of a registered user
+// Returns true if it was the user's last live connection
+// Must be called with h.mu held
+func (h *Hub) removeSessionLocked(c *client.Client) bool {
+	sessions, ok := h.sessions[c.UserID]
+	if !ok || !sessions[c.ID] {
+		return false
+	}
+	delete(sessions, c.ID)
+	if len(sessions) > 0 {
+		return false
+	}
+	delete(h.sessions, c.UserID)
+	delete(h.usernames, c.Username)
+	delete(h.blocks, c.UserID)
+	return true
+}
+
+// sessionsLocked returns the live connections of a user
+// Must be called with h.mu held
+func (h *Hub) sessionsLocked(userID string) []*client.Client {
+	sessions := h.sessions[userID]
+	clients := make([]*client.Client, 0, len(sessions))
+	for clientID := range sessions {
+		if c, ok := h.clients[clientID]; ok {
+			clients = append(clients, c)
+		}
+	}
+	return clients
+}
+
+// sendToUserLocked sends a message to every live connection of a user except
+// excludeConnID
+// Must be called with h.mu held
+func (h *Hub) sendToUserLocked(userID, excludeConnID string, msgType protocol.MessageType, payload interface{}) {
+	for clientID := range h.sessions[userID] {
+		if clientID == excludeConnID {
+			continue
+		}
+		if c, ok := h.clients[clientID]; ok {
+			_ = c.SendMessage(msgType, payload)
+		}
+	}
+}
+
+// broadcastExceptUserLocked sends a message to all registered clients that
+// don't belong to userID
+// Must be called with h.mu held
+func (h *Hub) broadcastExceptUserLocked(userID string, msgType protocol.MessageType, payload interface{}) {
+	for _, c := range h.clients {
+		if c.Username != "" && c.UserID != userID {
+			_ = c.SendMessage(msgType, payload)
+		}
+	}
+}
+
+// KickOtherSessions signs out every other connection of the client's user
+// Returns the number of connections closed
+func (h *Hub) KickOtherSessions(c *client.Client) (int, error) {
+	if c.Username == "" {
+		return 0, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	kicked := 0
+	for _, other := range h.sessionsLocked(c.UserID) {
+		if other.ID == c.ID {
+			continue
+		}
+		_ = other.SendMessage(protocol.TypeKicked, protocol.KickedPayload{
+			Reason: "Signed out from another session",
+		})
+		// Forget the connection now so nothing else is sent to it; its
+		// RemoveClient call on disconnect is then a no-op
+		h.dropClientLocked(other)
+		h.removeSessionLocked(other)
+		kicked++
+	}
+
+	if kicked > 0 {
+		slog.InfoContext(c.LogContext(), "Signed out other sessions", "sessions", kicked)
+	}
+	return kicked, nil
+}
@@ -0,0 +1,445 @@
+//go:build integration
+
+package hub
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"haven/internal/blob"
+	"haven/internal/client"
+	"haven/internal/moderation"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// newStoreHub creates a hub backed by a fresh PostgreSQL container
+func newStoreHub(t *testing.T) *Hub {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := postgres.SetupTestDB(t)
+	t.Cleanup(testDB.Close)
+
+	h := New()
+	h.SetStores(
+		postgres.NewRoomStore(testDB.Pool),
+		postgres.NewUserStore(testDB.Pool),
+		postgres.NewMemberStore(testDB.Pool),
+		postgres.NewMessageStore(testDB.Pool),
+		postgres.NewDirectMessageStore(testDB.Pool),
+	)
+	return h
+}
+
+// sendRoomMessage sends a room message and returns its ID as seen by reader
+func sendRoomMessage(t *testing.T, h *Hub, from, reader *client.Client, roomID, content string) string {
+	t.Helper()
+	drainMessages(reader)
+	if err := h.SendRoomMessage(from, roomID, content, MessageOptions{}); err != nil {
+		t.Fatalf("Failed to send message: %v", err)
+	}
+	var msg protocol.IncomingRoomMessage
+	_ = json.Unmarshal(nextMessage(t, reader, protocol.TypeRoomMessage).Payload, &msg)
+	return msg.MessageID
+}
+
+// expectNoMessage fails if a message of the given type is buffered for c
+func expectNoMessage(t *testing.T, c *client.Client, msgType protocol.MessageType) {
+	t.Helper()
+	for {
+		select {
+		case data := <-c.Send:
+			var env protocol.Envelope
+			if err := json.Unmarshal(data, &env); err == nil && env.Type == msgType {
+				t.Errorf("Expected no '%s' message for %s, got %s", msgType, c.Username, data)
+			}
+		default:
+			return
+		}
+	}
+}
+
+func TestHub_BlockedEditsAndReactions(t *testing.T) {
+	h := newStoreHub(t)
+
+	alice := mockClient("client-1")
+	bob := mockClient("client-2")
+	carol := mockClient("client-3")
+	h.AddClient(alice)
+	h.AddClient(bob)
+	h.AddClient(carol)
+	registerUser(t, h, alice, "alice")
+	registerUser(t, h, bob, "bob")
+	registerUser(t, h, carol, "carol")
+
+	room, _ := h.CreateRoom(alice, "General", true)
+	_, _ = h.JoinRoom(bob, room.ID, "")
+	_, _ = h.JoinRoom(carol, room.ID, "")
+	aliceMsg := sendRoomMessage(t, h, alice, carol, room.ID, "hello")
+	bobMsg := sendRoomMessage(t, h, bob, carol, room.ID, "hi")
+
+	if err := h.BlockUser(alice, "bob"); err != nil {
+		t.Fatalf("Failed to block: %v", err)
+	}
+
+	// Edits from a blocked user skip the blocker
+	drainMessages(alice)
+	drainMessages(carol)
+	if err := h.EditRoomMessage(bob, room.ID, bobMsg, "hi, edited"); err != nil {
+		t.Fatalf("Failed to edit: %v", err)
+	}
+	nextMessage(t, carol, protocol.TypeMessageEdited)
+	expectNoMessage(t, alice, protocol.TypeMessageEdited)
+
+	// So do their reactions, even to the blocker's own messages
+	if err := h.AddReaction(bob, room.ID, aliceMsg, "👍"); err != nil {
+		t.Fatalf("Failed to react: %v", err)
+	}
+	nextMessage(t, carol, protocol.TypeReactionUpdated)
+	expectNoMessage(t, alice, protocol.TypeReactionUpdated)
+
+	// The blocker's own reactions still reach everyone
+	drainMessages(bob)
+	if err := h.AddReaction(alice, room.ID, bobMsg, "👀"); err != nil {
+		t.Fatalf("Failed to react: %v", err)
+	}
+	nextMessage(t, alice, protocol.TypeReactionUpdated)
+	nextMessage(t, bob, protocol.TypeReactionUpdated)
+}
+
+func TestHub_MutedEditsAndReactions(t *testing.T) {
+	h := newStoreHub(t)
+
+	alice := mockClient("client-1")
+	bob := mockClient("client-2")
+	h.AddClient(alice)
+	h.AddClient(bob)
+	registerUser(t, h, alice, "alice")
+	registerUser(t, h, bob, "bob")
+
+	room, _ := h.CreateRoom(alice, "General", true)
+	_, _ = h.JoinRoom(bob, room.ID, "")
+	aliceMsg := sendRoomMessage(t, h, alice, bob, room.ID, "hello")
+	bobMsg := sendRoomMessage(t, h, bob, alice, room.ID, "hi")
+	if err := h.AddReaction(bob, room.ID, aliceMsg, "👍"); err != nil {
+		t.Fatalf("Failed to react: %v", err)
+	}
+
+	err := h.applySanction(context.Background(), postgres.SanctionMute, bob.UserID, room.ID, 0, "", adminActor)
+	if err != nil {
+		t.Fatalf("Failed to mute: %v", err)
+	}
+
+	err = h.EditRoomMessage(bob, room.ID, bobMsg, "new content")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMuted {
+		t.Errorf("Expected error code '%s' editing while muted, got %v", protocol.ErrCodeMuted, err)
+	}
+	err = h.AddReaction(bob, room.ID, aliceMsg, "🎉")
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMuted {
+		t.Errorf("Expected error code '%s' reacting while muted, got %v", protocol.ErrCodeMuted, err)
+	}
+
+	// Taking a reaction back is still allowed
+	if err := h.RemoveReaction(bob, room.ID, aliceMsg, "👍"); err != nil {
+		t.Errorf("Expected a muted user to remove their reaction, got %v", err)
+	}
+}
+
+func TestHub_MalformedMessageIDs(t *testing.T) {
+	h := newStoreHub(t)
+
+	alice := mockClient("client-1")
+	h.AddClient(alice)
+	registerUser(t, h, alice, "alice")
+	room, _ := h.CreateRoom(alice, "General", true)
+
+	// IDs that aren't UUIDs name no message; they never reach the database
+	calls := []struct {
+		name string
+		call func(id string) error
+	}{
+		{"editing", func(id string) error { return h.EditRoomMessage(alice, room.ID, id, "new content") }},
+		{"deleting", func(id string) error { return h.DeleteRoomMessage(alice, room.ID, id) }},
+		{"reacting", func(id string) error { return h.AddReaction(alice, room.ID, id, "👍") }},
+		{"removing a reaction", func(id string) error { return h.RemoveReaction(alice, room.ID, id, "👍") }},
+		{"replying", func(id string) error {
+			return h.SendRoomMessage(alice, room.ID, "reply", MessageOptions{ReplyTo: id})
+		}},
+		{"posting to a thread", func(id string) error {
+			return h.SendRoomMessage(alice, room.ID, "reply", MessageOptions{ThreadID: id})
+		}},
+		{"loading a thread", func(id string) error {
+			_, err := h.GetThreadHistory(alice, room.ID, id, 0, time.Time{})
+			return err
+		}},
+		{"marking read", func(id string) error { return h.MarkRead(alice, room.ID, id) }},
+		{"pinning", func(id string) error { return h.PinMessage(alice, room.ID, id) }},
+		{"unpinning", func(id string) error { return h.UnpinMessage(alice, room.ID, id) }},
+	}
+	for _, tt := range calls {
+		err := tt.call("not-a-uuid")
+		if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMessageNotFound {
+			t.Errorf("Expected error code '%s' %s, got %v", protocol.ErrCodeMessageNotFound, tt.name, err)
+		}
+	}
+}
+
+func TestHub_ServerAdmins(t *testing.T) {
+	h := newStoreHub(t)
+
+	admin := mockClient("client-1")
+	h.AddClient(admin)
+	registerUser(t, h, admin, "admin")
+	if err := h.SetServerAdmins([]string{"admin", "ghost"}); err != nil {
+		t.Fatalf("Failed to set server admins: %v", err)
+	}
+
+	if _, err := h.ListReports(admin, "", "all", 0); err != nil {
+		t.Errorf("Expected admin to see all reports, got %v", err)
+	}
+	if _, err := h.ListReports(admin, "", "pending", 0); err == nil {
+		t.Error("Expected unknown status to be rejected")
+	}
+
+	// Rights follow the account, not the name
+	h.RemoveClient(admin)
+	impostor := mockClient("client-2")
+	impostor.UserID = "00000000-0000-0000-0000-000000000001"
+	impostor.Username = "admin"
+	if _, err := h.ListReports(impostor, "", "all", 0); err == nil {
+		t.Error("Expected another account using the admin's name to be denied")
+	}
+
+	// A configured admin who registers later gets no rights until restart
+	ghost := mockClient("client-3")
+	h.AddClient(ghost)
+	registerUser(t, h, ghost, "ghost")
+	if _, err := h.ListReports(ghost, "", "all", 0); err == nil {
+		t.Error("Expected an unresolved admin name to carry no rights")
+	}
+}
+
+func TestHub_ReviewHeldMessages(t *testing.T) {
+	h := newStoreHub(t)
+
+	alice := mockClient("client-1")
+	bob := mockClient("client-2")
+	h.AddClient(alice)
+	h.AddClient(bob)
+	registerUser(t, h, alice, "alice")
+	registerUser(t, h, bob, "bob")
+
+	room, _ := h.CreateRoom(alice, "General", true)
+	_, _ = h.JoinRoom(bob, room.ID, "")
+	root := sendRoomMessage(t, h, bob, alice, room.ID, "any good links?")
+
+	cfg := moderation.Config{
+		Rules: []moderation.Rule{{Patterns: []string{`https?://`}, Action: "quarantine", Reason: "link"}},
+	}
+	pipeline, err := cfg.Pipeline()
+	if err != nil {
+		t.Fatalf("Failed to build pipeline: %v", err)
+	}
+	h.SetModeration(pipeline)
+
+	if err := h.SendRoomMessage(alice, room.ID, "http://x.io", MessageOptions{ReplyTo: root, ClientMsgID: "c-1"}); err != nil {
+		t.Fatalf("Failed to send room message: %v", err)
+	}
+	if err := h.SendDirectMessage(alice, "bob", "http://y.io", "d-1"); err != nil {
+		t.Fatalf("Failed to send direct message: %v", err)
+	}
+	if err := h.SendDirectMessage(alice, "bob", "http://z.io", ""); err != nil {
+		t.Fatalf("Failed to send direct message: %v", err)
+	}
+
+	held, err := h.AdminHeldMessages("", 0)
+	if err != nil {
+		t.Fatalf("Failed to list held messages: %v", err)
+	}
+	if len(held) != 3 {
+		t.Fatalf("Expected 3 held messages, got %d", len(held))
+	}
+	if held[0].RoomID != room.ID || held[0].ThreadID != root || held[0].ReplyTo != root || held[0].Reason != "link" {
+		t.Errorf("Unexpected held room message: %+v", held[0])
+	}
+	if inRoom, _ := h.AdminHeldMessages(room.ID, 0); len(inRoom) != 1 {
+		t.Errorf("Expected 1 held message in the room, got %d", len(inRoom))
+	}
+
+	// A released room message is posted as it was sent
+	drainMessages(alice)
+	drainMessages(bob)
+	if err := h.ReleaseHeldMessage(held[0].ID); err != nil {
+		t.Fatalf("Failed to release room message: %v", err)
+	}
+	var msg protocol.IncomingRoomMessage
+	_ = json.Unmarshal(nextMessage(t, bob, protocol.TypeRoomMessage).Payload, &msg)
+	if msg.Content != "http://x.io" || msg.ReplyTo != root || msg.ThreadID != root || msg.ClientMsgID != "c-1" {
+		t.Errorf("Unexpected released room message: %+v", msg)
+	}
+	nextMessage(t, alice, protocol.TypeRoomMessage)
+
+	// A message is only released once
+	err = h.ReleaseHeldMessage(held[0].ID)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeMessageNotFound {
+		t.Errorf("Expected error code '%s' releasing twice, got %v", protocol.ErrCodeMessageNotFound, err)
+	}
+
+	// A released direct message reaches the recipient and confirms the sender's key
+	if err := h.ReleaseHeldMessage(held[1].ID); err != nil {
+		t.Fatalf("Failed to release direct message: %v", err)
+	}
+	var dm protocol.IncomingDirectMessage
+	_ = json.Unmarshal(nextMessage(t, bob, protocol.TypeDirectMsg).Payload, &dm)
+	if dm.Content != "http://y.io" || dm.From != "alice" {
+		t.Errorf("Unexpected released direct message: %+v", dm)
+	}
+	_ = json.Unmarshal(nextMessage(t, alice, protocol.TypeDirectMsg).Payload, &dm)
+	if dm.ClientMsgID != "d-1" {
+		t.Errorf("Expected the sender's client_msg_id, got '%s'", dm.ClientMsgID)
+	}
+
+	// A discarded message is never delivered
+	if err := h.DiscardHeldMessage(held[2].ID); err != nil {
+		t.Fatalf("Failed to discard held message: %v", err)
+	}
+	expectNoMessage(t, bob, protocol.TypeDirectMsg)
+	if remaining, _ := h.AdminHeldMessages("", 0); len(remaining) != 0 {
+		t.Errorf("Expected no held messages left, got %d", len(remaining))
+	}
+
+	// A message that can't be delivered stays held
+	if err := h.SendRoomMessage(bob, room.ID, "http://w.io", MessageOptions{}); err != nil {
+		t.Fatalf("Failed to send room message: %v", err)
+	}
+	_ = h.LeaveRoom(bob, room.ID)
+	held, _ = h.AdminHeldMessages("", 0)
+	if len(held) != 1 {
+		t.Fatalf("Expected 1 held message, got %d", len(held))
+	}
+	err = h.ReleaseHeldMessage(held[0].ID)
+	if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodeNotInRoom {
+		t.Errorf("Expected error code '%s' releasing for a departed sender, got %v", protocol.ErrCodeNotInRoom, err)
+	}
+	if remaining, _ := h.AdminHeldMessages("", 0); len(remaining) != 1 {
+		t.Errorf("Expected the message to stay held, got %d held", len(remaining))
+	}
+}
+
+func TestHub_SyncReportsRemovals(t *testing.T) {
+	h := newStoreHub(t)
+
+	alice := mockClient("client-1")
+	bob := mockClient("client-2")
+	h.AddClient(alice)
+	h.AddClient(bob)
+	registerUser(t, h, alice, "alice")
+	registerUser(t, h, bob, "bob")
+
+	room, _ := h.CreateRoom(alice, "General", true)
+	_, _ = h.JoinRoom(bob, room.ID, "")
+	drainMessages(bob)
+
+	sync := func() protocol.SyncResponsePayload {
+		t.Helper()
+		if err := h.Sync(bob, time.Now().Add(-time.Minute).UnixMilli(), nil); err != nil {
+			t.Fatalf("Failed to sync: %v", err)
+		}
+		var resp protocol.SyncResponsePayload
+		_ = json.Unmarshal(nextMessage(t, bob, protocol.TypeSyncResp).Payload, &resp)
+		return resp
+	}
+
+	// Every sync ends with a watermark for the next one
+	resp := sync()
+	if !resp.Done || resp.Watermark == 0 {
+		t.Fatalf("Expected a final chunk with a watermark, got %+v", resp)
+	}
+
+	// Membership persists in the background; wait for it before kicking
+	time.Sleep(100 * time.Millisecond)
+	if err := h.KickMember(alice, room.ID, bob.UserID); err != nil {
+		t.Fatalf("Failed to kick: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	drainMessages(bob)
+
+	// The room is gone from the sync, but the kick is reported
+	resp = sync()
+	if len(resp.Rooms) != 0 {
+		t.Errorf("Expected no rooms after the kick, got %+v", resp.Rooms)
+	}
+	found := false
+	for _, e := range resp.MemberEvents {
+		if e.RoomID == room.ID && e.Action == "kicked" && e.User.UserID == bob.UserID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected bob's kick in the member events, got %+v", resp.MemberEvents)
+	}
+}
+
+func TestHub_SignedAttachmentURLs(t *testing.T) {
+	h := newStoreHub(t)
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+	h.SetBlobStore(blobs, AttachmentLimits{MaxSize: 1 << 20, Quota: 1 << 20})
+
+	alice := mockClient("client-1")
+	h.AddClient(alice)
+	registerUser(t, h, alice, "alice")
+	room, _ := h.CreateRoom(alice, "General", true)
+
+	info, err := h.UploadAttachment(alice, room.ID, "notes.txt", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+	link, err := url.Parse(info.URL)
+	if err != nil || link.Path != "/attachments/"+info.ID {
+		t.Fatalf("Unexpected attachment URL '%s'", info.URL)
+	}
+	expires, _ := strconv.ParseInt(link.Query().Get("expires"), 10, 64)
+	sig := link.Query().Get("sig")
+
+	// The URL alone is enough to download the file
+	_, content, err := h.OpenSignedAttachment(info.ID, expires, sig)
+	if err != nil {
+		t.Fatalf("Expected the signed URL to work, got %v", err)
+	}
+	data, _ := io.ReadAll(content)
+	_ = content.Close()
+	if string(data) != "hello" {
+		t.Errorf("Expected the uploaded contents, got '%s'", data)
+	}
+
+	// It is bound to its attachment and expiry, and stops working once expired
+	past := time.Now().Add(-time.Minute).Unix()
+	invalid := []struct {
+		name    string
+		id      string
+		expires int64
+		sig     string
+	}{
+		{"other attachment", "7d0b4bd6-3f3c-4b52-9f0e-4a9e8f3b2c11", expires, sig},
+		{"extended expiry", info.ID, expires + 3600, sig},
+		{"expired", info.ID, past, h.signAttachmentURL(info.ID, past)},
+	}
+	for _, tt := range invalid {
+		_, _, err := h.OpenSignedAttachment(tt.id, tt.expires, tt.sig)
+		if hubErr, ok := err.(*Error); !ok || hubErr.Code != protocol.ErrCodePermissionDenied {
+			t.Errorf("%s: expected error code '%s', got %v", tt.name, protocol.ErrCodePermissionDenied, err)
+		}
+	}
+}
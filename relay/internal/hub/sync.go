@@ -0,0 +1,214 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"time"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// Maximum number of messages sent in one sync_response chunk
+const syncChunkSize = 200
+
+// Sync sends the client everything that changed in its rooms since the given
+// cursors: the current state of each room, joins and leaves, and new, edited
+// or deleted messages. The response is split into sync_response chunks of at
+// most syncChunkSize messages; the last chunk is marked done and carries the
+// watermark for the next sync.
+func (h *Hub) Sync(c *client.Client, since int64, cursors map[string]int64) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if since <= 0 && len(cursors) == 0 {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Sync requires since or cursors"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	ctx := c.LogContext()
+
+	// Taken before any query so nothing that happens during the sync is skipped next time
+	watermark, err := h.syncWatermark(ctx)
+	if err != nil {
+		return err
+	}
+
+	roomIDs, err := h.syncRoomIDs(ctx, c, memberID)
+	if err != nil {
+		return err
+	}
+	readStates := h.readStatesFor(c)
+
+	first := protocol.SyncResponsePayload{
+		Rooms:    make([]protocol.SyncRoomState, 0, len(roomIDs)),
+		Messages: []protocol.IncomingRoomMessage{},
+	}
+	sinceByRoom := make(map[string]time.Time)
+
+	h.mu.RLock()
+	for _, roomID := range roomIDs {
+		r, exists := h.rooms[roomID]
+		if !exists {
+			continue
+		}
+		info := r.Info()
+		applyReadState(&info, readStates[roomID])
+		first.Rooms = append(first.Rooms, protocol.SyncRoomState{
+			RoomInfo: info,
+			Members:  h.roomMembersLocked(r),
+		})
+
+		cursor := cursors[roomID]
+		if cursor <= 0 {
+			cursor = since
+		}
+		if cursor > 0 {
+			sinceByRoom[roomID] = time.UnixMilli(cursor)
+		}
+	}
+	h.mu.RUnlock()
+
+	if h.memberStore != nil {
+		events, err := h.memberStore.GetEventsSince(ctx, sinceByRoom)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get member events", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to sync"}
+		}
+		removals, err := h.syncRemovals(ctx, c, since, cursors)
+		if err != nil {
+			return err
+		}
+		events = append(events, removals...)
+		sort.SliceStable(events, func(i, j int) bool { return events[i].CreatedAt.Before(events[j].CreatedAt) })
+
+		for _, e := range events {
+			first.MemberEvents = append(first.MemberEvents, protocol.MemberEventInfo{
+				RoomID:    e.RoomID,
+				Action:    e.Action,
+				User:      protocol.UserInfo{UserID: e.UserID, Username: e.Username},
+				Timestamp: e.CreatedAt.UnixMilli(),
+			})
+		}
+	}
+
+	if h.messageStore == nil {
+		first.Done = true
+		first.Watermark = watermark
+		return c.SendMessageWait(protocol.TypeSyncResp, first)
+	}
+
+	chunk := first
+	var afterAt time.Time
+	var afterID string
+	for {
+		// Fetch one extra to detect if there are more messages
+		messages, err := h.messageStore.GetChangesSince(ctx, sinceByRoom, afterAt, afterID, syncChunkSize+1)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get changed messages", "err", err)
+			return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to sync"}
+		}
+
+		hasMore := len(messages) > syncChunkSize
+		if hasMore {
+			messages = messages[:syncChunkSize]
+		}
+
+		chunk.Messages = make([]protocol.IncomingRoomMessage, len(messages))
+		for i, msg := range messages {
+			chunk.Messages[i] = roomMessageToProtocol(msg)
+		}
+		h.attachReactions(ctx, chunk.Messages)
+		h.attachAttachments(ctx, chunk.Messages)
+		h.attachThreadSummaries(ctx, chunk.Messages)
+
+		if !hasMore {
+			chunk.Done = true
+			chunk.Watermark = watermark
+		}
+		if err := c.SendMessageWait(protocol.TypeSyncResp, chunk); err != nil {
+			return err
+		}
+		if !hasMore {
+			return nil
+		}
+
+		last := messages[len(messages)-1]
+		afterAt, afterID = last.ChangedAt(), last.ID
+		chunk = protocol.SyncResponsePayload{Chunk: chunk.Chunk + 1}
+	}
+}
+
+// syncRoomIDs returns the rooms a sync covers: the user's persisted
+// memberships, or the rooms they are in right now without storage
+func (h *Hub) syncRoomIDs(ctx context.Context, c *client.Client, memberID string) ([]string, error) {
+	if h.memberStore != nil && c.UserID != "" {
+		roomIDs, err := h.memberStore.GetUserRooms(ctx, c.UserID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to get user rooms", "err", err)
+			return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to sync"}
+		}
+		return roomIDs, nil
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var roomIDs []string
+	for roomID, r := range h.rooms {
+		if r.HasMember(memberID) {
+			roomIDs = append(roomIDs, roomID)
+		}
+	}
+	return roomIDs, nil
+}
+
+// syncWatermark returns the time to resume the next sync from. With storage
+// it is read from the database clock, which stamps the changes a sync
+// compares it against, rather than the relay's.
+func (h *Hub) syncWatermark(ctx context.Context) (int64, error) {
+	if h.messageStore == nil {
+		return protocol.NewEnvelopeTimestamp(), nil
+	}
+	now, err := h.messageStore.Now(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to read database time", "err", err)
+		return 0, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to sync"}
+	}
+	return now.UnixMilli(), nil
+}
+
+// syncRemovals returns the user's leaves and kicks from rooms they are no
+// longer in since the given cursors, which the per-room sync can't cover
+func (h *Hub) syncRemovals(ctx context.Context, c *client.Client, since int64, cursors map[string]int64) ([]*postgres.MemberEvent, error) {
+	if c.UserID == "" {
+		return nil, nil
+	}
+
+	var sinceAll *time.Time
+	if since > 0 {
+		t := time.UnixMilli(since)
+		sinceAll = &t
+	}
+	sinceByRoom := make(map[string]time.Time, len(cursors))
+	for roomID, cursor := range cursors {
+		if cursor > 0 {
+			sinceByRoom[roomID] = time.UnixMilli(cursor)
+		}
+	}
+
+	removals, err := h.memberStore.GetRemovalsSince(ctx, c.UserID, sinceAll, sinceByRoom)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get room removals", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to sync"}
+	}
+	return removals, nil
+}
@@ -0,0 +1,168 @@
+package hub
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+	"haven/internal/storage/postgres"
+)
+
+// resolveThread validates the reply target of a new message and works out the
+// thread it belongs to. Replying to a reply continues the parent's thread, so
+// threads are always one level deep.
+func (h *Hub) resolveThread(ctx context.Context, roomID, replyTo, threadID string) (postgres.MessageOptions, error) {
+	if replyTo == "" && threadID == "" {
+		return postgres.MessageOptions{}, nil
+	}
+
+	// Without storage there is nothing to validate against
+	if h.messageStore == nil {
+		if threadID == "" {
+			threadID = replyTo
+		}
+		return postgres.MessageOptions{ThreadID: threadID, ReplyTo: replyTo}, nil
+	}
+
+	parentID := replyTo
+	if parentID == "" {
+		parentID = threadID
+	}
+	if _, err := uuid.Parse(parentID); err != nil {
+		return postgres.MessageOptions{}, &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Reply target not found"}
+	}
+
+	parent, err := h.messageStore.GetByID(ctx, parentID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get message", "err", err)
+		return postgres.MessageOptions{}, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Database error"}
+	}
+	if parent == nil || parent.RoomID != roomID {
+		return postgres.MessageOptions{}, &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Reply target not found"}
+	}
+
+	root := parent.ThreadID
+	if root == "" {
+		root = parent.ID
+	}
+	return postgres.MessageOptions{ThreadID: root, ReplyTo: replyTo}, nil
+}
+
+// GetThreadHistory retrieves the replies in a thread along with its root message
+func (h *Hub) GetThreadHistory(c *client.Client, roomID, threadID string, limit int, before time.Time) (*protocol.ThreadHistoryResponsePayload, error) {
+	if c.Username == "" {
+		return nil, &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	// Use database UserID for membership check, fall back to connection ID
+	memberID := c.UserID
+	if memberID == "" {
+		memberID = c.ID
+	}
+
+	h.mu.RLock()
+	r, exists := h.rooms[roomID]
+	if !exists {
+		h.mu.RUnlock()
+		return nil, &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+	}
+
+	if !r.HasMember(memberID) {
+		h.mu.RUnlock()
+		return nil, &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+	}
+	h.mu.RUnlock()
+
+	if h.messageStore == nil {
+		return &protocol.ThreadHistoryResponsePayload{
+			RoomID:   roomID,
+			ThreadID: threadID,
+			Messages: []protocol.IncomingRoomMessage{},
+			HasMore:  false,
+		}, nil
+	}
+
+	if _, err := uuid.Parse(threadID); err != nil {
+		return nil, &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Thread not found"}
+	}
+
+	ctx := logContext(c, roomID)
+
+	rootMsg, err := h.messageStore.GetByID(ctx, threadID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get thread root", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch history"}
+	}
+	if rootMsg == nil || rootMsg.RoomID != roomID || rootMsg.ThreadID != "" {
+		return nil, &Error{Code: protocol.ErrCodeMessageNotFound, Message: "Thread not found"}
+	}
+
+	// Default limit
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	// Fetch one extra to detect if there are more messages
+	messages, err := h.messageStore.GetThreadHistory(ctx, threadID, limit+1, before)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get thread history", "err", err)
+		return nil, &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Failed to fetch history"}
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	// Messages are returned newest first, reverse them so oldest is first
+	protoMessages := make([]protocol.IncomingRoomMessage, len(messages))
+	for i, msg := range messages {
+		protoMessages[len(messages)-1-i] = roomMessageToProtocol(msg)
+	}
+	h.attachReactions(ctx, protoMessages)
+	h.attachAttachments(ctx, protoMessages)
+
+	root := []protocol.IncomingRoomMessage{roomMessageToProtocol(rootMsg)}
+	h.attachReactions(ctx, root)
+	h.attachAttachments(ctx, root)
+	h.attachThreadSummaries(ctx, root)
+
+	return &protocol.ThreadHistoryResponsePayload{
+		RoomID:   roomID,
+		ThreadID: threadID,
+		Root:     &root[0],
+		Messages: protoMessages,
+		HasMore:  hasMore,
+	}, nil
+}
+
+// attachThreadSummaries fills in reply counts on a batch of top-level room messages
+func (h *Hub) attachThreadSummaries(ctx context.Context, messages []protocol.IncomingRoomMessage) {
+	if h.messageStore == nil || len(messages) == 0 {
+		return
+	}
+
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		if m.ThreadID == "" {
+			ids = append(ids, m.MessageID)
+		}
+	}
+
+	summaries, err := h.messageStore.GetThreadSummaries(ctx, ids)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get thread summaries", "err", err)
+		return
+	}
+
+	for i := range messages {
+		if summary, ok := summaries[messages[i].MessageID]; ok {
+			messages[i].ReplyCount = summary.ReplyCount
+			messages[i].LastReplyAt = summary.LastReplyAt.UnixMilli()
+		}
+	}
+}
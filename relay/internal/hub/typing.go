@@ -0,0 +1,192 @@
+package hub
+
+import (
+	"time"
+
+	"haven/internal/client"
+	"haven/internal/protocol"
+)
+
+const (
+	// How long a typing indicator lasts without a refresh from the client
+	typingTimeout = 6 * time.Second
+
+	// Minimum interval between typing events accepted from one connection
+	typingThrottle = 1 * time.Second
+)
+
+// typingState tracks an active typing indicator. Typing is never persisted.
+type typingState struct {
+	roomID     string // Set for room typing
+	toUsername string // Set for DM typing
+	userID     string
+	username   string
+	timer      *time.Timer
+}
+
+// typingKey identifies one user typing in one room or DM conversation
+func typingKey(userID, roomID, toUsername string) string {
+	if roomID != "" {
+		return "room:" + roomID + ":" + userID
+	}
+	return "dm:" + toUsername + ":" + userID
+}
+
+// SetTyping starts, refreshes or stops the client's typing indicator for a room
+// or a DM peer. Starts are relayed once and expire after typingTimeout unless
+// refreshed; refreshes within typingThrottle are dropped.
+func (h *Hub) SetTyping(c *client.Client, roomID, toUsername string, stopped bool) error {
+	if c.Username == "" {
+		return &Error{Code: protocol.ErrCodeNotRegistered, Message: "Must register first"}
+	}
+
+	if (roomID == "") == (toUsername == "") {
+		return &Error{Code: protocol.ErrCodeInvalidMessage, Message: "Typing requires either room_id or to"}
+	}
+
+	userID := c.UserID
+	if userID == "" {
+		userID = c.ID // Fallback for non-DB mode
+	}
+
+	h.mu.RLock()
+	if roomID != "" {
+		r, exists := h.rooms[roomID]
+		if !exists {
+			h.mu.RUnlock()
+			return &Error{Code: protocol.ErrCodeRoomNotFound, Message: "Room not found"}
+		}
+		if !r.HasMember(userID) {
+			h.mu.RUnlock()
+			return &Error{Code: protocol.ErrCodeNotInRoom, Message: "Not in room"}
+		}
+	} else if _, online := h.usernames[toUsername]; !online {
+		// Nobody to notify
+		h.mu.RUnlock()
+		return nil
+	}
+	h.mu.RUnlock()
+
+	key := typingKey(userID, roomID, toUsername)
+
+	if stopped {
+		h.stopTyping(key)
+		return nil
+	}
+
+	if !c.Throttle("typing:"+key, typingThrottle) {
+		return nil
+	}
+
+	h.typingMu.Lock()
+	if st, ok := h.typing[key]; ok {
+		// Already typing - just push the expiry back
+		st.timer.Reset(typingTimeout)
+		h.typingMu.Unlock()
+		return nil
+	}
+	st := &typingState{
+		roomID:     roomID,
+		toUsername: toUsername,
+		userID:     userID,
+		username:   c.Username,
+	}
+	st.timer = time.AfterFunc(typingTimeout, func() { h.expireTyping(key, st) })
+	h.typing[key] = st
+	h.typingMu.Unlock()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.sendTypingLocked(st, protocol.TypeTypingStarted)
+
+	return nil
+}
+
+// stopTyping ends a typing indicator and notifies the audience
+func (h *Hub) stopTyping(key string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.stopTypingLocked(key)
+}
+
+// stopTypingLocked ends a typing indicator and notifies the audience
+// Must be called with h.mu held
+func (h *Hub) stopTypingLocked(key string) {
+	h.typingMu.Lock()
+	st, ok := h.typing[key]
+	if ok {
+		st.timer.Stop()
+		delete(h.typing, key)
+	}
+	h.typingMu.Unlock()
+
+	if ok {
+		h.sendTypingLocked(st, protocol.TypeTypingStopped)
+	}
+}
+
+// clearUserTypingLocked ends every typing indicator of a user (e.g. on disconnect)
+// Must be called with h.mu held
+func (h *Hub) clearUserTypingLocked(userID string) {
+	h.typingMu.Lock()
+	var cleared []*typingState
+	for key, st := range h.typing {
+		if st.userID == userID {
+			st.timer.Stop()
+			delete(h.typing, key)
+			cleared = append(cleared, st)
+		}
+	}
+	h.typingMu.Unlock()
+
+	for _, st := range cleared {
+		h.sendTypingLocked(st, protocol.TypeTypingStopped)
+	}
+}
+
+// expireTyping is called by a typing timer when no refresh arrived in time
+func (h *Hub) expireTyping(key string, st *typingState) {
+	h.typingMu.Lock()
+	if h.typing[key] != st {
+		// Stopped or replaced in the meantime
+		h.typingMu.Unlock()
+		return
+	}
+	delete(h.typing, key)
+	h.typingMu.Unlock()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.sendTypingLocked(st, protocol.TypeTypingStopped)
+}
+
+// sendTypingLocked relays a typing event to the other room members or to the DM peer
+// Must be called with h.mu held
+func (h *Hub) sendTypingLocked(st *typingState, msgType protocol.MessageType) {
+	if st.roomID != "" {
+		r, ok := h.rooms[st.roomID]
+		if !ok {
+			return
+		}
+		payload := protocol.TypingEventPayload{
+			RoomID:   st.roomID,
+			UserID:   st.userID,
+			Username: st.username,
+		}
+		// Don't echo the indicator back to any of the typist's devices, nor
+		// show it to members who blocked the typist
+		for _, memberUserID := range r.MemberList() {
+			if memberUserID != st.userID && !h.hasBlockedLocked(memberUserID, st.userID) {
+				h.sendToUserLocked(memberUserID, "", msgType, payload)
+			}
+		}
+		return
+	}
+
+	if toID, ok := h.usernames[st.toUsername]; ok && !h.hasBlockedLocked(toID, st.userID) {
+		h.sendToUserLocked(toID, "", msgType, protocol.TypingEventPayload{
+			UserID:   st.userID,
+			Username: st.username,
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// Package logging sets up structured logging and carries log fields, such
+// as the connection and user a request belongs to, in contexts
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Formats accepted by New
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// redacted replaces the values of sensitive attributes
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are attribute keys whose values are never written, in case
+// a secret is ever passed to a log call by mistake
+var sensitiveKeys = map[string]bool{
+	"recovery_code": true,
+	"fingerprint":   true,
+	"password":      true,
+	"token":         true,
+	"auth_token":    true,
+	"admin_token":   true,
+	"invite_token":  true,
+	"authorization": true,
+}
+
+// New creates a logger writing to w in the given format ("text" or "json")
+// at the given minimum level ("debug", "info", "warn" or "error")
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case FormatText:
+		handler = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("invalid log format %q: expected text or json", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
+
+// Setup makes a logger writing to stderr the default, for both log/slog
+// and the standard log package
+func Setup(format, level string) error {
+	logger, err := New(os.Stderr, format, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+// redact hides the values of sensitive attributes
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// attrsKey is the context key of the attributes added by With
+type attrsKey struct{}
+
+// With returns a copy of ctx whose log lines also carry args, given as
+// alternating keys and values like slog.Logger.With
+func With(ctx context.Context, args ...any) context.Context {
+	if len(args) == 0 {
+		return ctx
+	}
+	var attrs []slog.Attr
+	if parent, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		attrs = append(attrs, parent...)
+	}
+	r := slog.NewRecord(time.Time{}, 0, "", 0)
+	r.Add(args...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+// contextHandler adds the attributes carried by a record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(attrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
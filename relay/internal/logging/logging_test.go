@@ -0,0 +1,75 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew_JSONWithContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "info")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	ctx := With(context.Background(), "conn_id", "c1", "user_id", "u1")
+	ctx = With(ctx, "room_id", "r1")
+	logger.InfoContext(ctx, "Message sent", "msg_type", "room_message")
+	logger.DebugContext(ctx, "Not written")
+
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON line, got %q", buf.String())
+	}
+	for key, want := range map[string]string{
+		"msg":      "Message sent",
+		"level":    "INFO",
+		"conn_id":  "c1",
+		"user_id":  "u1",
+		"room_id":  "r1",
+		"msg_type": "room_message",
+	} {
+		if entry[key] != want {
+			t.Errorf("Expected %s=%q, got %v", key, want, entry[key])
+		}
+	}
+}
+
+func TestNew_RedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "text", "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	ctx := With(context.Background(), "token", "abc123")
+	logger.With("Recovery_Code", "hunter2").DebugContext(ctx, "Registering", "username", "alice")
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "abc123") {
+		t.Errorf("Expected secrets to be redacted, got %q", out)
+	}
+	if !strings.Contains(out, "username=alice") || !strings.Contains(out, "token="+redacted) {
+		t.Errorf("Expected other fields to be kept, got %q", out)
+	}
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	if _, err := New(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("Expected unknown format to be rejected")
+	}
+	if _, err := New(&bytes.Buffer{}, "text", "loud"); err == nil {
+		t.Error("Expected unknown level to be rejected")
+	}
+	logger, err := New(&bytes.Buffer{}, "JSON", "WARN")
+	if err != nil {
+		t.Fatalf("Expected options to be case-insensitive, got %v", err)
+	}
+	if logger.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("Expected info to be disabled at warn level")
+	}
+}
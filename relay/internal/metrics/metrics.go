@@ -0,0 +1,371 @@
+// Package metrics implements counters, gauges and histograms exposed in the
+// Prometheus text format
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram bucket bounds suited to request latencies, in seconds
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is anything a Registry can expose
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds a set of metrics to expose together
+type Registry struct {
+	mu      sync.Mutex
+	metrics map[string]metric
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make(map[string]metric)}
+}
+
+// Default is the registry the package-level constructors register with
+var Default = NewRegistry()
+
+// register adds a metric, panicking on a duplicate name like a duplicate
+// flag or route would
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.metrics[name] = m
+}
+
+// WriteTo writes every metric in the Prometheus text format, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = r.metrics[name]
+	}
+	r.mu.Unlock()
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the registry's metrics over HTTP
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = r.WriteTo(w)
+	})
+}
+
+// Handler serves the default registry's metrics over HTTP
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// Counter is a value that only goes up, optionally split by labels
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+	series *seriesSet[*float64]
+}
+
+// NewCounter creates a counter in the default registry
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewCounter creates a counter in the registry
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, series: newSeriesSet(func() *float64 { return new(float64) })}
+	r.register(name, c)
+	return c
+}
+
+// Inc adds one to the series with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds v, which must not be negative, to the series with the given label values
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.series.update(labelValues, func(total *float64) { *total += v })
+}
+
+// Value returns the current value of the series with the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	var v float64
+	c.series.read(labelValues, func(total *float64) { v = *total })
+	return v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.series.each(func(values []string, total *float64) {
+		writeSample(w, c.name, c.labels, values, *total)
+	})
+}
+
+// Histogram counts observations in buckets, optionally split by labels
+type Histogram struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	series  *seriesSet[*histogramSeries]
+}
+
+// histogramSeries holds the observations of one label combination
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative; the last is +Inf
+	sum    float64
+	count  uint64
+}
+
+// NewHistogram creates a histogram in the default registry
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram creates a histogram in the registry
+// Buckets are upper bounds in increasing order; +Inf is added implicitly
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets}
+	h.series = newSeriesSet(func() *histogramSeries {
+		return &histogramSeries{counts: make([]uint64, len(buckets)+1)}
+	})
+	r.register(name, h)
+	return h
+}
+
+// Observe records a value in the series with the given label values
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.series.update(labelValues, func(s *histogramSeries) {
+		s.counts[i]++
+		s.sum += v
+		s.count++
+	})
+}
+
+// Count returns the number of observations in the series with the given label values
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	var n uint64
+	h.series.read(labelValues, func(s *histogramSeries) { n = s.count })
+	return n
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+	h.series.each(func(values []string, s *histogramSeries) {
+		var cumulative uint64
+		for i, count := range s.counts {
+			cumulative += count
+			le := math.Inf(1)
+			if i < len(h.buckets) {
+				le = h.buckets[i]
+			}
+			bucketValues := append(append(make([]string, 0, len(values)+1), values...), formatFloat(le))
+			writeSample(w, h.name+"_bucket", bucketLabels, bucketValues, float64(cumulative))
+		}
+		writeSample(w, h.name+"_sum", h.labels, values, s.sum)
+		writeSample(w, h.name+"_count", h.labels, values, float64(s.count))
+	})
+}
+
+// GaugeFunc is a value read from a function at collection time
+type GaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+// NewGaugeFunc creates a gauge in the default registry
+func NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	return Default.NewGaugeFunc(name, help, fn)
+}
+
+// NewGaugeFunc creates a gauge in the registry whose value is fn's result
+// fn is called on every collection and must be safe for concurrent use
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	r.register(name, g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, g.fn())
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	name  string
+	help  string
+	mu    sync.Mutex
+	value float64
+}
+
+// NewGauge creates a gauge in the default registry
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewGauge creates a gauge in the registry
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(name, g)
+	return g
+}
+
+// Set replaces the gauge's value
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+// Value returns the gauge's value
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, g.Value())
+}
+
+// seriesSet holds one value per combination of label values
+type seriesSet[T any] struct {
+	mu     sync.Mutex
+	newFn  func() T
+	values map[string]T
+	keys   map[string][]string // series key -> label values
+}
+
+func newSeriesSet[T any](newFn func() T) *seriesSet[T] {
+	return &seriesSet[T]{newFn: newFn, values: make(map[string]T), keys: make(map[string][]string)}
+}
+
+// update applies fn to a series, creating it on first use
+func (s *seriesSet[T]) update(labelValues []string, fn func(T)) {
+	key := strings.Join(labelValues, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.values[key]
+	if !ok {
+		v = s.newFn()
+		s.values[key] = v
+		s.keys[key] = append([]string{}, labelValues...)
+	}
+	fn(v)
+}
+
+// read applies fn to a series if it exists
+func (s *seriesSet[T]) read(labelValues []string, fn func(T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if v, ok := s.values[strings.Join(labelValues, "\xff")]; ok {
+		fn(v)
+	}
+}
+
+// each applies fn to every series in label order
+func (s *seriesSet[T]) each(fn func(labelValues []string, v T)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(s.keys[key], s.values[key])
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, helpEscaper.Replace(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			value := ""
+			if i < len(values) {
+				value = values[i]
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, labelEscaper.Replace(value))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
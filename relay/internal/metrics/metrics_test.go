@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+
+	received := r.NewCounter("test_messages_total", "Messages received.", "type")
+	received.Inc("room_message")
+	received.Inc("room_message")
+	received.Add(3, `odd"type`)
+	received.Add(-1, "room_message") // Counters never go down
+
+	latency := r.NewHistogram("test_latency_seconds", "Query latency.", []float64{0.1, 1}, "method")
+	latency.Observe(0.05, "Save")
+	latency.Observe(0.5, "Save")
+	latency.Observe(5, "Save")
+
+	r.NewGaugeFunc("test_clients", "Connected clients.", func() float64 { return 7 })
+	last := r.NewGauge("test_last_run", "Last run.")
+	last.Set(1.5)
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	expected := `# HELP test_clients Connected clients.
+# TYPE test_clients gauge
+test_clients 7
+# HELP test_last_run Last run.
+# TYPE test_last_run gauge
+test_last_run 1.5
+# HELP test_latency_seconds Query latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{method="Save",le="0.1"} 1
+test_latency_seconds_bucket{method="Save",le="1"} 2
+test_latency_seconds_bucket{method="Save",le="+Inf"} 3
+test_latency_seconds_sum{method="Save"} 5.55
+test_latency_seconds_count{method="Save"} 3
+# HELP test_messages_total Messages received.
+# TYPE test_messages_total counter
+test_messages_total{type="odd\"type"} 3
+test_messages_total{type="room_message"} 2
+`
+	if b.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nExpected:\n%s", b.String(), expected)
+	}
+
+	if v := received.Value("room_message"); v != 2 {
+		t.Errorf("Expected counter value 2, got %v", v)
+	}
+	if n := latency.Count("Save"); n != 3 {
+		t.Errorf("Expected 3 observations, got %d", n)
+	}
+	if n := latency.Count("Delete"); n != 0 {
+		t.Errorf("Expected no observations for an unused series, got %d", n)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain content type, got %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "test_total 1\n") {
+		t.Errorf("Expected counter in output, got %q", rec.Body.String())
+	}
+}
+
+func TestRegistry_DuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test.")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a duplicate name to panic")
+		}
+	}()
+	r.NewGaugeFunc("test_total", "Test.", func() float64 { return 0 })
+}
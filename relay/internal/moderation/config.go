@@ -0,0 +1,45 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config describes a moderation pipeline, typically loaded from a JSON file:
+//
+//	{
+//	  "rules": [{"words": ["spam"], "action": "mask"}],
+//	  "rooms": {"<room id>": [{"patterns": ["https?://"], "action": "quarantine", "reason": "link"}]}
+//	}
+type Config struct {
+	MaxLength int               `json:"max_length"` // Longest message in characters (0 = no limit)
+	Rules     []Rule            `json:"rules"`      // Rules for every message
+	Rooms     map[string][]Rule `json:"rooms"`      // Extra rules for messages in a room, keyed by room ID
+}
+
+// LoadConfig reads a JSON config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// Pipeline builds the configured filter chain: the length check, then word rules
+func (c *Config) Pipeline() (*Pipeline, error) {
+	filters := []Filter{LengthFilter{Max: c.MaxLength}}
+	if len(c.Rules) > 0 || len(c.Rooms) > 0 {
+		words, err := NewWordFilter(c.Rules, c.Rooms)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, words)
+	}
+	return NewPipeline(filters...), nil
+}
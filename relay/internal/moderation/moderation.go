@@ -0,0 +1,100 @@
+// Package moderation runs message content through a chain of filters
+// before it is stored or delivered
+package moderation
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Action is what a filter decides to do with a message
+// Stronger actions have larger values
+type Action int
+
+const (
+	Accept     Action = iota // Deliver the message as is
+	Rewrite                  // Deliver the message with changed content
+	Quarantine               // Hold the message for review instead of delivering it
+	Reject                   // Refuse the message and tell the sender why
+)
+
+// Reason codes reported to senders
+const (
+	ReasonEmpty          = "empty"
+	ReasonTooLong        = "too_long"
+	ReasonBlockedContent = "blocked_content"
+)
+
+// Message is the content being checked and where it is going
+type Message struct {
+	RoomID         string // Empty for direct messages
+	SenderID       string
+	Content        string
+	HasAttachments bool // A message with attachments may have no text
+}
+
+// Verdict is the outcome of checking a message
+type Verdict struct {
+	Action  Action
+	Reason  string // Reason code, set unless the message was accepted
+	Content string // Content to deliver, possibly rewritten
+}
+
+// Filter checks a message
+// Unless it rejects the message, a filter returns the content to pass on in
+// Verdict.Content, rewritten or not: a filter may mask part of a message and
+// still quarantine it
+type Filter interface {
+	Check(m Message) Verdict
+}
+
+// Pipeline runs a message through filters in order
+// Rewrites are passed on to later filters; the first rejection stops the chain;
+// a quarantine holds the message unless a later filter rejects it
+// A nil Pipeline accepts everything
+type Pipeline struct {
+	filters []Filter
+}
+
+// NewPipeline creates a pipeline of the given filters
+func NewPipeline(filters ...Filter) *Pipeline {
+	return &Pipeline{filters: filters}
+}
+
+// Check runs the message through every filter and returns the combined verdict
+func (p *Pipeline) Check(m Message) Verdict {
+	result := Verdict{Action: Accept}
+	if p != nil {
+		for _, f := range p.filters {
+			v := f.Check(m)
+			if v.Action == Reject {
+				v.Content = m.Content
+				return v
+			}
+			m.Content = v.Content
+			if v.Action > result.Action {
+				result.Action = v.Action
+				result.Reason = v.Reason
+			}
+		}
+	}
+	result.Content = m.Content
+	return result
+}
+
+// LengthFilter rejects messages without content and messages over Max characters
+// Max <= 0 disables the length check
+type LengthFilter struct {
+	Max int
+}
+
+// Check implements Filter
+func (f LengthFilter) Check(m Message) Verdict {
+	if strings.TrimSpace(m.Content) == "" && !m.HasAttachments {
+		return Verdict{Action: Reject, Reason: ReasonEmpty}
+	}
+	if f.Max > 0 && utf8.RuneCountInString(m.Content) > f.Max {
+		return Verdict{Action: Reject, Reason: ReasonTooLong}
+	}
+	return Verdict{Action: Accept, Content: m.Content}
+}
@@ -0,0 +1,155 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLengthFilter(t *testing.T) {
+	f := LengthFilter{Max: 5}
+
+	tests := []struct {
+		m      Message
+		action Action
+		reason string
+	}{
+		{Message{Content: "hello"}, Accept, ""},
+		{Message{Content: "héllo"}, Accept, ""}, // Characters, not bytes
+		{Message{Content: "hello!"}, Reject, ReasonTooLong},
+		{Message{Content: "  \n"}, Reject, ReasonEmpty},
+		{Message{Content: "", HasAttachments: true}, Accept, ""},
+	}
+
+	for _, tt := range tests {
+		v := f.Check(tt.m)
+		if v.Action != tt.action || v.Reason != tt.reason {
+			t.Errorf("Check(%q) = %v/%q, want %v/%q", tt.m.Content, v.Action, v.Reason, tt.action, tt.reason)
+		}
+	}
+}
+
+func TestWordFilter(t *testing.T) {
+	f, err := NewWordFilter(
+		[]Rule{
+			{Words: []string{"darn"}, Action: "mask"},
+			{Patterns: []string{`buy\s+now`}, Reason: "spam"},
+		},
+		map[string][]Rule{
+			"room-1": {{Patterns: []string{`https?://`}, Action: "quarantine", Reason: "link"}},
+		},
+	)
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+
+	// Whole words are masked regardless of case
+	v := f.Check(Message{Content: "Darn it, darnation"})
+	if v.Action != Rewrite || v.Content != "**** it, darnation" {
+		t.Errorf("Expected masked content, got %v %q", v.Action, v.Content)
+	}
+
+	v = f.Check(Message{Content: "BUY  NOW please"})
+	if v.Action != Accept {
+		t.Errorf("Expected patterns to be case sensitive, got %v", v.Action)
+	}
+	v = f.Check(Message{Content: "buy now, darn"})
+	if v.Action != Reject || v.Reason != "spam" {
+		t.Errorf("Expected spam rejection, got %v/%q", v.Action, v.Reason)
+	}
+
+	// Room rules apply only in their room
+	v = f.Check(Message{RoomID: "room-1", Content: "see https://example.com"})
+	if v.Action != Quarantine || v.Reason != "link" {
+		t.Errorf("Expected link quarantine in room-1, got %v/%q", v.Action, v.Reason)
+	}
+	v = f.Check(Message{RoomID: "room-2", Content: "see https://example.com"})
+	if v.Action != Accept {
+		t.Errorf("Expected link to be accepted in room-2, got %v", v.Action)
+	}
+
+	if _, err := NewWordFilter([]Rule{{Patterns: []string{"("}}}, nil); err == nil {
+		t.Error("Expected invalid pattern to be rejected")
+	}
+	if _, err := NewWordFilter([]Rule{{Words: []string{"x"}, Action: "explode"}}, nil); err == nil {
+		t.Error("Expected unknown action to be rejected")
+	}
+}
+
+// fixedFilter returns the same verdict for every message, passing the
+// content on unless the verdict sets it
+type fixedFilter Verdict
+
+func (f fixedFilter) Check(m Message) Verdict {
+	v := Verdict(f)
+	if v.Content == "" {
+		v.Content = m.Content
+	}
+	return v
+}
+
+func TestPipeline(t *testing.T) {
+	// A nil pipeline accepts everything
+	var p *Pipeline
+	if v := p.Check(Message{Content: "hi"}); v.Action != Accept || v.Content != "hi" {
+		t.Errorf("Expected nil pipeline to accept, got %v %q", v.Action, v.Content)
+	}
+
+	// Rewrites are seen by later filters
+	words, _ := NewWordFilter([]Rule{{Words: []string{"heck"}, Reason: "language"}}, nil)
+	p = NewPipeline(fixedFilter{Action: Rewrite, Content: "what the heck", Reason: "rewritten"}, words)
+	if v := p.Check(Message{Content: "what the"}); v.Action != Reject || v.Reason != "language" {
+		t.Errorf("Expected rewritten content to be rejected, got %v/%q", v.Action, v.Reason)
+	}
+
+	// A quarantine wins over a rewrite, and the rewrite is kept
+	p = NewPipeline(
+		fixedFilter{Action: Quarantine, Reason: "held"},
+		fixedFilter{Action: Rewrite, Content: "changed", Reason: "rewritten"},
+	)
+	v := p.Check(Message{Content: "original"})
+	if v.Action != Quarantine || v.Reason != "held" || v.Content != "changed" {
+		t.Errorf("Expected quarantine of rewritten content, got %v/%q %q", v.Action, v.Reason, v.Content)
+	}
+
+	// Masking by a filter that also quarantines is kept
+	words, _ = NewWordFilter([]Rule{
+		{Words: []string{"darn"}, Action: "mask"},
+		{Patterns: []string{`https?://`}, Action: "quarantine", Reason: "link"},
+	}, nil)
+	p = NewPipeline(LengthFilter{Max: 100}, words)
+	v = p.Check(Message{Content: "darn, see https://example.com"})
+	if v.Action != Quarantine || v.Reason != "link" || v.Content != "****, see https://example.com" {
+		t.Errorf("Expected quarantine of masked content, got %v/%q %q", v.Action, v.Reason, v.Content)
+	}
+
+	// A rejection stops the chain
+	p = NewPipeline(fixedFilter{Action: Reject, Reason: "no"}, fixedFilter{Action: Quarantine, Reason: "held"})
+	if v := p.Check(Message{Content: "x"}); v.Action != Reject || v.Reason != "no" {
+		t.Errorf("Expected rejection, got %v/%q", v.Action, v.Reason)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moderation.json")
+	data := `{"max_length": 10, "rules": [{"words": ["darn"], "action": "mask"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	p, err := cfg.Pipeline()
+	if err != nil {
+		t.Fatalf("Failed to build pipeline: %v", err)
+	}
+
+	if v := p.Check(Message{Content: "darn"}); v.Action != Rewrite || v.Content != "****" {
+		t.Errorf("Expected masked content, got %v %q", v.Action, v.Content)
+	}
+	if v := p.Check(Message{Content: "far too long"}); v.Action != Reject || v.Reason != ReasonTooLong {
+		t.Errorf("Expected too_long rejection, got %v/%q", v.Action, v.Reason)
+	}
+}
@@ -0,0 +1,141 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule matches words or regular expressions and says what to do with matching messages
+type Rule struct {
+	Words    []string `json:"words"`    // Matched as whole words, ignoring case
+	Patterns []string `json:"patterns"` // Go regular expressions
+	Action   string   `json:"action"`   // "reject" (default), "mask" or "quarantine"
+	Reason   string   `json:"reason"`   // Reason code reported for matches (default "blocked_content")
+}
+
+// compiledRule is a Rule with its words and patterns combined into one expression
+type compiledRule struct {
+	re     *regexp.Regexp
+	action Action
+	reason string
+}
+
+// compile builds the rule's expression
+func (r Rule) compile() (*compiledRule, error) {
+	var action Action
+	switch r.Action {
+	case "", "reject":
+		action = Reject
+	case "mask":
+		action = Rewrite
+	case "quarantine":
+		action = Quarantine
+	default:
+		return nil, fmt.Errorf("unknown action %q", r.Action)
+	}
+
+	var parts []string
+	if len(r.Words) > 0 {
+		words := make([]string, 0, len(r.Words))
+		for _, w := range r.Words {
+			if w = strings.TrimSpace(w); w != "" {
+				words = append(words, regexp.QuoteMeta(w))
+			}
+		}
+		if len(words) > 0 {
+			parts = append(parts, `(?i:\b(?:`+strings.Join(words, "|")+`)\b)`)
+		}
+	}
+	for _, p := range r.Patterns {
+		if _, err := regexp.Compile(p); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		parts = append(parts, "(?:"+p+")")
+	}
+	if len(parts) == 0 {
+		return nil, nil
+	}
+
+	reason := r.Reason
+	if reason == "" {
+		reason = ReasonBlockedContent
+	}
+	return &compiledRule{
+		re:     regexp.MustCompile(strings.Join(parts, "|")),
+		action: action,
+		reason: reason,
+	}, nil
+}
+
+// WordFilter applies word and pattern rules, globally and per room
+// Direct messages only get the global rules
+type WordFilter struct {
+	global []*compiledRule
+	rooms  map[string][]*compiledRule // roomID -> rules that apply on top of the global ones
+}
+
+// NewWordFilter compiles global rules and per-room rules keyed by room ID
+func NewWordFilter(global []Rule, rooms map[string][]Rule) (*WordFilter, error) {
+	f := &WordFilter{rooms: make(map[string][]*compiledRule)}
+
+	var err error
+	if f.global, err = compileRules(global); err != nil {
+		return nil, err
+	}
+	for roomID, rules := range rooms {
+		compiled, err := compileRules(rules)
+		if err != nil {
+			return nil, fmt.Errorf("room %s: %w", roomID, err)
+		}
+		f.rooms[roomID] = compiled
+	}
+	return f, nil
+}
+
+// compileRules compiles a list of rules, dropping empty ones
+func compileRules(rules []Rule) ([]*compiledRule, error) {
+	var compiled []*compiledRule
+	for i, r := range rules {
+		c, err := r.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if c != nil {
+			compiled = append(compiled, c)
+		}
+	}
+	return compiled, nil
+}
+
+// Check implements Filter
+// Matches of every masking rule are masked; the strongest other match wins
+func (f *WordFilter) Check(m Message) Verdict {
+	result := Verdict{Action: Accept, Content: m.Content}
+
+	check := func(rules []*compiledRule) {
+		for _, r := range rules {
+			if !r.re.MatchString(result.Content) {
+				continue
+			}
+			if r.action == Rewrite {
+				result.Content = r.re.ReplaceAllStringFunc(result.Content, mask)
+			}
+			if r.action > result.Action {
+				result.Action = r.action
+				result.Reason = r.reason
+			}
+		}
+	}
+	check(f.global)
+	if m.RoomID != "" {
+		check(f.rooms[m.RoomID])
+	}
+	return result
+}
+
+// mask replaces every character of a match with an asterisk
+func mask(match string) string {
+	return strings.Repeat("*", utf8.RuneCountInString(match))
+}
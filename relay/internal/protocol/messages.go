@@ -10,29 +10,87 @@ type MessageType string
 
 const (
 	// Client -> Server
-	TypeRegister    MessageType = "register"
-	TypeDirectMsg   MessageType = "direct_message"
-	TypeRoomCreate  MessageType = "room_create"
-	TypeRoomJoin    MessageType = "room_join"
-	TypeRoomLeave   MessageType = "room_leave"
-	TypeRoomMessage MessageType = "room_message"
-	TypeRoomHistory MessageType = "room_history"
-	TypeUserList    MessageType = "user_list"
-	TypeRoomList    MessageType = "room_list"
+	TypeRegister       MessageType = "register"
+	TypeDirectMsg      MessageType = "direct_message"
+	TypeRoomCreate     MessageType = "room_create"
+	TypeRoomJoin       MessageType = "room_join"
+	TypeRoomLeave      MessageType = "room_leave"
+	TypeRoomMessage    MessageType = "room_message"
+	TypeRoomHistory    MessageType = "room_history"
+	TypeThreadHistory  MessageType = "thread_history"
+	TypeDMHistory      MessageType = "dm_history"
+	TypeRoomMsgEdit    MessageType = "room_message_edit"
+	TypeRoomMsgDelete  MessageType = "room_message_delete"
+	TypeReactionAdd    MessageType = "reaction_add"
+	TypeReactionRemove MessageType = "reaction_remove"
+	TypeTyping         MessageType = "typing"
+	TypePresenceUpdate MessageType = "presence_update"
+	TypeMarkRead       MessageType = "mark_read"
+	TypeSync           MessageType = "sync"
+	TypeMentions       MessageType = "mentions"
+	TypeMessageSearch  MessageType = "message_search"
+	TypeMessagePin     MessageType = "message_pin"
+	TypeMessageUnpin   MessageType = "message_unpin"
+	TypeRoomUpdate     MessageType = "room_update"
+	TypeRoomSetRole    MessageType = "room_set_role"
+	TypeRoomKick       MessageType = "room_kick"
+	TypeRoomTransfer   MessageType = "room_transfer_ownership"
+	TypeRoomInvite     MessageType = "room_invite" // Also sent Server -> Client to the invited user
+	TypeInviteCreate   MessageType = "room_invite_create"
+	TypeInviteRevoke   MessageType = "room_invite_revoke"
+	TypeInviteList     MessageType = "room_invite_list"
+	TypeKickSessions   MessageType = "kick_other_sessions"
+	TypeUserBlock      MessageType = "user_block"
+	TypeUserUnblock    MessageType = "user_unblock"
+	TypeBlockList      MessageType = "block_list"
+	TypeReport         MessageType = "report"
+	TypeReportList     MessageType = "report_list"
+	TypeReportResolve  MessageType = "report_resolve"
+	TypeUserList       MessageType = "user_list"
+	TypeRoomList       MessageType = "room_list"
 
 	// Server -> Client
-	TypeRegisterAck     MessageType = "register_ack"
-	TypeKicked          MessageType = "kicked"
-	TypeUserJoined      MessageType = "user_joined"
-	TypeUserLeft        MessageType = "user_left"
-	TypeRoomCreated     MessageType = "room_created"
-	TypeRoomJoined      MessageType = "room_joined"
-	TypeRoomLeft        MessageType = "room_left"
-	TypeRoomMembers     MessageType = "room_members"
-	TypeRoomHistoryResp MessageType = "room_history_response"
-	TypeUserListResp    MessageType = "user_list_response"
-	TypeRoomListResp    MessageType = "room_list_response"
-	TypeError           MessageType = "error"
+	TypeRegisterAck       MessageType = "register_ack"
+	TypeKicked            MessageType = "kicked"
+	TypeUserJoined        MessageType = "user_joined"
+	TypeUserLeft          MessageType = "user_left"
+	TypeRoomCreated       MessageType = "room_created"
+	TypeRoomJoined        MessageType = "room_joined"
+	TypeRoomLeft          MessageType = "room_left"
+	TypeRoomMembers       MessageType = "room_members"
+	TypeRoomHistoryResp   MessageType = "room_history_response"
+	TypeThreadHistoryResp MessageType = "thread_history_response"
+	TypeDMHistoryResp     MessageType = "dm_history_response"
+	TypeMessageEdited     MessageType = "message_edited"
+	TypeMessageDeleted    MessageType = "message_deleted"
+	TypeReactionUpdated   MessageType = "reaction_updated"
+	TypeTypingStarted     MessageType = "typing_started"
+	TypeTypingStopped     MessageType = "typing_stopped"
+	TypeReadReceipt       MessageType = "read_receipt"
+	TypePresenceChanged   MessageType = "presence_changed"
+	TypeSyncResp          MessageType = "sync_response"
+	TypeMentioned         MessageType = "mentioned"
+	TypeMentionsResp      MessageType = "mentions_response"
+	TypeMessageSearchResp MessageType = "message_search_response"
+	TypeRoomPinsUpdated   MessageType = "room_pins_updated"
+	TypeRoomUpdated       MessageType = "room_updated"
+	TypeRoomKicked        MessageType = "room_kicked"
+	TypeRoomDeleted       MessageType = "room_deleted"
+	TypeRoomInviteResp    MessageType = "room_invite_response"
+	TypeInviteCreated     MessageType = "room_invite_created"
+	TypeInviteRevoked     MessageType = "room_invite_revoked"
+	TypeInviteListResp    MessageType = "room_invite_list_response"
+	TypeKickSessionsResp  MessageType = "kick_other_sessions_response"
+	TypeMessageHeld       MessageType = "message_held"
+	TypeUserBlocked       MessageType = "user_blocked"
+	TypeUserUnblocked     MessageType = "user_unblocked"
+	TypeBlockListResp     MessageType = "block_list_response"
+	TypeReportResp        MessageType = "report_response"
+	TypeReportListResp    MessageType = "report_list_response"
+	TypeReportResolved    MessageType = "report_resolved"
+	TypeUserListResp      MessageType = "user_list_response"
+	TypeRoomListResp      MessageType = "room_list_response"
+	TypeError             MessageType = "error"
 )
 
 // Envelope is the base message wrapper
@@ -71,8 +129,9 @@ type RegisterPayload struct {
 
 // DirectMessagePayload - send DM to another user
 type DirectMessagePayload struct {
-	To      string `json:"to"` // Target username
-	Content string `json:"content"`
+	To          string `json:"to"` // Target username
+	Content     string `json:"content"`
+	ClientMsgID string `json:"client_msg_id,omitempty"` // Idempotency key; retries with the same key are not stored twice
 }
 
 // RoomCreatePayload - create a new room
@@ -81,9 +140,64 @@ type RoomCreatePayload struct {
 	IsPublic bool   `json:"is_public"`
 }
 
+// RoomUpdatePayload - change a room's metadata (owner only)
+// Omitted fields are left unchanged
+type RoomUpdatePayload struct {
+	RoomID      string  `json:"room_id"`
+	Name        *string `json:"name,omitempty"`
+	Topic       *string `json:"topic,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+// RoomSetRolePayload - change a member's role (admins and above)
+type RoomSetRolePayload struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id"`
+	Role   string `json:"role"` // "admin", "moderator" or "member"
+}
+
+// RoomKickPayload - remove a member from a room (moderators and above)
+type RoomKickPayload struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id"`
+}
+
+// RoomTransferPayload - hand a room to another member (owner only)
+type RoomTransferPayload struct {
+	RoomID string `json:"room_id"`
+	UserID string `json:"user_id"` // New owner
+}
+
+// RoomInvitePayload - invite a user to a room (moderators and above for private rooms)
+type RoomInvitePayload struct {
+	RoomID   string `json:"room_id"`
+	Username string `json:"username"`
+}
+
+// InviteCreatePayload - create an invite link for a room (moderators and above)
+type InviteCreatePayload struct {
+	RoomID    string `json:"room_id"`
+	MaxUses   int    `json:"max_uses,omitempty"`   // 0 = unlimited
+	ExpiresIn int64  `json:"expires_in,omitempty"` // Seconds until the link expires, 0 = never
+}
+
+// InviteRevokePayload - revoke an invite link
+type InviteRevokePayload struct {
+	RoomID string `json:"room_id"`
+	Token  string `json:"token"`
+}
+
+// InviteListPayload - list a room's active invite links
+type InviteListPayload struct {
+	RoomID string `json:"room_id"`
+}
+
 // RoomJoinPayload - join an existing room
+// Private rooms require a pending invitation or an invite token; with a
+// token the room_id may be omitted
 type RoomJoinPayload struct {
-	RoomID string `json:"room_id"`
+	RoomID      string `json:"room_id"`
+	InviteToken string `json:"invite_token,omitempty"`
 }
 
 // RoomLeavePayload - leave a room
@@ -93,8 +207,12 @@ type RoomLeavePayload struct {
 
 // RoomMessagePayload - send message to room
 type RoomMessagePayload struct {
-	RoomID  string `json:"room_id"`
-	Content string `json:"content"`
+	RoomID      string   `json:"room_id"`
+	Content     string   `json:"content"`
+	ReplyTo     string   `json:"reply_to,omitempty"`      // Message being replied to (starts or continues its thread)
+	ThreadID    string   `json:"thread_id,omitempty"`     // Thread root to post into
+	ClientMsgID string   `json:"client_msg_id,omitempty"` // Idempotency key; retries with the same key are not stored twice
+	Attachments []string `json:"attachments,omitempty"`   // IDs of uploaded attachments to send with the message
 }
 
 // RoomHistoryPayload - request message history for a room
@@ -104,6 +222,124 @@ type RoomHistoryPayload struct {
 	Before int64  `json:"before,omitempty"` // Get messages before this timestamp (for pagination)
 }
 
+// ThreadHistoryPayload - request the replies in a thread
+type ThreadHistoryPayload struct {
+	RoomID   string `json:"room_id"`
+	ThreadID string `json:"thread_id"`        // Root message ID
+	Limit    int    `json:"limit,omitempty"`  // Max messages to return (default: 50)
+	Before   int64  `json:"before,omitempty"` // Get messages before this timestamp (for pagination)
+}
+
+// RoomMessageEditPayload - edit a previously sent room message
+type RoomMessageEditPayload struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+// RoomMessageDeletePayload - delete (redact) a room message
+type RoomMessageDeletePayload struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+}
+
+// MessagePinPayload - pin or unpin a room message
+type MessagePinPayload struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+}
+
+// ReactionPayload - add or remove an emoji reaction on a room message
+type ReactionPayload struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// TypingPayload - typing indicator for a room or a DM conversation
+// Clients resend it periodically while the user keeps typing
+type TypingPayload struct {
+	RoomID  string `json:"room_id,omitempty"` // Room being typed in
+	To      string `json:"to,omitempty"`      // DM target username
+	Stopped bool   `json:"stopped,omitempty"` // True when the user stopped typing
+}
+
+// PresenceUpdatePayload - change the user's presence state and/or custom status
+// Omitted fields are left unchanged; an empty status clears it
+type PresenceUpdatePayload struct {
+	State           string  `json:"state,omitempty"` // "online", "away", "dnd" or "invisible"
+	Status          *string `json:"status,omitempty"`
+	StatusExpiresIn int64   `json:"status_expires_in,omitempty"` // Seconds until the status clears, 0 = never
+}
+
+// MarkReadPayload - mark a room as read up to (and including) a message
+type MarkReadPayload struct {
+	RoomID    string `json:"room_id"`
+	MessageID string `json:"message_id"`
+}
+
+// SyncPayload - fetch everything missed since a cursor after reconnecting
+// Cursors maps room ID to the timestamp of the last change the client saw in
+// that room; rooms without a cursor fall back to Since (a global watermark)
+type SyncPayload struct {
+	Since   int64            `json:"since,omitempty"`
+	Cursors map[string]int64 `json:"cursors,omitempty"`
+}
+
+// MentionsPayload - request the user's recent @mentions across all rooms
+type MentionsPayload struct {
+	Limit  int   `json:"limit,omitempty"`  // Max mentions to return (default: 50)
+	Before int64 `json:"before,omitempty"` // Get mentions before this timestamp (for pagination)
+}
+
+// MessageSearchPayload - full-text search of messages in the user's rooms
+type MessageSearchPayload struct {
+	Query  string `json:"query"`             // Search terms; supports "quoted phrases", -excluded and or
+	RoomID string `json:"room_id,omitempty"` // Only search this room
+	Sender string `json:"sender,omitempty"`  // Only messages from this username
+	After  int64  `json:"after,omitempty"`   // Only messages after this timestamp
+	Before int64  `json:"before,omitempty"`  // Only messages before this timestamp
+	Limit  int    `json:"limit,omitempty"`   // Max results to return (default: 20)
+	Offset int    `json:"offset,omitempty"`  // Results to skip (for pagination)
+}
+
+// DMHistoryPayload - request direct message history with another user
+type DMHistoryPayload struct {
+	With   string `json:"with"`             // Peer username
+	Limit  int    `json:"limit,omitempty"`  // Max messages to return (default: 50)
+	Before int64  `json:"before,omitempty"` // Get messages before this timestamp (for pagination)
+}
+
+// UserBlockPayload - block or unblock a user
+type UserBlockPayload struct {
+	Username string `json:"username"`
+}
+
+// ReportPayload - report a room message, a direct message or a user to moderators
+type ReportPayload struct {
+	TargetType string `json:"target_type"`          // "room_message", "direct_message" or "user"
+	RoomID     string `json:"room_id,omitempty"`    // Room of a reported room message
+	MessageID  string `json:"message_id,omitempty"` // Reported message
+	Username   string `json:"username,omitempty"`   // Reported user (user reports only)
+	Category   string `json:"category"`             // "spam", "harassment", "hate", "sexual", "violence" or "other"
+	Details    string `json:"details,omitempty"`    // Free text from the reporter
+}
+
+// ReportListPayload - list reports (room moderators and server admins)
+type ReportListPayload struct {
+	RoomID string `json:"room_id,omitempty"` // Reports about this room (required unless a server admin)
+	Status string `json:"status,omitempty"`  // "open" (default), "resolved" or "all"
+	Limit  int    `json:"limit,omitempty"`   // Max reports to return (default: 50)
+}
+
+// ReportResolvePayload - close a report, taking an action against the reported content or user
+type ReportResolvePayload struct {
+	ReportID string `json:"report_id"`
+	Action   string `json:"action"`             // "dismiss", "delete", "mute" or "ban"
+	Duration int64  `json:"duration,omitempty"` // Seconds a mute or ban lasts (mute default: 1 day; ban default: permanent)
+	Note     string `json:"note,omitempty"`     // Moderator's note, kept with the resolution
+}
+
 // ==================== Server -> Client Messages ====================
 
 // RegisterAckPayload - registration acknowledgment
@@ -113,14 +349,54 @@ type RegisterAckPayload struct {
 	UserID       string `json:"user_id,omitempty"`
 	RecoveryCode string `json:"recovery_code,omitempty"` // Only for new users
 	IsNewUser    bool   `json:"is_new_user,omitempty"`
+	AuthToken    string `json:"auth_token,omitempty"` // Bearer token for HTTP requests (attachments), valid while connected
 	Error        string `json:"error,omitempty"`
 }
 
-// KickedPayload - notification when user is kicked (imposter detection)
+// KickedPayload - notification when a session is signed out from another session
 type KickedPayload struct {
 	Reason string `json:"reason"`
 }
 
+// KickSessionsResponsePayload - result of signing out the user's other sessions
+type KickSessionsResponsePayload struct {
+	Kicked int `json:"kicked"` // Number of connections closed
+}
+
+// MessageHeldPayload - tells the sender a message was held for moderator review instead of delivered
+type MessageHeldPayload struct {
+	RoomID      string `json:"room_id,omitempty"` // Set for room messages
+	To          string `json:"to,omitempty"`      // Set for direct messages
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	Reason      string `json:"reason"` // Content filter reason code
+}
+
+// UserBlockedPayload - sent to all of the blocker's sessions when they block or unblock a user
+type UserBlockedPayload struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// BlockListResponsePayload - the users the client has blocked, most recent first
+type BlockListResponsePayload struct {
+	Blocked []BlockedUser `json:"blocked"`
+}
+
+// ReportResponsePayload - confirms a report was filed
+type ReportResponsePayload struct {
+	ReportID string `json:"report_id"`
+}
+
+// ReportListResponsePayload - reports visible to the moderator, oldest first
+type ReportListResponsePayload struct {
+	Reports []ReportInfo `json:"reports"`
+}
+
+// ReportResolvedPayload - a report after it was resolved
+type ReportResolvedPayload struct {
+	Report ReportInfo `json:"report"`
+}
+
 // UserJoinedPayload - notification when user comes online
 type UserJoinedPayload struct {
 	UserID   string `json:"user_id"`
@@ -140,6 +416,55 @@ type RoomCreatedPayload struct {
 	Error   string    `json:"error,omitempty"`
 }
 
+// RoomUpdatedPayload - notification that a room's metadata changed
+type RoomUpdatedPayload struct {
+	Room      RoomInfo `json:"room"`
+	UpdatedBy UserInfo `json:"updated_by"`
+}
+
+// RoomKickedPayload - sent to a user who was kicked from a room
+type RoomKickedPayload struct {
+	RoomID   string   `json:"room_id"`
+	RoomName string   `json:"room_name"`
+	By       UserInfo `json:"by"`
+}
+
+// RoomDeletedPayload - sent when a server operator deletes a room
+type RoomDeletedPayload struct {
+	RoomID   string `json:"room_id"`
+	RoomName string `json:"room_name"`
+}
+
+// RoomInvitedPayload - sent to a user who was invited to a room
+type RoomInvitedPayload struct {
+	Room      RoomInfo `json:"room"`
+	InvitedBy UserInfo `json:"invited_by"`
+}
+
+// RoomInviteResponsePayload - confirms a direct invitation to the inviter
+type RoomInviteResponsePayload struct {
+	RoomID string   `json:"room_id"`
+	User   UserInfo `json:"user"`
+}
+
+// InviteCreatedPayload - response to room_invite_create
+type InviteCreatedPayload struct {
+	RoomID string     `json:"room_id"`
+	Invite InviteInfo `json:"invite"`
+}
+
+// InviteRevokedPayload - response to room_invite_revoke
+type InviteRevokedPayload struct {
+	RoomID string `json:"room_id"`
+	Token  string `json:"token"`
+}
+
+// InviteListResponsePayload - response to room_invite_list
+type InviteListResponsePayload struct {
+	RoomID  string       `json:"room_id"`
+	Invites []InviteInfo `json:"invites"`
+}
+
 // RoomJoinedPayload - room join response
 type RoomJoinedPayload struct {
 	Success bool                  `json:"success"`
@@ -147,6 +472,7 @@ type RoomJoinedPayload struct {
 	Room    *RoomInfo             `json:"room,omitempty"`
 	Members []UserInfo            `json:"members,omitempty"`
 	History []IncomingRoomMessage `json:"history,omitempty"` // Recent message history
+	Pins    []PinnedMessage       `json:"pins,omitempty"`    // Pinned messages, most recent first
 	Error   string                `json:"error,omitempty"`
 }
 
@@ -160,7 +486,7 @@ type RoomLeftPayload struct {
 // RoomMembersPayload - room member update (join/leave notification)
 type RoomMembersPayload struct {
 	RoomID  string     `json:"room_id"`
-	Action  string     `json:"action"` // "joined" or "left"
+	Action  string     `json:"action"` // "joined", "left", "kicked", "role_changed" or "owner_changed"
 	User    UserInfo   `json:"user"`
 	Members []UserInfo `json:"members"`
 }
@@ -172,25 +498,141 @@ type RoomHistoryResponsePayload struct {
 	HasMore  bool                  `json:"has_more"`
 }
 
-// IncomingDirectMessage - received direct message
-type IncomingDirectMessage struct {
+// SyncResponsePayload - one chunk of a sync response
+// Chunks are numbered from 0; the last one has Done set and carries the
+// watermark to use as Since on the next sync
+type SyncResponsePayload struct {
+	Chunk        int                   `json:"chunk"`
+	Done         bool                  `json:"done"`
+	Watermark    int64                 `json:"watermark,omitempty"`
+	Rooms        []SyncRoomState       `json:"rooms,omitempty"`         // Current room state, first chunk only
+	MemberEvents []MemberEventInfo     `json:"member_events,omitempty"` // Joins, leaves and kicks, first chunk only
+	Messages     []IncomingRoomMessage `json:"messages"`                // New, edited and deleted messages, oldest change first
+}
+
+// MentionsResponsePayload - recent mentions, newest first
+type MentionsResponsePayload struct {
+	Mentions []MentionInfo `json:"mentions"`
+	HasMore  bool          `json:"has_more"`
+}
+
+// MessageSearchResponsePayload - search results, most relevant first
+type MessageSearchResponsePayload struct {
+	Query   string         `json:"query"`
+	Results []SearchResult `json:"results"`
+	HasMore bool           `json:"has_more"`
+}
+
+// ThreadHistoryResponsePayload - thread replies response
+type ThreadHistoryResponsePayload struct {
+	RoomID   string                `json:"room_id"`
+	ThreadID string                `json:"thread_id"`
+	Root     *IncomingRoomMessage  `json:"root,omitempty"` // Thread root with its summary
+	Messages []IncomingRoomMessage `json:"messages"`
+	HasMore  bool                  `json:"has_more"`
+}
+
+// DMHistoryResponsePayload - direct message history response
+type DMHistoryResponsePayload struct {
+	With     string                  `json:"with"` // Peer username
+	Messages []IncomingDirectMessage `json:"messages"`
+	HasMore  bool                    `json:"has_more"`
+}
+
+// MessageEditedPayload - notification that a room message was edited
+type MessageEditedPayload struct {
+	RoomID    string `json:"room_id"`
 	MessageID string `json:"message_id"`
-	From      string `json:"from"`    // Username
-	FromID    string `json:"from_id"` // User ID
 	Content   string `json:"content"`
-	Timestamp int64  `json:"timestamp"`
+	EditedBy  string `json:"edited_by"` // User ID
+	EditedAt  int64  `json:"edited_at"`
 }
 
-// IncomingRoomMessage - received room message
-type IncomingRoomMessage struct {
+// MessageDeletedPayload - notification that a room message was deleted
+type MessageDeletedPayload struct {
+	RoomID    string `json:"room_id"`
 	MessageID string `json:"message_id"`
+	DeletedBy string `json:"deleted_by"` // User ID
+	DeletedAt int64  `json:"deleted_at"`
+}
+
+// RoomPinsUpdatedPayload - notification that a room's pinned messages changed
+type RoomPinsUpdatedPayload struct {
+	RoomID    string          `json:"room_id"`
+	Action    string          `json:"action"` // "pinned" or "unpinned"
+	MessageID string          `json:"message_id"`
+	UserID    string          `json:"user_id"` // Who made the change
+	Username  string          `json:"username"`
+	Pins      []PinnedMessage `json:"pins"` // Full pin list after the change
+}
+
+// ReactionUpdatedPayload - notification that reactions on a room message changed
+type ReactionUpdatedPayload struct {
+	RoomID    string         `json:"room_id"`
+	MessageID string         `json:"message_id"`
+	Emoji     string         `json:"emoji"`
+	UserID    string         `json:"user_id"`   // User who reacted
+	Action    string         `json:"action"`    // "added" or "removed"
+	Reactions []ReactionInfo `json:"reactions"` // All reactions on the message after the change
+}
+
+// TypingEventPayload - notification that a user started or stopped typing
+type TypingEventPayload struct {
+	RoomID   string `json:"room_id,omitempty"` // Empty for DMs
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+}
+
+// PresenceChangedPayload - a user's presence or custom status changed
+type PresenceChangedPayload struct {
+	UserID          string `json:"user_id"`
+	Username        string `json:"username"`
+	Presence        string `json:"presence"` // "online", "away", "dnd", "offline"; "invisible" only to the user themselves
+	Status          string `json:"status,omitempty"`
+	StatusExpiresAt int64  `json:"status_expires_at,omitempty"` // Unix milliseconds
+}
+
+// ReadReceiptPayload - notification that a member read a room up to a message
+type ReadReceiptPayload struct {
 	RoomID    string `json:"room_id"`
-	From      string `json:"from"`    // Username
-	FromID    string `json:"from_id"` // User ID
-	Content   string `json:"content"`
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	MessageID string `json:"message_id"`
 	Timestamp int64  `json:"timestamp"`
 }
 
+// IncomingDirectMessage - received direct message
+type IncomingDirectMessage struct {
+	MessageID   string `json:"message_id"`
+	From        string `json:"from"`            // Username
+	FromID      string `json:"from_id"`         // User ID
+	To          string `json:"to,omitempty"`    // Recipient username
+	ToID        string `json:"to_id,omitempty"` // Recipient user ID
+	Content     string `json:"content"`
+	Timestamp   int64  `json:"timestamp"`
+	Offline     bool   `json:"offline,omitempty"`       // Stored while the recipient was offline
+	ClientMsgID string `json:"client_msg_id,omitempty"` // Sender's idempotency key, echoed back
+}
+
+// IncomingRoomMessage - received room message
+type IncomingRoomMessage struct {
+	MessageID   string           `json:"message_id"`
+	RoomID      string           `json:"room_id"`
+	From        string           `json:"from"`    // Username
+	FromID      string           `json:"from_id"` // User ID
+	Content     string           `json:"content"` // Empty for deleted messages
+	Timestamp   int64            `json:"timestamp"`
+	EditedAt    int64            `json:"edited_at,omitempty"`     // Set if the message was edited
+	Deleted     bool             `json:"deleted,omitempty"`       // Tombstone for a deleted message
+	Reactions   []ReactionInfo   `json:"reactions,omitempty"`     // Aggregated emoji reactions
+	ThreadID    string           `json:"thread_id,omitempty"`     // Thread root, set on replies
+	ReplyTo     string           `json:"reply_to,omitempty"`      // Message being replied to
+	ReplyCount  int              `json:"reply_count,omitempty"`   // Thread summary, set on roots
+	LastReplyAt int64            `json:"last_reply_at,omitempty"` // Thread summary, set on roots
+	ClientMsgID string           `json:"client_msg_id,omitempty"` // Sender's idempotency key, echoed back
+	Attachments []AttachmentInfo `json:"attachments,omitempty"`   // Files sent with the message
+}
+
 // UserListResponsePayload - list of online users
 type UserListResponsePayload struct {
 	Users []UserInfo `json:"users"`
@@ -203,9 +645,11 @@ type RoomListResponsePayload struct {
 
 // ErrorPayload - error response
 type ErrorPayload struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
-	Target  string `json:"target,omitempty"` // Target username for DM errors
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Target     string `json:"target,omitempty"`      // Target identifier (e.g., username for DM errors, message ID for edits)
+	RetryAfter int64  `json:"retry_after,omitempty"` // Milliseconds until the request may be retried (RATE_LIMITED only)
+	Reason     string `json:"reason,omitempty"`      // Content filter reason code (MESSAGE_REJECTED only)
 }
 
 // ==================== Shared Types ====================
@@ -214,6 +658,9 @@ type ErrorPayload struct {
 type UserInfo struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`     // Room role, only set in room member lists
+	Presence string `json:"presence,omitempty"` // "online", "away", "dnd" or "offline"
+	Status   string `json:"status,omitempty"`   // Custom status text
 }
 
 // RoomInfo - public room information
@@ -224,6 +671,148 @@ type RoomInfo struct {
 	CreatorID   string `json:"creator_id"`
 	MemberCount int    `json:"member_count"`
 	IsPublic    bool   `json:"is_public"`
+	Topic       string `json:"topic,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Set in room lists for private rooms the user has a pending invitation to
+	Invited bool `json:"invited,omitempty"`
+
+	// Per-user read state, only set in responses addressed to a member
+	UnreadCount       int    `json:"unread_count,omitempty"`
+	LastReadMessageID string `json:"last_read_message_id,omitempty"`
+}
+
+// InviteInfo - an invite link to a room
+type InviteInfo struct {
+	Token     string   `json:"token"`
+	CreatedBy UserInfo `json:"created_by"`
+	MaxUses   int      `json:"max_uses"` // 0 = unlimited
+	Uses      int      `json:"uses"`
+	ExpiresAt int64    `json:"expires_at,omitempty"` // Unix milliseconds, omitted if the link never expires
+	CreatedAt int64    `json:"created_at"`
+}
+
+// SyncRoomState - current metadata and members of a room in a sync response
+type SyncRoomState struct {
+	RoomInfo
+	Members []UserInfo `json:"members"`
+}
+
+// MemberEventInfo - a join or leave that happened while the client was away
+// The client's own leave or kick is also reported for rooms it is no longer in
+type MemberEventInfo struct {
+	RoomID    string   `json:"room_id"`
+	Action    string   `json:"action"` // "joined", "left" or "kicked"
+	User      UserInfo `json:"user"`
+	Timestamp int64    `json:"timestamp"`
+}
+
+// MentionInfo - a room message that @mentions the user
+// Sent on its own as the payload of a mentioned event
+type MentionInfo struct {
+	RoomID   string              `json:"room_id"`
+	RoomName string              `json:"room_name"`
+	Message  IncomingRoomMessage `json:"message"`
+}
+
+// SearchResult - a room message matching a search
+// Snippet is an HTML-escaped excerpt of the content with matched terms wrapped
+// in <mark></mark>, so it is safe to render as HTML
+type SearchResult struct {
+	RoomID   string              `json:"room_id"`
+	RoomName string              `json:"room_name"`
+	Message  IncomingRoomMessage `json:"message"`
+	Snippet  string              `json:"snippet"`
+	Rank     float64             `json:"rank"`
+}
+
+// AttachmentInfo - a file uploaded for a room message
+// The contents are fetched over HTTP from URL with the connection's auth token
+type AttachmentInfo struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+}
+
+// PinnedMessage - a message pinned to a room
+type PinnedMessage struct {
+	Message    IncomingRoomMessage `json:"message"`
+	PinnedBy   string              `json:"pinned_by"` // Username
+	PinnedByID string              `json:"pinned_by_id,omitempty"`
+	PinnedAt   int64               `json:"pinned_at"`
+}
+
+// BlockedUser - a user on the client's block list
+type BlockedUser struct {
+	UserID    string `json:"user_id"`
+	Username  string `json:"username"`
+	BlockedAt int64  `json:"blocked_at"`
+}
+
+// ReportInfo - a report as seen by moderators
+type ReportInfo struct {
+	ID           string            `json:"id"`
+	TargetType   string            `json:"target_type"`
+	RoomID       string            `json:"room_id,omitempty"`
+	MessageID    string            `json:"message_id,omitempty"`
+	ReportedUser UserInfo          `json:"reported_user"`
+	Reporter     UserInfo          `json:"reporter"`
+	Category     string            `json:"category"`
+	Details      string            `json:"details,omitempty"`
+	Snapshot     string            `json:"snapshot,omitempty"` // Reported content when the report was filed
+	Status       string            `json:"status"`             // "open" or "resolved"
+	CreatedAt    int64             `json:"created_at"`
+	Resolution   *ReportResolution `json:"resolution,omitempty"`
+}
+
+// ReportResolution - how and by whom a report was resolved
+type ReportResolution struct {
+	Action     string   `json:"action"`
+	By         UserInfo `json:"by"`
+	Note       string   `json:"note,omitempty"`
+	ResolvedAt int64    `json:"resolved_at"`
+}
+
+// ReactionInfo - aggregated reactions for one emoji on a message
+type ReactionInfo struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"user_ids"`
+}
+
+// ==================== Admin API ====================
+
+// AdminUser - a user as seen by server operators
+type AdminUser struct {
+	UserID      string   `json:"user_id"`
+	Username    string   `json:"username"`
+	CreatedAt   int64    `json:"created_at,omitempty"`   // Unset without persistent storage
+	LastSeenAt  int64    `json:"last_seen_at,omitempty"` // Unset without persistent storage
+	Connections []string `json:"connections"`            // Live connection IDs; empty when offline
+	Banned      bool     `json:"banned"`                 // Under a server-wide ban
+}
+
+// AdminRoom - a room as seen by server operators
+type AdminRoom struct {
+	RoomInfo
+	OnlineCount int `json:"online_count"` // Members with a live connection
+}
+
+// AdminHeldMessage - a message held by a content filter, awaiting review
+type AdminHeldMessage struct {
+	ID            string   `json:"id"`
+	RoomID        string   `json:"room_id,omitempty"` // Set for room messages
+	ToID          string   `json:"to_id,omitempty"`   // Set for direct messages
+	From          string   `json:"from"`
+	FromID        string   `json:"from_id"`
+	Content       string   `json:"content"`
+	Reason        string   `json:"reason"` // Content filter reason code
+	ThreadID      string   `json:"thread_id,omitempty"`
+	ReplyTo       string   `json:"reply_to,omitempty"`
+	AttachmentIDs []string `json:"attachment_ids,omitempty"`
+	HeldAt        int64    `json:"held_at"`
 }
 
 // ==================== Error Codes ====================
@@ -240,4 +829,17 @@ const (
 	ErrCodeInvalidRoomName  = "INVALID_ROOM_NAME"
 	ErrCodeRecoveryRequired = "RECOVERY_REQUIRED"
 	ErrCodeInvalidRecovery  = "INVALID_RECOVERY"
+	ErrCodeMessageNotFound  = "MESSAGE_NOT_FOUND"
+	ErrCodePermissionDenied = "PERMISSION_DENIED"
+	ErrCodeInviteRequired   = "INVITE_REQUIRED"
+	ErrCodeInvalidInvite    = "INVALID_INVITE"
+	ErrCodeFileTooLarge     = "FILE_TOO_LARGE"
+	ErrCodeUnsupportedFile  = "UNSUPPORTED_FILE_TYPE"
+	ErrCodeQuotaExceeded    = "QUOTA_EXCEEDED"
+	ErrCodeFileNotFound     = "FILE_NOT_FOUND"
+	ErrCodeRateLimited      = "RATE_LIMITED"
+	ErrCodeMessageRejected  = "MESSAGE_REJECTED"
+	ErrCodeReportNotFound   = "REPORT_NOT_FOUND"
+	ErrCodeMuted            = "MUTED"
+	ErrCodeBanned           = "BANNED"
 )
@@ -0,0 +1,149 @@
+// Package ratelimit implements keyed token-bucket rate limiters
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limit allows Burst events at once, refilling at Burst events every Per
+type Limit struct {
+	Burst int
+	Per   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Per > 0
+}
+
+// String formats the limit as "burst/per", the form ParseLimit accepts
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Burst, l.Per)
+}
+
+// ParseLimit parses a limit such as "20/10s" (20 events per 10 seconds)
+// "off" and "0" disable the limit
+func ParseLimit(s string) (Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "off" || s == "0" {
+		return Limit{}, nil
+	}
+
+	count, per, ok := strings.Cut(s, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: expected count/duration", s)
+	}
+	burst, err := strconv.Atoi(count)
+	if err != nil || burst < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad count", s)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: bad duration", s)
+	}
+	return Limit{Burst: burst, Per: d}, nil
+}
+
+// Idle buckets are swept after this many calls to Allow
+const sweepInterval = 1024
+
+// bucket is a token bucket; tokens are fractional so refills are smooth
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps one token bucket per key
+// A nil Limiter allows everything
+type Limiter struct {
+	limit   Limit
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+}
+
+// New creates a limiter, or returns nil if the limit is disabled
+func New(limit Limit) *Limiter {
+	if !limit.Enabled() {
+		return nil
+	}
+	return &Limiter{
+		limit:   limit,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow spends a token from key's bucket
+// If the bucket is empty, it returns false and how long until a token is available
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowAt(key, time.Now())
+}
+
+// AllowAt is Allow at the given time
+func (l *Limiter) AllowAt(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.calls++
+	if l.calls%sweepInterval == 0 {
+		l.sweepLocked(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.limit.Burst), last: now}
+		l.buckets[key] = b
+	}
+	l.refill(b, now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	missing := 1 - b.tokens
+	retryAfter := time.Duration(missing * float64(l.limit.Per) / float64(l.limit.Burst))
+	return false, retryAfter
+}
+
+// Reset forgets key's bucket, e.g. when its connection closes
+func (l *Limiter) Reset(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, key)
+}
+
+// refill adds the tokens earned since the bucket was last used
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += float64(l.limit.Burst) * float64(elapsed) / float64(l.limit.Per)
+		b.tokens = min(b.tokens, float64(l.limit.Burst))
+		b.last = now
+	}
+}
+
+// sweepLocked drops buckets that have refilled completely, since a new
+// bucket starts full anyway
+// Must be called with l.mu held
+func (l *Limiter) sweepLocked(now time.Time) {
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{"20/10s", Limit{Burst: 20, Per: 10 * time.Second}, false},
+		{" 5/1m ", Limit{Burst: 5, Per: time.Minute}, false},
+		{"off", Limit{}, false},
+		{"0", Limit{}, false},
+		{"20", Limit{}, true},
+		{"x/10s", Limit{}, true},
+		{"-1/10s", Limit{}, true},
+		{"20/0s", Limit{}, true},
+		{"20/soon", Limit{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := New(Limit{Burst: 3, Per: 3 * time.Second})
+	now := time.Now()
+
+	// The full burst is available at once
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.AllowAt("a", now); !ok {
+			t.Fatalf("Expected event %d to be allowed", i+1)
+		}
+	}
+
+	ok, retryAfter := l.AllowAt("a", now)
+	if ok {
+		t.Fatal("Expected event past the burst to be rejected")
+	}
+	if retryAfter != time.Second {
+		t.Errorf("Expected retry after 1s, got %v", retryAfter)
+	}
+
+	// Other keys have their own bucket
+	if ok, _ := l.AllowAt("b", now); !ok {
+		t.Error("Expected a different key to be allowed")
+	}
+
+	// Tokens refill over time
+	if ok, _ := l.AllowAt("a", now.Add(500*time.Millisecond)); ok {
+		t.Error("Expected event before refill to be rejected")
+	}
+	if ok, _ := l.AllowAt("a", now.Add(time.Second)); !ok {
+		t.Error("Expected event after refill to be allowed")
+	}
+
+	// Reset gives a key a full bucket
+	l.Reset("a")
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.AllowAt("a", now.Add(time.Second)); !ok {
+			t.Fatalf("Expected event %d after reset to be allowed", i+1)
+		}
+	}
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l := New(Limit{})
+	if l != nil {
+		t.Fatal("Expected a disabled limit to give a nil limiter")
+	}
+	for i := 0; i < 100; i++ {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("Expected a nil limiter to allow everything")
+		}
+	}
+}
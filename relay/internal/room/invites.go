@@ -0,0 +1,131 @@
+package room
+
+import (
+	"time"
+)
+
+// Invite is a pending invitation of a user to a room
+type Invite struct {
+	UserID            string
+	Username          string
+	InvitedBy         string
+	InvitedByUsername string
+	CreatedAt         time.Time
+}
+
+// InviteToken is an invite link that lets whoever holds it join the room
+type InviteToken struct {
+	Token             string
+	CreatedBy         string
+	CreatedByUsername string
+	MaxUses           int // 0 = unlimited
+	Uses              int
+	ExpiresAt         time.Time // Zero = never expires
+	CreatedAt         time.Time
+}
+
+// Usable reports whether the token can still be redeemed at the given time
+func (t *InviteToken) Usable(now time.Time) bool {
+	if !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt) {
+		return false
+	}
+	return t.MaxUses == 0 || t.Uses < t.MaxUses
+}
+
+// AddInvite records a pending invitation
+// Returns false if the user is already a member or already invited
+func (r *Room) AddInvite(inv Invite) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.members[inv.UserID]; exists {
+		return false
+	}
+	if _, exists := r.invites[inv.UserID]; exists {
+		return false
+	}
+	r.invites[inv.UserID] = &inv
+	return true
+}
+
+// HasInvite checks if a user has a pending invitation
+func (r *Room) HasInvite(userID string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, exists := r.invites[userID]
+	return exists
+}
+
+// RemoveInvite removes a pending invitation
+// Returns false if the user was not invited
+func (r *Room) RemoveInvite(userID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.invites[userID]; !exists {
+		return false
+	}
+	delete(r.invites, userID)
+	return true
+}
+
+// AddToken registers an invite link
+func (r *Room) AddToken(t InviteToken) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tokens[t.Token] = &t
+}
+
+// HasToken checks if the room has a usable invite link with this token
+func (r *Room) HasToken(token string, now time.Time) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	t, exists := r.tokens[token]
+	return exists && t.Usable(now)
+}
+
+// RedeemToken uses up one use of an invite link
+// Returns false if the token is unknown, expired or exhausted
+func (r *Room) RedeemToken(token string, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, exists := r.tokens[token]
+	if !exists || !t.Usable(now) {
+		return false
+	}
+	t.Uses++
+	if !t.Usable(now) {
+		delete(r.tokens, token)
+	}
+	return true
+}
+
+// RevokeToken removes an invite link
+// Returns false if the token is unknown
+func (r *Room) RevokeToken(token string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tokens[token]; !exists {
+		return false
+	}
+	delete(r.tokens, token)
+	return true
+}
+
+// Tokens returns the room's usable invite links, dropping any that expired
+func (r *Room) Tokens(now time.Time) []InviteToken {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tokens := make([]InviteToken, 0, len(r.tokens))
+	for key, t := range r.tokens {
+		if !t.Usable(now) {
+			delete(r.tokens, key)
+			continue
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens
+}
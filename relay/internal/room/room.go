@@ -7,10 +7,51 @@ import (
 	"haven/internal/protocol"
 )
 
+// Member roles, from most to least privileged
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// roleRanks orders roles by privilege
+var roleRanks = map[string]int{
+	RoleOwner:     3,
+	RoleAdmin:     2,
+	RoleModerator: 1,
+	RoleMember:    0,
+}
+
+// ValidRole reports whether role is a known member role
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
+
+// roleRank returns a role's privilege rank, or -1 for unknown roles (e.g. non-members)
+func roleRank(role string) int {
+	if rank, ok := roleRanks[role]; ok {
+		return rank
+	}
+	return -1
+}
+
+// RoleAtLeast reports whether role is as privileged as min or more
+func RoleAtLeast(role, min string) bool {
+	return roleRank(role) >= roleRank(min)
+}
+
+// Outranks reports whether role a is strictly more privileged than role b
+func Outranks(a, b string) bool {
+	return roleRank(a) > roleRank(b)
+}
+
 // Member represents a room member
 type Member struct {
 	UserID   string
 	Username string
+	Role     string
 	JoinedAt time.Time
 }
 
@@ -22,8 +63,15 @@ type Room struct {
 	Creator   string // Username
 	IsPublic  bool
 	CreatedAt time.Time
-	members   map[string]*Member // userID -> Member
-	mu        sync.RWMutex
+
+	// Editable metadata, changed through SetMetadata
+	Topic       string
+	Description string
+
+	members map[string]*Member      // userID -> Member
+	invites map[string]*Invite      // userID -> pending invitation
+	tokens  map[string]*InviteToken // token -> invite link
+	mu      sync.RWMutex
 }
 
 // New creates a new room
@@ -36,11 +84,14 @@ func New(id, name, creatorID, creatorUsername string, isPublic bool) *Room {
 		IsPublic:  isPublic,
 		CreatedAt: time.Now(),
 		members:   make(map[string]*Member),
+		invites:   make(map[string]*Invite),
+		tokens:    make(map[string]*InviteToken),
 	}
-	// Creator auto-joins
+	// Creator auto-joins as owner
 	r.members[creatorID] = &Member{
 		UserID:   creatorID,
 		Username: creatorUsername,
+		Role:     RoleOwner,
 		JoinedAt: time.Now(),
 	}
 	return r
@@ -58,11 +109,92 @@ func (r *Room) AddMember(userID, username string) bool {
 	r.members[userID] = &Member{
 		UserID:   userID,
 		Username: username,
+		Role:     RoleMember,
 		JoinedAt: time.Now(),
 	}
 	return true
 }
 
+// RestoreMember adds a member with a known role and join time (e.g. when
+// loading from storage), replacing any existing entry
+func (r *Room) RestoreMember(userID, username, role string, joinedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.members[userID] = &Member{
+		UserID:   userID,
+		Username: username,
+		Role:     role,
+		JoinedAt: joinedAt,
+	}
+}
+
+// Owner returns the user ID of the room's owner, or an empty string if it has none
+func (r *Room) Owner() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for id, m := range r.members {
+		if m.Role == RoleOwner {
+			return id
+		}
+	}
+	return ""
+}
+
+// LongestStandingMember returns the member who joined first, used to pick a
+// new owner. Returns false if the room is empty.
+func (r *Room) LongestStandingMember() (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var oldest *Member
+	for _, m := range r.members {
+		if oldest == nil || m.JoinedAt.Before(oldest.JoinedAt) ||
+			(m.JoinedAt.Equal(oldest.JoinedAt) && m.UserID < oldest.UserID) {
+			oldest = m
+		}
+	}
+	if oldest == nil {
+		return "", false
+	}
+	return oldest.UserID, true
+}
+
+// Role returns a member's role, or an empty string for non-members
+func (r *Room) Role(userID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if m, exists := r.members[userID]; exists {
+		return m.Role
+	}
+	return ""
+}
+
+// SetRole changes a member's role
+// Returns false if the user is not a member
+func (r *Room) SetRole(userID, role string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	m, exists := r.members[userID]
+	if !exists {
+		return false
+	}
+	m.Role = role
+	return true
+}
+
+// MemberInfo returns a member's info, or false for non-members
+func (r *Room) MemberInfo(userID string) (protocol.UserInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, exists := r.members[userID]
+	if !exists {
+		return protocol.UserInfo{}, false
+	}
+	return protocol.UserInfo{UserID: m.UserID, Username: m.Username, Role: m.Role}, true
+}
+
 // RemoveMember removes a member from the room
 func (r *Room) RemoveMember(userID string) bool {
 	r.mu.Lock()
@@ -118,19 +250,35 @@ func (r *Room) MemberInfoList() []protocol.UserInfo {
 		infos = append(infos, protocol.UserInfo{
 			UserID:   m.UserID,
 			Username: m.Username,
+			Role:     m.Role,
 		})
 	}
 	return infos
 }
 
+// SetMetadata replaces the room's name, topic and description
+func (r *Room) SetMetadata(name, topic, description string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Name = name
+	r.Topic = topic
+	r.Description = description
+}
+
 // Info returns the room's public info
 func (r *Room) Info() protocol.RoomInfo {
-	return protocol.RoomInfo{
+	r.mu.RLock()
+	info := protocol.RoomInfo{
 		RoomID:      r.ID,
 		Name:        r.Name,
 		Creator:     r.Creator,
 		CreatorID:   r.CreatorID,
-		MemberCount: r.MemberCount(),
 		IsPublic:    r.IsPublic,
+		Topic:       r.Topic,
+		Description: r.Description,
 	}
+	r.mu.RUnlock()
+
+	info.MemberCount = r.MemberCount()
+	return info
 }
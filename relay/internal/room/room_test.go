@@ -2,6 +2,7 @@ package room
 
 import (
 	"testing"
+	"time"
 )
 
 func TestRoom_New(t *testing.T) {
@@ -148,3 +149,137 @@ func TestRoom_Info(t *testing.T) {
 		t.Error("Expected IsPublic to be true")
 	}
 }
+
+func TestRoom_SetMetadata(t *testing.T) {
+	r := New("room-1", "General", "user-1", "alice", true)
+
+	r.SetMetadata("Lobby", "Say hi", "Longer description")
+
+	info := r.Info()
+	if info.Name != "Lobby" || info.Topic != "Say hi" || info.Description != "Longer description" {
+		t.Errorf("Unexpected info after update: %+v", info)
+	}
+}
+
+func TestRoom_Roles(t *testing.T) {
+	r := New("room-1", "General", "user-1", "alice", true)
+	r.AddMember("user-2", "bob")
+
+	if r.Role("user-1") != RoleOwner {
+		t.Errorf("Expected creator to be owner, got '%s'", r.Role("user-1"))
+	}
+	if r.Role("user-2") != RoleMember {
+		t.Errorf("Expected new member to be member, got '%s'", r.Role("user-2"))
+	}
+	if r.Role("user-3") != "" {
+		t.Errorf("Expected no role for non-member, got '%s'", r.Role("user-3"))
+	}
+
+	if !r.SetRole("user-2", RoleModerator) {
+		t.Error("Expected SetRole to succeed for member")
+	}
+	if r.SetRole("user-3", RoleModerator) {
+		t.Error("Expected SetRole to fail for non-member")
+	}
+
+	info, ok := r.MemberInfo("user-2")
+	if !ok || info.Role != RoleModerator {
+		t.Errorf("Expected moderator in member info, got %+v", info)
+	}
+
+	if !RoleAtLeast(RoleAdmin, RoleModerator) || RoleAtLeast(RoleMember, RoleModerator) {
+		t.Error("Unexpected RoleAtLeast ordering")
+	}
+	if !Outranks(RoleOwner, RoleAdmin) || Outranks(RoleAdmin, RoleAdmin) {
+		t.Error("Unexpected Outranks ordering")
+	}
+	if RoleAtLeast("", RoleMember) {
+		t.Error("Expected non-members to rank below members")
+	}
+}
+
+func TestRoom_Invites(t *testing.T) {
+	r := New("room-1", "Secret", "user-1", "alice", false)
+
+	if r.AddInvite(Invite{UserID: "user-1", Username: "alice"}) {
+		t.Error("Expected AddInvite to return false for a member")
+	}
+	if !r.AddInvite(Invite{UserID: "user-2", Username: "bob", InvitedBy: "user-1"}) {
+		t.Error("Expected AddInvite to return true")
+	}
+	if r.AddInvite(Invite{UserID: "user-2", Username: "bob"}) {
+		t.Error("Expected AddInvite to return false for duplicate")
+	}
+	if !r.HasInvite("user-2") {
+		t.Error("Expected bob to be invited")
+	}
+
+	if !r.RemoveInvite("user-2") {
+		t.Error("Expected RemoveInvite to return true")
+	}
+	if r.HasInvite("user-2") || r.RemoveInvite("user-2") {
+		t.Error("Expected invite to be gone")
+	}
+}
+
+func TestRoom_InviteTokens(t *testing.T) {
+	r := New("room-1", "Secret", "user-1", "alice", false)
+	now := time.Now()
+
+	r.AddToken(InviteToken{Token: "once", MaxUses: 1})
+	r.AddToken(InviteToken{Token: "expired", ExpiresAt: now.Add(-time.Minute)})
+	r.AddToken(InviteToken{Token: "open"})
+
+	if r.RedeemToken("expired", now) {
+		t.Error("Expected expired token to be rejected")
+	}
+	if r.RedeemToken("unknown", now) {
+		t.Error("Expected unknown token to be rejected")
+	}
+
+	if !r.RedeemToken("once", now) {
+		t.Error("Expected first use of single-use token to succeed")
+	}
+	if r.RedeemToken("once", now) {
+		t.Error("Expected second use of single-use token to fail")
+	}
+
+	for i := 0; i < 3; i++ {
+		if !r.RedeemToken("open", now) {
+			t.Fatalf("Expected unlimited token to be redeemable (use %d)", i+1)
+		}
+	}
+
+	tokens := r.Tokens(now)
+	if len(tokens) != 1 || tokens[0].Token != "open" || tokens[0].Uses != 3 {
+		t.Errorf("Expected only the open token with 3 uses, got %+v", tokens)
+	}
+
+	if !r.RevokeToken("open") {
+		t.Error("Expected RevokeToken to return true")
+	}
+	if r.HasToken("open", now) || r.RevokeToken("open") {
+		t.Error("Expected token to be revoked")
+	}
+}
+
+func TestRoom_LongestStandingMember(t *testing.T) {
+	r := New("room-1", "General", "user-1", "alice", true)
+	r.RemoveMember("user-1")
+
+	if _, ok := r.LongestStandingMember(); ok {
+		t.Error("Expected no member in empty room")
+	}
+
+	now := time.Now()
+	r.RestoreMember("user-3", "carol", RoleMember, now)
+	r.RestoreMember("user-2", "bob", RoleAdmin, now.Add(-time.Hour))
+	r.RestoreMember("user-4", "dave", RoleOwner, now.Add(time.Hour))
+
+	if id, _ := r.LongestStandingMember(); id != "user-2" {
+		t.Errorf("Expected 'user-2', got '%s'", id)
+	}
+	if owner := r.Owner(); owner != "user-4" {
+		t.Errorf("Expected owner 'user-4', got '%s'", owner)
+	}
+}
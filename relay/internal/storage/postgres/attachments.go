@@ -0,0 +1,172 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Attachment is a file uploaded for a room message
+// Its contents are kept in a blob store under the attachment ID
+type Attachment struct {
+	ID          string
+	UploaderID  string // Empty if the uploader has since been deleted
+	RoomID      string // Empty if the room has since been deleted
+	MessageID   string // Empty until the attachment is sent with a message
+	Filename    string
+	ContentType string
+	Size        int64
+	CreatedAt   time.Time
+}
+
+// attachmentColumns is the column list scanned by scanAttachment
+const attachmentColumns = `id, COALESCE(uploader_id::text, ''), COALESCE(room_id::text, ''),
+	COALESCE(message_id::text, ''), filename, content_type, size, created_at`
+
+// deadAttachmentFilter matches attachments whose contents can be deleted:
+// those whose message, room or uploader is gone, those on deleted messages,
+// and pending uploads never sent before $1, unless a held message awaiting
+// review carries them
+const deadAttachmentFilter = `(message_id IS NULL AND (linked_at IS NOT NULL OR room_id IS NULL
+		OR uploader_id IS NULL OR (created_at < $1
+			AND id NOT IN (SELECT unnest(attachment_ids) FROM quarantined_messages))))
+	OR message_id IN (SELECT id FROM room_messages WHERE deleted_at IS NOT NULL)`
+
+// scanAttachment scans a row selected with attachmentColumns
+func scanAttachment(row pgx.Row) (*Attachment, error) {
+	var a Attachment
+	err := row.Scan(&a.ID, &a.UploaderID, &a.RoomID, &a.MessageID, &a.Filename, &a.ContentType, &a.Size, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SaveAttachment records an uploaded, not yet sent attachment if the
+// uploader's attachments, this one included, fit in quota bytes. The
+// uploader's row is locked while checking, so concurrent uploads can't
+// both slip under the quota.
+// Returns nil if the quota would be exceeded
+func (s *MessageStore) SaveAttachment(ctx context.Context, a *Attachment, quota int64) (*Attachment, error) {
+	ctx = withMethod(ctx, "MessageStore.SaveAttachment")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, a.UploaderID); err != nil {
+		return nil, err
+	}
+
+	saved, err := scanAttachment(tx.QueryRow(ctx, `
+		INSERT INTO attachments (id, uploader_id, room_id, filename, content_type, size)
+		SELECT $1, $2, $3, $4, $5, $6
+		WHERE (SELECT COALESCE(SUM(size), 0) FROM attachments WHERE uploader_id = $2) + $6 <= $7
+		RETURNING `+attachmentColumns,
+		a.ID, a.UploaderID, a.RoomID, a.Filename, a.ContentType, a.Size, quota,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// GetAttachment retrieves a live attachment by ID
+// Attachments of deleted messages are treated as missing
+func (s *MessageStore) GetAttachment(ctx context.Context, id string) (*Attachment, error) {
+	ctx = withMethod(ctx, "MessageStore.GetAttachment")
+	a, err := scanAttachment(s.pool.QueryRow(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE id = $1 AND room_id IS NOT NULL
+			AND NOT EXISTS (
+				SELECT 1 FROM room_messages m WHERE m.id = attachments.message_id AND m.deleted_at IS NOT NULL
+			)
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AttachmentUsage returns the total size of a user's stored attachments in bytes
+func (s *MessageStore) AttachmentUsage(ctx context.Context, userID string) (int64, error) {
+	ctx = withMethod(ctx, "MessageStore.AttachmentUsage")
+	var total int64
+	err := s.pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(size), 0)::bigint FROM attachments WHERE uploader_id = $1
+	`, userID).Scan(&total)
+	return total, err
+}
+
+// LinkAttachments attaches pending uploads to a message
+// Only the uploader's pending attachments in the message's room are linked
+// Returns the linked attachments
+func (s *MessageStore) LinkAttachments(ctx context.Context, messageID, roomID, uploaderID string, ids []string) ([]*Attachment, error) {
+	ctx = withMethod(ctx, "MessageStore.LinkAttachments")
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		UPDATE attachments SET message_id = $1, linked_at = NOW()
+		WHERE id = ANY($4::uuid[]) AND room_id = $2 AND uploader_id = $3 AND message_id IS NULL
+		RETURNING `+attachmentColumns,
+		messageID, roomID, uploaderID, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// GetAttachments returns the attachments of the given messages, keyed by message ID
+// Messages without attachments are omitted
+func (s *MessageStore) GetAttachments(ctx context.Context, messageIDs []string) (map[string][]*Attachment, error) {
+	ctx = withMethod(ctx, "MessageStore.GetAttachments")
+	result := make(map[string][]*Attachment)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+attachmentColumns+`
+		FROM attachments
+		WHERE message_id = ANY($1::uuid[])
+		ORDER BY created_at
+	`, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		result[a.MessageID] = append(result[a.MessageID], a)
+	}
+	return result, rows.Err()
+}
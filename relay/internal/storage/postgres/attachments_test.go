@@ -0,0 +1,174 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"haven/internal/blob"
+)
+
+// testQuota is an attachment quota that tests don't run into
+const testQuota = 1 << 20
+
+func TestMessageStore_Attachments(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+
+	a, err := messageStore.SaveAttachment(ctx, &Attachment{
+		ID: "6f1c2a9e-8d4b-4f7a-9c3e-1b2d3e4f5a60", UploaderID: alice.ID, RoomID: room.ID,
+		Filename: "cat.png", ContentType: "image/png", Size: 1000,
+	}, testQuota)
+	if err != nil {
+		t.Fatalf("Failed to save attachment: %v", err)
+	}
+	_, _ = messageStore.SaveAttachment(ctx, &Attachment{
+		ID: "0a7e3b5c-2d1f-4e6a-8b9c-7d6e5f4a3b20", UploaderID: alice.ID, RoomID: room.ID,
+		Filename: "notes.txt", ContentType: "text/plain", Size: 24,
+	}, testQuota)
+
+	usage, err := messageStore.AttachmentUsage(ctx, alice.ID)
+	if err != nil || usage != 1024 {
+		t.Errorf("Expected usage 1024, got %d (err %v)", usage, err)
+	}
+
+	// Uploads past the quota are refused, even when racing each other
+	var saved atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a, err := messageStore.SaveAttachment(ctx, &Attachment{
+				ID: uuid.New().String(), UploaderID: bob.ID, RoomID: room.ID,
+				Filename: "part.txt", ContentType: "text/plain", Size: 100,
+			}, 500)
+			if err != nil {
+				t.Errorf("Failed to save attachment: %v", err)
+			}
+			if a != nil {
+				saved.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if saved.Load() != 5 {
+		t.Errorf("Expected 5 uploads to fit the quota, got %d", saved.Load())
+	}
+
+	msg, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "look")
+
+	// Only the uploader can attach their files
+	linked, _ := messageStore.LinkAttachments(ctx, msg.ID, room.ID, bob.ID, []string{a.ID})
+	if len(linked) != 0 {
+		t.Errorf("Expected no attachments linked for another user, got %d", len(linked))
+	}
+	linked, err = messageStore.LinkAttachments(ctx, msg.ID, room.ID, alice.ID, []string{a.ID})
+	if err != nil || len(linked) != 1 || linked[0].MessageID != msg.ID {
+		t.Fatalf("Expected attachment to be linked, got %+v (err %v)", linked, err)
+	}
+	// Already sent attachments can't be reused
+	linked, _ = messageStore.LinkAttachments(ctx, msg.ID, room.ID, alice.ID, []string{a.ID})
+	if len(linked) != 0 {
+		t.Errorf("Expected linked attachment to be skipped, got %d", len(linked))
+	}
+
+	byMessage, err := messageStore.GetAttachments(ctx, []string{msg.ID})
+	if err != nil || len(byMessage[msg.ID]) != 1 || byMessage[msg.ID][0].Filename != "cat.png" {
+		t.Errorf("Unexpected attachments: %+v (err %v)", byMessage, err)
+	}
+
+	// Deleted messages hide their attachments
+	_, _ = messageStore.Redact(ctx, msg.ID, alice.ID)
+	got, err := messageStore.GetAttachment(ctx, a.ID)
+	if err != nil || got != nil {
+		t.Errorf("Expected attachment of deleted message to be hidden, got %+v (err %v)", got, err)
+	}
+}
+
+func TestCleanup_DeadAttachments(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	cleanup := NewCleanup(testDB.Pool)
+	ctx := context.Background()
+
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+	kept, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "kept")
+	deleted, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "deleted")
+
+	ids := map[string]string{
+		"kept":    "11111111-1111-4111-8111-111111111111",
+		"deleted": "22222222-2222-4222-8222-222222222222",
+		"pending": "33333333-3333-4333-8333-333333333333",
+	}
+	for name, id := range ids {
+		_, _ = blobs.Put(ctx, id, strings.NewReader(name))
+		_, err := messageStore.SaveAttachment(ctx, &Attachment{
+			ID: id, UploaderID: alice.ID, RoomID: room.ID, Filename: name + ".txt", ContentType: "text/plain", Size: 4,
+		}, testQuota)
+		if err != nil {
+			t.Fatalf("Failed to save attachment: %v", err)
+		}
+	}
+	_, _ = messageStore.LinkAttachments(ctx, kept.ID, room.ID, alice.ID, []string{ids["kept"]})
+	_, _ = messageStore.LinkAttachments(ctx, deleted.ID, room.ID, alice.ID, []string{ids["deleted"]})
+	_, _ = messageStore.Redact(ctx, deleted.ID, alice.ID)
+
+	// A fresh pending upload survives; the deleted message's attachment goes
+	count, err := cleanup.DeadAttachments(ctx, blobs, time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to clean up attachments: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 attachment deleted, got %d", count)
+	}
+	if _, err := blobs.Open(ctx, ids["deleted"]); !errors.Is(err, blob.ErrNotFound) {
+		t.Errorf("Expected deleted message's blob to be removed, got %v", err)
+	}
+
+	// Once past the timeout, unsent uploads go too
+	count, _ = cleanup.DeadAttachments(ctx, blobs, 0)
+	if count != 1 {
+		t.Errorf("Expected stale pending upload deleted, got %d", count)
+	}
+	if r, err := blobs.Open(ctx, ids["kept"]); err != nil {
+		t.Errorf("Expected sent attachment to be kept, got %v", err)
+	} else {
+		_ = r.Close()
+	}
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// BlockedUser is a user on someone's block list
+type BlockedUser struct {
+	UserID    string
+	Username  string
+	BlockedAt time.Time
+}
+
+// Block adds blockedID to blockerID's block list
+// Returns false if the user was already blocked
+func (s *UserStore) Block(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	ctx = withMethod(ctx, "UserStore.Block")
+	tag, err := s.pool.Exec(ctx, `
+		INSERT INTO user_blocks (blocker_id, blocked_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, blockerID, blockedID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Unblock removes blockedID from blockerID's block list
+// Returns false if the user wasn't blocked
+func (s *UserStore) Unblock(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	ctx = withMethod(ctx, "UserStore.Unblock")
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2
+	`, blockerID, blockedID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetBlocked returns a user's block list, most recently blocked first
+func (s *UserStore) GetBlocked(ctx context.Context, blockerID string) ([]*BlockedUser, error) {
+	ctx = withMethod(ctx, "UserStore.GetBlocked")
+	rows, err := s.pool.Query(ctx, `
+		SELECT u.id, u.username, b.created_at
+		FROM user_blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = $1
+		ORDER BY b.created_at DESC
+	`, blockerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocked []*BlockedUser
+	for rows.Next() {
+		var b BlockedUser
+		if err := rows.Scan(&b.UserID, &b.Username, &b.BlockedAt); err != nil {
+			return nil, err
+		}
+		blocked = append(blocked, &b)
+	}
+	return blocked, rows.Err()
+}
+
+// IsBlocked reports whether blockerID has blocked blockedID
+func (s *UserStore) IsBlocked(ctx context.Context, blockerID, blockedID string) (bool, error) {
+	ctx = withMethod(ctx, "UserStore.IsBlocked")
+	var blocked bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = $1 AND blocked_id = $2)
+	`, blockerID, blockedID).Scan(&blocked)
+	return blocked, err
+}
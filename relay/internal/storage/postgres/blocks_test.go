@@ -0,0 +1,69 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUserStore_Blocks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+
+	blocked, err := userStore.Block(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("Failed to block user: %v", err)
+	}
+	if !blocked {
+		t.Error("Expected first block to report a change")
+	}
+	if blocked, _ := userStore.Block(ctx, alice.ID, bob.ID); blocked {
+		t.Error("Expected duplicate block to report no change")
+	}
+
+	// Users can't block themselves
+	if _, err := userStore.Block(ctx, alice.ID, alice.ID); err == nil {
+		t.Error("Expected self-block to fail")
+	}
+
+	// Blocks are one-way
+	if isBlocked, _ := userStore.IsBlocked(ctx, alice.ID, bob.ID); !isBlocked {
+		t.Error("Expected bob to be blocked by alice")
+	}
+	if isBlocked, _ := userStore.IsBlocked(ctx, bob.ID, alice.ID); isBlocked {
+		t.Error("Expected alice not to be blocked by bob")
+	}
+
+	list, err := userStore.GetBlocked(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("Failed to get block list: %v", err)
+	}
+	if len(list) != 1 || list[0].UserID != bob.ID || list[0].Username != "bob" {
+		t.Fatalf("Expected block list [bob], got %+v", list)
+	}
+
+	unblocked, err := userStore.Unblock(ctx, alice.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("Failed to unblock user: %v", err)
+	}
+	if !unblocked {
+		t.Error("Expected unblock to report a change")
+	}
+	if unblocked, _ := userStore.Unblock(ctx, alice.ID, bob.ID); unblocked {
+		t.Error("Expected second unblock to report no change")
+	}
+	if list, _ := userStore.GetBlocked(ctx, alice.ID); len(list) != 0 {
+		t.Errorf("Expected empty block list, got %d", len(list))
+	}
+}
@@ -2,24 +2,42 @@ package postgres
 
 import (
 	"context"
-	"log"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"haven/internal/blob"
 )
 
+// How long an uploaded attachment may stay unsent before it is deleted
+const pendingAttachmentTimeout = 24 * time.Hour
+
+// How long a held message may wait for review before it is discarded
+const heldMessageTimeout = 7 * 24 * time.Hour
+
 // CleanupConfig holds the configuration for cleanup operations
 type CleanupConfig struct {
 	UserInactivityTimeout time.Duration
 	RoomInactivityTimeout time.Duration
 	MessageRetention      time.Duration
+	Blobs                 blob.Store // Attachment contents; attachments are not cleaned up if nil
+
+	// AfterRun is called after each run of a CleanupJob with what it deleted,
+	// so state kept in memory can follow (optional)
+	AfterRun func(ctx context.Context, stats *CleanupStats)
 }
 
 // CleanupStats holds the statistics from a cleanup run
 type CleanupStats struct {
-	UsersDeleted    int
-	RoomsDeleted    int
-	MessagesDeleted int
+	UsersDeleted          int
+	RoomsDeleted          int
+	MessagesDeleted       int
+	DirectMessagesDeleted int
+	AttachmentsDeleted    int
+
+	DeletedUserIDs []string // IDs of the users deleted
 }
 
 // Cleanup handles periodic cleanup of old data
@@ -33,21 +51,59 @@ func NewCleanup(pool *pgxpool.Pool) *Cleanup {
 }
 
 // InactiveUsers deletes users who haven't been seen for longer than the threshold
+// Rooms owned by a deleted user are handed to their longest-standing remaining member
 // Returns the number of users deleted
 func (c *Cleanup) InactiveUsers(ctx context.Context, threshold time.Duration) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.InactiveUsers")
+	ids, err := c.deleteInactiveUsers(ctx, threshold)
+	return len(ids), err
+}
+
+// deleteInactiveUsers does the work of InactiveUsers, returning the IDs of
+// the users deleted
+func (c *Cleanup) deleteInactiveUsers(ctx context.Context, threshold time.Duration) ([]string, error) {
 	cutoff := time.Now().Add(-threshold)
-	result, err := c.pool.Exec(ctx, `
-		DELETE FROM users WHERE last_seen_at < $1
+
+	tx, err := c.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	_, err = tx.Exec(ctx, promoteSuccessorsQuery(`SELECT id FROM users WHERE last_seen_at < $1`), cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		DELETE FROM users WHERE last_seen_at < $1 RETURNING id
 	`, cutoff)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	return int(result.RowsAffected()), nil
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ids, nil
 }
 
 // InactiveRooms deletes rooms that haven't had activity for longer than the threshold
 // Returns the number of rooms deleted (cascade deletes members and messages)
 func (c *Cleanup) InactiveRooms(ctx context.Context, threshold time.Duration) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.InactiveRooms")
 	cutoff := time.Now().Add(-threshold)
 	result, err := c.pool.Exec(ctx, `
 		DELETE FROM rooms WHERE last_activity_at < $1
@@ -59,11 +115,56 @@ func (c *Cleanup) InactiveRooms(ctx context.Context, threshold time.Duration) (i
 }
 
 // OldMessages deletes messages older than the threshold
+// Pinned messages are kept regardless of age
 // Returns the number of messages deleted
 func (c *Cleanup) OldMessages(ctx context.Context, threshold time.Duration) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.OldMessages")
+	cutoff := time.Now().Add(-threshold)
+	result, err := c.pool.Exec(ctx, `
+		DELETE FROM room_messages WHERE created_at < $1 AND `+unpinnedFilter, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// OldDirectMessages deletes delivered direct messages older than the threshold
+// Messages still waiting for their recipient are kept however old they are
+// Returns the number of direct messages deleted
+func (c *Cleanup) OldDirectMessages(ctx context.Context, threshold time.Duration) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.OldDirectMessages")
+	cutoff := time.Now().Add(-threshold)
+	result, err := c.pool.Exec(ctx, `
+		DELETE FROM direct_messages WHERE created_at < $1 AND delivered_at IS NOT NULL
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// OldMemberEvents deletes logged joins and leaves older than the threshold
+// Returns the number of events deleted
+func (c *Cleanup) OldMemberEvents(ctx context.Context, threshold time.Duration) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.OldMemberEvents")
+	cutoff := time.Now().Add(-threshold)
+	result, err := c.pool.Exec(ctx, `
+		DELETE FROM room_member_events WHERE created_at < $1
+	`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// OldQuarantinedMessages discards held messages that have waited for review
+// longer than the threshold
+// Returns the number of held messages discarded
+func (c *Cleanup) OldQuarantinedMessages(ctx context.Context, threshold time.Duration) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.OldQuarantinedMessages")
 	cutoff := time.Now().Add(-threshold)
 	result, err := c.pool.Exec(ctx, `
-		DELETE FROM room_messages WHERE created_at < $1
+		DELETE FROM quarantined_messages WHERE created_at < $1
 	`, cutoff)
 	if err != nil {
 		return 0, err
@@ -71,8 +172,70 @@ func (c *Cleanup) OldMessages(ctx context.Context, threshold time.Duration) (int
 	return int(result.RowsAffected()), nil
 }
 
+// UnusableInviteTokens deletes invite links that expired or ran out of uses
+// Returns the number of links deleted
+func (c *Cleanup) UnusableInviteTokens(ctx context.Context) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.UnusableInviteTokens")
+	result, err := c.pool.Exec(ctx, `
+		DELETE FROM room_invite_tokens WHERE NOT (`+usableTokenFilter+`)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// DeadAttachments deletes attachments of deleted messages, rooms and users,
+// and uploads that were never sent, along with their contents in blobs
+// Returns the number of attachments deleted
+func (c *Cleanup) DeadAttachments(ctx context.Context, blobs blob.Store, pendingTimeout time.Duration) (int, error) {
+	ctx = withMethod(ctx, "Cleanup.DeadAttachments")
+	cutoff := time.Now().Add(-pendingTimeout)
+	rows, err := c.pool.Query(ctx, `
+		SELECT id FROM attachments WHERE `+deadAttachmentFilter, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	// Delete the contents first; a row whose blob couldn't be deleted is kept
+	// so the next run retries it
+	deleted := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if err := blobs.Delete(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete attachment", "attachment_id", id, "err", err)
+			continue
+		}
+		deleted = append(deleted, id)
+	}
+	if len(deleted) == 0 {
+		return 0, nil
+	}
+
+	result, err := c.pool.Exec(ctx, `
+		DELETE FROM attachments WHERE id = ANY($1::uuid[])
+	`, deleted)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
 // RunAll runs all cleanup operations and returns statistics
 func (c *Cleanup) RunAll(ctx context.Context, cfg CleanupConfig) (*CleanupStats, error) {
+	ctx = withMethod(ctx, "Cleanup.RunAll")
 	stats := &CleanupStats{}
 	var err error
 
@@ -82,6 +245,26 @@ func (c *Cleanup) RunAll(ctx context.Context, cfg CleanupConfig) (*CleanupStats,
 		return stats, err
 	}
 
+	// Delivered direct messages follow the same retention as room messages
+	stats.DirectMessagesDeleted, err = c.OldDirectMessages(ctx, cfg.MessageRetention)
+	if err != nil {
+		return stats, err
+	}
+
+	// The member event log only needs to reach as far back as message history
+	if _, err = c.OldMemberEvents(ctx, cfg.MessageRetention); err != nil {
+		return stats, err
+	}
+
+	if _, err = c.UnusableInviteTokens(ctx); err != nil {
+		return stats, err
+	}
+
+	// Discarding unreviewed messages frees their uploads for the attachment pass
+	if _, err = c.OldQuarantinedMessages(ctx, heldMessageTimeout); err != nil {
+		return stats, err
+	}
+
 	// Delete inactive rooms (cascades to remaining messages and members)
 	stats.RoomsDeleted, err = c.InactiveRooms(ctx, cfg.RoomInactivityTimeout)
 	if err != nil {
@@ -89,11 +272,20 @@ func (c *Cleanup) RunAll(ctx context.Context, cfg CleanupConfig) (*CleanupStats,
 	}
 
 	// Delete inactive users last (foreign key constraints with rooms)
-	stats.UsersDeleted, err = c.InactiveUsers(ctx, cfg.UserInactivityTimeout)
+	stats.DeletedUserIDs, err = c.deleteInactiveUsers(ctx, cfg.UserInactivityTimeout)
+	stats.UsersDeleted = len(stats.DeletedUserIDs)
 	if err != nil {
 		return stats, err
 	}
 
+	// Attachments go after everything they hang off, so this run's deletions are included
+	if cfg.Blobs != nil {
+		stats.AttachmentsDeleted, err = c.DeadAttachments(ctx, cfg.Blobs, pendingAttachmentTimeout)
+		if err != nil {
+			return stats, err
+		}
+	}
+
 	return stats, nil
 }
 
@@ -103,6 +295,7 @@ type CleanupJob struct {
 	config   CleanupConfig
 	interval time.Duration
 	done     chan struct{}
+	mu       sync.Mutex // serializes runs
 }
 
 // NewCleanupJob creates a new background cleanup job
@@ -128,12 +321,13 @@ func (j *CleanupJob) run() {
 		select {
 		case <-ticker.C:
 			ctx := context.Background()
-			stats, err := j.cleanup.RunAll(ctx, j.config)
+			stats, err := j.RunNow(ctx)
 			if err != nil {
-				log.Printf("Cleanup error: %v", err)
-			} else if stats.UsersDeleted > 0 || stats.RoomsDeleted > 0 || stats.MessagesDeleted > 0 {
-				log.Printf("Cleanup completed: users=%d, rooms=%d, messages=%d",
-					stats.UsersDeleted, stats.RoomsDeleted, stats.MessagesDeleted)
+				slog.ErrorContext(ctx, "Cleanup failed", "err", err)
+			} else if stats.UsersDeleted > 0 || stats.RoomsDeleted > 0 || stats.MessagesDeleted > 0 || stats.DirectMessagesDeleted > 0 || stats.AttachmentsDeleted > 0 {
+				slog.InfoContext(ctx, "Cleanup completed", "users", stats.UsersDeleted, "rooms", stats.RoomsDeleted,
+					"messages", stats.MessagesDeleted, "direct_messages", stats.DirectMessagesDeleted,
+					"attachments", stats.AttachmentsDeleted)
 			}
 		case <-j.done:
 			return
@@ -141,6 +335,23 @@ func (j *CleanupJob) run() {
 	}
 }
 
+// RunNow runs all cleanup operations right away with the job's configuration
+// A run already in progress is waited for first
+func (j *CleanupJob) RunNow(ctx context.Context) (*CleanupStats, error) {
+	ctx = withMethod(ctx, "CleanupJob.RunNow")
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	start := time.Now()
+	stats, err := j.cleanup.RunAll(ctx, j.config)
+	recordCleanup(stats, err, time.Since(start))
+	// A failed run may still have deleted some things
+	if stats != nil && j.config.AfterRun != nil {
+		j.config.AfterRun(ctx, stats)
+	}
+	return stats, err
+}
+
 // Stop stops the cleanup job
 func (j *CleanupJob) Stop() {
 	close(j.done)
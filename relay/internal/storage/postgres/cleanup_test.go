@@ -54,6 +54,116 @@ func TestCleanup_InactiveUsers(t *testing.T) {
 	}
 }
 
+func TestCleanup_InactiveUsersKeepsRooms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	cleanup := NewCleanup(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	carol, _ := userStore.Create(ctx, "carol", "fp3", "rc3")
+	room, _ := roomStore.Create(ctx, "General", alice.ID, alice.Username, true)
+	_, _ = memberStore.Add(ctx, room.ID, alice.ID, alice.Username)
+	_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+	_, _ = memberStore.Add(ctx, room.ID, carol.ID, carol.Username)
+
+	// Only the owner has gone inactive
+	_, err := testDB.Pool.Exec(ctx, `UPDATE users SET last_seen_at = NOW() - INTERVAL '2 days' WHERE id = $1`, alice.ID)
+	if err != nil {
+		t.Fatalf("Failed to age user: %v", err)
+	}
+
+	deleted, err := cleanup.InactiveUsers(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to cleanup: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted, got %d", deleted)
+	}
+
+	stored, _ := roomStore.GetByID(ctx, room.ID)
+	if stored == nil {
+		t.Fatal("Expected room to survive its creator's deletion")
+	}
+	if stored.CreatorID != "" || stored.CreatorUsername != "alice" {
+		t.Errorf("Expected creator to be cleared but username kept, got %q/%q", stored.CreatorID, stored.CreatorUsername)
+	}
+
+	members, _ := memberStore.GetRoomMembers(ctx, room.ID)
+	if len(members) != 2 {
+		t.Fatalf("Expected 2 remaining members, got %d", len(members))
+	}
+	for _, m := range members {
+		want := "member"
+		if m.UserID == bob.ID {
+			want = "owner" // Longest-standing remaining member
+		}
+		if m.Role != want {
+			t.Errorf("Expected %s to be %s, got %s", m.Username, want, m.Role)
+		}
+	}
+}
+
+func TestCleanup_InactiveUsersKeepsMessages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	cleanup := NewCleanup(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "General", bob.ID, bob.Username, true)
+
+	// Alice starts a thread that bob replies to
+	root, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "question")
+	reply, _, err := messageStore.SaveWithOptions(ctx, room.ID, bob.ID, bob.Username, "answer",
+		MessageOptions{ThreadID: root.ID, ReplyTo: root.ID})
+	if err != nil {
+		t.Fatalf("Failed to save reply: %v", err)
+	}
+
+	_, err = testDB.Pool.Exec(ctx, `UPDATE users SET last_seen_at = NOW() - INTERVAL '2 days' WHERE id = $1`, alice.ID)
+	if err != nil {
+		t.Fatalf("Failed to age user: %v", err)
+	}
+	if _, err := cleanup.InactiveUsers(ctx, 24*time.Hour); err != nil {
+		t.Fatalf("Failed to cleanup: %v", err)
+	}
+
+	stored, err := messageStore.GetByID(ctx, root.ID)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	if stored == nil {
+		t.Fatal("Expected the deleted user's message to survive")
+	}
+	if stored.SenderID != "" || stored.SenderUsername != "alice" {
+		t.Errorf("Expected sender to be cleared but username kept, got %q/%q", stored.SenderID, stored.SenderUsername)
+	}
+
+	stored, _ = messageStore.GetByID(ctx, reply.ID)
+	if stored == nil || stored.ThreadID != root.ID {
+		t.Errorf("Expected bob's reply to stay in alice's thread, got %+v", stored)
+	}
+}
+
 func TestCleanup_InactiveRooms(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
@@ -146,6 +256,90 @@ func TestCleanup_OldMessages(t *testing.T) {
 	}
 }
 
+func TestCleanup_OldMessagesKeepsPins(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	cleanup := NewCleanup(testDB.Pool)
+	ctx := context.Background()
+
+	user, _ := userStore.Create(ctx, "testuser", "fp", "rc")
+	room, _ := roomStore.Create(ctx, "Test Room", user.ID, user.Username, true)
+	pinned, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Announcement")
+	_, _ = messageStore.Save(ctx, room.ID, user.ID, user.Username, "Chatter")
+	root, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Root")
+	reply, _, _ := messageStore.SaveWithOptions(ctx, room.ID, user.ID, user.Username, "Pinned reply", MessageOptions{
+		ThreadID: root.ID,
+		ReplyTo:  root.ID,
+	})
+	_, _, _ = messageStore.PinMessage(ctx, room.ID, pinned.ID, user.ID, user.Username, testPinLimit)
+	_, _, _ = messageStore.PinMessage(ctx, room.ID, reply.ID, user.ID, user.Username, testPinLimit)
+
+	deleted, err := cleanup.OldMessages(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to cleanup: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted, got %d", deleted)
+	}
+
+	// The pinned message, the pinned reply and its thread root survive
+	count, _ := messageStore.CountInRoom(ctx, room.ID)
+	if count != 3 {
+		t.Errorf("Expected 3 messages after cleanup, got %d", count)
+	}
+}
+
+func TestCleanup_OldDirectMessages(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	dmStore := NewDirectMessageStore(testDB.Pool)
+	cleanup := NewCleanup(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	_, _, _ = dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Hello!", "", false)
+	_, _, _ = dmStore.Save(ctx, bob.ID, bob.Username, alice.ID, alice.Username, "Hi!", "", true)
+
+	// Cleanup with long threshold (should delete nothing)
+	deleted, err := cleanup.OldDirectMessages(ctx, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to cleanup: %v", err)
+	}
+	if deleted != 0 {
+		t.Errorf("Expected 0 deleted, got %d", deleted)
+	}
+
+	// Cleanup with zero threshold (should delete only the delivered message)
+	deleted, err = cleanup.OldDirectMessages(ctx, 0)
+	if err != nil {
+		t.Fatalf("Failed to cleanup: %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("Expected 1 deleted, got %d", deleted)
+	}
+
+	// Messages waiting for an offline recipient are kept
+	count, _ := dmStore.CountUndelivered(ctx, bob.ID)
+	if count != 1 {
+		t.Errorf("Expected 1 undelivered direct message after cleanup, got %d", count)
+	}
+}
+
 func TestCleanup_RunAll(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
@@ -194,4 +388,7 @@ func TestCleanup_RunAll(t *testing.T) {
 	if stats.RoomsDeleted < 1 {
 		t.Errorf("Expected at least 1 room deleted, got %d", stats.RoomsDeleted)
 	}
+	if len(stats.DeletedUserIDs) != 1 || stats.DeletedUserIDs[0] != user.ID {
+		t.Errorf("Expected deleted user IDs [%s], got %v", user.ID, stats.DeletedUserIDs)
+	}
 }
@@ -54,6 +54,9 @@ func NewDB(ctx context.Context, cfg *Config) (*DB, error) {
 		poolConfig.MinConns = 2
 	}
 
+	// Time every query for the metrics endpoint
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
 	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create connection pool: %w", err)
@@ -0,0 +1,215 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DirectMessage represents a direct message stored in PostgreSQL
+type DirectMessage struct {
+	ID                string
+	SenderID          string
+	SenderUsername    string
+	RecipientID       string
+	RecipientUsername string
+	Content           string
+	CreatedAt         time.Time
+	DeliveredAt       *time.Time // nil until the recipient has received the message
+	ClientMsgID       string     // Sender-supplied idempotency key (empty if none)
+}
+
+// directMessageColumns is the column list scanned by scanDirectMessage
+const directMessageColumns = `id, sender_id, sender_username, recipient_id, recipient_username,
+	content, created_at, delivered_at, COALESCE(client_msg_id, '')`
+
+// scanDirectMessage scans a row selected with directMessageColumns
+func scanDirectMessage(row pgx.Row) (*DirectMessage, error) {
+	var msg DirectMessage
+	err := row.Scan(
+		&msg.ID, &msg.SenderID, &msg.SenderUsername, &msg.RecipientID, &msg.RecipientUsername,
+		&msg.Content, &msg.CreatedAt, &msg.DeliveredAt, &msg.ClientMsgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// DirectMessageStore handles direct message persistence in PostgreSQL
+type DirectMessageStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewDirectMessageStore creates a new PostgreSQL direct message store
+func NewDirectMessageStore(pool *pgxpool.Pool) *DirectMessageStore {
+	return &DirectMessageStore{pool: pool}
+}
+
+// Save saves a direct message and returns it with the generated ID.
+// If delivered is true the message is marked as delivered immediately.
+// If clientMsgID was already used by the sender, the existing message is
+// returned instead and created is false
+func (s *DirectMessageStore) Save(ctx context.Context, senderID, senderUsername, recipientID, recipientUsername, content, clientMsgID string, delivered bool) (*DirectMessage, bool, error) {
+	ctx = withMethod(ctx, "DirectMessageStore.Save")
+	msg, err := scanDirectMessage(s.pool.QueryRow(ctx, `
+		INSERT INTO direct_messages (sender_id, sender_username, recipient_id, recipient_username, content, client_msg_id, delivered_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), CASE WHEN $7::boolean THEN NOW() END)
+		ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING `+directMessageColumns,
+		senderID, senderUsername, recipientID, recipientUsername, content, clientMsgID, delivered,
+	))
+	if err == nil {
+		return msg, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// Conflict: the client is retrying a message we already stored
+	msg, err = scanDirectMessage(s.pool.QueryRow(ctx, `
+		SELECT `+directMessageColumns+`
+		FROM direct_messages WHERE sender_id = $1 AND client_msg_id = $2
+	`, senderID, clientMsgID))
+	if err != nil {
+		return nil, false, err
+	}
+	return msg, false, nil
+}
+
+// GetUndelivered returns all messages waiting for a recipient
+// Returns messages in chronological order (oldest first)
+func (s *DirectMessageStore) GetUndelivered(ctx context.Context, recipientID string) ([]*DirectMessage, error) {
+	ctx = withMethod(ctx, "DirectMessageStore.GetUndelivered")
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+directMessageColumns+`
+		FROM direct_messages
+		WHERE recipient_id = $1 AND delivered_at IS NULL
+		ORDER BY created_at
+	`, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*DirectMessage
+	for rows.Next() {
+		msg, err := scanDirectMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// MarkDelivered marks the given messages as delivered
+func (s *DirectMessageStore) MarkDelivered(ctx context.Context, ids []string) error {
+	ctx = withMethod(ctx, "DirectMessageStore.MarkDelivered")
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.pool.Exec(ctx, `
+		UPDATE direct_messages SET delivered_at = NOW()
+		WHERE id = ANY($1::uuid[]) AND delivered_at IS NULL
+	`, ids)
+	return err
+}
+
+// GetConversation retrieves the message history between two users
+// Returns messages in reverse chronological order (newest first)
+// If before is not zero, returns messages before that timestamp (for pagination)
+func (s *DirectMessageStore) GetConversation(ctx context.Context, userID, peerID string, limit int, before time.Time) ([]*DirectMessage, error) {
+	ctx = withMethod(ctx, "DirectMessageStore.GetConversation")
+	var rows pgx.Rows
+	var err error
+
+	if before.IsZero() {
+		rows, err = s.pool.Query(ctx, `
+			SELECT `+directMessageColumns+`
+			FROM direct_messages
+			WHERE LEAST(sender_id, recipient_id) = LEAST($1::uuid, $2::uuid)
+			  AND GREATEST(sender_id, recipient_id) = GREATEST($1::uuid, $2::uuid)
+			ORDER BY created_at DESC
+			LIMIT $3
+		`, userID, peerID, limit)
+	} else {
+		rows, err = s.pool.Query(ctx, `
+			SELECT `+directMessageColumns+`
+			FROM direct_messages
+			WHERE LEAST(sender_id, recipient_id) = LEAST($1::uuid, $2::uuid)
+			  AND GREATEST(sender_id, recipient_id) = GREATEST($1::uuid, $2::uuid)
+			  AND created_at < $3
+			ORDER BY created_at DESC
+			LIMIT $4
+		`, userID, peerID, before, limit)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*DirectMessage
+	for rows.Next() {
+		msg, err := scanDirectMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// CountUndelivered returns the number of messages waiting for a recipient
+func (s *DirectMessageStore) CountUndelivered(ctx context.Context, recipientID string) (int, error) {
+	ctx = withMethod(ctx, "DirectMessageStore.CountUndelivered")
+	var count int
+	err := s.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM direct_messages WHERE recipient_id = $1 AND delivered_at IS NULL
+	`, recipientID).Scan(&count)
+	return count, err
+}
+
+// DeleteOlderThan removes direct messages older than the specified time
+// Returns the number of messages deleted
+func (s *DirectMessageStore) DeleteOlderThan(ctx context.Context, threshold time.Time) (int, error) {
+	ctx = withMethod(ctx, "DirectMessageStore.DeleteOlderThan")
+	result, err := s.pool.Exec(ctx, `
+		DELETE FROM direct_messages WHERE created_at < $1
+	`, threshold)
+	if err != nil {
+		return 0, err
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// GetByID retrieves a direct message by ID
+func (s *DirectMessageStore) GetByID(ctx context.Context, id string) (*DirectMessage, error) {
+	ctx = withMethod(ctx, "DirectMessageStore.GetByID")
+	msg, err := scanDirectMessage(s.pool.QueryRow(ctx, `
+		SELECT `+directMessageColumns+`
+		FROM direct_messages WHERE id = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Delete permanently removes a direct message
+// Returns false if the message didn't exist
+func (s *DirectMessageStore) Delete(ctx context.Context, id string) (bool, error) {
+	ctx = withMethod(ctx, "DirectMessageStore.Delete")
+	tag, err := s.pool.Exec(ctx, `DELETE FROM direct_messages WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
@@ -0,0 +1,258 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDirectMessageStore_Save(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	dmStore := NewDirectMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+
+	// Delivered immediately (recipient online)
+	msg, _, err := dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Hi Bob!", "", true)
+	if err != nil {
+		t.Fatalf("Failed to save direct message: %v", err)
+	}
+	if msg.ID == "" {
+		t.Error("Expected message ID to be set")
+	}
+	if msg.SenderID != alice.ID || msg.RecipientID != bob.ID {
+		t.Errorf("Unexpected sender/recipient: %s -> %s", msg.SenderID, msg.RecipientID)
+	}
+	if msg.DeliveredAt == nil {
+		t.Error("Expected DeliveredAt to be set for delivered message")
+	}
+
+	// Stored for later (recipient offline)
+	msg, _, err = dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Are you there?", "", false)
+	if err != nil {
+		t.Fatalf("Failed to save direct message: %v", err)
+	}
+	if msg.DeliveredAt != nil {
+		t.Error("Expected DeliveredAt to be nil for undelivered message")
+	}
+}
+
+func TestDirectMessageStore_UndeliveredAndMarkDelivered(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	dmStore := NewDirectMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+
+	_, _, _ = dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Message 1", "", false)
+	time.Sleep(10 * time.Millisecond)
+	_, _, _ = dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Message 2", "", false)
+	_, _, _ = dmStore.Save(ctx, bob.ID, bob.Username, alice.ID, alice.Username, "Delivered", "", true)
+
+	pending, err := dmStore.GetUndelivered(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("Failed to get undelivered messages: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("Expected 2 undelivered messages, got %d", len(pending))
+	}
+	// Oldest first
+	if pending[0].Content != "Message 1" {
+		t.Errorf("Expected oldest message first, got '%s'", pending[0].Content)
+	}
+
+	// Alice has nothing pending
+	count, _ := dmStore.CountUndelivered(ctx, alice.ID)
+	if count != 0 {
+		t.Errorf("Expected 0 undelivered for alice, got %d", count)
+	}
+
+	if err := dmStore.MarkDelivered(ctx, []string{pending[0].ID, pending[1].ID}); err != nil {
+		t.Fatalf("Failed to mark delivered: %v", err)
+	}
+
+	count, _ = dmStore.CountUndelivered(ctx, bob.ID)
+	if count != 0 {
+		t.Errorf("Expected 0 undelivered after marking, got %d", count)
+	}
+}
+
+func TestDirectMessageStore_GetConversation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	dmStore := NewDirectMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	carol, _ := userStore.Create(ctx, "carol", "fp3", "rc3")
+
+	// Conversation in both directions, plus an unrelated one
+	_, _, _ = dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Message 1", "", true)
+	time.Sleep(10 * time.Millisecond)
+	_, _, _ = dmStore.Save(ctx, bob.ID, bob.Username, alice.ID, alice.Username, "Message 2", "", true)
+	time.Sleep(10 * time.Millisecond)
+	_, _, _ = dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Message 3", "", false)
+	_, _, _ = dmStore.Save(ctx, carol.ID, carol.Username, alice.ID, alice.Username, "Other", "", true)
+
+	messages, err := dmStore.GetConversation(ctx, alice.ID, bob.ID, 10, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to get conversation: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(messages))
+	}
+	// Newest first
+	if messages[0].Content != "Message 3" {
+		t.Errorf("Expected newest message first, got '%s'", messages[0].Content)
+	}
+
+	// Same conversation from bob's side
+	messages, _ = dmStore.GetConversation(ctx, bob.ID, alice.ID, 10, time.Time{})
+	if len(messages) != 3 {
+		t.Errorf("Expected 3 messages from bob's side, got %d", len(messages))
+	}
+
+	// Pagination
+	page1, _ := dmStore.GetConversation(ctx, alice.ID, bob.ID, 2, time.Time{})
+	if len(page1) != 2 {
+		t.Fatalf("Expected 2 messages in page 1, got %d", len(page1))
+	}
+	page2, _ := dmStore.GetConversation(ctx, alice.ID, bob.ID, 2, page1[len(page1)-1].CreatedAt)
+	if len(page2) != 1 {
+		t.Fatalf("Expected 1 message in page 2, got %d", len(page2))
+	}
+	if page2[0].Content != "Message 1" {
+		t.Errorf("Expected 'Message 1' in page 2, got '%s'", page2[0].Content)
+	}
+}
+
+func TestDirectMessageStore_CascadeDeleteOnUserDelete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	dmStore := NewDirectMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	_, _, _ = dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Hello!", "", false)
+
+	if err := userStore.Delete(ctx, alice.ID); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+
+	count, _ := dmStore.CountUndelivered(ctx, bob.ID)
+	if count != 0 {
+		t.Errorf("Expected 0 messages after sender delete, got %d", count)
+	}
+}
+
+func TestDirectMessageStore_ClientMsgID(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	dmStore := NewDirectMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+
+	first, created, err := dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Hi", "c-1", false)
+	if err != nil {
+		t.Fatalf("Failed to save direct message: %v", err)
+	}
+	if !created {
+		t.Error("Expected first save to create the message")
+	}
+
+	retry, created, err := dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "Hi", "c-1", false)
+	if err != nil {
+		t.Fatalf("Failed to save retry: %v", err)
+	}
+	if created {
+		t.Error("Expected retry not to create a message")
+	}
+	if retry.ID != first.ID || retry.ClientMsgID != "c-1" {
+		t.Errorf("Expected retry to return message '%s', got '%s'", first.ID, retry.ID)
+	}
+
+	count, _ := dmStore.CountUndelivered(ctx, bob.ID)
+	if count != 1 {
+		t.Errorf("Expected 1 undelivered message, got %d", count)
+	}
+}
+
+func TestDirectMessageStore_GetByIDAndDelete(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	dmStore := NewDirectMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	msg, _, _ := dmStore.Save(ctx, alice.ID, alice.Username, bob.ID, bob.Username, "hello", "", true)
+
+	got, err := dmStore.GetByID(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("Failed to get message: %v", err)
+	}
+	if got == nil || got.Content != "hello" || got.RecipientID != bob.ID {
+		t.Fatalf("Unexpected message: %+v", got)
+	}
+
+	deleted, err := dmStore.Delete(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("Failed to delete message: %v", err)
+	}
+	if !deleted {
+		t.Error("Expected message to be deleted")
+	}
+	if got, _ := dmStore.GetByID(ctx, msg.ID); got != nil {
+		t.Error("Expected deleted message to be gone")
+	}
+	if deleted, _ := dmStore.Delete(ctx, msg.ID); deleted {
+		t.Error("Expected second delete to report no change")
+	}
+}
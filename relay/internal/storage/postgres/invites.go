@@ -0,0 +1,140 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// Invite is a pending invitation of a user to a room
+type Invite struct {
+	RoomID            string
+	UserID            string
+	Username          string
+	InvitedBy         string // Empty if the inviting user has since been deleted
+	InvitedByUsername string
+	CreatedAt         time.Time
+}
+
+// InviteToken is an invite link to a room
+type InviteToken struct {
+	Token             string
+	RoomID            string
+	CreatedBy         string // Empty if the creating user has since been deleted
+	CreatedByUsername string
+	MaxUses           int // 0 = unlimited
+	Uses              int
+	ExpiresAt         *time.Time // nil = never expires
+	CreatedAt         time.Time
+}
+
+// usableTokenFilter matches room_invite_tokens rows that can still be redeemed
+const usableTokenFilter = `(expires_at IS NULL OR expires_at > NOW()) AND (max_uses = 0 OR uses < max_uses)`
+
+// SaveInvite records a pending invitation
+// Inviting a user who is already invited keeps the original invitation
+func (s *MemberStore) SaveInvite(ctx context.Context, roomID, userID, username, invitedBy, invitedByUsername string) error {
+	ctx = withMethod(ctx, "MemberStore.SaveInvite")
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO room_invites (room_id, user_id, username, invited_by, invited_by_username)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (room_id, user_id) DO NOTHING
+	`, roomID, userID, username, invitedBy, invitedByUsername)
+	return err
+}
+
+// DeleteInvite removes a pending invitation (e.g. once the user has joined)
+func (s *MemberStore) DeleteInvite(ctx context.Context, roomID, userID string) error {
+	ctx = withMethod(ctx, "MemberStore.DeleteInvite")
+	_, err := s.pool.Exec(ctx, `
+		DELETE FROM room_invites WHERE room_id = $1 AND user_id = $2
+	`, roomID, userID)
+	return err
+}
+
+// GetInvites returns the pending invitations of a room
+func (s *MemberStore) GetInvites(ctx context.Context, roomID string) ([]*Invite, error) {
+	ctx = withMethod(ctx, "MemberStore.GetInvites")
+	rows, err := s.pool.Query(ctx, `
+		SELECT room_id, user_id, username, COALESCE(invited_by::text, ''), invited_by_username, created_at
+		FROM room_invites WHERE room_id = $1
+		ORDER BY created_at
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []*Invite
+	for rows.Next() {
+		var inv Invite
+		err := rows.Scan(&inv.RoomID, &inv.UserID, &inv.Username, &inv.InvitedBy, &inv.InvitedByUsername, &inv.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, &inv)
+	}
+	return invites, rows.Err()
+}
+
+// SaveInviteToken stores a new invite link
+func (s *MemberStore) SaveInviteToken(ctx context.Context, t *InviteToken) error {
+	ctx = withMethod(ctx, "MemberStore.SaveInviteToken")
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO room_invite_tokens (token, room_id, created_by, created_by_username, max_uses, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, t.Token, t.RoomID, t.CreatedBy, t.CreatedByUsername, t.MaxUses, t.ExpiresAt, t.CreatedAt)
+	return err
+}
+
+// UseInviteToken counts one use of an invite link
+// Returns false if the link is unknown, expired or exhausted
+func (s *MemberStore) UseInviteToken(ctx context.Context, token string) (bool, error) {
+	ctx = withMethod(ctx, "MemberStore.UseInviteToken")
+	result, err := s.pool.Exec(ctx, `
+		UPDATE room_invite_tokens SET uses = uses + 1
+		WHERE token = $1 AND `+usableTokenFilter,
+		token)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// RevokeInviteToken deletes an invite link
+// Returns false if the link is unknown
+func (s *MemberStore) RevokeInviteToken(ctx context.Context, roomID, token string) (bool, error) {
+	ctx = withMethod(ctx, "MemberStore.RevokeInviteToken")
+	result, err := s.pool.Exec(ctx, `
+		DELETE FROM room_invite_tokens WHERE room_id = $1 AND token = $2
+	`, roomID, token)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// GetInviteTokens returns a room's invite links that can still be redeemed
+func (s *MemberStore) GetInviteTokens(ctx context.Context, roomID string) ([]*InviteToken, error) {
+	ctx = withMethod(ctx, "MemberStore.GetInviteTokens")
+	rows, err := s.pool.Query(ctx, `
+		SELECT token, room_id, COALESCE(created_by::text, ''), created_by_username, max_uses, uses, expires_at, created_at
+		FROM room_invite_tokens
+		WHERE room_id = $1 AND `+usableTokenFilter+`
+		ORDER BY created_at
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*InviteToken
+	for rows.Next() {
+		var t InviteToken
+		err := rows.Scan(&t.Token, &t.RoomID, &t.CreatedBy, &t.CreatedByUsername, &t.MaxUses, &t.Uses, &t.ExpiresAt, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, &t)
+	}
+	return tokens, rows.Err()
+}
@@ -0,0 +1,123 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemberStore_Invites(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Secret", alice.ID, alice.Username, false)
+
+	if err := memberStore.SaveInvite(ctx, room.ID, bob.ID, bob.Username, alice.ID, alice.Username); err != nil {
+		t.Fatalf("Failed to save invite: %v", err)
+	}
+	// Inviting twice is a no-op
+	if err := memberStore.SaveInvite(ctx, room.ID, bob.ID, bob.Username, alice.ID, alice.Username); err != nil {
+		t.Fatalf("Failed to save duplicate invite: %v", err)
+	}
+
+	invites, err := memberStore.GetInvites(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("Failed to get invites: %v", err)
+	}
+	if len(invites) != 1 {
+		t.Fatalf("Expected 1 invite, got %d", len(invites))
+	}
+	if invites[0].UserID != bob.ID || invites[0].InvitedBy != alice.ID || invites[0].InvitedByUsername != "alice" {
+		t.Errorf("Unexpected invite: %+v", invites[0])
+	}
+
+	if err := memberStore.DeleteInvite(ctx, room.ID, bob.ID); err != nil {
+		t.Fatalf("Failed to delete invite: %v", err)
+	}
+	invites, _ = memberStore.GetInvites(ctx, room.ID)
+	if len(invites) != 0 {
+		t.Errorf("Expected no invites after delete, got %d", len(invites))
+	}
+}
+
+func TestMemberStore_InviteTokens(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	cleanup := NewCleanup(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	room, _ := roomStore.Create(ctx, "Secret", alice.ID, alice.Username, false)
+
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	tokens := []*InviteToken{
+		{Token: "once", RoomID: room.ID, CreatedBy: alice.ID, CreatedByUsername: "alice", MaxUses: 1, ExpiresAt: &future, CreatedAt: time.Now()},
+		{Token: "expired", RoomID: room.ID, CreatedBy: alice.ID, CreatedByUsername: "alice", ExpiresAt: &past, CreatedAt: time.Now()},
+		{Token: "open", RoomID: room.ID, CreatedBy: alice.ID, CreatedByUsername: "alice", CreatedAt: time.Now()},
+	}
+	for _, tok := range tokens {
+		if err := memberStore.SaveInviteToken(ctx, tok); err != nil {
+			t.Fatalf("Failed to save token %s: %v", tok.Token, err)
+		}
+	}
+
+	used, err := memberStore.UseInviteToken(ctx, "once")
+	if err != nil || !used {
+		t.Fatalf("Expected first use to succeed, got %v (err %v)", used, err)
+	}
+	used, _ = memberStore.UseInviteToken(ctx, "once")
+	if used {
+		t.Error("Expected exhausted token to be rejected")
+	}
+	used, _ = memberStore.UseInviteToken(ctx, "expired")
+	if used {
+		t.Error("Expected expired token to be rejected")
+	}
+
+	active, err := memberStore.GetInviteTokens(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("Failed to get tokens: %v", err)
+	}
+	if len(active) != 1 || active[0].Token != "open" || active[0].ExpiresAt != nil {
+		t.Errorf("Expected only the open token, got %+v", active)
+	}
+
+	revoked, err := memberStore.RevokeInviteToken(ctx, room.ID, "open")
+	if err != nil || !revoked {
+		t.Fatalf("Expected revoke to succeed, got %v (err %v)", revoked, err)
+	}
+	revoked, _ = memberStore.RevokeInviteToken(ctx, room.ID, "open")
+	if revoked {
+		t.Error("Expected second revoke to report false")
+	}
+
+	deleted, err := cleanup.UnusableInviteTokens(ctx)
+	if err != nil {
+		t.Fatalf("Failed to clean up tokens: %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 unusable tokens deleted, got %d", deleted)
+	}
+}
@@ -12,6 +12,7 @@ type Member struct {
 	RoomID   string
 	UserID   string
 	Username string
+	Role     string // "owner", "admin", "moderator" or "member"
 	JoinedAt time.Time
 }
 
@@ -25,16 +26,39 @@ func NewMemberStore(pool *pgxpool.Pool) *MemberStore {
 	return &MemberStore{pool: pool}
 }
 
+// MemberEvent is a logged join or leave, used to sync reconnecting clients
+type MemberEvent struct {
+	RoomID    string
+	UserID    string
+	Username  string
+	Action    string // "joined", "left" or "kicked"
+	CreatedAt time.Time
+}
+
 // Add adds a user to a room. If already a member, returns existing membership.
+// The room's creator joins as owner while the room has none (i.e. on creation),
+// everyone else as member.
+// New memberships are recorded in the member event log.
 func (s *MemberStore) Add(ctx context.Context, roomID, userID, username string) (*Member, error) {
+	ctx = withMethod(ctx, "MemberStore.Add")
 	var member Member
 	err := s.pool.QueryRow(ctx, `
-		INSERT INTO room_members (room_id, user_id, username)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (room_id, user_id) DO UPDATE SET username = EXCLUDED.username
-		RETURNING room_id, user_id, username, joined_at
+		WITH member AS (
+			INSERT INTO room_members (room_id, user_id, username, role)
+			VALUES ($1, $2, $3, CASE
+				WHEN EXISTS (SELECT 1 FROM rooms WHERE id = $1 AND creator_id = $2)
+				 AND NOT EXISTS (SELECT 1 FROM room_members WHERE room_id = $1 AND role = 'owner') THEN 'owner'
+				ELSE 'member'
+			END)
+			ON CONFLICT (room_id, user_id) DO UPDATE SET username = EXCLUDED.username
+			RETURNING room_id, user_id, username, role, joined_at, xmax = 0 AS inserted
+		), logged AS (
+			INSERT INTO room_member_events (room_id, user_id, username, action)
+			SELECT room_id, user_id, username, 'joined' FROM member WHERE inserted
+		)
+		SELECT room_id, user_id, username, role, joined_at FROM member
 	`, roomID, userID, username).Scan(
-		&member.RoomID, &member.UserID, &member.Username, &member.JoinedAt,
+		&member.RoomID, &member.UserID, &member.Username, &member.Role, &member.JoinedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -42,16 +66,164 @@ func (s *MemberStore) Add(ctx context.Context, roomID, userID, username string)
 	return &member, nil
 }
 
-// Remove removes a user from a room
+// Remove removes a user from a room and records it in the member event log
 func (s *MemberStore) Remove(ctx context.Context, roomID, userID string) error {
+	ctx = withMethod(ctx, "MemberStore.Remove")
+	return s.remove(ctx, roomID, userID, "left")
+}
+
+// Kick removes a user from a room and records it in the member event log as a kick
+func (s *MemberStore) Kick(ctx context.Context, roomID, userID string) error {
+	ctx = withMethod(ctx, "MemberStore.Kick")
+	return s.remove(ctx, roomID, userID, "kicked")
+}
+
+// remove deletes a membership and logs it with the given action
+func (s *MemberStore) remove(ctx context.Context, roomID, userID, action string) error {
 	_, err := s.pool.Exec(ctx, `
-		DELETE FROM room_members WHERE room_id = $1 AND user_id = $2
-	`, roomID, userID)
+		WITH removed AS (
+			DELETE FROM room_members WHERE room_id = $1 AND user_id = $2
+			RETURNING room_id, user_id, username
+		)
+		INSERT INTO room_member_events (room_id, user_id, username, action)
+		SELECT room_id, user_id, username, $3 FROM removed
+	`, roomID, userID, action)
 	return err
 }
 
+// SetRole changes a member's role in a room
+// Returns false if the user is not a member
+func (s *MemberStore) SetRole(ctx context.Context, roomID, userID, role string) (bool, error) {
+	ctx = withMethod(ctx, "MemberStore.SetRole")
+	result, err := s.pool.Exec(ctx, `
+		UPDATE room_members SET role = $3 WHERE room_id = $1 AND user_id = $2
+	`, roomID, userID, role)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// TransferOwnership makes toID the owner of a room and demotes the current
+// owner fromID to admin.
+// Returns false if fromID is not the owner or toID is not a member
+func (s *MemberStore) TransferOwnership(ctx context.Context, roomID, fromID, toID string) (bool, error) {
+	ctx = withMethod(ctx, "MemberStore.TransferOwnership")
+	result, err := s.pool.Exec(ctx, `
+		UPDATE room_members SET role = CASE WHEN user_id = $3 THEN 'owner' ELSE 'admin' END
+		WHERE room_id = $1 AND user_id IN ($2, $3)
+		  AND EXISTS (SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2 AND role = 'owner')
+		  AND EXISTS (SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $3)
+	`, roomID, fromID, toID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() == 2, nil
+}
+
+// promoteSuccessorsQuery builds a statement that hands every room owned by one
+// of the departing users (a subquery yielding user IDs) to the room's
+// longest-standing remaining member. Run it before deleting the users.
+func promoteSuccessorsQuery(departing string) string {
+	return `
+		UPDATE room_members m SET role = 'owner'
+		FROM (
+			SELECT DISTINCT ON (s.room_id) s.room_id, s.user_id
+			FROM room_members s
+			JOIN room_members o ON o.room_id = s.room_id AND o.role = 'owner'
+			WHERE o.user_id IN (` + departing + `) AND s.user_id NOT IN (` + departing + `)
+			ORDER BY s.room_id, s.joined_at, s.user_id
+		) successor
+		WHERE m.room_id = successor.room_id AND m.user_id = successor.user_id`
+}
+
+// GetEventsSince returns joins and leaves logged after the given time in each room
+// since maps room ID to that room's cursor. Returns events oldest first.
+func (s *MemberStore) GetEventsSince(ctx context.Context, since map[string]time.Time) ([]*MemberEvent, error) {
+	ctx = withMethod(ctx, "MemberStore.GetEventsSince")
+	if len(since) == 0 {
+		return nil, nil
+	}
+
+	roomIDs, cursors := splitCursors(since)
+	rows, err := s.pool.Query(ctx, `
+		SELECT e.room_id, e.user_id, e.username, e.action, e.created_at
+		FROM room_member_events e
+		JOIN unnest($1::uuid[], $2::timestamptz[]) AS c(room_id, since) ON c.room_id = e.room_id
+		WHERE e.created_at > c.since
+		ORDER BY e.created_at, e.id
+	`, roomIDs, cursors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*MemberEvent
+	for rows.Next() {
+		var event MemberEvent
+		err := rows.Scan(&event.RoomID, &event.UserID, &event.Username, &event.Action, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// GetRemovalsSince returns the latest leave or kick of a user from each room
+// they are no longer in, if logged after that room's cursor in since, or
+// after sinceAll for rooms without one. A nil sinceAll skips those rooms.
+// Returns events oldest first.
+func (s *MemberStore) GetRemovalsSince(ctx context.Context, userID string, sinceAll *time.Time, since map[string]time.Time) ([]*MemberEvent, error) {
+	ctx = withMethod(ctx, "MemberStore.GetRemovalsSince")
+	if sinceAll == nil && len(since) == 0 {
+		return nil, nil
+	}
+
+	roomIDs, cursors := splitCursors(since)
+	rows, err := s.pool.Query(ctx, `
+		SELECT room_id, user_id, username, action, created_at FROM (
+			SELECT DISTINCT ON (e.room_id) e.room_id, e.user_id, e.username, e.action, e.created_at, e.id
+			FROM room_member_events e
+			LEFT JOIN unnest($3::uuid[], $4::timestamptz[]) AS c(room_id, since) ON c.room_id = e.room_id
+			WHERE e.user_id = $1 AND e.action IN ('left', 'kicked')
+				AND e.created_at > COALESCE(c.since, $2)
+				AND NOT EXISTS (SELECT 1 FROM room_members m WHERE m.room_id = e.room_id AND m.user_id = $1)
+			ORDER BY e.room_id, e.created_at DESC, e.id DESC
+		) removals
+		ORDER BY created_at, id
+	`, userID, sinceAll, roomIDs, cursors)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*MemberEvent
+	for rows.Next() {
+		var event MemberEvent
+		err := rows.Scan(&event.RoomID, &event.UserID, &event.Username, &event.Action, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// splitCursors turns a room ID -> time map into parallel arrays for unnest
+func splitCursors(since map[string]time.Time) ([]string, []time.Time) {
+	roomIDs := make([]string, 0, len(since))
+	cursors := make([]time.Time, 0, len(since))
+	for roomID, t := range since {
+		roomIDs = append(roomIDs, roomID)
+		cursors = append(cursors, t)
+	}
+	return roomIDs, cursors
+}
+
 // IsMember checks if a user is a member of a room
 func (s *MemberStore) IsMember(ctx context.Context, roomID, userID string) (bool, error) {
+	ctx = withMethod(ctx, "MemberStore.IsMember")
 	var exists bool
 	err := s.pool.QueryRow(ctx, `
 		SELECT EXISTS(SELECT 1 FROM room_members WHERE room_id = $1 AND user_id = $2)
@@ -61,8 +233,9 @@ func (s *MemberStore) IsMember(ctx context.Context, roomID, userID string) (bool
 
 // GetRoomMembers returns all members of a room
 func (s *MemberStore) GetRoomMembers(ctx context.Context, roomID string) ([]*Member, error) {
+	ctx = withMethod(ctx, "MemberStore.GetRoomMembers")
 	rows, err := s.pool.Query(ctx, `
-		SELECT room_id, user_id, username, joined_at
+		SELECT room_id, user_id, username, role, joined_at
 		FROM room_members WHERE room_id = $1 ORDER BY joined_at
 	`, roomID)
 	if err != nil {
@@ -73,7 +246,7 @@ func (s *MemberStore) GetRoomMembers(ctx context.Context, roomID string) ([]*Mem
 	var members []*Member
 	for rows.Next() {
 		var member Member
-		err := rows.Scan(&member.RoomID, &member.UserID, &member.Username, &member.JoinedAt)
+		err := rows.Scan(&member.RoomID, &member.UserID, &member.Username, &member.Role, &member.JoinedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -84,6 +257,7 @@ func (s *MemberStore) GetRoomMembers(ctx context.Context, roomID string) ([]*Mem
 
 // GetUserRooms returns all room IDs a user is a member of
 func (s *MemberStore) GetUserRooms(ctx context.Context, userID string) ([]string, error) {
+	ctx = withMethod(ctx, "MemberStore.GetUserRooms")
 	rows, err := s.pool.Query(ctx, `
 		SELECT room_id FROM room_members WHERE user_id = $1
 	`, userID)
@@ -105,6 +279,7 @@ func (s *MemberStore) GetUserRooms(ctx context.Context, userID string) ([]string
 
 // CountRoomMembers returns the number of members in a room
 func (s *MemberStore) CountRoomMembers(ctx context.Context, roomID string) (int, error) {
+	ctx = withMethod(ctx, "MemberStore.CountRoomMembers")
 	var count int
 	err := s.pool.QueryRow(ctx, `
 		SELECT COUNT(*) FROM room_members WHERE room_id = $1
@@ -5,6 +5,7 @@ package postgres
 import (
 	"context"
 	"testing"
+	"time"
 )
 
 func TestMemberStore_Add(t *testing.T) {
@@ -258,3 +259,207 @@ func TestMemberStore_CascadeDeleteOnRoomDelete(t *testing.T) {
 		t.Errorf("Expected 0 members after room delete, got %d", len(members))
 	}
 }
+
+func TestMemberStore_GetEventsSince(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+
+	_, _ = memberStore.Add(ctx, room.ID, alice.ID, alice.Username)
+	time.Sleep(10 * time.Millisecond)
+	cursor := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+	_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username) // Re-adding is not a new join
+	_ = memberStore.Remove(ctx, room.ID, bob.ID)
+
+	events, err := memberStore.GetEventsSince(ctx, map[string]time.Time{room.ID: cursor})
+	if err != nil {
+		t.Fatalf("Failed to get member events: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events after cursor, got %d", len(events))
+	}
+	if events[0].Action != "joined" || events[1].Action != "left" || events[1].UserID != bob.ID {
+		t.Errorf("Unexpected events: %+v, %+v", events[0], events[1])
+	}
+
+	// No cursors, no events
+	events, err = memberStore.GetEventsSince(ctx, nil)
+	if err != nil || len(events) != 0 {
+		t.Errorf("Expected no events without cursors, got %d (err=%v)", len(events), err)
+	}
+}
+
+func TestMemberStore_GetRemovalsSince(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	left, _ := roomStore.Create(ctx, "Left", alice.ID, alice.Username, true)
+	kicked, _ := roomStore.Create(ctx, "Kicked", alice.ID, alice.Username, true)
+	rejoined, _ := roomStore.Create(ctx, "Rejoined", alice.ID, alice.Username, true)
+	for _, room := range []*Room{left, kicked, rejoined} {
+		_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+	}
+	time.Sleep(10 * time.Millisecond)
+	cursor := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	_ = memberStore.Remove(ctx, left.ID, bob.ID)
+	_ = memberStore.Kick(ctx, kicked.ID, bob.ID)
+	_ = memberStore.Remove(ctx, rejoined.ID, bob.ID)
+	_, _ = memberStore.Add(ctx, rejoined.ID, bob.ID, bob.Username)
+
+	// Rooms the user is back in are left to the per-room sync
+	events, err := memberStore.GetRemovalsSince(ctx, bob.ID, &cursor, nil)
+	if err != nil {
+		t.Fatalf("Failed to get removals: %v", err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 removals, got %d", len(events))
+	}
+	if events[0].RoomID != left.ID || events[0].Action != "left" ||
+		events[1].RoomID != kicked.ID || events[1].Action != "kicked" {
+		t.Errorf("Unexpected removals: %+v, %+v", events[0], events[1])
+	}
+
+	// A room's own cursor wins over the global one
+	events, _ = memberStore.GetRemovalsSince(ctx, bob.ID, &cursor, map[string]time.Time{kicked.ID: time.Now()})
+	if len(events) != 1 || events[0].RoomID != left.ID {
+		t.Errorf("Expected only the left room past its cursor, got %d removals", len(events))
+	}
+	events, _ = memberStore.GetRemovalsSince(ctx, bob.ID, nil, map[string]time.Time{kicked.ID: cursor})
+	if len(events) != 1 || events[0].RoomID != kicked.ID {
+		t.Errorf("Expected only the room with a cursor, got %d removals", len(events))
+	}
+}
+
+func TestMemberStore_Roles(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+
+	owner, _ := memberStore.Add(ctx, room.ID, alice.ID, alice.Username)
+	if owner.Role != "owner" {
+		t.Errorf("Expected creator to join as owner, got '%s'", owner.Role)
+	}
+	member, _ := memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+	if member.Role != "member" {
+		t.Errorf("Expected member role, got '%s'", member.Role)
+	}
+
+	changed, err := memberStore.SetRole(ctx, room.ID, bob.ID, "moderator")
+	if err != nil {
+		t.Fatalf("Failed to set role: %v", err)
+	}
+	if !changed {
+		t.Error("Expected role change for member")
+	}
+
+	members, _ := memberStore.GetRoomMembers(ctx, room.ID)
+	if len(members) != 2 || members[1].Role != "moderator" {
+		t.Errorf("Expected bob to be moderator, got %+v", members)
+	}
+
+	// Invalid roles are rejected by the database
+	if _, err := memberStore.SetRole(ctx, room.ID, bob.ID, "superuser"); err == nil {
+		t.Error("Expected error for invalid role")
+	}
+
+	// Kicks are logged separately from leaves
+	cursor := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if err := memberStore.Kick(ctx, room.ID, bob.ID); err != nil {
+		t.Fatalf("Failed to kick member: %v", err)
+	}
+	events, _ := memberStore.GetEventsSince(ctx, map[string]time.Time{room.ID: cursor})
+	if len(events) != 1 || events[0].Action != "kicked" {
+		t.Errorf("Expected a kicked event, got %+v", events)
+	}
+}
+
+func TestMemberStore_TransferOwnership(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	carol, _ := userStore.Create(ctx, "carol", "fp3", "rc3")
+	room, _ := roomStore.Create(ctx, "General", alice.ID, alice.Username, true)
+	_, _ = memberStore.Add(ctx, room.ID, alice.ID, alice.Username)
+	_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+
+	// Non-owners can't transfer, and only to members
+	if ok, _ := memberStore.TransferOwnership(ctx, room.ID, bob.ID, alice.ID); ok {
+		t.Error("Expected transfer by non-owner to fail")
+	}
+	if ok, _ := memberStore.TransferOwnership(ctx, room.ID, alice.ID, carol.ID); ok {
+		t.Error("Expected transfer to non-member to fail")
+	}
+
+	ok, err := memberStore.TransferOwnership(ctx, room.ID, alice.ID, bob.ID)
+	if err != nil || !ok {
+		t.Fatalf("Expected transfer to succeed, got %v (err %v)", ok, err)
+	}
+
+	roles := make(map[string]string)
+	members, _ := memberStore.GetRoomMembers(ctx, room.ID)
+	for _, m := range members {
+		roles[m.UserID] = m.Role
+	}
+	if roles[alice.ID] != "admin" || roles[bob.ID] != "owner" {
+		t.Errorf("Unexpected roles after transfer: %v", roles)
+	}
+
+	// The creator rejoining doesn't reclaim ownership
+	_ = memberStore.Remove(ctx, room.ID, alice.ID)
+	member, _ := memberStore.Add(ctx, room.ID, alice.ID, alice.Username)
+	if member.Role != "member" {
+		t.Errorf("Expected returning creator to join as member, got %s", member.Role)
+	}
+}
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// SaveMentions records the users @mentioned in a message
+func (s *MessageStore) SaveMentions(ctx context.Context, messageID string, userIDs []string) error {
+	ctx = withMethod(ctx, "MessageStore.SaveMentions")
+	if len(userIDs) == 0 {
+		return nil
+	}
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO message_mentions (message_id, user_id)
+		SELECT $1, unnest($2::uuid[])
+		ON CONFLICT (message_id, user_id) DO NOTHING
+	`, messageID, userIDs)
+	return err
+}
+
+// GetMentions returns messages that mention a user, across all rooms they still belong to
+// Returns messages in reverse chronological order (newest first); deleted messages are skipped
+// If before is not zero, returns messages before that timestamp (for pagination)
+func (s *MessageStore) GetMentions(ctx context.Context, userID string, limit int, before time.Time) ([]*Message, error) {
+	ctx = withMethod(ctx, "MessageStore.GetMentions")
+	return s.queryMessages(ctx, `id IN (SELECT message_id FROM message_mentions WHERE user_id = $1)
+		AND room_id IN (SELECT room_id FROM room_members WHERE user_id = $1)
+		AND deleted_at IS NULL`, userID, limit, before)
+}
@@ -2,8 +2,10 @@ package postgres
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -11,10 +13,64 @@ import (
 type Message struct {
 	ID             string
 	RoomID         string
-	SenderID       string
+	SenderID       string // Empty once the sender's account is deleted
 	SenderUsername string
 	Content        string
 	CreatedAt      time.Time
+	EditedAt       *time.Time // nil if never edited
+	DeletedAt      *time.Time // nil unless the message has been redacted
+	ThreadID       string     // Root message of the thread (empty for top-level messages)
+	ReplyTo        string     // Message this one directly replies to (empty if none)
+	ClientMsgID    string     // Sender-supplied idempotency key (empty if none)
+}
+
+// IsDeleted reports whether the message has been redacted
+func (m *Message) IsDeleted() bool {
+	return m.DeletedAt != nil
+}
+
+// MessageOptions holds optional attributes for a new room message
+type MessageOptions struct {
+	ThreadID    string // Root message of the thread this message belongs to
+	ReplyTo     string // Message this message directly replies to
+	ClientMsgID string // Idempotency key, unique per sender
+}
+
+// ThreadSummary describes the replies to a thread root message
+type ThreadSummary struct {
+	ReplyCount  int
+	LastReplyAt time.Time
+}
+
+// MessageEdit represents a previous version of an edited room message
+type MessageEdit struct {
+	ID              string
+	MessageID       string
+	EditorID        string
+	PreviousContent string
+	EditedAt        time.Time
+}
+
+// messageColumns is the column list scanned by scanMessage
+const messageColumns = `id, room_id, COALESCE(sender_id::text, ''), sender_username, content, created_at, edited_at, deleted_at,
+	COALESCE(thread_id::text, ''), COALESCE(reply_to::text, ''), COALESCE(client_msg_id, '')`
+
+// scanMessage scans a row selected with messageColumns
+func scanMessage(row pgx.Row) (*Message, error) {
+	var msg Message
+	if err := row.Scan(messageFields(&msg)...); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// messageFields returns scan destinations matching messageColumns
+func messageFields(msg *Message) []any {
+	return []any{
+		&msg.ID, &msg.RoomID, &msg.SenderID, &msg.SenderUsername, &msg.Content,
+		&msg.CreatedAt, &msg.EditedAt, &msg.DeletedAt, &msg.ThreadID, &msg.ReplyTo,
+		&msg.ClientMsgID,
+	}
 }
 
 // MessageStore handles room message persistence in PostgreSQL
@@ -29,48 +85,97 @@ func NewMessageStore(pool *pgxpool.Pool) *MessageStore {
 
 // Save saves a room message and returns it with the generated ID
 func (s *MessageStore) Save(ctx context.Context, roomID, senderID, senderUsername, content string) (*Message, error) {
-	var msg Message
-	err := s.pool.QueryRow(ctx, `
-		INSERT INTO room_messages (room_id, sender_id, sender_username, content)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, room_id, sender_id, sender_username, content, created_at
-	`, roomID, senderID, senderUsername, content).Scan(
-		&msg.ID, &msg.RoomID, &msg.SenderID, &msg.SenderUsername, &msg.Content, &msg.CreatedAt,
-	)
+	ctx = withMethod(ctx, "MessageStore.Save")
+	msg, _, err := s.SaveWithOptions(ctx, roomID, senderID, senderUsername, content, MessageOptions{})
+	return msg, err
+}
+
+// SaveWithOptions saves a room message with optional threading attributes
+// If opts.ClientMsgID was already used by the sender, the existing message is
+// returned instead and created is false
+func (s *MessageStore) SaveWithOptions(ctx context.Context, roomID, senderID, senderUsername, content string, opts MessageOptions) (*Message, bool, error) {
+	ctx = withMethod(ctx, "MessageStore.SaveWithOptions")
+	msg, err := scanMessage(s.pool.QueryRow(ctx, `
+		INSERT INTO room_messages (room_id, sender_id, sender_username, content, thread_id, reply_to, client_msg_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid, NULLIF($6, '')::uuid, NULLIF($7, ''))
+		ON CONFLICT (sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING `+messageColumns,
+		roomID, senderID, senderUsername, content, opts.ThreadID, opts.ReplyTo, opts.ClientMsgID,
+	))
+	if err == nil {
+		return msg, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, err
+	}
+
+	// Conflict: the client is retrying a message we already stored
+	msg, err = scanMessage(s.pool.QueryRow(ctx, `
+		SELECT `+messageColumns+`
+		FROM room_messages WHERE sender_id = $1 AND client_msg_id = $2
+	`, senderID, opts.ClientMsgID))
+	if err != nil {
+		return nil, false, err
+	}
+	return msg, false, nil
+}
+
+// GetByID retrieves a message by its ID (including redacted messages)
+func (s *MessageStore) GetByID(ctx context.Context, id string) (*Message, error) {
+	ctx = withMethod(ctx, "MessageStore.GetByID")
+	msg, err := scanMessage(s.pool.QueryRow(ctx, `
+		SELECT `+messageColumns+`
+		FROM room_messages WHERE id = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	return &msg, nil
+	return msg, nil
 }
 
-// GetHistory retrieves message history for a room
+// GetHistory retrieves the main timeline of a room (top-level messages only;
+// thread replies are fetched with GetThreadHistory)
 // Returns messages in reverse chronological order (newest first)
 // If before is not zero, returns messages before that timestamp (for pagination)
+// Redacted messages are included as tombstones with empty content
 func (s *MessageStore) GetHistory(ctx context.Context, roomID string, limit int, before time.Time) ([]*Message, error) {
-	var rows interface {
-		Close()
-		Next() bool
-		Scan(...any) error
-		Err() error
-	}
+	ctx = withMethod(ctx, "MessageStore.GetHistory")
+	return s.queryMessages(ctx, `room_id = $1 AND thread_id IS NULL`, roomID, limit, before)
+}
+
+// GetThreadHistory retrieves the replies in a thread
+// Returns messages in reverse chronological order (newest first)
+// If before is not zero, returns messages before that timestamp (for pagination)
+func (s *MessageStore) GetThreadHistory(ctx context.Context, threadID string, limit int, before time.Time) ([]*Message, error) {
+	ctx = withMethod(ctx, "MessageStore.GetThreadHistory")
+	return s.queryMessages(ctx, `thread_id = $1`, threadID, limit, before)
+}
+
+// queryMessages runs a paginated, newest-first message query
+// filter is a WHERE clause using $1 for key
+func (s *MessageStore) queryMessages(ctx context.Context, filter, key string, limit int, before time.Time) ([]*Message, error) {
+	var rows pgx.Rows
 	var err error
 
 	if before.IsZero() {
 		rows, err = s.pool.Query(ctx, `
-			SELECT id, room_id, sender_id, sender_username, content, created_at
+			SELECT `+messageColumns+`
 			FROM room_messages
-			WHERE room_id = $1
+			WHERE `+filter+`
 			ORDER BY created_at DESC
 			LIMIT $2
-		`, roomID, limit)
+		`, key, limit)
 	} else {
 		rows, err = s.pool.Query(ctx, `
-			SELECT id, room_id, sender_id, sender_username, content, created_at
+			SELECT `+messageColumns+`
 			FROM room_messages
-			WHERE room_id = $1 AND created_at < $2
+			WHERE `+filter+` AND created_at < $2
 			ORDER BY created_at DESC
 			LIMIT $3
-		`, roomID, before, limit)
+		`, key, before, limit)
 	}
 
 	if err != nil {
@@ -80,18 +185,209 @@ func (s *MessageStore) GetHistory(ctx context.Context, roomID string, limit int,
 
 	var messages []*Message
 	for rows.Next() {
-		var msg Message
-		err := rows.Scan(&msg.ID, &msg.RoomID, &msg.SenderID, &msg.SenderUsername, &msg.Content, &msg.CreatedAt)
+		msg, err := scanMessage(rows)
 		if err != nil {
 			return nil, err
 		}
-		messages = append(messages, &msg)
+		messages = append(messages, msg)
 	}
 	return messages, rows.Err()
 }
 
+// GetThreadSummaries returns reply counts for the given thread roots, keyed by root ID
+// Roots without replies are omitted; deleted replies are not counted
+func (s *MessageStore) GetThreadSummaries(ctx context.Context, rootIDs []string) (map[string]*ThreadSummary, error) {
+	ctx = withMethod(ctx, "MessageStore.GetThreadSummaries")
+	result := make(map[string]*ThreadSummary)
+	if len(rootIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT thread_id, COUNT(*), MAX(created_at)
+		FROM room_messages
+		WHERE thread_id = ANY($1::uuid[]) AND deleted_at IS NULL
+		GROUP BY thread_id
+	`, rootIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rootID string
+		var summary ThreadSummary
+		if err := rows.Scan(&rootID, &summary.ReplyCount, &summary.LastReplyAt); err != nil {
+			return nil, err
+		}
+		result[rootID] = &summary
+	}
+	return result, rows.Err()
+}
+
+// Edit replaces the content of a message, recording the previous version in
+// the edit history. Returns nil if the message does not exist or was deleted.
+func (s *MessageStore) Edit(ctx context.Context, id, editorID, content string) (*Message, error) {
+	ctx = withMethod(ctx, "MessageStore.Edit")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO room_message_edits (message_id, editor_id, previous_content)
+		SELECT id, $2, content FROM room_messages
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id, editorID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, nil
+	}
+
+	msg, err := scanMessage(tx.QueryRow(ctx, `
+		UPDATE room_messages SET content = $2, edited_at = NOW()
+		WHERE id = $1
+		RETURNING `+messageColumns,
+		id, content,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Redact turns a message into a tombstone: its content and edit history are
+// removed but the row is kept so history pagination stays stable.
+// An empty deletedBy records a deletion by the server operator.
+// Returns nil if the message does not exist or was already deleted.
+func (s *MessageStore) Redact(ctx context.Context, id, deletedBy string) (*Message, error) {
+	ctx = withMethod(ctx, "MessageStore.Redact")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	msg, err := scanMessage(tx.QueryRow(ctx, `
+		UPDATE room_messages SET content = '', deleted_at = NOW(), deleted_by = NULLIF($2, '')::uuid
+		WHERE id = $1 AND deleted_at IS NULL
+		RETURNING `+messageColumns,
+		id, deletedBy,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM room_message_edits WHERE message_id = $1`, id); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ChangedAt returns when the message was last created, edited or deleted
+func (m *Message) ChangedAt() time.Time {
+	changed := m.CreatedAt
+	if m.EditedAt != nil && m.EditedAt.After(changed) {
+		changed = *m.EditedAt
+	}
+	if m.DeletedAt != nil && m.DeletedAt.After(changed) {
+		changed = *m.DeletedAt
+	}
+	return changed
+}
+
+// Now returns the database's current time, the clock that stamps messages
+// and member events, for use as a sync watermark
+func (s *MessageStore) Now(ctx context.Context) (time.Time, error) {
+	ctx = withMethod(ctx, "MessageStore.Now")
+	var now time.Time
+	err := s.pool.QueryRow(ctx, `SELECT NOW()`).Scan(&now)
+	return now, err
+}
+
+// GetChangesSince returns messages created, edited or deleted after the given
+// time in each room, including thread replies. since maps room ID to that
+// room's cursor. Results are ordered by ChangedAt then ID; pass the last
+// message's ChangedAt and ID as afterAt/afterID to fetch the next page.
+func (s *MessageStore) GetChangesSince(ctx context.Context, since map[string]time.Time, afterAt time.Time, afterID string, limit int) ([]*Message, error) {
+	ctx = withMethod(ctx, "MessageStore.GetChangesSince")
+	if len(since) == 0 {
+		return nil, nil
+	}
+	if afterID == "" {
+		afterID = "00000000-0000-0000-0000-000000000000"
+	}
+
+	roomIDs, cursors := splitCursors(since)
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+messageColumns+`
+		FROM (
+			SELECT m.*, GREATEST(m.created_at, m.edited_at, m.deleted_at) AS changed_at
+			FROM room_messages m
+			JOIN unnest($1::uuid[], $2::timestamptz[]) AS c(room_id, since) ON c.room_id = m.room_id
+			WHERE GREATEST(m.created_at, m.edited_at, m.deleted_at) > c.since
+		) changed
+		WHERE (changed_at, id) > ($3, $4::uuid)
+		ORDER BY changed_at, id
+		LIMIT $5
+	`, roomIDs, cursors, afterAt, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// GetEditHistory returns the previous versions of a message (oldest first)
+func (s *MessageStore) GetEditHistory(ctx context.Context, messageID string) ([]*MessageEdit, error) {
+	ctx = withMethod(ctx, "MessageStore.GetEditHistory")
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, message_id, COALESCE(editor_id::text, ''), previous_content, edited_at
+		FROM room_message_edits WHERE message_id = $1 ORDER BY edited_at
+	`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edits []*MessageEdit
+	for rows.Next() {
+		var edit MessageEdit
+		err := rows.Scan(&edit.ID, &edit.MessageID, &edit.EditorID, &edit.PreviousContent, &edit.EditedAt)
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, &edit)
+	}
+	return edits, rows.Err()
+}
+
 // CountInRoom returns the number of messages in a room
 func (s *MessageStore) CountInRoom(ctx context.Context, roomID string) (int, error) {
+	ctx = withMethod(ctx, "MessageStore.CountInRoom")
 	var count int
 	err := s.pool.QueryRow(ctx, `
 		SELECT COUNT(*) FROM room_messages WHERE room_id = $1
@@ -101,16 +397,17 @@ func (s *MessageStore) CountInRoom(ctx context.Context, roomID string) (int, err
 
 // Delete removes a message by ID
 func (s *MessageStore) Delete(ctx context.Context, id string) error {
+	ctx = withMethod(ctx, "MessageStore.Delete")
 	_, err := s.pool.Exec(ctx, `DELETE FROM room_messages WHERE id = $1`, id)
 	return err
 }
 
-// DeleteOlderThan removes messages older than the specified time
+// DeleteOlderThan removes messages older than the specified time, keeping pinned messages
 // Returns the number of messages deleted
 func (s *MessageStore) DeleteOlderThan(ctx context.Context, threshold time.Time) (int, error) {
+	ctx = withMethod(ctx, "MessageStore.DeleteOlderThan")
 	result, err := s.pool.Exec(ctx, `
-		DELETE FROM room_messages WHERE created_at < $1
-	`, threshold)
+		DELETE FROM room_messages WHERE created_at < $1 AND `+unpinnedFilter, threshold)
 	if err != nil {
 		return 0, err
 	}
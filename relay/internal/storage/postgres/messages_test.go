@@ -247,3 +247,338 @@ func TestMessageStore_Count(t *testing.T) {
 		t.Errorf("Expected 2 messages, got %d", count)
 	}
 }
+
+func TestMessageStore_Edit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	user, _ := userStore.Create(ctx, "testuser", "fp", "rc")
+	room, _ := roomStore.Create(ctx, "Test Room", user.ID, user.Username, true)
+	msg, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Helo")
+
+	edited, err := messageStore.Edit(ctx, msg.ID, user.ID, "Hello")
+	if err != nil {
+		t.Fatalf("Failed to edit message: %v", err)
+	}
+	if edited.Content != "Hello" {
+		t.Errorf("Expected content 'Hello', got '%s'", edited.Content)
+	}
+	if edited.EditedAt == nil {
+		t.Error("Expected EditedAt to be set")
+	}
+
+	_, _ = messageStore.Edit(ctx, msg.ID, user.ID, "Hello!")
+
+	// Previous versions are kept, oldest first
+	edits, err := messageStore.GetEditHistory(ctx, msg.ID)
+	if err != nil {
+		t.Fatalf("Failed to get edit history: %v", err)
+	}
+	if len(edits) != 2 {
+		t.Fatalf("Expected 2 edits, got %d", len(edits))
+	}
+	if edits[0].PreviousContent != "Helo" || edits[1].PreviousContent != "Hello" {
+		t.Errorf("Unexpected edit history: '%s', '%s'", edits[0].PreviousContent, edits[1].PreviousContent)
+	}
+
+	// History reflects the latest content
+	messages, _ := messageStore.GetHistory(ctx, room.ID, 10, time.Time{})
+	if len(messages) != 1 || messages[0].Content != "Hello!" {
+		t.Errorf("Expected edited content in history, got %+v", messages)
+	}
+
+	// Unknown message
+	missing, err := messageStore.Edit(ctx, "00000000-0000-0000-0000-000000000000", user.ID, "x")
+	if err != nil {
+		t.Fatalf("Expected no error for unknown message, got %v", err)
+	}
+	if missing != nil {
+		t.Error("Expected nil for unknown message")
+	}
+}
+
+func TestMessageStore_Redact(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	user, _ := userStore.Create(ctx, "testuser", "fp", "rc")
+	room, _ := roomStore.Create(ctx, "Test Room", user.ID, user.Username, true)
+	msg, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Secret")
+	_, _ = messageStore.Edit(ctx, msg.ID, user.ID, "Secret 2")
+
+	redacted, err := messageStore.Redact(ctx, msg.ID, user.ID)
+	if err != nil {
+		t.Fatalf("Failed to redact message: %v", err)
+	}
+	if !redacted.IsDeleted() {
+		t.Error("Expected message to be deleted")
+	}
+	if redacted.Content != "" {
+		t.Errorf("Expected empty content, got '%s'", redacted.Content)
+	}
+
+	// Edit history is removed with the content
+	edits, _ := messageStore.GetEditHistory(ctx, msg.ID)
+	if len(edits) != 0 {
+		t.Errorf("Expected no edit history after redaction, got %d", len(edits))
+	}
+
+	// Tombstone remains in history
+	messages, _ := messageStore.GetHistory(ctx, room.ID, 10, time.Time{})
+	if len(messages) != 1 || !messages[0].IsDeleted() {
+		t.Errorf("Expected tombstone in history, got %+v", messages)
+	}
+
+	// Deleted messages can't be edited or deleted again
+	edited, _ := messageStore.Edit(ctx, msg.ID, user.ID, "Revived")
+	if edited != nil {
+		t.Error("Expected edit of deleted message to return nil")
+	}
+	again, _ := messageStore.Redact(ctx, msg.ID, user.ID)
+	if again != nil {
+		t.Error("Expected second redaction to return nil")
+	}
+}
+
+func TestMessageStore_Threads(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	user, _ := userStore.Create(ctx, "testuser", "fp", "rc")
+	room, _ := roomStore.Create(ctx, "Test Room", user.ID, user.Username, true)
+
+	root, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Root")
+	other, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Other")
+	time.Sleep(10 * time.Millisecond)
+	reply1, _, err := messageStore.SaveWithOptions(ctx, room.ID, user.ID, user.Username, "Reply 1", MessageOptions{
+		ThreadID: root.ID,
+		ReplyTo:  root.ID,
+	})
+	if err != nil {
+		t.Fatalf("Failed to save reply: %v", err)
+	}
+	if reply1.ThreadID != root.ID || reply1.ReplyTo != root.ID {
+		t.Errorf("Expected reply in thread '%s', got thread=%q reply_to=%q", root.ID, reply1.ThreadID, reply1.ReplyTo)
+	}
+	time.Sleep(10 * time.Millisecond)
+	_, _, _ = messageStore.SaveWithOptions(ctx, room.ID, user.ID, user.Username, "Reply 2", MessageOptions{
+		ThreadID: root.ID,
+		ReplyTo:  reply1.ID,
+	})
+
+	// Main timeline excludes replies
+	timeline, _ := messageStore.GetHistory(ctx, room.ID, 10, time.Time{})
+	if len(timeline) != 2 {
+		t.Fatalf("Expected 2 top-level messages, got %d", len(timeline))
+	}
+
+	// Thread history returns only the replies, newest first
+	thread, err := messageStore.GetThreadHistory(ctx, root.ID, 10, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to get thread history: %v", err)
+	}
+	if len(thread) != 2 {
+		t.Fatalf("Expected 2 replies, got %d", len(thread))
+	}
+	if thread[0].Content != "Reply 2" {
+		t.Errorf("Expected newest reply first, got '%s'", thread[0].Content)
+	}
+
+	summaries, err := messageStore.GetThreadSummaries(ctx, []string{root.ID, other.ID})
+	if err != nil {
+		t.Fatalf("Failed to get thread summaries: %v", err)
+	}
+	if _, ok := summaries[other.ID]; ok {
+		t.Error("Expected no summary for message without replies")
+	}
+	summary := summaries[root.ID]
+	if summary == nil || summary.ReplyCount != 2 {
+		t.Fatalf("Expected 2 replies in summary, got %+v", summary)
+	}
+	if !summary.LastReplyAt.After(root.CreatedAt) {
+		t.Error("Expected last reply time after root creation")
+	}
+}
+
+func TestMessageStore_ClientMsgID(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+
+	first, created, err := messageStore.SaveWithOptions(ctx, room.ID, alice.ID, alice.Username, "Hello", MessageOptions{ClientMsgID: "c-1"})
+	if err != nil {
+		t.Fatalf("Failed to save message: %v", err)
+	}
+	if !created {
+		t.Error("Expected first save to create the message")
+	}
+	if first.ClientMsgID != "c-1" {
+		t.Errorf("Expected client_msg_id 'c-1', got '%s'", first.ClientMsgID)
+	}
+
+	// Retry returns the stored message
+	retry, created, err := messageStore.SaveWithOptions(ctx, room.ID, alice.ID, alice.Username, "Hello", MessageOptions{ClientMsgID: "c-1"})
+	if err != nil {
+		t.Fatalf("Failed to save retry: %v", err)
+	}
+	if created {
+		t.Error("Expected retry not to create a message")
+	}
+	if retry.ID != first.ID {
+		t.Errorf("Expected retry to return message '%s', got '%s'", first.ID, retry.ID)
+	}
+
+	// Keys are scoped per sender
+	_, created, err = messageStore.SaveWithOptions(ctx, room.ID, bob.ID, bob.Username, "Hello", MessageOptions{ClientMsgID: "c-1"})
+	if err != nil || !created {
+		t.Errorf("Expected another sender's key to be independent (created=%v, err=%v)", created, err)
+	}
+
+	// Messages without a key are never deduplicated
+	_, _ = messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "Hello")
+	_, _ = messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "Hello")
+
+	count, _ := messageStore.CountInRoom(ctx, room.ID)
+	if count != 4 {
+		t.Errorf("Expected 4 messages, got %d", count)
+	}
+}
+
+func TestMessageStore_GetChangesSince(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	user, _ := userStore.Create(ctx, "testuser", "fp", "rc")
+	room, _ := roomStore.Create(ctx, "Test Room", user.ID, user.Username, true)
+	other, _ := roomStore.Create(ctx, "Other Room", user.ID, user.Username, true)
+
+	old, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Old")
+	time.Sleep(10 * time.Millisecond)
+	cursor := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	_, _ = messageStore.Save(ctx, room.ID, user.ID, user.Username, "New 1")
+	_, _ = messageStore.Save(ctx, room.ID, user.ID, user.Username, "New 2")
+	_, _ = messageStore.Save(ctx, other.ID, user.ID, user.Username, "Elsewhere")
+	_, _ = messageStore.Edit(ctx, old.ID, user.ID, "Old (edited)")
+
+	since := map[string]time.Time{room.ID: cursor}
+
+	// First page
+	page, err := messageStore.GetChangesSince(ctx, since, time.Time{}, "", 2)
+	if err != nil {
+		t.Fatalf("Failed to get changes: %v", err)
+	}
+	if len(page) != 2 || page[0].Content != "New 1" {
+		t.Fatalf("Expected first page to start with 'New 1', got %d messages", len(page))
+	}
+
+	// Next page picks up after the last message, including the edit
+	last := page[1]
+	page, err = messageStore.GetChangesSince(ctx, since, last.ChangedAt(), last.ID, 2)
+	if err != nil {
+		t.Fatalf("Failed to get next page: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != old.ID || page[0].Content != "Old (edited)" {
+		t.Errorf("Expected the edited message on the last page, got %d messages", len(page))
+	}
+}
+
+func TestMessageStore_Mentions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+	left, _ := roomStore.Create(ctx, "Left Room", alice.ID, alice.Username, true)
+	_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+
+	msg1, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "hi @bob")
+	time.Sleep(10 * time.Millisecond)
+	msg2, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "@bob again")
+	other, _ := messageStore.Save(ctx, left.ID, alice.ID, alice.Username, "@bob elsewhere")
+
+	for _, id := range []string{msg1.ID, msg2.ID, other.ID} {
+		if err := messageStore.SaveMentions(ctx, id, []string{bob.ID}); err != nil {
+			t.Fatalf("Failed to save mentions: %v", err)
+		}
+	}
+
+	// Only rooms bob still belongs to, newest first
+	mentions, err := messageStore.GetMentions(ctx, bob.ID, 10, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to get mentions: %v", err)
+	}
+	if len(mentions) != 2 {
+		t.Fatalf("Expected 2 mentions, got %d", len(mentions))
+	}
+	if mentions[0].ID != msg2.ID {
+		t.Errorf("Expected newest mention first, got '%s'", mentions[0].Content)
+	}
+
+	// Deleted messages drop out
+	_, _ = messageStore.Redact(ctx, msg2.ID, alice.ID)
+	mentions, _ = messageStore.GetMentions(ctx, bob.ID, 10, time.Time{})
+	if len(mentions) != 1 {
+		t.Errorf("Expected 1 mention after delete, got %d", len(mentions))
+	}
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"haven/internal/metrics"
+)
+
+var (
+	queryDuration = metrics.NewHistogram("haven_db_query_duration_seconds",
+		"Time taken by database queries, by store method.", metrics.DefaultBuckets, "method")
+	queryErrors = metrics.NewCounter("haven_db_query_errors_total",
+		"Database queries that failed, by store method.", "method")
+
+	cleanupRuns = metrics.NewCounter("haven_cleanup_runs_total",
+		"Cleanup runs, by result (ok or error).", "result")
+	cleanupDeleted = metrics.NewCounter("haven_cleanup_deleted_total",
+		"Rows deleted by cleanup runs, by kind.", "kind")
+	cleanupLastRun = metrics.NewGauge("haven_cleanup_last_run_timestamp_seconds",
+		"Unix time the last cleanup run finished.")
+	cleanupLastDuration = metrics.NewGauge("haven_cleanup_last_duration_seconds",
+		"Time taken by the last cleanup run.")
+)
+
+// queryTracer times every query run through the pool, attributing it to
+// the store method that issued it (see withMethod)
+type queryTracer struct{}
+
+// queryTrace is what TraceQueryStart hands to TraceQueryEnd
+type queryTrace struct {
+	method string
+	start  time.Time
+}
+
+type queryTraceKey struct{}
+
+type queryMethodKey struct{}
+
+// withMethod labels the queries run with ctx with the store method that
+// issues them, such as "MessageStore.Save"; every exported store method
+// starts with it. Unlabelled queries are counted as "other".
+func withMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, queryMethodKey{}, method)
+}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	method, ok := ctx.Value(queryMethodKey{}).(string)
+	if !ok {
+		method = "other"
+	}
+	return context.WithValue(ctx, queryTraceKey{}, queryTrace{method: method, start: time.Now()})
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	trace, ok := ctx.Value(queryTraceKey{}).(queryTrace)
+	if !ok {
+		return
+	}
+	queryDuration.Observe(time.Since(trace.start).Seconds(), trace.method)
+	if data.Err != nil && !errors.Is(data.Err, pgx.ErrNoRows) {
+		queryErrors.Inc(trace.method)
+		// Callers log failures they act on; this records the method at fault
+		slog.DebugContext(ctx, "Query failed", "method", trace.method, "err", data.Err)
+	}
+}
+
+// recordCleanup exposes the outcome of a cleanup run
+func recordCleanup(stats *CleanupStats, err error, took time.Duration) {
+	if err != nil {
+		cleanupRuns.Inc("error")
+	} else {
+		cleanupRuns.Inc("ok")
+	}
+	cleanupLastRun.Set(float64(time.Now().Unix()))
+	cleanupLastDuration.Set(took.Seconds())
+
+	if stats == nil {
+		return
+	}
+	cleanupDeleted.Add(float64(stats.UsersDeleted), "users")
+	cleanupDeleted.Add(float64(stats.RoomsDeleted), "rooms")
+	cleanupDeleted.Add(float64(stats.MessagesDeleted), "messages")
+	cleanupDeleted.Add(float64(stats.DirectMessagesDeleted), "direct_messages")
+	cleanupDeleted.Add(float64(stats.AttachmentsDeleted), "attachments")
+}
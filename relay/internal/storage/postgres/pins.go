@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// unpinnedFilter matches room_messages rows that retention sweeps may delete:
+// neither pinned nor the root of a thread with a pinned reply (deleting the
+// root would cascade to the reply)
+const unpinnedFilter = `NOT EXISTS (SELECT 1 FROM room_pins p WHERE p.message_id = room_messages.id)
+	AND NOT EXISTS (
+		SELECT 1 FROM room_pins p JOIN room_messages r ON r.id = p.message_id
+		WHERE r.thread_id = room_messages.id
+	)`
+
+// Pin is a message pinned to a room
+type Pin struct {
+	Message          *Message
+	PinnedBy         string // Empty if the pinning user has since been deleted
+	PinnedByUsername string
+	PinnedAt         time.Time
+}
+
+// PinMessage pins a message to its room if the room has fewer than limit
+// pins. The room's row is locked while checking, so concurrent pins can't
+// both slip under the limit.
+// Returns pinned=false if the message was already pinned, and full=true if
+// the room is at the limit
+func (s *MessageStore) PinMessage(ctx context.Context, roomID, messageID, userID, username string, limit int) (pinned, full bool, err error) {
+	ctx = withMethod(ctx, "MessageStore.PinMessage")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, false, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// NO KEY UPDATE serializes pinners without blocking messages being
+	// inserted into the room
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM rooms WHERE id = $1 FOR NO KEY UPDATE`, roomID); err != nil {
+		return false, false, err
+	}
+
+	result, err := tx.Exec(ctx, `
+		INSERT INTO room_pins (room_id, message_id, pinned_by, pinned_by_username)
+		SELECT $1, $2, $3, $4
+		WHERE (SELECT COUNT(*) FROM room_pins WHERE room_id = $1) < $5
+		ON CONFLICT (room_id, message_id) DO NOTHING
+	`, roomID, messageID, userID, username, limit)
+	if err != nil {
+		return false, false, err
+	}
+	if result.RowsAffected() == 0 {
+		var exists bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM room_pins WHERE room_id = $1 AND message_id = $2)
+		`, roomID, messageID).Scan(&exists)
+		return false, err == nil && !exists, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return false, false, err
+	}
+	return true, false, nil
+}
+
+// UnpinMessage removes a pinned message from its room
+// Returns false if the message was not pinned
+func (s *MessageStore) UnpinMessage(ctx context.Context, roomID, messageID string) (bool, error) {
+	ctx = withMethod(ctx, "MessageStore.UnpinMessage")
+	result, err := s.pool.Exec(ctx, `
+		DELETE FROM room_pins WHERE room_id = $1 AND message_id = $2
+	`, roomID, messageID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// GetPins returns the pinned messages of a room, most recently pinned first
+func (s *MessageStore) GetPins(ctx context.Context, roomID string) ([]*Pin, error) {
+	ctx = withMethod(ctx, "MessageStore.GetPins")
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+messageColumns+`, COALESCE(p.pin_user::text, ''), p.pin_username, p.pinned_at
+		FROM room_messages
+		JOIN (
+			SELECT message_id, pinned_by AS pin_user, pinned_by_username AS pin_username, pinned_at
+			FROM room_pins WHERE room_id = $1
+		) p ON p.message_id = room_messages.id
+		ORDER BY p.pinned_at DESC
+	`, roomID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pins []*Pin
+	for rows.Next() {
+		var msg Message
+		pin := Pin{Message: &msg}
+		dest := append(messageFields(&msg), &pin.PinnedBy, &pin.PinnedByUsername, &pin.PinnedAt)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		pins = append(pins, &pin)
+	}
+	return pins, rows.Err()
+}
+
+// CountPins returns the number of pinned messages in a room
+func (s *MessageStore) CountPins(ctx context.Context, roomID string) (int, error) {
+	ctx = withMethod(ctx, "MessageStore.CountPins")
+	var count int
+	err := s.pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM room_pins WHERE room_id = $1
+	`, roomID).Scan(&count)
+	return count, err
+}
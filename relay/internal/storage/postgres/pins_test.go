@@ -0,0 +1,112 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testPinLimit = 50
+
+func TestMessageStore_Pins(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	user, _ := userStore.Create(ctx, "testuser", "fp", "rc")
+	room, _ := roomStore.Create(ctx, "Test Room", user.ID, user.Username, true)
+	msg1, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Message 1")
+	msg2, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Message 2")
+
+	pinned, _, err := messageStore.PinMessage(ctx, room.ID, msg1.ID, user.ID, user.Username, testPinLimit)
+	if err != nil {
+		t.Fatalf("Failed to pin message: %v", err)
+	}
+	if !pinned {
+		t.Error("Expected first pin to succeed")
+	}
+
+	// Pinning twice is a no-op
+	pinned, _, _ = messageStore.PinMessage(ctx, room.ID, msg1.ID, user.ID, user.Username, testPinLimit)
+	if pinned {
+		t.Error("Expected duplicate pin to report no change")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	_, _, _ = messageStore.PinMessage(ctx, room.ID, msg2.ID, user.ID, user.Username, testPinLimit)
+
+	pins, err := messageStore.GetPins(ctx, room.ID)
+	if err != nil {
+		t.Fatalf("Failed to get pins: %v", err)
+	}
+	if len(pins) != 2 {
+		t.Fatalf("Expected 2 pins, got %d", len(pins))
+	}
+	if pins[0].Message.ID != msg2.ID {
+		t.Errorf("Expected most recent pin first, got '%s'", pins[0].Message.Content)
+	}
+	if pins[0].PinnedBy != user.ID || pins[0].PinnedByUsername != user.Username {
+		t.Errorf("Unexpected pinner: %s (%s)", pins[0].PinnedByUsername, pins[0].PinnedBy)
+	}
+
+	unpinned, err := messageStore.UnpinMessage(ctx, room.ID, msg2.ID)
+	if err != nil {
+		t.Fatalf("Failed to unpin message: %v", err)
+	}
+	if !unpinned {
+		t.Error("Expected unpin to succeed")
+	}
+
+	count, _ := messageStore.CountPins(ctx, room.ID)
+	if count != 1 {
+		t.Errorf("Expected 1 pin, got %d", count)
+	}
+
+	// Concurrent pins can't push the room past the limit
+	var wg sync.WaitGroup
+	var added, full atomic.Int32
+	for i := 0; i < 10; i++ {
+		msg, _ := messageStore.Save(ctx, room.ID, user.ID, user.Username, "Candidate "+strconv.Itoa(i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pinned, isFull, err := messageStore.PinMessage(ctx, room.ID, msg.ID, user.ID, user.Username, 5)
+			if err != nil {
+				t.Errorf("Failed to pin message: %v", err)
+			}
+			if pinned {
+				added.Add(1)
+			}
+			if isFull {
+				full.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if added.Load() != 4 || full.Load() != 6 {
+		t.Errorf("Expected 4 pins added and 6 refused, got %d and %d", added.Load(), full.Load())
+	}
+	count, _ = messageStore.CountPins(ctx, room.ID)
+	if count != 5 {
+		t.Errorf("Expected 5 pins, got %d", count)
+	}
+
+	// Re-pinning a pinned message in a full room is still a no-op
+	pinned, isFull, _ := messageStore.PinMessage(ctx, room.ID, msg1.ID, user.ID, user.Username, 5)
+	if pinned || isFull {
+		t.Errorf("Expected no change and no limit error, got pinned=%v full=%v", pinned, isFull)
+	}
+}
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// QuarantinedMessage is a message held back by moderation for review
+type QuarantinedMessage struct {
+	ID             string
+	RoomID         string // Set for room messages
+	RecipientID    string // Set for direct messages
+	SenderID       string
+	SenderUsername string
+	Content        string
+	Reason         string   // Reason code of the filter that held the message
+	ThreadID       string   // Thread root a room message was posted into
+	ReplyTo        string   // Message a room message replies to
+	ClientMsgID    string   // Sender's idempotency key, reused when the message is released
+	AttachmentIDs  []string // Pending uploads sent with a room message
+	CreatedAt      time.Time
+}
+
+// quarantineColumns is the column list scanned by scanQuarantined
+const quarantineColumns = `id, COALESCE(room_id::text, ''), COALESCE(recipient_id::text, ''),
+	sender_id, sender_username, content, reason, COALESCE(thread_id::text, ''),
+	COALESCE(reply_to::text, ''), COALESCE(client_msg_id, ''), attachment_ids::text[], created_at`
+
+// scanQuarantined scans a row selected with quarantineColumns
+func scanQuarantined(row pgx.Row) (*QuarantinedMessage, error) {
+	var m QuarantinedMessage
+	err := row.Scan(&m.ID, &m.RoomID, &m.RecipientID, &m.SenderID, &m.SenderUsername, &m.Content, &m.Reason,
+		&m.ThreadID, &m.ReplyTo, &m.ClientMsgID, &m.AttachmentIDs, &m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Quarantine stores a held message
+func (s *MessageStore) Quarantine(ctx context.Context, m *QuarantinedMessage) (*QuarantinedMessage, error) {
+	ctx = withMethod(ctx, "MessageStore.Quarantine")
+	return scanQuarantined(s.pool.QueryRow(ctx, `
+		INSERT INTO quarantined_messages (room_id, recipient_id, sender_id, sender_username, content, reason,
+			thread_id, reply_to, client_msg_id, attachment_ids)
+		VALUES (NULLIF($1, '')::uuid, NULLIF($2, '')::uuid, $3, $4, $5, $6,
+			NULLIF($7, '')::uuid, NULLIF($8, '')::uuid, NULLIF($9, ''), COALESCE($10::uuid[], '{}'))
+		RETURNING `+quarantineColumns,
+		m.RoomID, m.RecipientID, m.SenderID, m.SenderUsername, m.Content, m.Reason,
+		m.ThreadID, m.ReplyTo, m.ClientMsgID, m.AttachmentIDs,
+	))
+}
+
+// GetQuarantined returns held messages, oldest first
+// An empty roomID returns held messages from every room and direct conversation
+func (s *MessageStore) GetQuarantined(ctx context.Context, roomID string, limit int) ([]*QuarantinedMessage, error) {
+	ctx = withMethod(ctx, "MessageStore.GetQuarantined")
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+quarantineColumns+`
+		FROM quarantined_messages
+		WHERE $1 = '' OR room_id = NULLIF($1, '')::uuid
+		ORDER BY created_at
+		LIMIT $2
+	`, roomID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*QuarantinedMessage
+	for rows.Next() {
+		m, err := scanQuarantined(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// TakeQuarantined hands a held message to handle and removes it from review
+// if handle succeeds. The message stays locked meanwhile, so it is released
+// or discarded at most once; if handle fails it stays held and its error is
+// returned.
+// Returns nil if no such message is held
+func (s *MessageStore) TakeQuarantined(ctx context.Context, id string, handle func(*QuarantinedMessage) error) (*QuarantinedMessage, error) {
+	ctx = withMethod(ctx, "MessageStore.TakeQuarantined")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	m, err := scanQuarantined(tx.QueryRow(ctx, `
+		SELECT `+quarantineColumns+` FROM quarantined_messages WHERE id = $1 FOR UPDATE
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := handle(m); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM quarantined_messages WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
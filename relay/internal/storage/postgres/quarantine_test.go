@@ -0,0 +1,128 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"haven/internal/blob"
+)
+
+func TestMessageStore_Quarantine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+	root, _ := messageStore.Save(ctx, room.ID, bob.ID, bob.Username, "any good links?")
+	upload, _ := messageStore.SaveAttachment(ctx, &Attachment{
+		ID: "11111111-1111-4111-8111-111111111111", UploaderID: alice.ID, RoomID: room.ID,
+		Filename: "shot.png", ContentType: "image/png", Size: 4,
+	}, testQuota)
+
+	held, err := messageStore.Quarantine(ctx, &QuarantinedMessage{
+		RoomID:         room.ID,
+		SenderID:       alice.ID,
+		SenderUsername: alice.Username,
+		Content:        "see https://example.com",
+		Reason:         "link",
+		ThreadID:       root.ID,
+		ReplyTo:        root.ID,
+		ClientMsgID:    "msg-1",
+		AttachmentIDs:  []string{upload.ID},
+	})
+	if err != nil {
+		t.Fatalf("Failed to quarantine room message: %v", err)
+	}
+	if held.ID == "" || held.RoomID != room.ID || held.RecipientID != "" {
+		t.Errorf("Unexpected quarantined room message: %+v", held)
+	}
+	if held.ThreadID != root.ID || held.ReplyTo != root.ID || held.ClientMsgID != "msg-1" ||
+		len(held.AttachmentIDs) != 1 || held.AttachmentIDs[0] != upload.ID {
+		t.Errorf("Expected the message options to be kept, got %+v", held)
+	}
+
+	if _, err := messageStore.Quarantine(ctx, &QuarantinedMessage{
+		RecipientID:    bob.ID,
+		SenderID:       alice.ID,
+		SenderUsername: alice.Username,
+		Content:        "buy now",
+		Reason:         "spam",
+	}); err != nil {
+		t.Fatalf("Failed to quarantine direct message: %v", err)
+	}
+
+	// Uploads of a held message outlive the pending timeout while it awaits review
+	blobs, err := blob.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+	_, _ = blobs.Put(ctx, upload.ID, strings.NewReader("shot"))
+	if count, _ := NewCleanup(testDB.Pool).DeadAttachments(ctx, blobs, 0); count != 0 {
+		t.Errorf("Expected a held message's upload to be kept, got %d deleted", count)
+	}
+
+	// A message must go to a room or a user, not both
+	if _, err := messageStore.Quarantine(ctx, &QuarantinedMessage{
+		RoomID:         room.ID,
+		RecipientID:    bob.ID,
+		SenderID:       alice.ID,
+		SenderUsername: alice.Username,
+		Content:        "x",
+		Reason:         "x",
+	}); err == nil {
+		t.Error("Expected message with room and recipient to be rejected")
+	}
+
+	all, err := messageStore.GetQuarantined(ctx, "", 10)
+	if err != nil {
+		t.Fatalf("Failed to get quarantined messages: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != held.ID {
+		t.Fatalf("Expected 2 held messages oldest first, got %d", len(all))
+	}
+
+	inRoom, _ := messageStore.GetQuarantined(ctx, room.ID, 10)
+	if len(inRoom) != 1 || inRoom[0].Reason != "link" {
+		t.Errorf("Expected 1 held message in room, got %d", len(inRoom))
+	}
+
+	// A failed release leaves the message held
+	failed := errors.New("release failed")
+	if _, err := messageStore.TakeQuarantined(ctx, held.ID, func(*QuarantinedMessage) error { return failed }); err != failed {
+		t.Errorf("Expected the release error, got %v", err)
+	}
+
+	// Taking a message off review hands it out once
+	keep := func(*QuarantinedMessage) error { return nil }
+	taken, err := messageStore.TakeQuarantined(ctx, held.ID, keep)
+	if err != nil || taken == nil || taken.ClientMsgID != "msg-1" {
+		t.Fatalf("Expected to take the held message, got %+v (err %v)", taken, err)
+	}
+	if again, err := messageStore.TakeQuarantined(ctx, held.ID, keep); again != nil || err != nil {
+		t.Errorf("Expected nothing left to take, got %+v (err %v)", again, err)
+	}
+
+	// Messages nobody reviewed expire
+	cleanup := NewCleanup(testDB.Pool)
+	if count, _ := cleanup.OldQuarantinedMessages(ctx, time.Hour); count != 0 {
+		t.Errorf("Expected fresh held messages to be kept, got %d deleted", count)
+	}
+	if count, _ := cleanup.OldQuarantinedMessages(ctx, 0); count != 1 {
+		t.Errorf("Expected 1 expired held message, got %d", count)
+	}
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+)
+
+// ReactionCount is the aggregated count of one emoji on a message
+type ReactionCount struct {
+	Emoji   string
+	Count   int
+	UserIDs []string // Users who reacted, in reaction order
+}
+
+// AddReaction records a user's emoji reaction on a message
+// Returns false if the user had already reacted with that emoji
+func (s *MessageStore) AddReaction(ctx context.Context, messageID, userID, emoji string) (bool, error) {
+	ctx = withMethod(ctx, "MessageStore.AddReaction")
+	result, err := s.pool.Exec(ctx, `
+		INSERT INTO message_reactions (message_id, user_id, emoji)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+	`, messageID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// RemoveReaction removes a user's emoji reaction from a message
+// Returns false if the reaction did not exist
+func (s *MessageStore) RemoveReaction(ctx context.Context, messageID, userID, emoji string) (bool, error) {
+	ctx = withMethod(ctx, "MessageStore.RemoveReaction")
+	result, err := s.pool.Exec(ctx, `
+		DELETE FROM message_reactions WHERE message_id = $1 AND user_id = $2 AND emoji = $3
+	`, messageID, userID, emoji)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// GetReactions returns aggregated reactions for the given messages, keyed by message ID
+// Emojis are ordered by when they were first used on each message
+func (s *MessageStore) GetReactions(ctx context.Context, messageIDs []string) (map[string][]*ReactionCount, error) {
+	ctx = withMethod(ctx, "MessageStore.GetReactions")
+	result := make(map[string][]*ReactionCount)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT message_id, emoji, COUNT(*), array_agg(user_id::text ORDER BY created_at)
+		FROM message_reactions
+		WHERE message_id = ANY($1::uuid[])
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)
+	`, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID string
+		var reaction ReactionCount
+		if err := rows.Scan(&messageID, &reaction.Emoji, &reaction.Count, &reaction.UserIDs); err != nil {
+			return nil, err
+		}
+		result[messageID] = append(result[messageID], &reaction)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,82 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+func TestMessageStore_Reactions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+	msg1, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "Message 1")
+	msg2, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "Message 2")
+
+	added, err := messageStore.AddReaction(ctx, msg1.ID, alice.ID, "👍")
+	if err != nil {
+		t.Fatalf("Failed to add reaction: %v", err)
+	}
+	if !added {
+		t.Error("Expected reaction to be added")
+	}
+
+	// Duplicate reaction is ignored
+	added, _ = messageStore.AddReaction(ctx, msg1.ID, alice.ID, "👍")
+	if added {
+		t.Error("Expected duplicate reaction to be ignored")
+	}
+
+	_, _ = messageStore.AddReaction(ctx, msg1.ID, bob.ID, "👍")
+	_, _ = messageStore.AddReaction(ctx, msg1.ID, bob.ID, "🎉")
+
+	reactions, err := messageStore.GetReactions(ctx, []string{msg1.ID, msg2.ID})
+	if err != nil {
+		t.Fatalf("Failed to get reactions: %v", err)
+	}
+	if len(reactions[msg2.ID]) != 0 {
+		t.Errorf("Expected no reactions on message 2, got %d", len(reactions[msg2.ID]))
+	}
+	counts := reactions[msg1.ID]
+	if len(counts) != 2 {
+		t.Fatalf("Expected 2 emojis on message 1, got %d", len(counts))
+	}
+	if counts[0].Emoji != "👍" || counts[0].Count != 2 || len(counts[0].UserIDs) != 2 {
+		t.Errorf("Unexpected first reaction: %+v", counts[0])
+	}
+	if counts[1].Emoji != "🎉" || counts[1].Count != 1 {
+		t.Errorf("Unexpected second reaction: %+v", counts[1])
+	}
+
+	removed, err := messageStore.RemoveReaction(ctx, msg1.ID, bob.ID, "🎉")
+	if err != nil {
+		t.Fatalf("Failed to remove reaction: %v", err)
+	}
+	if !removed {
+		t.Error("Expected reaction to be removed")
+	}
+	removed, _ = messageStore.RemoveReaction(ctx, msg1.ID, bob.ID, "🎉")
+	if removed {
+		t.Error("Expected removing a missing reaction to return false")
+	}
+
+	// Reactions are deleted with their message
+	_ = messageStore.Delete(ctx, msg1.ID)
+	reactions, _ = messageStore.GetReactions(ctx, []string{msg1.ID})
+	if len(reactions[msg1.ID]) != 0 {
+		t.Errorf("Expected reactions to cascade on message delete, got %d", len(reactions[msg1.ID]))
+	}
+}
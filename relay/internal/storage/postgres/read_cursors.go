@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ReadState is a member's read position and unread count in a room
+type ReadState struct {
+	RoomID            string
+	LastReadMessageID string // Empty if the member hasn't read anything yet
+	UnreadCount       int
+}
+
+// MarkRead moves a member's read cursor to the given message
+// The cursor only moves forward; returns false if the message is unknown,
+// belongs to another room, or is older than the current cursor
+func (s *MemberStore) MarkRead(ctx context.Context, roomID, userID, messageID string) (bool, error) {
+	ctx = withMethod(ctx, "MemberStore.MarkRead")
+	result, err := s.pool.Exec(ctx, `
+		INSERT INTO room_read_cursors (room_id, user_id, last_read_message_id, last_read_at)
+		SELECT room_id, $2, id, created_at FROM room_messages
+		WHERE id = $3 AND room_id = $1
+		ON CONFLICT (room_id, user_id) DO UPDATE
+		SET last_read_message_id = EXCLUDED.last_read_message_id,
+		    last_read_at = EXCLUDED.last_read_at,
+		    updated_at = NOW()
+		WHERE room_read_cursors.last_read_at < EXCLUDED.last_read_at
+	`, roomID, userID, messageID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// unreadStateQuery computes read state for a user's memberships
+// Messages count as unread if they were sent by someone else after the
+// member's cursor (or after they joined, if they have no cursor) and not deleted
+const unreadStateQuery = `
+	SELECT m.room_id, COALESCE(c.last_read_message_id::text, ''),
+		(SELECT COUNT(*) FROM room_messages rm
+		 WHERE rm.room_id = m.room_id
+		   AND rm.sender_id IS DISTINCT FROM m.user_id
+		   AND rm.deleted_at IS NULL
+		   AND rm.created_at > COALESCE(c.last_read_at, m.joined_at))
+	FROM room_members m
+	LEFT JOIN room_read_cursors c ON c.room_id = m.room_id AND c.user_id = m.user_id
+	WHERE m.user_id = $1`
+
+// GetReadState returns a member's read state in one room
+// Returns nil if the user is not a member of the room
+func (s *MemberStore) GetReadState(ctx context.Context, roomID, userID string) (*ReadState, error) {
+	ctx = withMethod(ctx, "MemberStore.GetReadState")
+	var state ReadState
+	err := s.pool.QueryRow(ctx, unreadStateQuery+` AND m.room_id = $2`, userID, roomID).Scan(
+		&state.RoomID, &state.LastReadMessageID, &state.UnreadCount,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// GetReadStates returns a user's read state in every room they belong to, keyed by room ID
+func (s *MemberStore) GetReadStates(ctx context.Context, userID string) (map[string]*ReadState, error) {
+	ctx = withMethod(ctx, "MemberStore.GetReadStates")
+	rows, err := s.pool.Query(ctx, unreadStateQuery, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make(map[string]*ReadState)
+	for rows.Next() {
+		var state ReadState
+		if err := rows.Scan(&state.RoomID, &state.LastReadMessageID, &state.UnreadCount); err != nil {
+			return nil, err
+		}
+		states[state.RoomID] = &state
+	}
+	return states, rows.Err()
+}
@@ -0,0 +1,85 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemberStore_ReadState(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+	_, _ = memberStore.Add(ctx, room.ID, alice.ID, alice.Username)
+	_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+	time.Sleep(10 * time.Millisecond)
+
+	msg1, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "Message 1")
+	time.Sleep(10 * time.Millisecond)
+	msg2, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "Message 2")
+	time.Sleep(10 * time.Millisecond)
+	_, _ = messageStore.Save(ctx, room.ID, bob.ID, bob.Username, "Own message")
+
+	// Without a cursor, everything from others since joining is unread
+	state, err := memberStore.GetReadState(ctx, room.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("Failed to get read state: %v", err)
+	}
+	if state.UnreadCount != 2 {
+		t.Errorf("Expected 2 unread, got %d", state.UnreadCount)
+	}
+	if state.LastReadMessageID != "" {
+		t.Errorf("Expected no read cursor, got '%s'", state.LastReadMessageID)
+	}
+
+	advanced, err := memberStore.MarkRead(ctx, room.ID, bob.ID, msg2.ID)
+	if err != nil {
+		t.Fatalf("Failed to mark read: %v", err)
+	}
+	if !advanced {
+		t.Error("Expected cursor to advance")
+	}
+
+	// Cursor never moves backwards
+	advanced, _ = memberStore.MarkRead(ctx, room.ID, bob.ID, msg1.ID)
+	if advanced {
+		t.Error("Expected cursor not to move backwards")
+	}
+
+	states, err := memberStore.GetReadStates(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("Failed to get read states: %v", err)
+	}
+	state = states[room.ID]
+	if state == nil {
+		t.Fatal("Expected read state for room")
+	}
+	if state.UnreadCount != 0 {
+		t.Errorf("Expected 0 unread, got %d", state.UnreadCount)
+	}
+	if state.LastReadMessageID != msg2.ID {
+		t.Errorf("Expected cursor at '%s', got '%s'", msg2.ID, state.LastReadMessageID)
+	}
+
+	// Non-members have no read state
+	carol, _ := userStore.Create(ctx, "carol", "fp3", "rc3")
+	state, _ = memberStore.GetReadState(ctx, room.ID, carol.ID)
+	if state != nil {
+		t.Error("Expected nil read state for non-member")
+	}
+}
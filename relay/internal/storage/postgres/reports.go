@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Report target types
+const (
+	ReportRoomMessage   = "room_message"
+	ReportDirectMessage = "direct_message"
+	ReportUser          = "user"
+)
+
+// Report statuses
+const (
+	ReportOpen     = "open"
+	ReportResolved = "resolved"
+)
+
+// Report is a user's complaint about a message or another user
+type Report struct {
+	ID                 string
+	ReporterID         string // Empty if the reporter has since been deleted
+	ReporterUsername   string
+	TargetType         string // ReportRoomMessage, ReportDirectMessage or ReportUser
+	RoomID             string // Set for room message reports
+	MessageID          string // Set for message reports
+	ReportedUserID     string // Empty if the reported user has since been deleted
+	ReportedUsername   string
+	Category           string
+	Details            string
+	Snapshot           string // Reported message content at the time of the report
+	Status             string
+	CreatedAt          time.Time
+	ResolvedBy         string // Empty while open, or if the resolver has since been deleted
+	ResolvedByUsername string
+	Resolution         string // Action taken: "dismiss", "delete", "mute" or "ban"
+	ResolutionNote     string
+	ResolvedAt         *time.Time // nil while open
+}
+
+// ReportFilter selects reports to list
+type ReportFilter struct {
+	RoomID string // Only reports about this room's messages (empty for all reports)
+	Status string // Only reports with this status (empty for any)
+	Limit  int
+}
+
+// reportColumns is the column list scanned by scanReport
+const reportColumns = `id, COALESCE(reporter_id::text, ''), reporter_username, target_type,
+	COALESCE(room_id::text, ''), COALESCE(message_id::text, ''), COALESCE(reported_user_id::text, ''),
+	reported_username, category, details, snapshot, status, created_at,
+	COALESCE(resolved_by::text, ''), COALESCE(resolved_by_username, ''), COALESCE(resolution, ''),
+	COALESCE(resolution_note, ''), resolved_at`
+
+// scanReport scans a row selected with reportColumns
+func scanReport(row pgx.Row) (*Report, error) {
+	var r Report
+	err := row.Scan(
+		&r.ID, &r.ReporterID, &r.ReporterUsername, &r.TargetType,
+		&r.RoomID, &r.MessageID, &r.ReportedUserID,
+		&r.ReportedUsername, &r.Category, &r.Details, &r.Snapshot, &r.Status, &r.CreatedAt,
+		&r.ResolvedBy, &r.ResolvedByUsername, &r.Resolution,
+		&r.ResolutionNote, &r.ResolvedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateReport stores a new open report
+func (s *MessageStore) CreateReport(ctx context.Context, r *Report) (*Report, error) {
+	ctx = withMethod(ctx, "MessageStore.CreateReport")
+	return scanReport(s.pool.QueryRow(ctx, `
+		INSERT INTO reports (reporter_id, reporter_username, target_type, room_id, message_id,
+			reported_user_id, reported_username, category, details, snapshot)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, NULLIF($6, '')::uuid, $7, $8, $9, $10)
+		RETURNING `+reportColumns,
+		r.ReporterID, r.ReporterUsername, r.TargetType, r.RoomID, r.MessageID,
+		r.ReportedUserID, r.ReportedUsername, r.Category, r.Details, r.Snapshot,
+	))
+}
+
+// GetReport retrieves a report by ID
+func (s *MessageStore) GetReport(ctx context.Context, id string) (*Report, error) {
+	ctx = withMethod(ctx, "MessageStore.GetReport")
+	r, err := scanReport(s.pool.QueryRow(ctx, `
+		SELECT `+reportColumns+` FROM reports WHERE id = $1
+	`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ListReports returns reports matching the filter, oldest first
+func (s *MessageStore) ListReports(ctx context.Context, f ReportFilter) ([]*Report, error) {
+	ctx = withMethod(ctx, "MessageStore.ListReports")
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+reportColumns+`
+		FROM reports
+		WHERE ($1 = '' OR room_id = NULLIF($1, '')::uuid)
+			AND ($2 = '' OR status = $2)
+		ORDER BY created_at
+		LIMIT $3
+	`, f.RoomID, f.Status, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*Report
+	for rows.Next() {
+		r, err := scanReport(rows)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
+
+// ResolveReport closes an open report, recording who resolved it and how,
+// and calls apply to carry out the resolution. The report stays claimed
+// while apply runs, so it is acted on at most once; if apply fails the
+// report stays open and apply's error is returned.
+// Returns nil if the report doesn't exist or was already resolved
+func (s *MessageStore) ResolveReport(ctx context.Context, id, resolverID, resolverUsername, resolution, note string, apply func(*Report) error) (*Report, error) {
+	ctx = withMethod(ctx, "MessageStore.ResolveReport")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	r, err := scanReport(tx.QueryRow(ctx, `
+		UPDATE reports
+		SET status = 'resolved', resolved_by = $2, resolved_by_username = $3,
+			resolution = $4, resolution_note = $5, resolved_at = NOW()
+		WHERE id = $1 AND status = 'open'
+		RETURNING `+reportColumns,
+		id, resolverID, resolverUsername, resolution, note,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := apply(r); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
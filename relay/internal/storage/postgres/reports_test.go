@@ -0,0 +1,168 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMessageStore_Reports(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	mod, _ := userStore.Create(ctx, "mod", "fp3", "rc3")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+	msg, _ := messageStore.Save(ctx, room.ID, bob.ID, bob.Username, "buy now")
+
+	report, err := messageStore.CreateReport(ctx, &Report{
+		ReporterID:       alice.ID,
+		ReporterUsername: alice.Username,
+		TargetType:       ReportRoomMessage,
+		RoomID:           room.ID,
+		MessageID:        msg.ID,
+		ReportedUserID:   bob.ID,
+		ReportedUsername: bob.Username,
+		Category:         "spam",
+		Details:          "again",
+		Snapshot:         msg.Content,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create report: %v", err)
+	}
+	if report.Status != ReportOpen || report.Snapshot != "buy now" || report.ResolvedAt != nil {
+		t.Errorf("Unexpected new report: %+v", report)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if _, err := messageStore.CreateReport(ctx, &Report{
+		ReporterID:       alice.ID,
+		ReporterUsername: alice.Username,
+		TargetType:       ReportUser,
+		ReportedUserID:   bob.ID,
+		ReportedUsername: bob.Username,
+		Category:         "harassment",
+	}); err != nil {
+		t.Fatalf("Failed to create user report: %v", err)
+	}
+
+	all, err := messageStore.ListReports(ctx, ReportFilter{Status: ReportOpen, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to list reports: %v", err)
+	}
+	if len(all) != 2 || all[0].ID != report.ID {
+		t.Fatalf("Expected 2 open reports oldest first, got %d", len(all))
+	}
+	inRoom, _ := messageStore.ListReports(ctx, ReportFilter{RoomID: room.ID, Limit: 10})
+	if len(inRoom) != 1 {
+		t.Errorf("Expected 1 report in room, got %d", len(inRoom))
+	}
+
+	// A resolution whose action fails leaves the report open
+	failed := errors.New("action failed")
+	_, err = messageStore.ResolveReport(ctx, report.ID, mod.ID, mod.Username, "delete", "", func(*Report) error { return failed })
+	if err != failed {
+		t.Errorf("Expected the action's error, got %v", err)
+	}
+
+	applied := 0
+	apply := func(*Report) error { applied++; return nil }
+	resolved, err := messageStore.ResolveReport(ctx, report.ID, mod.ID, mod.Username, "delete", "spam bot", apply)
+	if err != nil {
+		t.Fatalf("Failed to resolve report: %v", err)
+	}
+	if resolved.Status != ReportResolved || resolved.ResolvedBy != mod.ID || resolved.Resolution != "delete" ||
+		resolved.ResolutionNote != "spam bot" || resolved.ResolvedAt == nil {
+		t.Errorf("Unexpected resolved report: %+v", resolved)
+	}
+
+	// A report is resolved, and its action applied, once
+	if again, _ := messageStore.ResolveReport(ctx, report.ID, mod.ID, mod.Username, "dismiss", "", apply); again != nil {
+		t.Error("Expected second resolution to be refused")
+	}
+	if applied != 1 {
+		t.Errorf("Expected the action to be applied once, got %d", applied)
+	}
+	if open, _ := messageStore.ListReports(ctx, ReportFilter{Status: ReportOpen, Limit: 10}); len(open) != 1 {
+		t.Errorf("Expected 1 open report, got %d", len(open))
+	}
+
+	// The resolution outlives the resolver's account
+	_ = userStore.Delete(ctx, mod.ID)
+	got, _ := messageStore.GetReport(ctx, report.ID)
+	if got == nil || got.ResolvedBy != "" || got.ResolvedByUsername != "mod" {
+		t.Errorf("Expected resolution to keep the resolver's username, got %+v", got)
+	}
+}
+
+func TestUserStore_Sanctions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+
+	expired := time.Now().Add(-time.Hour)
+	later := time.Now().Add(time.Hour)
+	for _, sn := range []*Sanction{
+		{UserID: bob.ID, RoomID: room.ID, Kind: SanctionMute, CreatedBy: alice.ID, ExpiresAt: &expired},
+		{UserID: bob.ID, Kind: SanctionBan, CreatedBy: alice.ID},
+	} {
+		if _, err := userStore.AddSanction(ctx, sn); err != nil {
+			t.Fatalf("Failed to add sanction: %v", err)
+		}
+	}
+
+	active, err := userStore.GetActiveSanctions(ctx)
+	if err != nil {
+		t.Fatalf("Failed to get sanctions: %v", err)
+	}
+	if len(active) != 1 || active[0].Kind != SanctionBan || active[0].RoomID != "" {
+		t.Fatalf("Expected only the server ban to be active, got %+v", active)
+	}
+
+	// Sanctioning again replaces the old sanction
+	if _, err := userStore.AddSanction(ctx, &Sanction{UserID: bob.ID, RoomID: room.ID, Kind: SanctionMute, ExpiresAt: &later}); err != nil {
+		t.Fatalf("Failed to replace sanction: %v", err)
+	}
+	if active, _ := userStore.GetActiveSanctions(ctx); len(active) != 2 {
+		t.Errorf("Expected 2 active sanctions, got %d", len(active))
+	}
+
+	removed, err := userStore.RemoveSanction(ctx, bob.ID, "", SanctionBan)
+	if err != nil {
+		t.Fatalf("Failed to remove sanction: %v", err)
+	}
+	if !removed {
+		t.Error("Expected server ban to be removed")
+	}
+	if removed, _ := userStore.RemoveSanction(ctx, bob.ID, "", SanctionBan); removed {
+		t.Error("Expected second removal to report no change")
+	}
+	active, _ = userStore.GetActiveSanctions(ctx)
+	if len(active) != 1 || active[0].RoomID != room.ID {
+		t.Errorf("Expected only the room mute to remain, got %+v", active)
+	}
+}
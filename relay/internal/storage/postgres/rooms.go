@@ -13,11 +13,31 @@ import (
 type Room struct {
 	ID              string
 	Name            string
-	CreatorID       string
+	CreatorID       string // Empty if the creator has since been deleted
 	CreatorUsername string
 	IsPublic        bool
+	Topic           string
+	Description     string
 	CreatedAt       time.Time
 	LastActivityAt  time.Time
+	UpdatedAt       time.Time // Last metadata change
+}
+
+// roomColumns is the column list scanned by scanRoom
+const roomColumns = `id, name, COALESCE(creator_id::text, ''), creator_username, is_public, topic, description,
+	created_at, last_activity_at, updated_at`
+
+// scanRoom scans a row selected with roomColumns
+func scanRoom(row pgx.Row) (*Room, error) {
+	var room Room
+	err := row.Scan(
+		&room.ID, &room.Name, &room.CreatorID, &room.CreatorUsername, &room.IsPublic,
+		&room.Topic, &room.Description, &room.CreatedAt, &room.LastActivityAt, &room.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
 }
 
 // RoomStore handles room persistence in PostgreSQL
@@ -32,44 +52,35 @@ func NewRoomStore(pool *pgxpool.Pool) *RoomStore {
 
 // Create creates a new room and returns it with the generated ID
 func (s *RoomStore) Create(ctx context.Context, name, creatorID, creatorUsername string, isPublic bool) (*Room, error) {
-	var room Room
-	err := s.pool.QueryRow(ctx, `
+	ctx = withMethod(ctx, "RoomStore.Create")
+	return scanRoom(s.pool.QueryRow(ctx, `
 		INSERT INTO rooms (name, creator_id, creator_username, is_public)
 		VALUES ($1, $2, $3, $4)
-		RETURNING id, name, creator_id, creator_username, is_public, created_at, last_activity_at
-	`, name, creatorID, creatorUsername, isPublic).Scan(
-		&room.ID, &room.Name, &room.CreatorID, &room.CreatorUsername,
-		&room.IsPublic, &room.CreatedAt, &room.LastActivityAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	return &room, nil
+		RETURNING `+roomColumns,
+		name, creatorID, creatorUsername, isPublic,
+	))
 }
 
 // GetByID retrieves a room by its ID
 func (s *RoomStore) GetByID(ctx context.Context, id string) (*Room, error) {
-	var room Room
-	err := s.pool.QueryRow(ctx, `
-		SELECT id, name, creator_id, creator_username, is_public, created_at, last_activity_at
-		FROM rooms WHERE id = $1
-	`, id).Scan(
-		&room.ID, &room.Name, &room.CreatorID, &room.CreatorUsername,
-		&room.IsPublic, &room.CreatedAt, &room.LastActivityAt,
-	)
+	ctx = withMethod(ctx, "RoomStore.GetByID")
+	room, err := scanRoom(s.pool.QueryRow(ctx, `
+		SELECT `+roomColumns+` FROM rooms WHERE id = $1
+	`, id))
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &room, nil
+	return room, nil
 }
 
 // GetAll returns all rooms
 func (s *RoomStore) GetAll(ctx context.Context) ([]*Room, error) {
+	ctx = withMethod(ctx, "RoomStore.GetAll")
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, creator_id, creator_username, is_public, created_at, last_activity_at
+		SELECT `+roomColumns+`
 		FROM rooms ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -79,23 +90,20 @@ func (s *RoomStore) GetAll(ctx context.Context) ([]*Room, error) {
 
 	var rooms []*Room
 	for rows.Next() {
-		var room Room
-		err := rows.Scan(
-			&room.ID, &room.Name, &room.CreatorID, &room.CreatorUsername,
-			&room.IsPublic, &room.CreatedAt, &room.LastActivityAt,
-		)
+		room, err := scanRoom(rows)
 		if err != nil {
 			return nil, err
 		}
-		rooms = append(rooms, &room)
+		rooms = append(rooms, room)
 	}
 	return rooms, rows.Err()
 }
 
 // GetPublic returns all public rooms
 func (s *RoomStore) GetPublic(ctx context.Context) ([]*Room, error) {
+	ctx = withMethod(ctx, "RoomStore.GetPublic")
 	rows, err := s.pool.Query(ctx, `
-		SELECT id, name, creator_id, creator_username, is_public, created_at, last_activity_at
+		SELECT `+roomColumns+`
 		FROM rooms WHERE is_public = true ORDER BY created_at DESC
 	`)
 	if err != nil {
@@ -105,35 +113,53 @@ func (s *RoomStore) GetPublic(ctx context.Context) ([]*Room, error) {
 
 	var rooms []*Room
 	for rows.Next() {
-		var room Room
-		err := rows.Scan(
-			&room.ID, &room.Name, &room.CreatorID, &room.CreatorUsername,
-			&room.IsPublic, &room.CreatedAt, &room.LastActivityAt,
-		)
+		room, err := scanRoom(rows)
 		if err != nil {
 			return nil, err
 		}
-		rooms = append(rooms, &room)
+		rooms = append(rooms, room)
 	}
 	return rooms, rows.Err()
 }
 
 // UpdateActivity updates the last activity timestamp for a room
 func (s *RoomStore) UpdateActivity(ctx context.Context, id string) error {
+	ctx = withMethod(ctx, "RoomStore.UpdateActivity")
 	_, err := s.pool.Exec(ctx, `
 		UPDATE rooms SET last_activity_at = NOW() WHERE id = $1
 	`, id)
 	return err
 }
 
+// UpdateMetadata replaces a room's name, topic and description
+// Returns nil if the room doesn't exist
+func (s *RoomStore) UpdateMetadata(ctx context.Context, id, name, topic, description string) (*Room, error) {
+	ctx = withMethod(ctx, "RoomStore.UpdateMetadata")
+	room, err := scanRoom(s.pool.QueryRow(ctx, `
+		UPDATE rooms SET name = $2, topic = $3, description = $4, updated_at = NOW()
+		WHERE id = $1
+		RETURNING `+roomColumns,
+		id, name, topic, description,
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return room, nil
+}
+
 // Delete removes a room by ID
 func (s *RoomStore) Delete(ctx context.Context, id string) error {
+	ctx = withMethod(ctx, "RoomStore.Delete")
 	_, err := s.pool.Exec(ctx, `DELETE FROM rooms WHERE id = $1`, id)
 	return err
 }
 
 // Count returns the total number of rooms
 func (s *RoomStore) Count(ctx context.Context) (int, error) {
+	ctx = withMethod(ctx, "RoomStore.Count")
 	var count int
 	err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM rooms`).Scan(&count)
 	return count, err
@@ -142,6 +168,7 @@ func (s *RoomStore) Count(ctx context.Context) (int, error) {
 // CleanupInactive removes rooms that have been inactive for longer than the threshold
 // Returns the number of rooms deleted
 func (s *RoomStore) CleanupInactive(ctx context.Context, threshold time.Duration) (int, error) {
+	ctx = withMethod(ctx, "RoomStore.CleanupInactive")
 	cutoff := time.Now().Add(-threshold)
 	result, err := s.pool.Exec(ctx, `
 		DELETE FROM rooms WHERE last_activity_at < $1
@@ -184,6 +184,47 @@ func TestRoomStore_UpdateActivity(t *testing.T) {
 	}
 }
 
+func TestRoomStore_UpdateMetadata(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	ctx := context.Background()
+
+	user, _ := userStore.Create(ctx, "creator", "fp", "rc")
+	created, _ := roomStore.Create(ctx, "Test Room", user.ID, user.Username, true)
+	if created.Topic != "" || created.Description != "" {
+		t.Errorf("Expected empty metadata on a new room, got topic=%q description=%q", created.Topic, created.Description)
+	}
+
+	updated, err := roomStore.UpdateMetadata(ctx, created.ID, "Renamed", "Weekly sync", "Notes\nand agenda")
+	if err != nil {
+		t.Fatalf("Failed to update room: %v", err)
+	}
+	if updated.Name != "Renamed" || updated.Topic != "Weekly sync" || updated.Description != "Notes\nand agenda" {
+		t.Errorf("Unexpected metadata: %+v", updated)
+	}
+
+	room, _ := roomStore.GetByID(ctx, created.ID)
+	if room.Name != "Renamed" || room.Topic != "Weekly sync" {
+		t.Errorf("Expected update to persist, got name=%q topic=%q", room.Name, room.Topic)
+	}
+
+	// Unknown room
+	updated, err = roomStore.UpdateMetadata(ctx, "00000000-0000-0000-0000-000000000000", "X", "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated != nil {
+		t.Error("Expected nil for non-existent room")
+	}
+}
+
 func TestRoomStore_Delete(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping integration test in short mode")
@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"time"
+)
+
+// Sanction kinds
+const (
+	SanctionMute = "mute" // May not send messages
+	SanctionBan  = "ban"  // May not join the room, or log in if server-wide
+)
+
+// Sanction is a mute or ban of a user, in one room or server-wide
+type Sanction struct {
+	UserID    string
+	RoomID    string // Empty for server-wide sanctions
+	Kind      string // SanctionMute or SanctionBan
+	Reason    string
+	CreatedBy string // Empty if the issuer has since been deleted
+	CreatedAt time.Time
+	ExpiresAt *time.Time // nil for permanent sanctions
+}
+
+// sanctionColumns is the column list scanned by AddSanction and GetActiveSanctions
+const sanctionColumns = `user_id, COALESCE(room_id::text, ''), kind, reason,
+	COALESCE(created_by::text, ''), created_at, expires_at`
+
+// AddSanction mutes or bans a user, replacing any sanction of the same kind and scope
+func (s *UserStore) AddSanction(ctx context.Context, sn *Sanction) (*Sanction, error) {
+	ctx = withMethod(ctx, "UserStore.AddSanction")
+	var saved Sanction
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO user_sanctions (user_id, room_id, kind, reason, created_by, expires_at)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, NULLIF($5, '')::uuid, $6)
+		ON CONFLICT (user_id, kind, COALESCE(room_id, '00000000-0000-0000-0000-000000000000'::uuid))
+		DO UPDATE SET reason = EXCLUDED.reason, created_by = EXCLUDED.created_by,
+			created_at = NOW(), expires_at = EXCLUDED.expires_at
+		RETURNING `+sanctionColumns,
+		sn.UserID, sn.RoomID, sn.Kind, sn.Reason, sn.CreatedBy, sn.ExpiresAt,
+	).Scan(&saved.UserID, &saved.RoomID, &saved.Kind, &saved.Reason, &saved.CreatedBy, &saved.CreatedAt, &saved.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// RemoveSanction lifts a user's sanction of the given kind and scope
+// Returns false if there was none
+func (s *UserStore) RemoveSanction(ctx context.Context, userID, roomID, kind string) (bool, error) {
+	ctx = withMethod(ctx, "UserStore.RemoveSanction")
+	tag, err := s.pool.Exec(ctx, `
+		DELETE FROM user_sanctions
+		WHERE user_id = $1 AND kind = $3
+			AND COALESCE(room_id, '00000000-0000-0000-0000-000000000000'::uuid)
+				= COALESCE(NULLIF($2, '')::uuid, '00000000-0000-0000-0000-000000000000'::uuid)
+	`, userID, roomID, kind)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetActiveSanctions returns every sanction that hasn't expired
+func (s *UserStore) GetActiveSanctions(ctx context.Context) ([]*Sanction, error) {
+	ctx = withMethod(ctx, "UserStore.GetActiveSanctions")
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+sanctionColumns+`
+		FROM user_sanctions
+		WHERE expires_at IS NULL OR expires_at > NOW()
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sanctions []*Sanction
+	for rows.Next() {
+		var sn Sanction
+		if err := rows.Scan(&sn.UserID, &sn.RoomID, &sn.Kind, &sn.Reason, &sn.CreatedBy, &sn.CreatedAt, &sn.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sanctions = append(sanctions, &sn)
+	}
+	return sanctions, rows.Err()
+}
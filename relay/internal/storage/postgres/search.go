@@ -0,0 +1,89 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// searchHeadlineOptions configures ts_headline for search snippets; matched
+// terms are wrapped in <mark></mark>
+const searchHeadlineOptions = `StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2`
+
+// escapedContent is the message content with HTML special characters escaped,
+// so the only markup in a snippet is the <mark> tags ts_headline adds
+const escapedContent = `replace(replace(replace(replace(replace(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+
+// SearchQuery describes a full-text message search
+// Zero-valued filters are not applied
+type SearchQuery struct {
+	Text           string    // Search terms in web search syntax ("quoted phrases", -excluded, or)
+	RoomID         string    // Only search this room
+	SenderUsername string    // Only messages sent by this user
+	After          time.Time // Only messages created after this time
+	Before         time.Time // Only messages created before this time
+	Limit          int
+	Offset         int
+}
+
+// SearchResult is a message matching a search, with its relevance and a
+// snippet of the content with matched terms highlighted
+type SearchResult struct {
+	Message *Message
+	Rank    float64
+	Snippet string // HTML-escaped, with matches in <mark></mark>; safe to render as HTML
+}
+
+// Search finds messages matching a full-text query in the rooms a user belongs to
+// Results are ordered by relevance, then newest first; deleted messages are skipped
+func (s *MessageStore) Search(ctx context.Context, userID string, q SearchQuery) ([]*SearchResult, error) {
+	ctx = withMethod(ctx, "MessageStore.Search")
+	args := []any{userID, q.Text}
+	filter := ``
+	addFilter := func(clause string, arg any) {
+		args = append(args, arg)
+		filter += ` AND ` + clause + ` $` + strconv.Itoa(len(args))
+	}
+	if q.RoomID != "" {
+		addFilter(`room_id =`, q.RoomID)
+	}
+	if q.SenderUsername != "" {
+		addFilter(`sender_username =`, q.SenderUsername)
+	}
+	if !q.After.IsZero() {
+		addFilter(`created_at >`, q.After)
+	}
+	if !q.Before.IsZero() {
+		addFilter(`created_at <`, q.Before)
+	}
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+messageColumns+`,
+			ts_rank(search_vector, query)::float8 AS rank,
+			ts_headline('english', `+escapedContent+`, query, '`+searchHeadlineOptions+`')
+		FROM room_messages, websearch_to_tsquery('english', $2) query
+		WHERE search_vector @@ query
+			AND room_id IN (SELECT room_id FROM room_members WHERE user_id = $1)
+			AND deleted_at IS NULL`+filter+`
+		ORDER BY rank DESC, created_at DESC
+		LIMIT $`+strconv.Itoa(len(args)-1)+` OFFSET $`+strconv.Itoa(len(args)),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		var msg Message
+		var result SearchResult
+		fields := append(messageFields(&msg), &result.Rank, &result.Snippet)
+		if err := rows.Scan(fields...); err != nil {
+			return nil, err
+		}
+		result.Message = &msg
+		results = append(results, &result)
+	}
+	return results, rows.Err()
+}
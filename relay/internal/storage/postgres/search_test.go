@@ -0,0 +1,94 @@
+//go:build integration
+
+package postgres
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageStore_Search(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	userStore := NewUserStore(testDB.Pool)
+	roomStore := NewRoomStore(testDB.Pool)
+	memberStore := NewMemberStore(testDB.Pool)
+	messageStore := NewMessageStore(testDB.Pool)
+	ctx := context.Background()
+
+	alice, _ := userStore.Create(ctx, "alice", "fp1", "rc1")
+	bob, _ := userStore.Create(ctx, "bob", "fp2", "rc2")
+	room, _ := roomStore.Create(ctx, "Test Room", alice.ID, alice.Username, true)
+	other, _ := roomStore.Create(ctx, "Other Room", alice.ID, alice.Username, true)
+	_, _ = memberStore.Add(ctx, room.ID, bob.ID, bob.Username)
+
+	deploy, _ := messageStore.Save(ctx, room.ID, alice.ID, alice.Username, "The deployment failed again")
+	time.Sleep(10 * time.Millisecond)
+	mid := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	reply, _ := messageStore.Save(ctx, room.ID, bob.ID, bob.Username, "Deploying a fix for the failed deploy now")
+	_, _ = messageStore.Save(ctx, room.ID, bob.ID, bob.Username, "Lunch anyone?")
+	_, _ = messageStore.Save(ctx, other.ID, alice.ID, alice.Username, "deploy notes for the other room")
+
+	// Stemming matches deploy/deploying/deployment; other rooms are excluded
+	results, err := messageStore.Search(ctx, bob.ID, SearchQuery{Text: "deploy", Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Message.ID != reply.ID {
+		t.Errorf("Expected the message with more matches first, got '%s'", results[0].Message.Content)
+	}
+	if !strings.Contains(results[0].Snippet, "<mark>") || results[0].Rank <= 0 {
+		t.Errorf("Expected a highlighted, ranked result, got %+v", results[0])
+	}
+
+	// Filters
+	results, _ = messageStore.Search(ctx, bob.ID, SearchQuery{Text: "deploy", SenderUsername: "alice", Limit: 10})
+	if len(results) != 1 || results[0].Message.ID != deploy.ID {
+		t.Errorf("Expected only alice's message, got %d results", len(results))
+	}
+	results, _ = messageStore.Search(ctx, bob.ID, SearchQuery{Text: "deploy", After: mid, Limit: 10})
+	if len(results) != 1 || results[0].Message.ID != reply.ID {
+		t.Errorf("Expected only the later message, got %d results", len(results))
+	}
+	results, _ = messageStore.Search(ctx, bob.ID, SearchQuery{Text: "deploy", Before: mid, Limit: 10})
+	if len(results) != 1 || results[0].Message.ID != deploy.ID {
+		t.Errorf("Expected only the earlier message, got %d results", len(results))
+	}
+	results, _ = messageStore.Search(ctx, alice.ID, SearchQuery{Text: "deploy", RoomID: other.ID, Limit: 10})
+	if len(results) != 1 || results[0].Message.RoomID != other.ID {
+		t.Errorf("Expected only the other room's message, got %d results", len(results))
+	}
+	results, _ = messageStore.Search(ctx, bob.ID, SearchQuery{Text: "deploy", Limit: 1, Offset: 1})
+	if len(results) != 1 || results[0].Message.ID != deploy.ID {
+		t.Errorf("Expected the second result on the second page, got %d results", len(results))
+	}
+
+	// Markup in the content is escaped; only the highlight tags are HTML
+	_, _ = messageStore.Save(ctx, room.ID, bob.ID, bob.Username, `<script>alert("xss")</script> rollback & retry`)
+	results, _ = messageStore.Search(ctx, bob.ID, SearchQuery{Text: "rollback", Limit: 10})
+	if len(results) != 1 {
+		t.Fatalf("Expected 1 rollback result, got %d", len(results))
+	}
+	if snippet := results[0].Snippet; strings.Contains(snippet, "<script>") ||
+		!strings.Contains(snippet, "&lt;script&gt;") || !strings.Contains(snippet, "<mark>rollback</mark>") {
+		t.Errorf("Expected an escaped snippet with highlights, got '%s'", snippet)
+	}
+
+	// Deleted messages drop out
+	_, _ = messageStore.Redact(ctx, reply.ID, bob.ID)
+	results, _ = messageStore.Search(ctx, bob.ID, SearchQuery{Text: "deploy", Limit: 10})
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result after delete, got %d", len(results))
+	}
+}
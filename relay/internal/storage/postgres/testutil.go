@@ -157,7 +157,7 @@ func (db *TestDB) Close() {
 // TruncateAll removes all data from all tables (for test isolation)
 func (db *TestDB) TruncateAll(ctx context.Context) error {
 	_, err := db.Pool.Exec(ctx, `
-		TRUNCATE room_messages, room_members, rooms, users CASCADE
+		TRUNCATE room_member_events, direct_messages, room_messages, room_members, rooms, users CASCADE
 	`)
 	return err
 }
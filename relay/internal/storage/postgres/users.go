@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -31,6 +32,7 @@ func NewUserStore(pool *pgxpool.Pool) *UserStore {
 
 // Create creates a new user and returns it with the generated ID
 func (s *UserStore) Create(ctx context.Context, username, fingerprintHash, recoveryCodeHash string) (*User, error) {
+	ctx = withMethod(ctx, "UserStore.Create")
 	var user User
 	err := s.pool.QueryRow(ctx, `
 		INSERT INTO users (username, fingerprint_hash, recovery_code_hash)
@@ -48,6 +50,7 @@ func (s *UserStore) Create(ctx context.Context, username, fingerprintHash, recov
 
 // GetByID retrieves a user by their ID
 func (s *UserStore) GetByID(ctx context.Context, id string) (*User, error) {
+	ctx = withMethod(ctx, "UserStore.GetByID")
 	var user User
 	err := s.pool.QueryRow(ctx, `
 		SELECT id, username, fingerprint_hash, recovery_code_hash, created_at, last_seen_at
@@ -67,6 +70,7 @@ func (s *UserStore) GetByID(ctx context.Context, id string) (*User, error) {
 
 // GetByUsername retrieves a user by their username
 func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
+	ctx = withMethod(ctx, "UserStore.GetByUsername")
 	var user User
 	err := s.pool.QueryRow(ctx, `
 		SELECT id, username, fingerprint_hash, recovery_code_hash, created_at, last_seen_at
@@ -86,6 +90,7 @@ func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User,
 
 // GetByFingerprint finds a user by fingerprint hash
 func (s *UserStore) GetByFingerprint(ctx context.Context, fingerprintHash string) (*User, error) {
+	ctx = withMethod(ctx, "UserStore.GetByFingerprint")
 	var user User
 	err := s.pool.QueryRow(ctx, `
 		SELECT id, username, fingerprint_hash, recovery_code_hash, created_at, last_seen_at
@@ -105,6 +110,7 @@ func (s *UserStore) GetByFingerprint(ctx context.Context, fingerprintHash string
 
 // GetByRecoveryCode finds a user by recovery code hash
 func (s *UserStore) GetByRecoveryCode(ctx context.Context, recoveryCodeHash string) (*User, error) {
+	ctx = withMethod(ctx, "UserStore.GetByRecoveryCode")
 	var user User
 	err := s.pool.QueryRow(ctx, `
 		SELECT id, username, fingerprint_hash, recovery_code_hash, created_at, last_seen_at
@@ -122,8 +128,40 @@ func (s *UserStore) GetByRecoveryCode(ctx context.Context, recoveryCodeHash stri
 	return &user, nil
 }
 
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Search returns users whose username contains query, ignoring case, in
+// alphabetical order. An empty query matches every user.
+func (s *UserStore) Search(ctx context.Context, query string, limit int) ([]*User, error) {
+	ctx = withMethod(ctx, "UserStore.Search")
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, username, fingerprint_hash, recovery_code_hash, created_at, last_seen_at
+		FROM users WHERE username ILIKE '%' || $1 || '%'
+		ORDER BY username LIMIT $2
+	`, likeEscaper.Replace(query), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(
+			&user.ID, &user.Username, &user.FingerprintHash,
+			&user.RecoveryCodeHash, &user.CreatedAt, &user.LastSeenAt,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+	return users, rows.Err()
+}
+
 // UpdateLastSeen updates the last seen timestamp for a user
 func (s *UserStore) UpdateLastSeen(ctx context.Context, id string) error {
+	ctx = withMethod(ctx, "UserStore.UpdateLastSeen")
 	_, err := s.pool.Exec(ctx, `
 		UPDATE users SET last_seen_at = NOW() WHERE id = $1
 	`, id)
@@ -132,6 +170,7 @@ func (s *UserStore) UpdateLastSeen(ctx context.Context, id string) error {
 
 // UpdateFingerprint updates the fingerprint hash for a user
 func (s *UserStore) UpdateFingerprint(ctx context.Context, id, fingerprintHash string) error {
+	ctx = withMethod(ctx, "UserStore.UpdateFingerprint")
 	_, err := s.pool.Exec(ctx, `
 		UPDATE users SET fingerprint_hash = $1, last_seen_at = NOW() WHERE id = $2
 	`, fingerprintHash, id)
@@ -140,13 +179,27 @@ func (s *UserStore) UpdateFingerprint(ctx context.Context, id, fingerprintHash s
 
 // Count returns the total number of users
 func (s *UserStore) Count(ctx context.Context) (int, error) {
+	ctx = withMethod(ctx, "UserStore.Count")
 	var count int
 	err := s.pool.QueryRow(ctx, `SELECT COUNT(*) FROM users`).Scan(&count)
 	return count, err
 }
 
 // Delete removes a user by ID
+// Rooms the user owns are handed to their longest-standing remaining member
 func (s *UserStore) Delete(ctx context.Context, id string) error {
-	_, err := s.pool.Exec(ctx, `DELETE FROM users WHERE id = $1`, id)
-	return err
+	ctx = withMethod(ctx, "UserStore.Delete")
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, promoteSuccessorsQuery(`SELECT $1::uuid`), id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
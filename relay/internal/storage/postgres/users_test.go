@@ -317,3 +317,40 @@ func TestUserStore_Count(t *testing.T) {
 		t.Errorf("Expected 2 users, got %d", count)
 	}
 }
+
+func TestUserStore_Search(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	testDB := SetupTestDB(t)
+	defer testDB.Close()
+
+	store := NewUserStore(testDB.Pool)
+	ctx := context.Background()
+
+	for i, name := range []string{"bob", "Alice", "alicia", "al_x", "alpx"} {
+		if _, err := store.Create(ctx, name, "fp"+name, "rc"+string(rune('a'+i))); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	users, err := store.Search(ctx, "ALI", 10)
+	if err != nil {
+		t.Fatalf("Failed to search users: %v", err)
+	}
+	if len(users) != 2 || users[0].Username != "Alice" || users[1].Username != "alicia" {
+		t.Errorf("Expected Alice and alicia, got %d users", len(users))
+	}
+
+	// Wildcards in the query match literally
+	users, _ = store.Search(ctx, "l_", 10)
+	if len(users) != 1 || users[0].Username != "al_x" {
+		t.Errorf("Expected only al_x, got %d users", len(users))
+	}
+
+	users, _ = store.Search(ctx, "", 3)
+	if len(users) != 3 {
+		t.Errorf("Expected limit of 3 users, got %d", len(users))
+	}
+}
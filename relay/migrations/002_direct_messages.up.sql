@@ -0,0 +1,16 @@
+-- Direct messages (persisted so offline recipients receive them on next login)
+CREATE TABLE direct_messages (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sender_username VARCHAR(20) NOT NULL,
+    recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_username VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMPTZ
+);
+CREATE INDEX idx_dms_conversation ON direct_messages(
+    LEAST(sender_id, recipient_id), GREATEST(sender_id, recipient_id), created_at DESC
+);
+CREATE INDEX idx_dms_undelivered ON direct_messages(recipient_id, created_at) WHERE delivered_at IS NULL;
+CREATE INDEX idx_dms_created ON direct_messages(created_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS room_message_edits;
+ALTER TABLE room_messages DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE room_messages DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE room_messages DROP COLUMN IF EXISTS edited_at;
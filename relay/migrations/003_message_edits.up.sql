@@ -0,0 +1,15 @@
+-- Edit and deletion state for room messages
+-- Deleted messages are kept as tombstones (content cleared) so history stays consistent
+ALTER TABLE room_messages ADD COLUMN edited_at TIMESTAMPTZ;
+ALTER TABLE room_messages ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE room_messages ADD COLUMN deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+-- Previous versions of edited room messages
+CREATE TABLE room_message_edits (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    message_id UUID NOT NULL REFERENCES room_messages(id) ON DELETE CASCADE,
+    editor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    previous_content TEXT NOT NULL,
+    edited_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_message_edits_message ON room_message_edits(message_id, edited_at);
@@ -0,0 +1,9 @@
+-- Emoji reactions on room messages (one row per user per emoji)
+CREATE TABLE message_reactions (
+    message_id UUID NOT NULL REFERENCES room_messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji VARCHAR(32) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
+CREATE INDEX idx_reactions_user ON message_reactions(user_id);
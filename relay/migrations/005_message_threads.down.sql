@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_messages_room_timeline;
+DROP INDEX IF EXISTS idx_messages_thread;
+ALTER TABLE room_messages DROP COLUMN IF EXISTS reply_to;
+ALTER TABLE room_messages DROP COLUMN IF EXISTS thread_id;
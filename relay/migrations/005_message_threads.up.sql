@@ -0,0 +1,6 @@
+-- Threaded replies: thread_id points at the root message of a thread,
+-- reply_to at the specific message being answered (which may itself be a reply)
+ALTER TABLE room_messages ADD COLUMN thread_id UUID REFERENCES room_messages(id) ON DELETE CASCADE;
+ALTER TABLE room_messages ADD COLUMN reply_to UUID REFERENCES room_messages(id) ON DELETE SET NULL;
+CREATE INDEX idx_messages_thread ON room_messages(thread_id, created_at DESC) WHERE thread_id IS NOT NULL;
+CREATE INDEX idx_messages_room_timeline ON room_messages(room_id, created_at DESC) WHERE thread_id IS NULL;
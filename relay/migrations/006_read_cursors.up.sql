@@ -0,0 +1,10 @@
+-- Per-member read position in each room, shared by all of a user's devices
+CREATE TABLE room_read_cursors (
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    last_read_message_id UUID REFERENCES room_messages(id) ON DELETE SET NULL,
+    last_read_at TIMESTAMPTZ NOT NULL, -- created_at of the last read message
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+CREATE INDEX idx_read_cursors_user ON room_read_cursors(user_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_dms_client_msg_id;
+ALTER TABLE direct_messages DROP COLUMN IF EXISTS client_msg_id;
+DROP INDEX IF EXISTS idx_messages_client_msg_id;
+ALTER TABLE room_messages DROP COLUMN IF EXISTS client_msg_id;
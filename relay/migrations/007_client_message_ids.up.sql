@@ -0,0 +1,8 @@
+-- Client-supplied idempotency keys so retried sends don't create duplicates
+ALTER TABLE room_messages ADD COLUMN client_msg_id VARCHAR(64);
+CREATE UNIQUE INDEX idx_messages_client_msg_id ON room_messages(sender_id, client_msg_id)
+    WHERE client_msg_id IS NOT NULL;
+
+ALTER TABLE direct_messages ADD COLUMN client_msg_id VARCHAR(64);
+CREATE UNIQUE INDEX idx_dms_client_msg_id ON direct_messages(sender_id, client_msg_id)
+    WHERE client_msg_id IS NOT NULL;
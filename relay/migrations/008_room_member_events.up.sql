@@ -0,0 +1,11 @@
+-- Log of joins and leaves so reconnecting clients can sync membership changes
+CREATE TABLE room_member_events (
+    id BIGSERIAL PRIMARY KEY,
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username VARCHAR(20) NOT NULL,
+    action VARCHAR(16) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_member_events_room ON room_member_events(room_id, created_at);
+CREATE INDEX idx_member_events_created ON room_member_events(created_at);
@@ -0,0 +1,8 @@
+-- Users @mentioned in room messages
+CREATE TABLE message_mentions (
+    message_id UUID NOT NULL REFERENCES room_messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id)
+);
+CREATE INDEX idx_mentions_user ON message_mentions(user_id, created_at DESC);
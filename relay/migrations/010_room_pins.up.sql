@@ -0,0 +1,10 @@
+-- Messages pinned to the top of a room (exempt from retention cleanup)
+CREATE TABLE room_pins (
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    message_id UUID NOT NULL REFERENCES room_messages(id) ON DELETE CASCADE,
+    pinned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    pinned_by_username VARCHAR(20) NOT NULL,
+    pinned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, message_id)
+);
+CREATE INDEX idx_pins_message ON room_pins(message_id);
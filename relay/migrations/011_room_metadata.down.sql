@@ -0,0 +1,3 @@
+ALTER TABLE rooms DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE rooms DROP COLUMN IF EXISTS description;
+ALTER TABLE rooms DROP COLUMN IF EXISTS topic;
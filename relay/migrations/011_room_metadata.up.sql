@@ -0,0 +1,4 @@
+-- Editable room metadata
+ALTER TABLE rooms ADD COLUMN topic VARCHAR(250) NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE rooms ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
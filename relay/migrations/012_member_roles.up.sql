@@ -0,0 +1,7 @@
+-- Per-room member roles
+ALTER TABLE room_members ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member'
+    CHECK (role IN ('owner', 'admin', 'moderator', 'member'));
+
+-- Existing creators own their rooms
+UPDATE room_members m SET role = 'owner'
+FROM rooms r WHERE r.id = m.room_id AND r.creator_id = m.user_id;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS room_invite_tokens;
+DROP TABLE IF EXISTS room_invites;
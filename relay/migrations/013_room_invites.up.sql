@@ -0,0 +1,23 @@
+-- Pending invitations of users to rooms (removed once the user joins)
+CREATE TABLE room_invites (
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username VARCHAR(20) NOT NULL,
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    invited_by_username VARCHAR(20) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (room_id, user_id)
+);
+
+-- Invite links; max_uses = 0 means unlimited, NULL expires_at means never
+CREATE TABLE room_invite_tokens (
+    token VARCHAR(64) PRIMARY KEY,
+    room_id UUID NOT NULL REFERENCES rooms(id) ON DELETE CASCADE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_by_username VARCHAR(20) NOT NULL,
+    max_uses INTEGER NOT NULL DEFAULT 0 CHECK (max_uses >= 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX idx_invite_tokens_room ON room_invite_tokens(room_id);
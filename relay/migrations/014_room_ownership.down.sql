@@ -0,0 +1,6 @@
+-- Rooms whose creator was deleted can't satisfy NOT NULL again
+DELETE FROM rooms WHERE creator_id IS NULL;
+ALTER TABLE rooms DROP CONSTRAINT rooms_creator_id_fkey;
+ALTER TABLE rooms ALTER COLUMN creator_id SET NOT NULL;
+ALTER TABLE rooms ADD CONSTRAINT rooms_creator_id_fkey
+    FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+-- Deleting a user must not take their rooms with them: ownership lives in
+-- room_members.role, creator_id only records who created the room
+ALTER TABLE rooms DROP CONSTRAINT rooms_creator_id_fkey;
+ALTER TABLE rooms ALTER COLUMN creator_id DROP NOT NULL;
+ALTER TABLE rooms ADD CONSTRAINT rooms_creator_id_fkey
+    FOREIGN KEY (creator_id) REFERENCES users(id) ON DELETE SET NULL;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_messages_search;
+ALTER TABLE room_messages DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,5 @@
+-- Full-text search over room messages
+-- The vector follows the content, so edits are re-indexed and redacted messages drop out
+ALTER TABLE room_messages ADD COLUMN search_vector TSVECTOR
+    GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+CREATE INDEX idx_messages_search ON room_messages USING GIN (search_vector);
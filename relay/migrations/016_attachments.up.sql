@@ -0,0 +1,16 @@
+-- Files uploaded for room messages; the contents live in the blob store under the attachment ID
+-- An attachment is pending until it is linked to a message. References are set to NULL
+-- rather than cascading so the cleanup job can still find the blob to delete.
+CREATE TABLE attachments (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    uploader_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    room_id UUID REFERENCES rooms(id) ON DELETE SET NULL,
+    message_id UUID REFERENCES room_messages(id) ON DELETE SET NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size BIGINT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    linked_at TIMESTAMPTZ
+);
+CREATE INDEX idx_attachments_uploader ON attachments(uploader_id);
+CREATE INDEX idx_attachments_message ON attachments(message_id);
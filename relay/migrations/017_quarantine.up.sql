@@ -0,0 +1,14 @@
+-- Messages held back by the moderation pipeline for review
+-- Exactly one of room_id (room messages) and recipient_id (direct messages) is set
+CREATE TABLE quarantined_messages (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    room_id UUID REFERENCES rooms(id) ON DELETE CASCADE,
+    recipient_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    sender_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    sender_username VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+    reason VARCHAR(50) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK ((room_id IS NULL) <> (recipient_id IS NULL))
+);
+CREATE INDEX idx_quarantined_messages_room ON quarantined_messages(room_id, created_at);
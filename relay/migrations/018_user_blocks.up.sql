@@ -0,0 +1,10 @@
+-- Users a user has blocked: their direct messages are dropped and their room
+-- messages are hidden from the blocker
+CREATE TABLE user_blocks (
+    blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id <> blocked_id)
+);
+CREATE INDEX idx_user_blocks_blocked ON user_blocks(blocked_id);
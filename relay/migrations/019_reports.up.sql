@@ -0,0 +1,38 @@
+-- User reports of room messages, direct messages and users, and their resolutions
+-- message_id has no foreign key and the reported content is copied into snapshot,
+-- so reports outlive the messages they are about
+CREATE TABLE reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    reporter_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    reporter_username VARCHAR(20) NOT NULL,
+    target_type VARCHAR(20) NOT NULL CHECK (target_type IN ('room_message', 'direct_message', 'user')),
+    room_id UUID REFERENCES rooms(id) ON DELETE CASCADE,
+    message_id UUID,
+    reported_user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    reported_username VARCHAR(20) NOT NULL,
+    category VARCHAR(20) NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    snapshot TEXT NOT NULL DEFAULT '',
+    status VARCHAR(10) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    resolved_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    resolved_by_username VARCHAR(20),
+    resolution VARCHAR(10) CHECK (resolution IN ('dismiss', 'delete', 'mute', 'ban')),
+    resolution_note TEXT,
+    resolved_at TIMESTAMPTZ
+);
+CREATE INDEX idx_reports_room_status ON reports(room_id, status, created_at);
+CREATE INDEX idx_reports_status ON reports(status, created_at);
+
+-- Mutes and bans, in one room or server-wide (room_id NULL)
+CREATE TABLE user_sanctions (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    room_id UUID REFERENCES rooms(id) ON DELETE CASCADE,
+    kind VARCHAR(10) NOT NULL CHECK (kind IN ('mute', 'ban')),
+    reason TEXT NOT NULL DEFAULT '',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX idx_user_sanctions_unique
+    ON user_sanctions(user_id, kind, COALESCE(room_id, '00000000-0000-0000-0000-000000000000'::uuid));
@@ -0,0 +1,6 @@
+-- Messages whose sender was deleted can't satisfy NOT NULL again
+DELETE FROM room_messages WHERE sender_id IS NULL;
+ALTER TABLE room_messages DROP CONSTRAINT room_messages_sender_id_fkey;
+ALTER TABLE room_messages ALTER COLUMN sender_id SET NOT NULL;
+ALTER TABLE room_messages ADD CONSTRAINT room_messages_sender_id_fkey
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,7 @@
+-- Deleting a user must not take their messages in shared rooms with them,
+-- nor, through thread_id, the replies of other members to their threads.
+-- sender_username keeps the author's name once sender_id is cleared.
+ALTER TABLE room_messages DROP CONSTRAINT room_messages_sender_id_fkey;
+ALTER TABLE room_messages ALTER COLUMN sender_id DROP NOT NULL;
+ALTER TABLE room_messages ADD CONSTRAINT room_messages_sender_id_fkey
+    FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE SET NULL;
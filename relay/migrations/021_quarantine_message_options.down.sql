@@ -0,0 +1,5 @@
+ALTER TABLE quarantined_messages
+    DROP COLUMN IF EXISTS attachment_ids,
+    DROP COLUMN IF EXISTS client_msg_id,
+    DROP COLUMN IF EXISTS reply_to,
+    DROP COLUMN IF EXISTS thread_id;
@@ -0,0 +1,7 @@
+-- Held room messages keep what they were sent with, so releasing one after
+-- review posts it as it was sent: in its thread, as a reply, with its uploads
+ALTER TABLE quarantined_messages
+    ADD COLUMN thread_id UUID REFERENCES room_messages(id) ON DELETE CASCADE,
+    ADD COLUMN reply_to UUID REFERENCES room_messages(id) ON DELETE SET NULL,
+    ADD COLUMN client_msg_id VARCHAR(64),
+    ADD COLUMN attachment_ids UUID[] NOT NULL DEFAULT '{}';